@@ -0,0 +1,8 @@
+-- Write your migrate up statements here
+alter table "redirects" add column password_hash text not null default '';
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+alter table "redirects" drop column if exists password_hash;
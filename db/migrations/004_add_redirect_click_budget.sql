@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+alter table "redirects" add column max_clicks integer not null default 0;
+alter table "redirects" add column clicks bigint not null default 0;
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+alter table "redirects" drop column if exists clicks;
+alter table "redirects" drop column if exists max_clicks;
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+alter table "redirects" add column title text not null default '';
+alter table "redirects" add column force_preview boolean not null default false;
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+alter table "redirects" drop column if exists force_preview;
+alter table "redirects" drop column if exists title;
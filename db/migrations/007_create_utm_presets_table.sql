@@ -0,0 +1,23 @@
+-- Write your migrate up statements here
+create table "utm_presets" (
+    id text primary key,
+    user_id text not null references "users" (id) on delete cascade,
+    name text not null,
+    source text not null,
+    medium text not null,
+    campaign text not null,
+    term text not null,
+    content text not null,
+    created_at timestamptz not null
+);
+
+alter table "redirects" add column utm_preset_id text references "utm_presets" (id) on delete set null;
+alter table "redirects" add column utm_campaign text not null default '';
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+alter table "redirects" drop column if exists utm_campaign;
+alter table "redirects" drop column if exists utm_preset_id;
+drop table if exists "utm_presets";
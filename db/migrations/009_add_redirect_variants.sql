@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+alter table "redirects" add column targets jsonb not null default '[]';
+
+create table "redirect_variant_clicks" (
+    short text not null references "redirects" (short) on delete cascade,
+    variant integer not null,
+    clicks bigint not null default 0,
+    primary key (short, variant)
+);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop table if exists "redirect_variant_clicks";
+alter table "redirects" drop column if exists targets;
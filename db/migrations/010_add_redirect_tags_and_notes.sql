@@ -0,0 +1,28 @@
+-- Write your migrate up statements here
+alter table "redirects" add column notes text not null default '';
+alter table "redirects" add column tags text[] not null default '{}';
+
+-- array_to_string is only stable, wrapping it allows using the document in an index
+create function redirect_search_document(url text, title text, notes text, tags text[]) returns tsvector
+    language sql immutable as
+$$
+select setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+       setweight(to_tsvector('simple', array_to_string(tags, ' ')), 'A') ||
+       setweight(to_tsvector('simple', coalesce(notes, '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce(url, '')), 'C')
+$$;
+
+create index redirects_search_idx on "redirects" using gin (redirect_search_document(url, title, notes, tags));
+create index redirects_tags_idx on "redirects" using gin (tags);
+create index redirects_user_created_idx on "redirects" (user_id, created_at desc);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop index if exists redirects_user_created_idx;
+drop index if exists redirects_tags_idx;
+drop index if exists redirects_search_idx;
+drop function if exists redirect_search_document(text, text, text, text[]);
+alter table "redirects" drop column if exists tags;
+alter table "redirects" drop column if exists notes;
@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+drop index if exists redirects_user_created_idx;
+create index redirects_user_created_idx on "redirects" (user_id, created_at desc, short desc);
+create index redirects_user_clicks_idx on "redirects" (user_id, clicks desc, short desc);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop index if exists redirects_user_clicks_idx;
+drop index if exists redirects_user_created_idx;
+create index redirects_user_created_idx on "redirects" (user_id, created_at desc);
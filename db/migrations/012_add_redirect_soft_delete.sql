@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+alter table "redirects" add column deleted_at timestamptz;
+
+create index redirects_deleted_idx on "redirects" (deleted_at) where deleted_at is not null;
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop index if exists redirects_deleted_idx;
+delete from "redirects" where deleted_at is not null;
+alter table "redirects" drop column if exists deleted_at;
@@ -0,0 +1,23 @@
+-- Write your migrate up statements here
+create table "audit_events" (
+    id text primary key,
+    actor_id text not null,
+    action text not null,
+    target_type text not null,
+    target_id text not null,
+    before_value jsonb,
+    after_value jsonb,
+    request_id text not null,
+    ip text not null,
+    created_at timestamptz not null
+);
+
+create index audit_events_target_idx on "audit_events" (target_type, target_id, created_at desc);
+create index audit_events_actor_idx on "audit_events" (actor_id, created_at desc);
+create index audit_events_created_at_idx on "audit_events" (created_at desc);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop table if exists "audit_events";
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+alter table "users" add column role text not null default 'user';
+alter table "users" add column disabled boolean not null default false;
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+alter table "users" drop column if exists disabled;
+alter table "users" drop column if exists role;
@@ -0,0 +1,20 @@
+-- Write your migrate up statements here
+create table "sessions" (
+    id text primary key,
+    user_id text references "users" (id) on delete cascade,
+    data bytea not null,
+    user_agent text not null,
+    ip text not null,
+    created_at timestamptz not null,
+    last_seen_at timestamptz not null,
+    expires_at timestamptz not null
+);
+
+create index sessions_user_id_idx on "sessions" (user_id);
+create index sessions_expires_at_idx on "sessions" (expires_at);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop table if exists "sessions";
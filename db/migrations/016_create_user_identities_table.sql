@@ -0,0 +1,30 @@
+-- Write your migrate up statements here
+create table "user_identities" (
+    provider text not null,
+    subject text not null,
+    user_id text not null references "users" (id) on delete cascade,
+    email text not null,
+    created_at timestamptz not null,
+    primary key (provider, subject)
+);
+
+create index user_identities_user_id_idx on "user_identities" (user_id);
+
+insert into "user_identities" (provider, subject, user_id, email, created_at)
+select 'google', google_provider_id, id, email, now()
+from "users";
+
+alter table "users" drop column google_provider_id;
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+alter table "users" add column google_provider_id text unique;
+
+update "users" u
+set google_provider_id = i.subject
+from "user_identities" i
+where i.user_id = u.id and i.provider = 'google';
+
+drop table if exists "user_identities";
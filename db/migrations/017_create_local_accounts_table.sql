@@ -0,0 +1,25 @@
+-- Write your migrate up statements here
+create table "local_accounts" (
+    user_id text primary key references "users" (id) on delete cascade,
+    password_hash text not null,
+    email_verified boolean not null default false,
+    created_at timestamptz not null,
+    updated_at timestamptz not null
+);
+
+create table "account_tokens" (
+    id text primary key,
+    user_id text not null references "users" (id) on delete cascade,
+    purpose text not null,
+    created_at timestamptz not null,
+    expires_at timestamptz not null
+);
+
+create index account_tokens_expires_at_idx on "account_tokens" (expires_at);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop table if exists "account_tokens";
+drop table if exists "local_accounts";
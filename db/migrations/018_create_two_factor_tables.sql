@@ -0,0 +1,22 @@
+-- Write your migrate up statements here
+create table "two_factor" (
+    user_id text primary key references "users" (id) on delete cascade,
+    secret text not null,
+    enabled boolean not null default false,
+    last_counter bigint not null default 0,
+    created_at timestamptz not null
+);
+
+create table "recovery_codes" (
+    user_id text not null references "two_factor" (user_id) on delete cascade,
+    code_hash text not null,
+    created_at timestamptz not null,
+    primary key (user_id, code_hash)
+);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop table if exists "recovery_codes";
+drop table if exists "two_factor";
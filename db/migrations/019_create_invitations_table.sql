@@ -0,0 +1,14 @@
+-- Write your migrate up statements here
+create table "invitations" (
+    id text primary key,
+    email text not null unique,
+    invited_by text not null references "users" (id) on delete cascade,
+    created_at timestamptz not null,
+    expires_at timestamptz not null
+);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop table if exists "invitations";
@@ -0,0 +1,35 @@
+-- Write your migrate up statements here
+create table "webhooks" (
+    id text primary key,
+    user_id text not null references "users" (id) on delete cascade,
+    url text not null,
+    secret text not null,
+    events text[] not null,
+    created_at timestamptz not null
+);
+
+create index webhooks_user_id_idx on "webhooks" (user_id);
+
+create table "webhook_deliveries" (
+    id text primary key,
+    webhook_id text not null references "webhooks" (id) on delete cascade,
+    event text not null,
+    payload jsonb not null,
+    status text not null default 'pending',
+    attempts integer not null default 0,
+    next_attempt_at timestamptz not null,
+    response_status integer not null default 0,
+    error text not null default '',
+    created_at timestamptz not null,
+    delivered_at timestamptz
+);
+
+create index webhook_deliveries_pending_idx on "webhook_deliveries" (next_attempt_at) where status = 'pending';
+create index webhook_deliveries_webhook_idx on "webhook_deliveries" (webhook_id, created_at desc);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop table if exists "webhook_deliveries";
+drop table if exists "webhooks";
@@ -0,0 +1,38 @@
+-- Write your migrate up statements here
+alter table "redirect_variant_clicks" drop constraint redirect_variant_clicks_short_fkey;
+alter table "redirect_variant_clicks" drop constraint redirect_variant_clicks_pkey;
+
+alter table "redirects" add column domain text not null default '';
+alter table "redirects" drop constraint redirects_pkey;
+alter table "redirects" add primary key (domain, short);
+
+alter table "redirect_variant_clicks" add column domain text not null default '';
+alter table "redirect_variant_clicks" add primary key (domain, short, variant);
+alter table "redirect_variant_clicks" add foreign key (domain, short) references "redirects" (domain, short) on delete cascade;
+
+drop index if exists redirects_user_created_idx;
+drop index if exists redirects_user_clicks_idx;
+create index redirects_user_created_idx on "redirects" (user_id, created_at desc, short desc, domain desc);
+create index redirects_user_clicks_idx on "redirects" (user_id, clicks desc, short desc, domain desc);
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+delete from "redirects" where domain <> '';
+
+drop index if exists redirects_user_clicks_idx;
+drop index if exists redirects_user_created_idx;
+create index redirects_user_created_idx on "redirects" (user_id, created_at desc, short desc);
+create index redirects_user_clicks_idx on "redirects" (user_id, clicks desc, short desc);
+
+alter table "redirect_variant_clicks" drop constraint redirect_variant_clicks_domain_short_fkey;
+alter table "redirect_variant_clicks" drop constraint redirect_variant_clicks_pkey;
+alter table "redirect_variant_clicks" drop column if exists domain;
+
+alter table "redirects" drop constraint redirects_pkey;
+alter table "redirects" drop column if exists domain;
+alter table "redirects" add primary key (short);
+
+alter table "redirect_variant_clicks" add primary key (short, variant);
+alter table "redirect_variant_clicks" add foreign key (short) references "redirects" (short) on delete cascade;
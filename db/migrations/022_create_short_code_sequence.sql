@@ -0,0 +1,8 @@
+-- Write your migrate up statements here
+create sequence "short_code_seq" as bigint minvalue 0 start with 0;
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+drop sequence if exists "short_code_seq";
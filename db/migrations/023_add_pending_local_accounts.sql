@@ -0,0 +1,33 @@
+-- Write your migrate up statements here
+alter table "local_accounts" add column email text;
+update "local_accounts" set email = "users".email from "users" where "users".id = "local_accounts".user_id;
+alter table "local_accounts" alter column email set not null;
+
+-- registrations have no user until their email is verified
+alter table "local_accounts" drop constraint local_accounts_pkey;
+alter table "local_accounts" alter column user_id drop not null;
+alter table "local_accounts" add primary key (email);
+alter table "local_accounts" add unique (user_id);
+
+alter table "account_tokens" add column email text references "local_accounts" (email) on delete cascade;
+update "account_tokens" set email = "local_accounts".email from "local_accounts" where "local_accounts".user_id = "account_tokens".user_id;
+delete from "account_tokens" where email is null;
+alter table "account_tokens" alter column email set not null;
+alter table "account_tokens" drop column user_id;
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
+alter table "account_tokens" add column user_id text references "users" (id) on delete cascade;
+update "account_tokens" set user_id = "local_accounts".user_id from "local_accounts" where "local_accounts".email = "account_tokens".email;
+delete from "account_tokens" where user_id is null;
+alter table "account_tokens" alter column user_id set not null;
+alter table "account_tokens" drop column if exists email;
+
+delete from "local_accounts" where user_id is null;
+alter table "local_accounts" drop constraint local_accounts_user_id_key;
+alter table "local_accounts" drop constraint local_accounts_pkey;
+alter table "local_accounts" alter column user_id set not null;
+alter table "local_accounts" add primary key (user_id);
+alter table "local_accounts" drop column if exists email;
@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+-- emails are looked up lower-cased; addresses that would clash with another user keep their case
+update "users" set email = lower(trim(email))
+where email <> lower(trim(email))
+  and not exists (select 1 from "users" as other where other.email = lower(trim("users".email)));
+
+---- create above / drop below ----
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
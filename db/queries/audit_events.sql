@@ -0,0 +1,22 @@
+-- name: AnonymizeAuditEvents :exec
+UPDATE audit_events
+SET ip           = CASE WHEN actor_id = sqlc.arg(user_id)::text THEN '' ELSE ip END,
+    before_value = CASE WHEN target_type = 'user' and target_id = sqlc.arg(user_id)::text THEN null ELSE before_value END,
+    after_value  = CASE WHEN target_type = 'user' and target_id = sqlc.arg(user_id)::text THEN null ELSE after_value END
+WHERE actor_id = sqlc.arg(user_id)::text
+   or (target_type = 'user' and target_id = sqlc.arg(user_id)::text);
+
+-- name: ListAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE (sqlc.arg(actor_id)::text = '' or actor_id = sqlc.arg(actor_id)::text)
+  and (sqlc.arg(action)::text = '' or action = sqlc.arg(action)::text)
+  and (sqlc.arg(target_type)::text = '' or target_type = sqlc.arg(target_type)::text)
+  and (sqlc.arg(target_id)::text = '' or target_id = sqlc.arg(target_id)::text)
+  and created_at < sqlc.arg(created_before)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: SaveAuditEvent :exec
+INSERT INTO audit_events (id, actor_id, action, target_type, target_id, before_value, after_value, request_id, ip, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
@@ -0,0 +1,18 @@
+-- name: ListInvitations :many
+select * from invitations where expires_at > now() order by created_at desc;
+
+-- name: SaveInvitation :exec
+insert into invitations (id, email, invited_by, created_at, expires_at)
+values ($1, $2, $3, $4, $5)
+on conflict (email) do update set id         = excluded.id,
+                                  invited_by = excluded.invited_by,
+                                  created_at = excluded.created_at,
+                                  expires_at = excluded.expires_at;
+
+-- name: ConsumeInvitation :one
+delete from invitations
+where email = $1 and expires_at > now()
+returning *;
+
+-- name: DeleteInvitation :execrows
+delete from invitations where id = $1;
@@ -0,0 +1,25 @@
+-- name: GetLocalAccount :one
+select * from local_accounts where email = $1;
+
+-- name: SaveLocalAccount :exec
+insert into local_accounts (email, user_id, password_hash, email_verified, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6)
+on conflict (email) do update set user_id        = excluded.user_id,
+                                  password_hash  = excluded.password_hash,
+                                  email_verified = excluded.email_verified,
+                                  updated_at     = excluded.updated_at;
+
+-- name: DeleteLocalAccount :exec
+delete from local_accounts where email = $1;
+
+-- name: SaveAccountToken :exec
+insert into account_tokens (id, email, purpose, created_at, expires_at)
+values ($1, $2, $3, $4, $5);
+
+-- name: ConsumeAccountToken :one
+delete from account_tokens
+where id = $1 and purpose = $2 and expires_at > now()
+returning *;
+
+-- name: DeleteExpiredAccountTokens :execrows
+delete from account_tokens where expires_at <= now();
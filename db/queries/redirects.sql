@@ -1,24 +1,149 @@
--- name: ListRedirectsByUserId :many
+-- name: ListRedirectsByCreatedAt :many
 SELECT *
 FROM redirects
-WHERE user_id = $1;
+WHERE user_id = sqlc.arg(user_id) and deleted_at is null
+  and (sqlc.arg(query)::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', sqlc.arg(query)::text))
+  and (sqlc.arg(tag)::text = '' or sqlc.arg(tag)::text = any(tags))
+  and created_at >= sqlc.arg(created_from) and created_at < sqlc.arg(created_until)
+  and (created_at, short, domain) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_short)::text, sqlc.arg(cursor_domain)::text)
+ORDER BY created_at DESC, short DESC, domain DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListRedirectsByShort :many
+SELECT *
+FROM redirects
+WHERE user_id = sqlc.arg(user_id) and deleted_at is null
+  and (sqlc.arg(query)::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', sqlc.arg(query)::text))
+  and (sqlc.arg(tag)::text = '' or sqlc.arg(tag)::text = any(tags))
+  and created_at >= sqlc.arg(created_from) and created_at < sqlc.arg(created_until)
+  and (short, domain) > (sqlc.arg(cursor_short)::text, sqlc.arg(cursor_domain)::text)
+ORDER BY short, domain
+LIMIT sqlc.arg(page_size);
+
+-- name: ListRedirectsByClicks :many
+SELECT *
+FROM redirects
+WHERE user_id = sqlc.arg(user_id) and deleted_at is null
+  and (sqlc.arg(query)::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', sqlc.arg(query)::text))
+  and (sqlc.arg(tag)::text = '' or sqlc.arg(tag)::text = any(tags))
+  and created_at >= sqlc.arg(created_from) and created_at < sqlc.arg(created_until)
+  and (clicks, short, domain) < (sqlc.arg(cursor_clicks)::bigint, sqlc.arg(cursor_short)::text, sqlc.arg(cursor_domain)::text)
+ORDER BY clicks DESC, short DESC, domain DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListAllRedirects :many
+SELECT *
+FROM redirects
+WHERE (sqlc.arg(user_id)::text = '' or user_id = sqlc.arg(user_id)::text) and deleted_at is null
+  and (sqlc.arg(query)::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', sqlc.arg(query)::text))
+  and (created_at, short, domain) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_short)::text, sqlc.arg(cursor_domain)::text)
+ORDER BY created_at DESC, short DESC, domain DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListTagsByUserId :many
+SELECT DISTINCT unnest(tags)::text AS tag
+FROM redirects
+WHERE user_id = $1 and deleted_at is null
+ORDER BY tag;
+
+-- name: ListCampaignsByUserId :many
+SELECT utm_campaign, count(*) AS links, sum(clicks)::bigint AS clicks
+FROM redirects
+WHERE user_id = $1 and utm_campaign <> '' and deleted_at is null
+GROUP BY utm_campaign
+ORDER BY utm_campaign;
 
 -- name: GetRedirectByShort :one
 SELECT *
 FROM redirects
-WHERE short = $1 and user_id = $2;
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is null;
 
--- name: SaveRedirect :exec
-INSERT INTO redirects (short, url, user_id, created_at)
-VALUES ($1, $2, $3, $4)
-ON CONFLICT (short) DO NOTHING
-RETURNING *;
+-- name: GetRedirect :one
+SELECT *
+FROM redirects
+WHERE domain = $1 and short = $2 and deleted_at is null;
+
+-- name: SaveRedirect :execrows
+INSERT INTO redirects (domain, short, url, user_id, created_at, password_hash, max_clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, notes, tags)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (domain, short) DO NOTHING;
+
+-- name: ImportRedirect :execrows
+INSERT INTO redirects (short, url, user_id, created_at, title, notes, tags, clicks)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (domain, short) DO NOTHING;
 
 -- name: ExpandRedirect :one
-SELECT url
+UPDATE redirects
+SET clicks = clicks + 1
+WHERE domain = $1 and short = $2 and deleted_at is null and (max_clicks = 0 or clicks < max_clicks)
+RETURNING *;
+
+-- name: UpdateRedirectDetails :exec
+UPDATE redirects
+SET title = $4, notes = $5, tags = $6
+WHERE domain = $1 and short = $2 and user_id = $3;
+
+-- name: UpdateRedirectRules :exec
+UPDATE redirects
+SET rules = $4
+WHERE domain = $1 and short = $2 and user_id = $3;
+
+-- name: UpdateRedirectTargets :exec
+UPDATE redirects
+SET targets = $4
+WHERE domain = $1 and short = $2 and user_id = $3;
+
+-- name: ResetVariantClicks :exec
+DELETE FROM redirect_variant_clicks
+WHERE domain = $1 and short = $2;
+
+-- name: CountVariantClick :exec
+INSERT INTO redirect_variant_clicks (domain, short, variant, clicks)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (domain, short, variant) DO UPDATE SET clicks = redirect_variant_clicks.clicks + 1;
+
+-- name: ListVariantClicks :many
+SELECT variant, clicks
+FROM redirect_variant_clicks
+WHERE domain = $1 and short = $2
+ORDER BY variant;
+
+-- name: TrashRedirect :execrows
+UPDATE redirects
+SET deleted_at = now()
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is null;
+
+-- name: ListTrashedRedirectsByUserId :many
+SELECT *
 FROM redirects
-WHERE short = $1;
+WHERE user_id = $1 and deleted_at is not null
+ORDER BY deleted_at DESC;
+
+-- name: RestoreRedirect :execrows
+UPDATE redirects
+SET deleted_at = null
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is not null;
+
+-- name: PurgeRedirect :execrows
+DELETE FROM redirects
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is not null;
+
+-- name: PurgeTrashedRedirects :execrows
+DELETE FROM redirects
+WHERE deleted_at < $1;
+
+-- name: TransferAllRedirects :many
+UPDATE redirects
+SET user_id = sqlc.arg(to_user_id)
+WHERE user_id = sqlc.arg(from_user_id) and deleted_at is null
+RETURNING domain, short;
+
+-- name: TransferRedirect :execrows
+UPDATE redirects
+SET user_id = $3
+WHERE domain = $1 and short = $2 and deleted_at is null;
 
--- name: DeleteRedirect :exec
+-- name: RemoveRedirect :execrows
 DELETE FROM redirects
-WHERE short = $1 and user_id = $2;
+WHERE domain = $1 and short = $2;
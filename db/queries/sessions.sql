@@ -0,0 +1,37 @@
+-- name: GetSession :one
+SELECT *
+FROM sessions
+WHERE id = $1 and expires_at > now();
+
+-- name: ListSessionsByUserId :many
+SELECT *
+FROM sessions
+WHERE user_id = $1 and expires_at > now()
+ORDER BY last_seen_at DESC;
+
+-- name: SaveSession :exec
+INSERT INTO sessions (id, user_id, data, user_agent, ip, created_at, last_seen_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, data = excluded.data, user_agent = excluded.user_agent,
+                               ip = excluded.ip, last_seen_at = excluded.last_seen_at, expires_at = excluded.expires_at;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = $2, ip = $3
+WHERE id = $1;
+
+-- name: DeleteSession :exec
+DELETE FROM sessions
+WHERE id = $1;
+
+-- name: DeleteUserSession :execrows
+DELETE FROM sessions
+WHERE id = $1 and user_id = $2;
+
+-- name: DeleteSessionsByUserId :execrows
+DELETE FROM sessions
+WHERE user_id = $1;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM sessions
+WHERE expires_at <= now();
@@ -0,0 +1,2 @@
+-- name: NextShortCode :one
+SELECT nextval('short_code_seq')::bigint;
@@ -0,0 +1,31 @@
+-- name: GetTwoFactor :one
+select * from two_factor where user_id = $1;
+
+-- name: SaveTwoFactor :exec
+insert into two_factor (user_id, secret, created_at)
+values ($1, $2, $3)
+on conflict (user_id) do update set secret     = excluded.secret,
+                                    created_at = excluded.created_at
+where not two_factor.enabled;
+
+-- name: EnableTwoFactor :execrows
+update two_factor set enabled = true, last_counter = $2 where user_id = $1 and not enabled;
+
+-- name: UseTwoFactorCounter :execrows
+update two_factor set last_counter = $2 where user_id = $1 and enabled and last_counter < $2;
+
+-- name: DeleteTwoFactor :exec
+delete from two_factor where user_id = $1;
+
+-- name: SaveRecoveryCode :exec
+insert into recovery_codes (user_id, code_hash, created_at)
+values ($1, $2, $3);
+
+-- name: DeleteRecoveryCodes :exec
+delete from recovery_codes where user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+delete from recovery_codes where user_id = $1 and code_hash = $2;
+
+-- name: CountRecoveryCodes :one
+select count(*) from recovery_codes where user_id = $1;
@@ -0,0 +1,12 @@
+-- name: GetUserIdentity :one
+select * from user_identities where provider = $1 and subject = $2;
+
+-- name: ListUserIdentitiesByUserId :many
+select * from user_identities where user_id = $1 order by created_at;
+
+-- name: SaveUserIdentity :exec
+insert into user_identities (provider, subject, user_id, email, created_at)
+values ($1, $2, $3, $4, $5);
+
+-- name: DeleteUserIdentity :execrows
+delete from user_identities where provider = $1 and subject = $2 and user_id = $3;
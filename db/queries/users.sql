@@ -1,7 +1,26 @@
--- name: GetUserByGoogleId :one
-select * from users where google_provider_id = $1;
+-- name: DeleteUser :execrows
+delete from users where id = $1;
+
+-- name: GetUser :one
+select * from users where id = $1;
+
+-- name: GetUserByEmail :one
+select * from users where email = $1;
+
+-- name: ListUsers :many
+select *
+from users
+where sqlc.arg(query)::text = '' or id = sqlc.arg(query)::text or email ilike '%' || sqlc.arg(query)::text || '%'
+order by email
+limit sqlc.arg(page_size);
 
 -- name: SaveUser :exec
-INSERT INTO users (id, email, google_provider_id)
-VALUES ($1, $2, $3)
-ON CONFLICT (id) DO UPDATE SET email = excluded.email, google_provider_id = excluded.google_provider_id;
+INSERT INTO users (id, email)
+VALUES ($1, $2)
+ON CONFLICT (id) DO UPDATE SET email = excluded.email;
+
+-- name: UpdateUserDisabled :execrows
+update users set disabled = $2 where id = $1;
+
+-- name: UpdateUserRole :execrows
+update users set role = $2 where id = $1;
@@ -0,0 +1,18 @@
+-- name: ListUTMPresetsByUserId :many
+SELECT *
+FROM utm_presets
+WHERE user_id = $1
+ORDER BY name;
+
+-- name: GetUTMPreset :one
+SELECT *
+FROM utm_presets
+WHERE id = $1 and user_id = $2;
+
+-- name: SaveUTMPreset :exec
+INSERT INTO utm_presets (id, user_id, name, source, medium, campaign, term, content, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: DeleteUTMPreset :exec
+DELETE FROM utm_presets
+WHERE id = $1 and user_id = $2;
@@ -0,0 +1,48 @@
+-- name: ListWebhooks :many
+select * from webhooks where user_id = $1 order by created_at;
+
+-- name: ListSubscribedWebhooks :many
+select * from webhooks where user_id = sqlc.arg(user_id) and sqlc.arg(event)::text = any(events);
+
+-- name: GetWebhook :one
+select * from webhooks where id = $1 and user_id = $2;
+
+-- name: FindWebhook :one
+select * from webhooks where id = $1;
+
+-- name: SaveWebhook :exec
+insert into webhooks (id, user_id, url, secret, events, created_at)
+values ($1, $2, $3, $4, $5, $6);
+
+-- name: DeleteWebhook :execrows
+delete from webhooks where id = $1 and user_id = $2;
+
+-- name: SaveWebhookDelivery :exec
+insert into webhook_deliveries (id, webhook_id, event, payload, next_attempt_at, created_at)
+values ($1, $2, $3, $4, $5, $6);
+
+-- name: ClaimWebhookDeliveries :many
+update webhook_deliveries
+set next_attempt_at = sqlc.arg(lease_until)
+where id in (select id
+             from webhook_deliveries
+             where status = 'pending' and next_attempt_at <= sqlc.arg(now)
+             order by next_attempt_at
+             limit sqlc.arg(batch_size) for update skip locked)
+returning *;
+
+-- name: UpdateWebhookDelivery :exec
+update webhook_deliveries
+set status          = $2,
+    attempts        = $3,
+    next_attempt_at = $4,
+    response_status = $5,
+    error           = $6,
+    delivered_at    = $7
+where id = $1;
+
+-- name: ListWebhookDeliveries :many
+select * from webhook_deliveries where webhook_id = $1 order by created_at desc limit $2;
+
+-- name: DeleteWebhookDeliveriesBefore :execrows
+delete from webhook_deliveries where status <> 'pending' and created_at < $1;
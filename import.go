@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
+	"github.com/pscheid92/dwarferl/internal/config"
+	"github.com/pscheid92/dwarferl/internal/importer"
+	"github.com/pscheid92/dwarferl/internal/repository"
+	"github.com/pscheid92/dwarferl/internal/shortener"
+	"github.com/pscheid92/dwarferl/internal/webhooks"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// runImport implements the "import" subcommand, e.g. dwarferl import -user <id> -file links.csv
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	userID := flags.String("user", "", "id of the user owning the imported links")
+	path := flags.String("file", "", "csv file exported from dwarferl, YOURLS or Bitly")
+	verbose := flags.Bool("v", false, "print every row instead of only the problems")
+	_ = flags.Parse(args)
+
+	if *userID == "" || *path == "" {
+		flags.Usage()
+		return errors.New("user and file are required")
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	records, err := importer.Parse(file)
+	if err != nil {
+		return err
+	}
+
+	conf, err := config.GatherConfig()
+	if err != nil {
+		return err
+	}
+
+	pool, err := openPGConnectionPool()
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	auditService := audit.NewService(repository.NewDBAuditEventsRepository(pool))
+	redirectsRepository := repository.NewDBRedirectsRepository(pool)
+	// imported links are announced to webhooks, which the server delivers from the outbox
+	webhookService := webhooks.NewService(repository.NewDBWebhooksRepository(pool), auditService)
+	urlShortener := shortener.NewUrlShortenerService(newHasher(conf, pool), redirectsRepository, auditService, webhookService, nil)
+
+	// the owner is recorded as the one who imported the links
+	ctx := audit.WithActor(context.Background(), *userID)
+	report, err := urlShortener.Import(ctx, *userID, records)
+	printReport(os.Stdout, report, *verbose)
+	if err != nil {
+		return fmt.Errorf("import stopped early, run it again to continue: %w", err)
+	}
+	return nil
+}
+
+func printReport(w io.Writer, report internal.ImportReport, verbose bool) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range report.Results {
+		if verbose || r.Status == internal.ImportConflict || r.Status == internal.ImportInvalid {
+			_, _ = fmt.Fprintf(table, "line %d\t%s\t%s\t%s\t%s\n", r.Line, r.Short, r.Status, r.Message, r.URL)
+		}
+	}
+	_ = table.Flush()
+
+	_, _ = fmt.Fprintf(w, "%d created, %d existing, %d conflicts, %d invalid\n", report.Created, report.Existing, report.Conflicts, report.Invalid)
+}
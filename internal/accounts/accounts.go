@@ -0,0 +1,344 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	minPasswordLength = 10
+	maxPasswordLength = 256
+
+	tokenLength         = 32
+	verifyTokenLifetime = 48 * time.Hour
+	resetTokenLifetime  = time.Hour
+)
+
+// Service manages local accounts, which sign in with email and password. They are linked to
+// their user like external logins, as an identity of the local provider.
+type Service struct {
+	users    internal.UsersService
+	accounts internal.LocalAccountRepository
+	tokens   internal.AccountTokenRepository
+	sessions internal.SessionService
+	audit    internal.AuditService
+	mailer   internal.Mailer
+
+	linkBase            string
+	requireVerification bool
+}
+
+// NewService creates the accounts service. Links in emails start with linkBase, the public URL
+// of the web interface including the forwarded prefix.
+func NewService(users internal.UsersService, accounts internal.LocalAccountRepository, tokens internal.AccountTokenRepository, sessions internal.SessionService, audit internal.AuditService, mailer internal.Mailer, linkBase string, requireVerification bool) *Service {
+	return &Service{
+		users:               users,
+		accounts:            accounts,
+		tokens:              tokens,
+		sessions:            sessions,
+		audit:               audit,
+		mailer:              mailer,
+		linkBase:            linkBase,
+		requireVerification: requireVerification,
+	}
+}
+
+// Register creates a local account. With verification, the user is only created once the
+// email is confirmed, so unverified registrations neither claim the email nor use up an
+// invitation; until then the returned user is empty. Registering again replaces such a
+// registration along with the links sent for it.
+func (s *Service) Register(ctx context.Context, email string, password string) (internal.User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return internal.User{}, err
+	}
+
+	if err := checkPassword(password); err != nil {
+		return internal.User{}, err
+	}
+
+	_, err = s.users.GetByEmail(ctx, email)
+	if err == nil {
+		return internal.User{}, internal.ErrEmailInUse
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return internal.User{}, err
+	}
+
+	existing, err := s.accounts.Get(ctx, email)
+	switch {
+	case err == nil && existing.UserID != "":
+		return internal.User{}, internal.ErrEmailInUse
+	case err == nil:
+		if err := s.accounts.Delete(ctx, email); err != nil {
+			return internal.User{}, err
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		return internal.User{}, err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return internal.User{}, err
+	}
+
+	now := time.Now()
+	account := internal.LocalAccount{
+		Email:         email,
+		PasswordHash:  hash,
+		EmailVerified: !s.requireVerification,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.accounts.Save(ctx, account); err != nil {
+		return internal.User{}, err
+	}
+
+	if !s.requireVerification {
+		return s.activate(ctx, account)
+	}
+	return internal.User{}, s.sendVerification(ctx, email)
+}
+
+// Login checks the password. Unknown emails and wrong passwords are indistinguishable.
+func (s *Service) Login(ctx context.Context, email string, password string) (internal.User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return internal.User{}, internal.ErrWrongPassword
+	}
+
+	account, err := s.accounts.Get(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		wasteTime(password)
+		return internal.User{}, internal.ErrWrongPassword
+	}
+	if err != nil {
+		return internal.User{}, err
+	}
+
+	ok, err := verifyPassword(account.PasswordHash, password)
+	if err != nil {
+		return internal.User{}, err
+	}
+	if !ok {
+		return internal.User{}, internal.ErrWrongPassword
+	}
+
+	if s.requireVerification && !account.EmailVerified {
+		return internal.User{}, internal.ErrEmailUnverified
+	}
+
+	// signing in like any other login checks for disabled users and promotes administrators;
+	// a taken email means the password login was disconnected on the profile page
+	var user internal.User
+	if account.UserID == "" {
+		user, err = s.activate(ctx, account)
+	} else {
+		user, err = s.users.SignIn(ctx, localIdentity(email))
+	}
+	if errors.Is(err, internal.ErrEmailInUse) {
+		return internal.User{}, internal.ErrWrongPassword
+	}
+	return user, err
+}
+
+// ResendVerification sends another verification email. It stays silent about unknown emails.
+func (s *Service) ResendVerification(ctx context.Context, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	account, err := s.accounts.Get(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && account.EmailVerified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.sendVerification(ctx, email)
+}
+
+// VerifyEmail confirms the email of an account and creates its user, who is admitted and
+// promoted like any other sign-up.
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	account, err := s.consume(ctx, token, internal.TokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	if account.UserID == "" {
+		_, err := s.activate(ctx, account)
+		return err
+	}
+
+	account.EmailVerified = true
+	account.UpdatedAt = time.Now()
+	return s.accounts.Save(ctx, account)
+}
+
+// RequestPasswordReset emails a reset link. It stays silent about unknown emails.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	_, err = s.accounts.Get(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, email, internal.TokenResetPassword, resetTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Someone asked to reset the password of your dwarferl account. If that was you, choose a new password here:\n\n%sreset?token=%s\n\nThe link expires in one hour. If you did not ask for it, you can ignore this email.", s.linkBase, token)
+	return s.mailer.Send(ctx, email, "Reset your dwarferl password", body)
+}
+
+// ResetPassword sets a new password and signs the user out everywhere. Receiving the
+// link proves the email, so it counts as verified afterwards and a pending registration
+// gets its user.
+func (s *Service) ResetPassword(ctx context.Context, token string, password string) error {
+	if err := checkPassword(password); err != nil {
+		return err
+	}
+
+	account, err := s.consume(ctx, token, internal.TokenResetPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	account.PasswordHash = hash
+	if account.UserID == "" {
+		_, err := s.activate(ctx, account)
+		return err
+	}
+
+	account.EmailVerified = true
+	account.UpdatedAt = time.Now()
+	if err := s.accounts.Save(ctx, account); err != nil {
+		return err
+	}
+
+	if _, err := s.sessions.RevokeAll(ctx, account.UserID); err != nil {
+		return err
+	}
+
+	ctx = audit.WithActor(ctx, account.UserID)
+	return s.audit.Record(ctx, internal.AuditUserPassword, internal.AuditTargetUser, account.UserID, nil, nil)
+}
+
+func (s *Service) DeleteExpiredTokens(ctx context.Context) (int, error) {
+	return s.tokens.DeleteExpired(ctx)
+}
+
+// activate creates the user of an account whose email is verified.
+func (s *Service) activate(ctx context.Context, account internal.LocalAccount) (internal.User, error) {
+	user, err := s.users.SignIn(ctx, localIdentity(account.Email))
+	if err != nil {
+		return internal.User{}, err
+	}
+
+	account.UserID = user.ID
+	account.EmailVerified = true
+	account.UpdatedAt = time.Now()
+	if err := s.accounts.Save(ctx, account); err != nil {
+		return internal.User{}, err
+	}
+	return user, nil
+}
+
+func (s *Service) sendVerification(ctx context.Context, email string) error {
+	token, err := s.issueToken(ctx, email, internal.TokenVerifyEmail, verifyTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Welcome to dwarferl! Please confirm your email address by opening this link:\n\n%sverify?token=%s\n\nThe link expires in two days.", s.linkBase, token)
+	return s.mailer.Send(ctx, email, "Confirm your email for dwarferl", body)
+}
+
+func (s *Service) issueToken(ctx context.Context, email string, purpose internal.TokenPurpose, lifetime time.Duration) (string, error) {
+	raw := make([]byte, tokenLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	stored := internal.AccountToken{
+		ID:        hashToken(token),
+		Email:     email,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	}
+	if err := s.tokens.Save(ctx, stored); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *Service) consume(ctx context.Context, token string, purpose internal.TokenPurpose) (internal.LocalAccount, error) {
+	stored, err := s.tokens.Consume(ctx, hashToken(token), purpose)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return internal.LocalAccount{}, internal.ErrInvalidToken
+	}
+	if err != nil {
+		return internal.LocalAccount{}, err
+	}
+	return s.accounts.Get(ctx, stored.Email)
+}
+
+// localIdentity counts as verified, since accounts only sign in once the email is confirmed
+// or the instance does not ask for confirmation.
+func localIdentity(email string) internal.Identity {
+	return internal.Identity{Provider: internal.ProviderLocal, Subject: email, Email: email, EmailVerified: true}
+}
+
+// normalizeEmail accepts bare addresses only and lower-cases them, so they compare equal.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", internal.ErrEmailInvalid
+	}
+	return strings.ToLower(email), nil
+}
+
+// checkPassword limits the length in both directions, long passwords make hashing expensive.
+func checkPassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return internal.ErrWeakPassword
+	}
+	return nil
+}
+
+// hashToken derives the stored ID, so a leaked table cannot be used to verify or reset.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
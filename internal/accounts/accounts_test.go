@@ -0,0 +1,377 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/mailer"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const (
+	testEmail    = "user@example.com"
+	testPassword = "correct horse battery staple"
+	testLinkBase = "https://dwarf.example.com/"
+)
+
+var tokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestService_Register(t *testing.T) {
+	sut, fakes := setupService(true)
+
+	_, err := sut.Register(context.Background(), " User@Example.com ", "an abandoned password")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	// registering again replaces the unverified registration
+	_, err = sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, fakes.tokens.tokens, 1, "Expected only the new verification token, got %d", len(fakes.tokens.tokens))
+
+	account, ok := fakes.accounts.accounts[testEmail]
+	assert.Truef(t, ok, "Expected account with normalized email, got %v", fakes.accounts.accounts)
+	assert.Falsef(t, account.EmailVerified, "Expected email to be unverified")
+	assert.Emptyf(t, account.UserID, "Expected no user before verification, got %v", account.UserID)
+	assert.Emptyf(t, fakes.users.users, "Expected no user before verification, got %v", fakes.users.users)
+
+	messages := fakes.mailer.Messages()
+	assert.Lenf(t, messages, 2, "Expected verification emails, got %d messages", len(messages))
+	assert.Containsf(t, messages[1].Body, testLinkBase+"verify?token=", "Expected verification link, got %v", messages[1].Body)
+
+	err = sut.VerifyEmail(context.Background(), lastToken(t, fakes.mailer))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	user, err := fakes.users.GetByEmail(context.Background(), testEmail)
+	assert.NoErrorf(t, err, "Expected user after verification, got %v", err)
+	assert.Equalf(t, user.ID, fakes.accounts.accounts[testEmail].UserID, "Expected account to belong to the user, got %v", fakes.accounts.accounts[testEmail].UserID)
+
+	_, err = sut.Register(context.Background(), testEmail, testPassword)
+	assert.ErrorIsf(t, err, internal.ErrEmailInUse, "Expected %v, got %v", internal.ErrEmailInUse, err)
+
+	_, err = sut.Register(context.Background(), "Someone <someone@example.com>", testPassword)
+	assert.ErrorIsf(t, err, internal.ErrEmailInvalid, "Expected %v, got %v", internal.ErrEmailInvalid, err)
+
+	_, err = sut.Register(context.Background(), "someone@example.com", "short")
+	assert.ErrorIsf(t, err, internal.ErrWeakPassword, "Expected %v, got %v", internal.ErrWeakPassword, err)
+}
+
+func TestService_Register_Admin(t *testing.T) {
+	sut, fakes := setupService(true)
+	fakes.users.admins = map[string]bool{testEmail: true}
+
+	_, err := sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	_, err = fakes.users.GetByEmail(context.Background(), testEmail)
+	assert.ErrorIsf(t, err, pgx.ErrNoRows, "Expected no user for an unverified admin email, got %v", err)
+
+	_, err = sut.Login(context.Background(), testEmail, testPassword)
+	assert.ErrorIsf(t, err, internal.ErrEmailUnverified, "Expected %v, got %v", internal.ErrEmailUnverified, err)
+
+	err = sut.VerifyEmail(context.Background(), lastToken(t, fakes.mailer))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	user, err := sut.Login(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, user.IsAdmin(), "Expected admin after verification, got role %v", user.Role)
+}
+
+func TestService_Login(t *testing.T) {
+	sut, fakes := setupService(true)
+
+	_, err := sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	_, err = sut.Login(context.Background(), testEmail, testPassword)
+	assert.ErrorIsf(t, err, internal.ErrEmailUnverified, "Expected %v, got %v", internal.ErrEmailUnverified, err)
+
+	err = sut.VerifyEmail(context.Background(), lastToken(t, fakes.mailer))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	loggedIn, err := sut.Login(context.Background(), "USER@example.com", testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, fakes.accounts.accounts[testEmail].UserID, loggedIn.ID, "Expected user of the account, got %v", loggedIn.ID)
+
+	_, err = sut.Login(context.Background(), testEmail, "wrong password")
+	assert.ErrorIsf(t, err, internal.ErrWrongPassword, "Expected %v, got %v", internal.ErrWrongPassword, err)
+
+	_, err = sut.Login(context.Background(), "unknown@example.com", testPassword)
+	assert.ErrorIsf(t, err, internal.ErrWrongPassword, "Expected %v, got %v", internal.ErrWrongPassword, err)
+}
+
+func TestService_WithoutVerification(t *testing.T) {
+	sut, fakes := setupService(false)
+
+	user, err := sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.NotEmptyf(t, user.ID, "Expected user right away, got %v", user)
+	assert.Emptyf(t, fakes.mailer.Messages(), "Expected no verification email")
+
+	_, err = sut.Login(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+}
+
+func TestService_VerifyEmail(t *testing.T) {
+	sut, fakes := setupService(true)
+
+	_, err := sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.ResendVerification(context.Background(), testEmail)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	token := lastToken(t, fakes.mailer)
+
+	err = sut.VerifyEmail(context.Background(), token)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.VerifyEmail(context.Background(), token)
+	assert.ErrorIsf(t, err, internal.ErrInvalidToken, "Expected token to work only once, got %v", err)
+
+	err = sut.ResendVerification(context.Background(), "unknown@example.com")
+	assert.NoErrorf(t, err, "Expected unknown emails to pass silently, got %v", err)
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	sut, fakes := setupService(false)
+
+	user, err := sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.RequestPasswordReset(context.Background(), "unknown@example.com")
+	assert.NoErrorf(t, err, "Expected unknown emails to pass silently, got %v", err)
+	assert.Emptyf(t, fakes.mailer.Messages(), "Expected no email for unknown users, got %d messages", len(fakes.mailer.Messages()))
+
+	err = sut.RequestPasswordReset(context.Background(), testEmail)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	token := lastToken(t, fakes.mailer)
+
+	err = sut.ResetPassword(context.Background(), token, "short")
+	assert.ErrorIsf(t, err, internal.ErrWeakPassword, "Expected %v, got %v", internal.ErrWeakPassword, err)
+
+	err = sut.ResetPassword(context.Background(), token, "a new and better password")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, []string{user.ID}, fakes.sessions.revoked, "Expected sessions to be revoked, got %v", fakes.sessions.revoked)
+
+	_, err = sut.Login(context.Background(), testEmail, "a new and better password")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.ResetPassword(context.Background(), token, "yet another password")
+	assert.ErrorIsf(t, err, internal.ErrInvalidToken, "Expected token to work only once, got %v", err)
+}
+
+func TestService_ResetPassword_Unverified(t *testing.T) {
+	sut, fakes := setupService(true)
+
+	_, err := sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.RequestPasswordReset(context.Background(), testEmail)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.ResetPassword(context.Background(), lastToken(t, fakes.mailer), "a new and better password")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	_, err = sut.Login(context.Background(), testEmail, "a new and better password")
+	assert.NoErrorf(t, err, "Expected reset to verify the email, got %v", err)
+}
+
+func TestService_ExpiredToken(t *testing.T) {
+	sut, fakes := setupService(true)
+
+	_, err := sut.Register(context.Background(), testEmail, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	for id, token := range fakes.tokens.tokens {
+		token.ExpiresAt = time.Now().Add(-time.Minute)
+		fakes.tokens.tokens[id] = token
+	}
+
+	err = sut.VerifyEmail(context.Background(), lastToken(t, fakes.mailer))
+	assert.ErrorIsf(t, err, internal.ErrInvalidToken, "Expected %v, got %v", internal.ErrInvalidToken, err)
+
+	deleted, err := sut.DeleteExpiredTokens(context.Background())
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, deleted, "Expected one deleted token, got %d", deleted)
+}
+
+type fakes struct {
+	users    *usersServiceFake
+	accounts *localAccountRepositoryFake
+	tokens   *accountTokenRepositoryFake
+	sessions *sessionServiceFake
+	mailer   *mailer.LogMailer
+}
+
+func setupService(requireVerification bool) (*Service, fakes) {
+	tokens := &accountTokenRepositoryFake{tokens: map[string]internal.AccountToken{}}
+	f := fakes{
+		users:    &usersServiceFake{users: map[string]internal.User{}},
+		accounts: &localAccountRepositoryFake{accounts: map[string]internal.LocalAccount{}, tokens: tokens},
+		tokens:   tokens,
+		sessions: &sessionServiceFake{},
+		mailer:   mailer.NewLogMailer(),
+	}
+	sut := NewService(f.users, f.accounts, f.tokens, f.sessions, auditServiceFake{}, f.mailer, testLinkBase, requireVerification)
+	return sut, f
+}
+
+func lastToken(t *testing.T, m *mailer.LogMailer) string {
+	messages := m.Messages()
+	if len(messages) == 0 {
+		t.Fatal("Expected an email, got none")
+	}
+
+	match := tokenPattern.FindStringSubmatch(messages[len(messages)-1].Body)
+	if match == nil {
+		t.Fatalf("Expected a token in the email, got %v", messages[len(messages)-1].Body)
+	}
+	return match[1]
+}
+
+type usersServiceFake struct {
+	users  map[string]internal.User
+	admins map[string]bool
+}
+
+func (u *usersServiceFake) List(context.Context, string) ([]internal.User, error) {
+	return nil, nil
+}
+
+func (u *usersServiceFake) Get(_ context.Context, id string) (internal.User, error) {
+	user, ok := u.users[id]
+	if !ok {
+		return internal.User{}, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+func (u *usersServiceFake) GetByEmail(_ context.Context, email string) (internal.User, error) {
+	for _, user := range u.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return internal.User{}, pgx.ErrNoRows
+}
+
+func (u *usersServiceFake) SetDisabled(context.Context, string, bool) error {
+	return nil
+}
+
+func (u *usersServiceFake) Delete(_ context.Context, id string) error {
+	delete(u.users, id)
+	return nil
+}
+
+func (u *usersServiceFake) SignIn(ctx context.Context, identity internal.Identity) (internal.User, error) {
+	if user, err := u.GetByEmail(ctx, identity.Email); err == nil {
+		return user, nil
+	}
+
+	user := internal.User{ID: uuid.New().String(), Email: identity.Email, Role: internal.RoleUser}
+	if u.admins[identity.Email] {
+		user.Role = internal.RoleAdmin
+	}
+	u.users[user.ID] = user
+	return user, nil
+}
+
+func (u *usersServiceFake) Identities(context.Context, string) ([]internal.Identity, error) {
+	return nil, nil
+}
+
+func (u *usersServiceFake) Link(context.Context, string, internal.Identity) error {
+	return nil
+}
+
+func (u *usersServiceFake) Unlink(context.Context, string, string, string) error {
+	return nil
+}
+
+type localAccountRepositoryFake struct {
+	accounts map[string]internal.LocalAccount
+	tokens   *accountTokenRepositoryFake
+}
+
+func (l *localAccountRepositoryFake) Get(_ context.Context, email string) (internal.LocalAccount, error) {
+	account, ok := l.accounts[email]
+	if !ok {
+		return internal.LocalAccount{}, pgx.ErrNoRows
+	}
+	return account, nil
+}
+
+func (l *localAccountRepositoryFake) Save(_ context.Context, account internal.LocalAccount) error {
+	l.accounts[account.Email] = account
+	return nil
+}
+
+func (l *localAccountRepositoryFake) Delete(_ context.Context, email string) error {
+	delete(l.accounts, email)
+	for id, token := range l.tokens.tokens {
+		if token.Email == email {
+			delete(l.tokens.tokens, id)
+		}
+	}
+	return nil
+}
+
+type accountTokenRepositoryFake struct {
+	tokens map[string]internal.AccountToken
+}
+
+func (a *accountTokenRepositoryFake) Save(_ context.Context, token internal.AccountToken) error {
+	a.tokens[token.ID] = token
+	return nil
+}
+
+func (a *accountTokenRepositoryFake) Consume(_ context.Context, id string, purpose internal.TokenPurpose) (internal.AccountToken, error) {
+	token, ok := a.tokens[id]
+	if !ok || token.Purpose != purpose || token.ExpiresAt.Before(time.Now()) {
+		return internal.AccountToken{}, pgx.ErrNoRows
+	}
+	delete(a.tokens, id)
+	return token, nil
+}
+
+func (a *accountTokenRepositoryFake) DeleteExpired(context.Context) (int, error) {
+	count := 0
+	for id, token := range a.tokens {
+		if token.ExpiresAt.Before(time.Now()) {
+			delete(a.tokens, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+type sessionServiceFake struct {
+	revoked []string
+}
+
+func (s *sessionServiceFake) List(context.Context, string, string) ([]internal.Session, error) {
+	return nil, nil
+}
+
+func (s *sessionServiceFake) Revoke(context.Context, string, string) error {
+	return errors.New("not implemented")
+}
+
+func (s *sessionServiceFake) RevokeAll(_ context.Context, userID string) (int, error) {
+	s.revoked = append(s.revoked, userID)
+	return 1, nil
+}
+
+type auditServiceFake struct{}
+
+func (a auditServiceFake) Record(context.Context, internal.AuditAction, string, string, any, any) error {
+	return nil
+}
+
+func (a auditServiceFake) List(context.Context, internal.AuditFilter) ([]internal.AuditEvent, error) {
+	return nil, nil
+}
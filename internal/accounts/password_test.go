@@ -0,0 +1,36 @@
+package accounts
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse battery staple")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$"), "Expected PHC formatted argon2id hash, got %v", hash)
+
+	ok, err := verifyPassword(hash, "correct horse battery staple")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, ok, "Expected password to match")
+
+	ok, err = verifyPassword(hash, "Correct horse battery staple")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Falsef(t, ok, "Expected wrong password to not match")
+
+	other, _ := hashPassword("correct horse battery staple")
+	assert.NotEqualf(t, hash, other, "Expected salted hashes to differ")
+
+	_, err = verifyPassword("$2a$10$bcrypthash", "password")
+	assert.ErrorIsf(t, err, errMalformedHash, "Expected %v, got %v", errMalformedHash, err)
+}
+
+func TestPassword_Parameters(t *testing.T) {
+	// test vector of the argon2 reference implementation, with other parameters than ours
+	reference := "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"
+
+	ok, err := verifyPassword(reference, "password")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, ok, "Expected password to match the reference hash")
+}
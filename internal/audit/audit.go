@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/pscheid92/dwarferl/internal"
+	"time"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestKey
+)
+
+type request struct {
+	id string
+	ip string
+}
+
+// WithActor marks the user who performs the changes made with the returned context.
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorKey, userID)
+}
+
+// WithRequest attaches the request ID and client IP to the events recorded with the returned context.
+func WithRequest(ctx context.Context, requestID string, ip string) context.Context {
+	return context.WithValue(ctx, requestKey, request{id: requestID, ip: ip})
+}
+
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// ClientIP returns the client IP attached with WithRequest.
+func ClientIP(ctx context.Context) string {
+	req, _ := ctx.Value(requestKey).(request)
+	return req.ip
+}
+
+type Service struct {
+	repository internal.AuditRepository
+}
+
+func NewService(repository internal.AuditRepository) *Service {
+	return &Service{repository: repository}
+}
+
+func (s *Service) Record(ctx context.Context, action internal.AuditAction, targetType string, targetID string, before any, after any) error {
+	beforeValue, err := marshal(before)
+	if err != nil {
+		return err
+	}
+
+	afterValue, err := marshal(after)
+	if err != nil {
+		return err
+	}
+
+	req, _ := ctx.Value(requestKey).(request)
+	event := internal.AuditEvent{
+		ID:         uuid.New().String(),
+		ActorID:    Actor(ctx),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     beforeValue,
+		After:      afterValue,
+		RequestID:  req.id,
+		IP:         req.ip,
+		CreatedAt:  time.Now(),
+	}
+	return s.repository.Save(ctx, event)
+}
+
+func (s *Service) List(ctx context.Context, filter internal.AuditFilter) ([]internal.AuditEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+	if filter.Limit > maxLimit {
+		filter.Limit = maxLimit
+	}
+	return s.repository.List(ctx, filter)
+}
+
+// marshal keeps absent values absent instead of storing a JSON null.
+func marshal(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testUser = "00000000-0000-0000-0000-000000000000"
+
+func TestService_Record(t *testing.T) {
+	repo, sut := setupService()
+
+	ctx := WithRequest(WithActor(context.Background(), testUser), "request-1", "192.0.2.1")
+	err := sut.Record(ctx, internal.AuditLinkUpdate, internal.AuditTargetLink, "short", map[string]string{"title": "old"}, map[string]string{"title": "new"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, repo.events, 1, "Expected one event, got %d", len(repo.events))
+
+	event := repo.events[0]
+	assert.NotEmptyf(t, event.ID, "Expected event ID to be set")
+	assert.Equalf(t, testUser, event.ActorID, "Expected actor %s, got %s", testUser, event.ActorID)
+	assert.Equalf(t, "request-1", event.RequestID, "Expected request ID request-1, got %s", event.RequestID)
+	assert.Equalf(t, "192.0.2.1", event.IP, "Expected IP 192.0.2.1, got %s", event.IP)
+	assert.JSONEqf(t, `{"title":"old"}`, string(event.Before), "Expected before value, got %s", event.Before)
+	assert.JSONEqf(t, `{"title":"new"}`, string(event.After), "Expected after value, got %s", event.After)
+}
+
+func TestService_Record_System(t *testing.T) {
+	repo, sut := setupService()
+
+	err := sut.Record(context.Background(), internal.AuditTrashPurge, internal.AuditTargetTrash, "", nil, map[string]int{"purged": 3})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	event := repo.events[0]
+	assert.Emptyf(t, event.ActorID, "Expected system actor, got %s", event.ActorID)
+	assert.Nilf(t, event.Before, "Expected no before value, got %s", event.Before)
+
+	repo.FailMode = true
+	err = sut.Record(context.Background(), internal.AuditTrashPurge, internal.AuditTargetTrash, "", nil, nil)
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestService_List(t *testing.T) {
+	repo, sut := setupService()
+
+	_, err := sut.List(context.Background(), internal.AuditFilter{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, defaultLimit, repo.lastFilter.Limit, "Expected default limit, got %d", repo.lastFilter.Limit)
+
+	_, err = sut.List(context.Background(), internal.AuditFilter{Limit: 10000})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, maxLimit, repo.lastFilter.Limit, "Expected max limit, got %d", repo.lastFilter.Limit)
+}
+
+func setupService() (*auditRepositoryFake, *Service) {
+	repo := &auditRepositoryFake{}
+	return repo, NewService(repo)
+}
+
+type auditRepositoryFake struct {
+	events     []internal.AuditEvent
+	lastFilter internal.AuditFilter
+	FailMode   bool
+}
+
+func (a *auditRepositoryFake) Save(_ context.Context, event internal.AuditEvent) error {
+	if a.FailMode {
+		return errors.New("fake error")
+	}
+	a.events = append(a.events, event)
+	return nil
+}
+
+func (a *auditRepositoryFake) List(_ context.Context, filter internal.AuditFilter) ([]internal.AuditEvent, error) {
+	if a.FailMode {
+		return nil, errors.New("fake error")
+	}
+	a.lastFilter = filter
+	return a.events, nil
+}
@@ -2,10 +2,30 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pscheid92/dwarferl/internal"
 	"github.com/spf13/viper"
+	"net"
+	"net/http"
 	"strings"
+	"time"
 )
 
+const (
+	defaultSessionSecret = "secret"
+	minSessionSecretLen  = 32
+)
+
+// codeLengths lists the default, minimum and maximum length of the codes of each generator. The
+// length of word codes counts words, hash codes always have six characters.
+var codeLengths = map[string][3]int{
+	"hash":     {0, 0, 0},
+	"random":   {8, 4, 32},
+	"sequence": {6, 4, 10},
+	"words":    {3, 2, 6},
+}
+
 type Configuration struct {
 	ForwardedPrefix   string `mapstructure:"forwarded_prefix"`
 	SessionSecret     string `mapstructure:"session_secret"`
@@ -14,14 +34,128 @@ type Configuration struct {
 	GoogleClientKey   string `mapstructure:"google_client_key"`
 	GoogleSecret      string `mapstructure:"google_secret"`
 	GoogleCallbackURL string `mapstructure:"google_callback_url"`
+	GitHubClientKey   string `mapstructure:"github_client_key"`
+	GitHubSecret      string `mapstructure:"github_secret"`
+	GitHubCallbackURL string `mapstructure:"github_callback_url"`
+	OIDCName          string `mapstructure:"oidc_name"`
+	OIDCClientKey     string `mapstructure:"oidc_client_key"`
+	OIDCSecret        string `mapstructure:"oidc_secret"`
+	OIDCDiscoveryURL  string `mapstructure:"oidc_discovery_url"`
+	OIDCCallbackURL   string `mapstructure:"oidc_callback_url"`
+
+	UnlockDuration time.Duration `mapstructure:"unlock_duration"`
+	ForcePreview   bool          `mapstructure:"force_preview"`
+	PageSize       int           `mapstructure:"page_size"`
+	TrashRetention time.Duration `mapstructure:"trash_retention"`
+	AdminEmails    []string      `mapstructure:"admin_emails"`
+	AllowedDomains []string      `mapstructure:"allowed_domains"`
+	AllowedEmails  []string      `mapstructure:"allowed_emails"`
+	ShortDomains   []string      `mapstructure:"short_domains"`
+	TrustedProxies []string      `mapstructure:"trusted_proxies"`
+
+	CodeGenerator string `mapstructure:"code_generator"`
+	CodeLength    int    `mapstructure:"code_length"`
+	CodeAlphabet  string `mapstructure:"code_alphabet"`
+	CodeSalt      string `mapstructure:"code_salt"`
+
+	SessionEncryptionKey          string        `mapstructure:"session_encryption_key"`
+	SessionPreviousSecrets        []string      `mapstructure:"session_previous_secrets"`
+	SessionPreviousEncryptionKeys []string      `mapstructure:"session_previous_encryption_keys"`
+	SessionLifetime               time.Duration `mapstructure:"session_lifetime"`
+	CookieDomain                  string        `mapstructure:"cookie_domain"`
+	CookieSecure                  bool          `mapstructure:"cookie_secure"`
+	CookieSameSite                string        `mapstructure:"cookie_same_site"`
+
+	BaseURL           string `mapstructure:"base_url"`
+	LocalAccounts     bool   `mapstructure:"local_accounts"`
+	LocalRegistration bool   `mapstructure:"local_registration"`
+	EmailVerification bool   `mapstructure:"email_verification"`
+	MailTransport     string `mapstructure:"mail_transport"`
+	MailFrom          string `mapstructure:"mail_from"`
+	SMTPHost          string `mapstructure:"smtp_host"`
+	SMTPPort          int    `mapstructure:"smtp_port"`
+	SMTPUsername      string `mapstructure:"smtp_username"`
+	SMTPPassword      string `mapstructure:"smtp_password"`
+
+	TwoFactorRoles  []string `mapstructure:"two_factor_roles"`
+	TwoFactorIssuer string   `mapstructure:"two_factor_issuer"`
 }
 
 func GatherConfig() (Configuration, error) {
+	debug := gin.Mode() == gin.DebugMode
+
 	// forwarded prefix
 	viper.SetDefault("forwarded_prefix", "/")
 
-	// session secret
-	viper.SetDefault("session_secret", "secret")
+	// session secret signs the session cookies, the optional encryption key (16, 24 or 32 bytes)
+	// encrypts them; previous secrets and keys are still accepted when reading cookies
+	viper.SetDefault("session_secret", defaultSessionSecret)
+	viper.SetDefault("session_encryption_key", "")
+	viper.SetDefault("session_previous_secrets", []string{})
+	viper.SetDefault("session_previous_encryption_keys", []string{})
+
+	// session cookie settings, plain http is only expected while debugging
+	viper.SetDefault("session_lifetime", 30*24*time.Hour)
+	viper.SetDefault("cookie_domain", "")
+	viper.SetDefault("cookie_secure", !debug)
+	viper.SetDefault("cookie_same_site", "lax")
+
+	// how long an unlocked password-protected link stays accessible
+	viper.SetDefault("unlock_duration", time.Hour)
+
+	// show the preview page to every visitor before redirecting
+	viper.SetDefault("force_preview", false)
+
+	// number of links shown per page on the index page
+	viper.SetDefault("page_size", 50)
+
+	// how long deleted links stay in the trash, zero keeps them forever
+	viper.SetDefault("trash_retention", 30*24*time.Hour)
+
+	// users signing in with one of these emails become administrators
+	viper.SetDefault("admin_emails", []string{})
+
+	// only these email domains and addresses may sign up, everyone else needs an invitation;
+	// without either, everyone may sign up
+	viper.SetDefault("allowed_domains", []string{})
+	viper.SetDefault("allowed_emails", []string{})
+
+	// further hostnames serving links, each with its own shorts; every other host serves the default ones
+	viper.SetDefault("short_domains", []string{})
+
+	// addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For and X-Forwarded-Host
+	// headers are trusted
+	viper.SetDefault("trusted_proxies", []string{})
+
+	// how short codes are generated: hash of the link (hash), random characters (random), numbered
+	// by a database sequence (sequence) or random words (words); a length of zero picks the
+	// generator's default; random and sequence codes may use the unambiguous alphabet without
+	// 0, O, l and 1; the salt shuffles the alphabet of sequence codes
+	viper.SetDefault("code_generator", "hash")
+	viper.SetDefault("code_length", 0)
+	viper.SetDefault("code_alphabet", "base62")
+	viper.SetDefault("code_salt", "")
+
+	// public URL of the web interface without the forwarded prefix, used for links in emails
+	viper.SetDefault("base_url", "")
+
+	// sign in with email and password, optionally open for everyone to register
+	viper.SetDefault("local_accounts", false)
+	viper.SetDefault("local_registration", true)
+	viper.SetDefault("email_verification", true)
+
+	// emails are sent by smtp or only logged
+	viper.SetDefault("mail_transport", "log")
+	viper.SetDefault("mail_from", "")
+	viper.SetDefault("smtp_host", "")
+	viper.SetDefault("smtp_port", 587)
+	viper.SetDefault("smtp_username", "")
+	viper.SetDefault("smtp_password", "")
+
+	// users of these roles must set up two-factor authentication, the issuer names the
+	// account in authenticator apps
+	viper.SetDefault("two_factor_roles", []string{})
+	viper.SetDefault("two_factor_issuer", "dwarferl")
 
 	// fs paths
 	viper.SetDefault("template_path", "templates")
@@ -32,6 +166,18 @@ func GatherConfig() (Configuration, error) {
 	viper.SetDefault("google_secret", "")
 	viper.SetDefault("google_callback_url", "")
 
+	// github login settings
+	viper.SetDefault("github_client_key", "")
+	viper.SetDefault("github_secret", "")
+	viper.SetDefault("github_callback_url", "")
+
+	// openid connect login settings, the name is shown on the login button
+	viper.SetDefault("oidc_name", "OpenID Connect")
+	viper.SetDefault("oidc_client_key", "")
+	viper.SetDefault("oidc_secret", "")
+	viper.SetDefault("oidc_discovery_url", "")
+	viper.SetDefault("oidc_callback_url", "")
+
 	// environment variable bindings
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
@@ -45,9 +191,215 @@ func GatherConfig() (Configuration, error) {
 		return Configuration{}, errors.New("forwarded_prefix must start with /")
 	}
 
+	if config.PageSize < 1 {
+		return Configuration{}, errors.New("page_size must be positive")
+	}
+
+	if config.TrashRetention < 0 {
+		return Configuration{}, errors.New("trash_retention must not be negative")
+	}
+
+	if err := validateDomains(&config); err != nil {
+		return Configuration{}, err
+	}
+
+	if err := validateCodes(&config); err != nil {
+		return Configuration{}, err
+	}
+
+	if err := validateSession(&config, debug); err != nil {
+		return Configuration{}, err
+	}
+
+	if err := validateAccounts(config); err != nil {
+		return Configuration{}, err
+	}
+
+	for _, role := range config.TwoFactorRoles {
+		if role != string(internal.RoleUser) && role != string(internal.RoleAdmin) {
+			return Configuration{}, errors.New("two_factor_roles may only contain user and admin")
+		}
+	}
+
 	if !strings.HasSuffix(config.ForwardedPrefix, "/") {
 		config.ForwardedPrefix += "/"
 	}
 
 	return config, nil
 }
+
+func validateDomains(config *Configuration) error {
+	for i, domain := range config.ShortDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "/:@ ") {
+			return errors.New("short_domains may only contain hostnames")
+		}
+		config.ShortDomains[i] = domain
+	}
+
+	for _, proxy := range config.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return errors.New("trusted_proxies may only contain IP addresses and CIDR ranges")
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsShortDomain reports whether the host has its own shorts. The host may include a port.
+func (c Configuration) IsShortDomain(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	for _, domain := range c.ShortDomains {
+		if strings.EqualFold(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCodes(config *Configuration) error {
+	lengths, ok := codeLengths[config.CodeGenerator]
+	if !ok {
+		return errors.New("code_generator must be hash, random, sequence or words")
+	}
+
+	if config.CodeAlphabet != "base62" && config.CodeAlphabet != "unambiguous" {
+		return errors.New("code_alphabet must be base62 or unambiguous")
+	}
+	// hash and word codes bring their own characters
+	if config.CodeAlphabet != "base62" && (config.CodeGenerator == "hash" || config.CodeGenerator == "words") {
+		return fmt.Errorf("code_alphabet cannot be changed for %s codes", config.CodeGenerator)
+	}
+
+	if config.CodeLength == 0 {
+		config.CodeLength = lengths[0]
+	}
+	if config.CodeLength < lengths[1] || config.CodeLength > lengths[2] {
+		if config.CodeGenerator == "hash" {
+			return errors.New("code_length cannot be changed for hash codes")
+		}
+		return fmt.Errorf("code_length of %s codes must be between %d and %d", config.CodeGenerator, lengths[1], lengths[2])
+	}
+
+	return nil
+}
+
+func validateSession(config *Configuration, debug bool) error {
+	// the default secret is public, so it would allow anyone to forge sessions
+	if !debug && (config.SessionSecret == defaultSessionSecret || len(config.SessionSecret) < minSessionSecretLen) {
+		return errors.New("session_secret must be set to at least 32 characters outside of debug mode")
+	}
+
+	for _, key := range append([]string{config.SessionEncryptionKey}, config.SessionPreviousEncryptionKeys...) {
+		if key != "" && len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return errors.New("session encryption keys must be 16, 24 or 32 bytes long")
+		}
+	}
+
+	if len(config.SessionPreviousEncryptionKeys) > len(config.SessionPreviousSecrets) {
+		return errors.New("session_previous_encryption_keys needs a matching previous session secret each")
+	}
+
+	if config.SessionLifetime <= 0 {
+		return errors.New("session_lifetime must be positive")
+	}
+
+	config.CookieSameSite = strings.ToLower(config.CookieSameSite)
+	switch config.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !config.CookieSecure {
+			return errors.New("cookie_same_site none requires cookie_secure")
+		}
+	default:
+		return errors.New("cookie_same_site must be lax, strict or none")
+	}
+
+	return nil
+}
+
+func validateAccounts(config Configuration) error {
+	switch config.MailTransport {
+	case "log":
+	case "smtp":
+		if config.SMTPHost == "" || config.MailFrom == "" {
+			return errors.New("mail_transport smtp requires smtp_host and mail_from")
+		}
+	default:
+		return errors.New("mail_transport must be log or smtp")
+	}
+
+	if !config.LocalAccounts {
+		return nil
+	}
+
+	// verification and reset emails link back to us
+	if config.BaseURL == "" {
+		return errors.New("local_accounts requires base_url")
+	}
+
+	// anyone could register with an admin email and would be promoted without proving it
+	if !config.EmailVerification && len(config.AdminEmails) > 0 {
+		return errors.New("local_accounts with admin_emails requires email_verification")
+	}
+
+	// likewise, anyone could register with an allowed email
+	if !config.EmailVerification && (len(config.AllowedDomains) > 0 || len(config.AllowedEmails) > 0) {
+		return errors.New("local_accounts with allowed_domains or allowed_emails requires email_verification")
+	}
+
+	return nil
+}
+
+// LinkBase is the public URL of the web interface including the forwarded prefix.
+func (c Configuration) LinkBase() string {
+	return strings.TrimSuffix(c.BaseURL, "/") + c.ForwardedPrefix
+}
+
+// TwoFactorRequired tells whether users of the role must use two-factor authentication.
+func (c Configuration) TwoFactorRequired(role internal.Role) bool {
+	for _, required := range c.TwoFactorRoles {
+		if required == string(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionKeyPairs returns the signing and encryption keys for session cookies. The current
+// pair comes first and is used for writing, the previous pairs only for reading.
+func (c Configuration) SessionKeyPairs() [][]byte {
+	pairs := [][]byte{[]byte(c.SessionSecret), optionalKey(c.SessionEncryptionKey)}
+	for i, secret := range c.SessionPreviousSecrets {
+		var encryptionKey string
+		if i < len(c.SessionPreviousEncryptionKeys) {
+			encryptionKey = c.SessionPreviousEncryptionKeys[i]
+		}
+		pairs = append(pairs, []byte(secret), optionalKey(encryptionKey))
+	}
+	return pairs
+}
+
+func (c Configuration) SameSite() http.SameSite {
+	switch c.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// optionalKey turns a missing key into nil, which disables encryption.
+func optionalKey(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"github.com/gin-gonic/gin"
+	"github.com/pscheid92/dwarferl/internal"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGatherConfig(t *testing.T) {
@@ -38,4 +43,247 @@ func TestGatherConfig(t *testing.T) {
 		_, err = GatherConfig()
 		assert.Errorf(t, err, "unexpected error: %v", err)
 	})
+
+	t.Run("fails if page size is not positive", func(t *testing.T) {
+		_ = os.Unsetenv("FORWARDED_PREFIX")
+		err := os.Setenv("PAGE_SIZE", "0")
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		defer os.Unsetenv("PAGE_SIZE")
+
+		_, err = GatherConfig()
+		assert.Errorf(t, err, "expected error for page size 0")
+	})
+	t.Run("successfully reads admin emails", func(t *testing.T) {
+		err := os.Setenv("ADMIN_EMAILS", "admin@example.com,ops@example.com")
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		defer os.Unsetenv("ADMIN_EMAILS")
+
+		config, err := GatherConfig()
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Equal(t, []string{"admin@example.com", "ops@example.com"}, config.AdminEmails)
+	})
+
+	t.Run("fails if trash retention is negative", func(t *testing.T) {
+		err := os.Setenv("TRASH_RETENTION", "-1h")
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		defer os.Unsetenv("TRASH_RETENTION")
+
+		_, err = GatherConfig()
+		assert.Errorf(t, err, "expected error for negative trash retention")
+	})
+
+	t.Run("successfully reads cookie settings", func(t *testing.T) {
+		_ = os.Setenv("COOKIE_DOMAIN", "example.com")
+		_ = os.Setenv("COOKIE_SECURE", "true")
+		_ = os.Setenv("COOKIE_SAME_SITE", "None")
+		_ = os.Setenv("SESSION_LIFETIME", "12h")
+		defer unsetenv("COOKIE_DOMAIN", "COOKIE_SECURE", "COOKIE_SAME_SITE", "SESSION_LIFETIME")
+
+		config, err := GatherConfig()
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Equal(t, "example.com", config.CookieDomain)
+		assert.Equal(t, http.SameSiteNoneMode, config.SameSite())
+		assert.Equal(t, 12*time.Hour, config.SessionLifetime)
+	})
+
+	t.Run("fails if same site none is not secure", func(t *testing.T) {
+		_ = os.Setenv("COOKIE_SECURE", "false")
+		_ = os.Setenv("COOKIE_SAME_SITE", "none")
+		defer unsetenv("COOKIE_SECURE", "COOKIE_SAME_SITE")
+
+		_, err := GatherConfig()
+		assert.Errorf(t, err, "expected error for insecure same site none")
+	})
+
+	t.Run("fails with invalid encryption key", func(t *testing.T) {
+		_ = os.Setenv("SESSION_ENCRYPTION_KEY", "short")
+		defer unsetenv("SESSION_ENCRYPTION_KEY")
+
+		_, err := GatherConfig()
+		assert.Errorf(t, err, "expected error for invalid encryption key")
+	})
+
+	t.Run("fails with default session secret outside of debug mode", func(t *testing.T) {
+		gin.SetMode(gin.ReleaseMode)
+		defer gin.SetMode(gin.DebugMode)
+
+		_, err := GatherConfig()
+		assert.Errorf(t, err, "expected error for default session secret")
+
+		_ = os.Setenv("SESSION_SECRET", "too-short")
+		_, err = GatherConfig()
+		assert.Errorf(t, err, "expected error for short session secret")
+
+		_ = os.Setenv("SESSION_SECRET", strings.Repeat("s", 32))
+		defer unsetenv("SESSION_SECRET")
+
+		config, err := GatherConfig()
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Truef(t, config.CookieSecure, "expected secure cookies outside of debug mode")
+	})
+}
+
+func TestGatherConfig_Accounts(t *testing.T) {
+	t.Run("local accounts require a base url", func(t *testing.T) {
+		_ = os.Setenv("LOCAL_ACCOUNTS", "true")
+		defer unsetenv("LOCAL_ACCOUNTS")
+
+		_, err := GatherConfig()
+		assert.Errorf(t, err, "expected error without base url")
+
+		_ = os.Setenv("BASE_URL", "https://dwarf.example.com/")
+		defer unsetenv("BASE_URL")
+
+		config, err := GatherConfig()
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Equal(t, "https://dwarf.example.com/", config.LinkBase())
+	})
+
+	t.Run("admin emails require email verification", func(t *testing.T) {
+		_ = os.Setenv("LOCAL_ACCOUNTS", "true")
+		_ = os.Setenv("BASE_URL", "https://dwarf.example.com")
+		_ = os.Setenv("EMAIL_VERIFICATION", "false")
+		_ = os.Setenv("ADMIN_EMAILS", "admin@example.com")
+		defer unsetenv("LOCAL_ACCOUNTS", "BASE_URL", "EMAIL_VERIFICATION", "ADMIN_EMAILS")
+
+		_, err := GatherConfig()
+		assert.Errorf(t, err, "expected error for admin emails without verification")
+	})
+
+	t.Run("allowed domains require email verification", func(t *testing.T) {
+		_ = os.Setenv("LOCAL_ACCOUNTS", "true")
+		_ = os.Setenv("BASE_URL", "https://dwarf.example.com")
+		_ = os.Setenv("ALLOWED_DOMAINS", "example.com")
+		defer unsetenv("LOCAL_ACCOUNTS", "BASE_URL", "ALLOWED_DOMAINS")
+
+		config, err := GatherConfig()
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Equal(t, []string{"example.com"}, config.AllowedDomains)
+
+		_ = os.Setenv("EMAIL_VERIFICATION", "false")
+		defer unsetenv("EMAIL_VERIFICATION")
+
+		_, err = GatherConfig()
+		assert.Errorf(t, err, "expected error for allowed domains without verification")
+	})
+
+	t.Run("smtp requires a host", func(t *testing.T) {
+		_ = os.Setenv("MAIL_TRANSPORT", "smtp")
+		defer unsetenv("MAIL_TRANSPORT")
+
+		_, err := GatherConfig()
+		assert.Errorf(t, err, "expected error for smtp without host")
+
+		_ = os.Setenv("SMTP_HOST", "mail.example.com")
+		_ = os.Setenv("MAIL_FROM", "dwarferl@example.com")
+		defer unsetenv("SMTP_HOST", "MAIL_FROM")
+
+		config, err := GatherConfig()
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Equal(t, 587, config.SMTPPort)
+	})
+}
+
+func TestGatherConfig_Domains(t *testing.T) {
+	_ = os.Setenv("SHORT_DOMAINS", "Go.Example.com,links.example.org")
+	_ = os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,192.168.1.1")
+	defer unsetenv("SHORT_DOMAINS", "TRUSTED_PROXIES")
+
+	config, err := GatherConfig()
+	assert.NoErrorf(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []string{"go.example.com", "links.example.org"}, config.ShortDomains)
+	assert.Truef(t, config.IsShortDomain("GO.example.com:8080"), "expected host with port to match")
+	assert.Falsef(t, config.IsShortDomain("example.com"), "expected other hosts not to match")
+
+	_ = os.Setenv("SHORT_DOMAINS", "https://go.example.com")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for URL instead of hostname")
+
+	_ = os.Setenv("SHORT_DOMAINS", "go.example.com")
+	_ = os.Setenv("TRUSTED_PROXIES", "proxy.local")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for hostname as trusted proxy")
+}
+
+func TestGatherConfig_Codes(t *testing.T) {
+	defer unsetenv("CODE_GENERATOR", "CODE_LENGTH", "CODE_ALPHABET")
+
+	config, err := GatherConfig()
+	assert.NoErrorf(t, err, "unexpected error: %v", err)
+	assert.Equalf(t, "hash", config.CodeGenerator, "Expected hash generator by default, got %s", config.CodeGenerator)
+
+	_ = os.Setenv("CODE_GENERATOR", "words")
+	config, err = GatherConfig()
+	assert.NoErrorf(t, err, "unexpected error: %v", err)
+	assert.Equalf(t, 3, config.CodeLength, "Expected default length of word codes, got %d", config.CodeLength)
+
+	_ = os.Setenv("CODE_GENERATOR", "random")
+	_ = os.Setenv("CODE_LENGTH", "12")
+	_ = os.Setenv("CODE_ALPHABET", "unambiguous")
+	config, err = GatherConfig()
+	assert.NoErrorf(t, err, "unexpected error: %v", err)
+	assert.Equalf(t, 12, config.CodeLength, "Expected configured length, got %d", config.CodeLength)
+
+	_ = os.Setenv("CODE_LENGTH", "2")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for too short codes")
+
+	_ = os.Setenv("CODE_GENERATOR", "hash")
+	_ = os.Setenv("CODE_LENGTH", "8")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for length of hash codes")
+
+	_ = os.Setenv("CODE_LENGTH", "0")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for alphabet of hash codes")
+
+	_ = os.Setenv("CODE_GENERATOR", "words")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for alphabet of word codes")
+
+	_ = os.Setenv("CODE_GENERATOR", "uuid")
+	_ = os.Setenv("CODE_LENGTH", "0")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for unknown generator")
+
+	_ = os.Setenv("CODE_GENERATOR", "random")
+	_ = os.Setenv("CODE_ALPHABET", "hex")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for unknown alphabet")
+}
+
+func TestGatherConfig_TwoFactor(t *testing.T) {
+	_ = os.Setenv("TWO_FACTOR_ROLES", "admin")
+	defer unsetenv("TWO_FACTOR_ROLES")
+
+	config, err := GatherConfig()
+	assert.NoErrorf(t, err, "unexpected error: %v", err)
+	assert.Truef(t, config.TwoFactorRequired(internal.RoleAdmin), "expected two-factor authentication for admins")
+	assert.Falsef(t, config.TwoFactorRequired(internal.RoleUser), "expected no two-factor authentication for users")
+
+	_ = os.Setenv("TWO_FACTOR_ROLES", "admin,owner")
+	_, err = GatherConfig()
+	assert.Errorf(t, err, "expected error for unknown role")
+}
+
+func TestConfiguration_SessionKeyPairs(t *testing.T) {
+	config := Configuration{
+		SessionSecret:                 "current",
+		SessionEncryptionKey:          "0123456789abcdef",
+		SessionPreviousSecrets:        []string{"old", "older"},
+		SessionPreviousEncryptionKeys: []string{"fedcba9876543210"},
+	}
+
+	pairs := config.SessionKeyPairs()
+	assert.Len(t, pairs, 6)
+	assert.Equal(t, []byte("current"), pairs[0])
+	assert.Equal(t, []byte("0123456789abcdef"), pairs[1])
+	assert.Equal(t, []byte("fedcba9876543210"), pairs[3])
+	assert.Nilf(t, pairs[5], "expected no encryption for the oldest pair, got %v", pairs[5])
+}
+
+func unsetenv(keys ...string) {
+	for _, key := range keys {
+		_ = os.Unsetenv(key)
+	}
 }
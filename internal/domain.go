@@ -2,49 +2,784 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
 	"time"
 )
 
+var (
+	ErrWrongPassword   = errors.New("wrong password")
+	ErrTooManyAttempts = errors.New("too many attempts")
+	ErrClicksExhausted = errors.New("clicks exhausted")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrUserDisabled    = errors.New("user disabled")
+	ErrEmailInUse      = errors.New("email in use")
+	ErrEmailMissing    = errors.New("email missing")
+	ErrIdentityInUse   = errors.New("identity in use")
+	ErrLastIdentity    = errors.New("last identity")
+	ErrWeakPassword    = errors.New("weak password")
+	ErrEmailInvalid    = errors.New("invalid email")
+	ErrEmailUnverified = errors.New("email not verified")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrInvalidCode     = errors.New("invalid code")
+	ErrTwoFactorOn     = errors.New("two-factor authentication enabled")
+	ErrTwoFactorOff    = errors.New("two-factor authentication not enabled")
+	ErrNotInvited      = errors.New("not invited")
+	ErrInvalidHeir     = errors.New("invalid heir")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrTooManyWebhooks = errors.New("too many webhooks")
+	ErrUnknownDomain   = errors.New("unknown domain")
+	ErrShortTaken      = errors.New("short code taken")
+	ErrLinkTrashed     = errors.New("link in trash")
+)
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
 type User struct {
 	ID       string
 	Email    string
-	GoogleID string
+	Role     Role
+	Disabled bool
+}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Identity links a user to an account at an external login provider. The subject is the
+// provider's ID of that account. Whether the provider verified the email is only known while
+// signing in and is not stored.
+type Identity struct {
+	Provider      string
+	Subject       string
+	UserID        string
+	Email         string
+	EmailVerified bool
+	CreatedAt     time.Time
+}
+
+// Invitation lets someone sign up whose email is not allowed to otherwise.
+type Invitation struct {
+	ID        string
+	Email     string
+	InvitedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// ProviderLocal is the identity provider of local accounts, which sign in with email and password.
+const ProviderLocal = "local"
+
+// LocalAccount holds the password of a user who signs in without an external provider.
+// Registrations wait for the email to be verified before their user is created, until
+// then the user ID is empty.
+type LocalAccount struct {
+	Email         string
+	UserID        string
+	PasswordHash  string
+	EmailVerified bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TwoFactor holds the TOTP secret of a user. It only guards sign-ins once enabled, which
+// requires a first code from the authenticator app. LastCounter stops codes from being reused.
+type TwoFactor struct {
+	UserID      string
+	Secret      string
+	Enabled     bool
+	LastCounter int64
+	CreatedAt   time.Time
+}
+
+type TwoFactorStatus struct {
+	Enabled       bool
+	RecoveryCodes int
+}
+
+// TwoFactorEnrollment is what authenticator apps need to add an account. URI is the
+// otpauth provisioning URI, usually scanned as QR code.
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
 }
 
+type TokenPurpose string
+
+const (
+	TokenVerifyEmail   TokenPurpose = "verify_email"
+	TokenResetPassword TokenPurpose = "reset_password"
+)
+
+// AccountToken is a single-use token sent by email. The ID is a hash of the token in the link.
+type AccountToken struct {
+	ID        string
+	Email     string
+	Purpose   TokenPurpose
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Redirect is identified by its short together with its domain. Each short domain has
+// its own namespace of shorts, the empty domain is the one every other host serves.
 type Redirect struct {
+	Domain       string
+	Short        string
+	URL          string
+	UserID       string
+	CreatedAt    time.Time
+	PasswordHash string
+	MaxClicks    int
+	Clicks       int
+	Title        string
+	ForcePreview bool
+	Passthrough  Passthrough
+	UTMPresetID  string
+	UTMCampaign  string
+	Rules        []TargetingRule
+	Targets      []WeightedTarget
+	Notes        string
+	Tags         []string
+	DeletedAt    time.Time
+}
+
+// WeightedTarget is one destination of an A/B split. Visitors are distributed
+// among the targets of a redirect in proportion to their weights.
+type WeightedTarget struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// VariantStats reports how many clicks went to one target of an A/B split.
+type VariantStats struct {
+	WeightedTarget
+	Clicks int
+	Share  float64
+}
+
+type RuleKind string
+
+const (
+	RuleOS       RuleKind = "os"
+	RuleLanguage RuleKind = "language"
+	RuleQuery    RuleKind = "query"
+)
+
+// TargetingRule sends visitors to an alternative URL if they match.
+// Rules are evaluated in order and the redirect's URL serves as fallback.
+type TargetingRule struct {
+	Kind  RuleKind `json:"kind"`
+	Key   string   `json:"key,omitempty"`
+	Value string   `json:"value"`
+	URL   string   `json:"url"`
+}
+
+// Passthrough controls how the path suffix and query parameters of a visit are
+// carried over to the destination URL.
+type Passthrough string
+
+const (
+	// PassthroughNone drops everything after the short code.
+	PassthroughNone Passthrough = ""
+	// PassthroughMerge appends the path suffix and adds query parameters the destination does not set itself.
+	PassthroughMerge Passthrough = "merge"
+	// PassthroughOverride appends the path suffix and lets query parameters of the visit replace those of the destination.
+	PassthroughOverride Passthrough = "override"
+)
+
+func (p Passthrough) IsValid() bool {
+	return p == PassthroughNone || p == PassthroughMerge || p == PassthroughOverride
+}
+
+// Visit describes the request that is about to be redirected.
+type Visit struct {
+	Path           string
+	Query          url.Values
+	UserAgent      string
+	AcceptLanguage string
+	VisitorID      string
+}
+
+func (r Redirect) IsProtected() bool {
+	return r.PasswordHash != ""
+}
+
+// HasClickBudget reports whether the redirect only works for a limited number of clicks.
+func (r Redirect) HasClickBudget() bool {
+	return r.MaxClicks > 0
+}
+
+func (r Redirect) RemainingClicks() int {
+	if r.Clicks >= r.MaxClicks {
+		return 0
+	}
+	return r.MaxClicks - r.Clicks
+}
+
+func (r Redirect) IsExhausted() bool {
+	return r.HasClickBudget() && r.RemainingClicks() == 0
+}
+
+// IsTrashed reports whether the redirect was deleted but can still be restored.
+func (r Redirect) IsTrashed() bool {
+	return !r.DeletedAt.IsZero()
+}
+
+// LinkID names a redirect in the audit log: its short on the default domain, prefixed
+// with the domain otherwise.
+func LinkID(domain string, short string) string {
+	if domain == "" {
+		return short
+	}
+	return domain + "/" + short
+}
+
+type RedirectOptions struct {
+	Domain       string
+	Password     string
+	MaxClicks    int
+	Title        string
+	ForcePreview bool
+	Passthrough  Passthrough
+	UTMPreset    UTMPreset
+	Notes        string
+	Tags         []string
+}
+
+// RedirectDetails are the descriptive fields of a redirect that can be edited after creation.
+type RedirectDetails struct {
+	Title string
+	Notes string
+	Tags  []string
+}
+
+type RedirectSort string
+
+const (
+	SortByCreated RedirectSort = "created"
+	SortByShort   RedirectSort = "short"
+	SortByClicks  RedirectSort = "clicks"
+)
+
+func (s RedirectSort) IsValid() bool {
+	switch s {
+	case SortByCreated, SortByShort, SortByClicks:
+		return true
+	default:
+		return false
+	}
+}
+
+// RedirectCursor holds the sort keys of the last redirect of a page, the next page starts right after it.
+type RedirectCursor struct {
+	CreatedAt time.Time
+	Short     string
+	Domain    string
+	Clicks    int
+}
+
+// PageRequest asks for one page of a listing. The cursor is opaque and taken from the previous page.
+type PageRequest struct {
+	Sort   RedirectSort
+	Size   int
+	Cursor string
+}
+
+type RedirectPage struct {
+	Redirects  []Redirect
+	NextCursor string
+}
+
+// RedirectFilter narrows down a listing of redirects. Zero values match everything.
+type RedirectFilter struct {
+	Query        string
+	Tag          string
+	CreatedFrom  time.Time
+	CreatedUntil time.Time
+}
+
+// UTMPreset is a reusable set of UTM parameters that gets applied to links on creation.
+type UTMPreset struct {
+	ID        string
+	UserID    string
+	Name      string
+	Source    string
+	Medium    string
+	Campaign  string
+	Term      string
+	Content   string
+	CreatedAt time.Time
+}
+
+// Apply sets the preset's non-empty UTM parameters on the given URL, replacing existing ones.
+func (p UTMPreset) Apply(rawURL string) (string, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	params := map[string]string{
+		"utm_source":   p.Source,
+		"utm_medium":   p.Medium,
+		"utm_campaign": p.Campaign,
+		"utm_term":     p.Term,
+		"utm_content":  p.Content,
+	}
+
+	query := target.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// CampaignStats summarizes the links created for one UTM campaign.
+type CampaignStats struct {
+	Campaign string
+	Links    int
+	Clicks   int
+}
+
+// ImportRecord is one link read from an import file. Without a short code the hasher picks one.
+type ImportRecord struct {
+	Line      int
 	Short     string
 	URL       string
+	Title     string
+	Notes     string
+	Tags      []string
+	Clicks    int
+	CreatedAt time.Time
+	// Problem is set when the row could not be read
+	Problem string
+}
+
+type ImportStatus string
+
+const (
+	ImportCreated  ImportStatus = "created"
+	ImportExisting ImportStatus = "existing"
+	ImportConflict ImportStatus = "conflict"
+	ImportInvalid  ImportStatus = "invalid"
+)
+
+type ImportResult struct {
+	Line    int
+	Short   string
+	URL     string
+	Status  ImportStatus
+	Message string
+}
+
+// ImportReport lists the outcome of every imported row. Rows that already exist with the
+// same destination are reported as existing, which makes an interrupted import resumable.
+type ImportReport struct {
+	Results   []ImportResult
+	Created   int
+	Existing  int
+	Conflicts int
+	Invalid   int
+}
+
+func (r *ImportReport) Add(result ImportResult) {
+	r.Results = append(r.Results, result)
+
+	switch result.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportExisting:
+		r.Existing++
+	case ImportConflict:
+		r.Conflicts++
+	case ImportInvalid:
+		r.Invalid++
+	}
+}
+
+type AuditAction string
+
+const (
+	AuditUserCreate   AuditAction = "user.create"
+	AuditUserRole     AuditAction = "user.role"
+	AuditUserDisable  AuditAction = "user.disable"
+	AuditUserEnable   AuditAction = "user.enable"
+	AuditUserLink     AuditAction = "user.link"
+	AuditUserUnlink   AuditAction = "user.unlink"
+	AuditUserPassword AuditAction = "user.password"
+	AuditUserTwoFA    AuditAction = "user.2fa"
+	AuditUserRecovery AuditAction = "user.recovery"
+	AuditUserDelete   AuditAction = "user.delete"
+	AuditLinkCreate   AuditAction = "link.create"
+	AuditLinkImport   AuditAction = "link.import"
+	AuditLinkUpdate   AuditAction = "link.update"
+	AuditLinkRules    AuditAction = "link.rules"
+	AuditLinkTargets  AuditAction = "link.targets"
+	AuditLinkDelete   AuditAction = "link.delete"
+	AuditLinkRestore  AuditAction = "link.restore"
+	AuditLinkPurge    AuditAction = "link.purge"
+	AuditLinkTransfer AuditAction = "link.transfer"
+	AuditLinkRemove   AuditAction = "link.remove"
+	AuditTrashPurge   AuditAction = "trash.purge"
+	AuditInviteCreate AuditAction = "invite.create"
+	AuditInviteRevoke AuditAction = "invite.revoke"
+	AuditHookCreate   AuditAction = "webhook.create"
+	AuditHookDelete   AuditAction = "webhook.delete"
+)
+
+const (
+	AuditTargetUser   = "user"
+	AuditTargetLink   = "link"
+	AuditTargetTrash  = "trash"
+	AuditTargetInvite = "invite"
+	AuditTargetHook   = "webhook"
+)
+
+// AuditEvent records one change. Events are only ever appended, never updated or removed,
+// except that deleting a user strips their personal data from the events.
+// An empty actor stands for the system itself, e.g. the trash retention.
+type AuditEvent struct {
+	ID         string
+	ActorID    string
+	Action     AuditAction
+	TargetType string
+	TargetID   string
+	Before     json.RawMessage
+	After      json.RawMessage
+	RequestID  string
+	IP         string
+	CreatedAt  time.Time
+}
+
+// AuditFilter narrows down a listing of audit events. Zero values match everything.
+type AuditFilter struct {
+	ActorID    string
+	Action     AuditAction
+	TargetType string
+	TargetID   string
+	Before     time.Time
+	Limit      int
+}
+
+// Session is a server-side login session. The ID is a hash of the token in the session cookie.
+type Session struct {
+	ID         string
+	UserID     string
+	Data       []byte
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Device     string
+	Current    bool
+}
+
+type WebhookEvent string
+
+const (
+	EventLinkCreated WebhookEvent = "link.created"
+	EventLinkDeleted WebhookEvent = "link.deleted"
+	EventLinkClicked WebhookEvent = "link.clicked"
+	// EventPing is only sent by test deliveries, which reach webhooks regardless of their events.
+	EventPing WebhookEvent = "ping"
+)
+
+// WebhookEvents are the events webhooks can subscribe to.
+var WebhookEvents = []WebhookEvent{EventLinkCreated, EventLinkDeleted, EventLinkClicked}
+
+// Webhook receives the events it subscribed to for the links of its user. Payloads are
+// signed with the secret, so receivers can tell they come from us.
+type Webhook struct {
+	ID        string
 	UserID    string
+	URL       string
+	Secret    string
+	Events    []WebhookEvent
 	CreatedAt time.Time
 }
 
+func (w Webhook) Subscribes(event WebhookEvent) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event on its way to a webhook. Pending deliveries form the outbox and
+// are attempted at NextAttemptAt until they run out of attempts. ResponseStatus and Error
+// describe the last attempt.
+type WebhookDelivery struct {
+	ID             string
+	WebhookID      string
+	Event          WebhookEvent
+	Payload        json.RawMessage
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	ResponseStatus int
+	Error          string
+	CreatedAt      time.Time
+	DeliveredAt    time.Time
+}
+
+// Hasher generates the short codes of new links. Generators that do not derive the code from
+// the link may hand out a taken one, which is then generated anew.
 type Hasher interface {
-	Hash(userID string, url string) string
+	Hash(ctx context.Context, userID string, url string) (string, error)
 	Validate(short string) bool
 }
 
 type UsersRepository interface {
+	List(ctx context.Context, query string, limit int) ([]User, error)
+	Get(ctx context.Context, id string) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
 	Save(ctx context.Context, user User) error
-	GetByGoogleID(ctx context.Context, googleID string) (User, error)
+	UpdateRole(ctx context.Context, id string, role Role) error
+	UpdateDisabled(ctx context.Context, id string, disabled bool) error
+	Delete(ctx context.Context, id string) error
+}
+
+type IdentityRepository interface {
+	Get(ctx context.Context, provider string, subject string) (Identity, error)
+	ListByUser(ctx context.Context, userID string) ([]Identity, error)
+	Save(ctx context.Context, identity Identity) error
+	Delete(ctx context.Context, provider string, subject string, userID string) error
+}
+
+type InvitationRepository interface {
+	List(ctx context.Context) ([]Invitation, error)
+	Save(ctx context.Context, invitation Invitation) error
+	Consume(ctx context.Context, email string) (Invitation, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// LocalAccountRepository stores local accounts by their email. Deleting an account deletes
+// its tokens as well.
+type LocalAccountRepository interface {
+	Get(ctx context.Context, email string) (LocalAccount, error)
+	Save(ctx context.Context, account LocalAccount) error
+	Delete(ctx context.Context, email string) error
+}
+
+type AccountTokenRepository interface {
+	Save(ctx context.Context, token AccountToken) error
+	Consume(ctx context.Context, id string, purpose TokenPurpose) (AccountToken, error)
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// TwoFactorRepository stores recovery codes as hashes. UseCounter and UseRecoveryCode
+// return pgx.ErrNoRows when the code was used already.
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID string) (TwoFactor, error)
+	Save(ctx context.Context, twoFactor TwoFactor) error
+	Enable(ctx context.Context, userID string, counter int64, recoveryCodes []string) error
+	UseCounter(ctx context.Context, userID string, counter int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error
+	UseRecoveryCode(ctx context.Context, userID string, recoveryCode string) error
+	CountRecoveryCodes(ctx context.Context, userID string) (int, error)
+	Delete(ctx context.Context, userID string) error
+}
+
+// WebhookRepository stores webhooks and their deliveries. Find is not scoped to a user and
+// only meant for sending deliveries. Claim leases due deliveries until the given time, so
+// concurrent dispatchers do not send them twice.
+type WebhookRepository interface {
+	List(ctx context.Context, userID string) ([]Webhook, error)
+	ListSubscribed(ctx context.Context, userID string, event WebhookEvent) ([]Webhook, error)
+	Get(ctx context.Context, id string, userID string) (Webhook, error)
+	Find(ctx context.Context, id string) (Webhook, error)
+	Save(ctx context.Context, webhook Webhook) error
+	Delete(ctx context.Context, id string, userID string) error
+	Enqueue(ctx context.Context, deliveries []WebhookDelivery) error
+	Claim(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error
+	ListDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDelivery, error)
+	DeleteDeliveriesBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// Mailer sends plain text emails.
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+type UTMPresetRepository interface {
+	List(ctx context.Context, userID string) ([]UTMPreset, error)
+	Get(ctx context.Context, id string, userID string) (UTMPreset, error)
+	Save(ctx context.Context, preset UTMPreset) error
+	Delete(ctx context.Context, id string, userID string) error
+}
+
+type AuditRepository interface {
+	Save(ctx context.Context, event AuditEvent) error
+	List(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+}
+
+type SessionRepository interface {
+	Get(ctx context.Context, id string) (Session, error)
+	Save(ctx context.Context, session Session) error
+	Touch(ctx context.Context, id string, lastSeen time.Time, ip string) error
+	Delete(ctx context.Context, id string) error
+	ListByUser(ctx context.Context, userID string) ([]Session, error)
+	DeleteForUser(ctx context.Context, id string, userID string) error
+	DeleteAllForUser(ctx context.Context, userID string) (int, error)
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+type ShortCodeSequence interface {
+	Next(ctx context.Context) (int64, error)
 }
 
 type RedirectRepository interface {
-	List(ctx context.Context, userID string) ([]Redirect, error)
-	GetRedirectByShort(ctx context.Context, short string, userID string) (Redirect, error)
+	List(ctx context.Context, userID string, filter RedirectFilter, sort RedirectSort, after *RedirectCursor, limit int) ([]Redirect, error)
+	ListAll(ctx context.Context, ownerID string, query string, after *RedirectCursor, limit int) ([]Redirect, error)
+	Tags(ctx context.Context, userID string) ([]string, error)
+	Campaigns(ctx context.Context, userID string) ([]CampaignStats, error)
+	GetRedirectByShort(ctx context.Context, domain string, short string, userID string) (Redirect, error)
+	Lookup(ctx context.Context, domain string, short string) (Redirect, error)
 	Save(ctx context.Context, redirect Redirect) error
-	Expand(ctx context.Context, short string) (string, error)
-	Delete(ctx context.Context, short string, userID string) error
+	Import(ctx context.Context, redirects []Redirect) ([]bool, error)
+	UpdateDetails(ctx context.Context, domain string, short string, userID string, details RedirectDetails) error
+	UpdateRules(ctx context.Context, domain string, short string, userID string, rules []TargetingRule) error
+	UpdateTargets(ctx context.Context, domain string, short string, userID string, targets []WeightedTarget) error
+	CountVariantClick(ctx context.Context, domain string, short string, variant int) error
+	VariantClicks(ctx context.Context, domain string, short string) (map[int]int, error)
+	Expand(ctx context.Context, domain string, short string) (Redirect, error)
+	Delete(ctx context.Context, domain string, short string, userID string) error
+	Trash(ctx context.Context, userID string) ([]Redirect, error)
+	Restore(ctx context.Context, domain string, short string, userID string) error
+	Purge(ctx context.Context, domain string, short string, userID string) error
+	PurgeTrashedBefore(ctx context.Context, before time.Time) (int, error)
+	Transfer(ctx context.Context, domain string, short string, userID string) error
+	TransferAll(ctx context.Context, fromUserID string, toUserID string) ([]string, error)
+	Remove(ctx context.Context, domain string, short string) error
 }
 
 type UrlShortenerService interface {
-	List(ctx context.Context, userID string) ([]Redirect, error)
-	GetRedirectByShort(ctx context.Context, short string, userID string) (Redirect, error)
-	ShortenURL(ctx context.Context, url string, userID string) (Redirect, error)
-	ExpandShortURL(ctx context.Context, short string) (string, error)
-	DeleteShortURL(ctx context.Context, short string, userID string) error
+	List(ctx context.Context, userID string, filter RedirectFilter, page PageRequest) (RedirectPage, error)
+	ListAll(ctx context.Context, ownerID string, query string, page PageRequest) (RedirectPage, error)
+	Tags(ctx context.Context, userID string) ([]string, error)
+	Campaigns(ctx context.Context, userID string) ([]CampaignStats, error)
+	GetRedirectByShort(ctx context.Context, domain string, short string, userID string) (Redirect, error)
+	LookupShortURL(ctx context.Context, domain string, short string) (Redirect, error)
+	ShortenURL(ctx context.Context, url string, userID string, options RedirectOptions) (Redirect, error)
+	Import(ctx context.Context, userID string, records []ImportRecord) (ImportReport, error)
+	Export(ctx context.Context, userID string, fn func(Redirect) error) error
+	UnlockShortURL(ctx context.Context, domain string, short string, password string) error
+	UpdateDetails(ctx context.Context, domain string, short string, userID string, details RedirectDetails) error
+	UpdateRules(ctx context.Context, domain string, short string, userID string, rules []TargetingRule) error
+	UpdateTargets(ctx context.Context, domain string, short string, userID string, targets []WeightedTarget) error
+	VariantStats(ctx context.Context, domain string, short string, userID string) ([]VariantStats, error)
+	ExpandShortURL(ctx context.Context, domain string, short string, visit Visit) (string, error)
+	DeleteShortURL(ctx context.Context, domain string, short string, userID string) error
+	Trash(ctx context.Context, userID string) ([]Redirect, error)
+	RestoreShortURL(ctx context.Context, domain string, short string, userID string) error
+	PurgeShortURL(ctx context.Context, domain string, short string, userID string) error
+	PurgeExpiredTrash(ctx context.Context, retention time.Duration) (int, error)
+	TransferShortURL(ctx context.Context, domain string, short string, userID string) error
+	TransferAll(ctx context.Context, fromUserID string, toUserID string) (int, error)
+	RemoveShortURL(ctx context.Context, domain string, short string) error
+}
+
+// AuditService records changes. Actor, request ID and IP are taken from the context.
+type AuditService interface {
+	Record(ctx context.Context, action AuditAction, targetType string, targetID string, before any, after any) error
+	List(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
 }
 
 type UsersService interface {
-	CreateWithGoogleID(ctx context.Context, googleID string, email string) (User, error)
-	GetOrCreateByGoogle(ctx context.Context, googleID string, email string) (User, error)
+	List(ctx context.Context, query string) ([]User, error)
+	Get(ctx context.Context, id string) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
+	SignIn(ctx context.Context, identity Identity) (User, error)
+	Identities(ctx context.Context, userID string) ([]Identity, error)
+	Link(ctx context.Context, userID string, identity Identity) error
+	Unlink(ctx context.Context, userID string, provider string, subject string) error
+	SetDisabled(ctx context.Context, id string, disabled bool) error
+	Delete(ctx context.Context, id string) error
+}
+
+// PrivacyService lets users download everything stored about them and delete their account.
+// Before deleting, the links can be handed over to an heir, otherwise they are deleted as well.
+type PrivacyService interface {
+	Export(ctx context.Context, userID string, w io.Writer) error
+	DeleteAccount(ctx context.Context, userID string, heirEmail string) error
+}
+
+// InvitationService lets administrators invite people to sign up. The inviting
+// administrator is taken from the context.
+type InvitationService interface {
+	Invitations(ctx context.Context) ([]Invitation, error)
+	Invite(ctx context.Context, email string) (Invitation, error)
+	RevokeInvitation(ctx context.Context, id string) error
+}
+
+// SessionService lets users see and revoke their sessions. The token is the one of the
+// session making the request, so it can be marked as current.
+type SessionService interface {
+	List(ctx context.Context, userID string, token string) ([]Session, error)
+	Revoke(ctx context.Context, id string, userID string) error
+	RevokeAll(ctx context.Context, userID string) (int, error)
+}
+
+type AccountService interface {
+	Register(ctx context.Context, email string, password string) (User, error)
+	Login(ctx context.Context, email string, password string) (User, error)
+	ResendVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, password string) error
+}
+
+// TwoFactorService manages TOTP two-factor authentication. Enabling takes a code from the
+// authenticator app, everything else accepts a recovery code as well, which works only once.
+type TwoFactorService interface {
+	Status(ctx context.Context, userID string) (TwoFactorStatus, error)
+	Enroll(ctx context.Context, user User) (TwoFactorEnrollment, error)
+	Enable(ctx context.Context, userID string, code string) ([]string, error)
+	Verify(ctx context.Context, userID string, code string) error
+	Disable(ctx context.Context, userID string, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID string, code string) ([]string, error)
+}
+
+// WebhookPublisher queues an event for the webhooks of the user who owns the link.
+type WebhookPublisher interface {
+	Publish(ctx context.Context, userID string, event WebhookEvent, data any) error
+}
+
+type WebhookService interface {
+	WebhookPublisher
+	List(ctx context.Context, userID string) ([]Webhook, error)
+	Get(ctx context.Context, id string, userID string) (Webhook, error)
+	Create(ctx context.Context, userID string, url string, events []WebhookEvent) (Webhook, error)
+	Delete(ctx context.Context, id string, userID string) error
+	Deliveries(ctx context.Context, id string, userID string) ([]WebhookDelivery, error)
+	Test(ctx context.Context, id string, userID string) (WebhookDelivery, error)
+}
+
+type UTMPresetService interface {
+	List(ctx context.Context, userID string) ([]UTMPreset, error)
+	Get(ctx context.Context, id string, userID string) (UTMPreset, error)
+	Create(ctx context.Context, preset UTMPreset) (UTMPreset, error)
+	Delete(ctx context.Context, id string, userID string) error
 }
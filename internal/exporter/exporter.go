@@ -0,0 +1,153 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pscheid92/dwarferl/internal"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(value)) {
+	case CSV, "":
+		return CSV, nil
+	case JSON:
+		return JSON, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q", value)
+	}
+}
+
+func (f Format) ContentType() string {
+	if f == JSON {
+		return "application/json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Writer writes redirects one at a time, so an export never has to be held in memory.
+type Writer interface {
+	Write(redirect internal.Redirect) error
+	Close() error
+}
+
+func NewWriter(w io.Writer, format Format) Writer {
+	if format == JSON {
+		return &jsonWriter{w: w}
+	}
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// the columns match what the importer understands, so exports can be imported again
+var csvHeader = []string{"short", "url", "title", "notes", "tags", "clicks", "created_at"}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvWriter) Write(redirect internal.Redirect) error {
+	if !c.headerWritten {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	row := []string{
+		redirect.Short,
+		redirect.URL,
+		redirect.Title,
+		redirect.Notes,
+		strings.Join(redirect.Tags, ","),
+		strconv.Itoa(redirect.Clicks),
+		redirect.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+
+	// hand every row to the client right away instead of buffering
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	if !c.headerWritten {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonRedirect struct {
+	Short     string    `json:"short"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Notes     string    `json:"notes"`
+	Tags      []string  `json:"tags"`
+	Clicks    int       `json:"clicks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// jsonWriter streams a JSON array element by element.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonWriter) Write(redirect internal.Redirect) error {
+	separator := ",\n"
+	if j.count == 0 {
+		separator = "[\n"
+	}
+
+	tags := redirect.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	encoded, err := json.Marshal(jsonRedirect{
+		Short:     redirect.Short,
+		URL:       redirect.URL,
+		Title:     redirect.Title,
+		Notes:     redirect.Notes,
+		Tags:      tags,
+		Clicks:    redirect.Clicks,
+		CreatedAt: redirect.CreatedAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(j.w, separator); err != nil {
+		return err
+	}
+	if _, err := j.w.Write(encoded); err != nil {
+		return err
+	}
+	j.count++
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	closing := "\n]\n"
+	if j.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
@@ -0,0 +1,80 @@
+package exporter
+
+import (
+	"encoding/json"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/importer"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRedirects = []internal.Redirect{
+	{Short: "abc123", URL: "https://example.com", Title: "Example, Inc.", Tags: []string{"docs", "q3"}, Clicks: 42, CreatedAt: time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)},
+	{Short: "def456", URL: "https://example.org", CreatedAt: time.Date(2022, 8, 2, 10, 0, 0, 0, time.UTC)},
+}
+
+func TestParseFormat(t *testing.T) {
+	tt := []struct {
+		value    string
+		expected Format
+		valid    bool
+	}{
+		{"", CSV, true},
+		{"csv", CSV, true},
+		{"JSON", JSON, true},
+		{"xml", "", false},
+	}
+
+	for _, c := range tt {
+		result, err := ParseFormat(c.value)
+		assert.Equalf(t, c.valid, err == nil, "%q: expected valid=%v, got error %v", c.value, c.valid, err)
+		assert.Equalf(t, c.expected, result, "%q: expected %s, got %s", c.value, c.expected, result)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var out strings.Builder
+	w := NewWriter(&out, CSV)
+	for _, r := range testRedirects {
+		assert.NoErrorf(t, w.Write(r), "Expected no error")
+	}
+	assert.NoErrorf(t, w.Close(), "Expected no error")
+
+	// an export can be imported again
+	records, err := importer.Parse(strings.NewReader(out.String()))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, records, 2, "Expected two records, got %d", len(records))
+	assert.Equalf(t, "abc123", records[0].Short, "Expected short abc123, got %s", records[0].Short)
+	assert.Equalf(t, "Example, Inc.", records[0].Title, "Expected title to survive quoting, got %s", records[0].Title)
+	assert.Equalf(t, []string{"docs", "q3"}, records[0].Tags, "Expected tags, got %v", records[0].Tags)
+	assert.Equalf(t, 42, records[0].Clicks, "Expected 42 clicks, got %d", records[0].Clicks)
+	assert.Equalf(t, testRedirects[0].CreatedAt, records[0].CreatedAt, "Expected creation date, got %v", records[0].CreatedAt)
+
+	out.Reset()
+	w = NewWriter(&out, CSV)
+	assert.NoErrorf(t, w.Close(), "Expected no error")
+	assert.Equalf(t, "short,url,title,notes,tags,clicks,created_at\n", out.String(), "Expected only header, got %s", out.String())
+}
+
+func TestJSONWriter(t *testing.T) {
+	var out strings.Builder
+	w := NewWriter(&out, JSON)
+	for _, r := range testRedirects {
+		assert.NoErrorf(t, w.Write(r), "Expected no error")
+	}
+	assert.NoErrorf(t, w.Close(), "Expected no error")
+
+	var decoded []jsonRedirect
+	err := json.Unmarshal([]byte(out.String()), &decoded)
+	assert.NoErrorf(t, err, "Expected valid json, got %v", err)
+	assert.Lenf(t, decoded, 2, "Expected two entries, got %d", len(decoded))
+	assert.Equalf(t, 42, decoded[0].Clicks, "Expected 42 clicks, got %d", decoded[0].Clicks)
+	assert.Equalf(t, []string{}, decoded[1].Tags, "Expected empty tags list, got %v", decoded[1].Tags)
+
+	out.Reset()
+	w = NewWriter(&out, JSON)
+	assert.NoErrorf(t, w.Close(), "Expected no error")
+	assert.Equalf(t, "[]\n", out.String(), "Expected empty array, got %s", out.String())
+}
@@ -1,11 +1,19 @@
 package hasher
 
 import (
+	"context"
 	"github.com/jxskiss/base62"
 	"hash/fnv"
 	"regexp"
 )
 
+const (
+	Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// UnambiguousAlphabet leaves out the characters easily mistaken for one another: 0, O, l and 1.
+	UnambiguousAlphabet = "23456789ABCDEFGHIJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+)
+
 type UrlHasher struct {
 	regex *regexp.Regexp
 }
@@ -14,12 +22,12 @@ func NewUrlHasher() UrlHasher {
 	return UrlHasher{regex: regexp.MustCompile(`^[A-Za-z\d]{6}$`)}
 }
 
-func (UrlHasher) Hash(userID string, url string) string {
+func (UrlHasher) Hash(_ context.Context, userID string, url string) (string, error) {
 	hash := fnv.New32a()
 	_, _ = hash.Write([]byte(url))
 	_, _ = hash.Write([]byte(userID))
 	hashed := hash.Sum([]byte{})
-	return base62.EncodeToString(hashed)
+	return base62.EncodeToString(hashed), nil
 }
 
 func (h UrlHasher) Validate(short string) bool {
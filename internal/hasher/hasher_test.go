@@ -1,7 +1,10 @@
 package hasher
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -26,7 +29,8 @@ func TestUrlHasher_Hash(t *testing.T) {
 	hasher := NewUrlHasher()
 
 	for _, c := range tt {
-		result := hasher.Hash(c.userID, c.url)
+		result, err := hasher.Hash(context.Background(), c.userID, c.url)
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
 		assert.Equalf(t, c.short, result, "hash of (%v, %s) should be %s, but is %s", c.userID, c.url, c.short, result)
 	}
 }
@@ -51,3 +55,92 @@ func TestUrlHasher_Validate(t *testing.T) {
 		assert.Equalf(t, c.expected, result, "validation of '%v' should be %t, but is %t", c.short, c.expected, result)
 	}
 }
+
+func TestRandomHasher(t *testing.T) {
+	hasher := NewRandomHasher(UnambiguousAlphabet, 10)
+
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		short, err := hasher.Hash(context.Background(), "", "")
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Lenf(t, short, 10, "code %s should have 10 characters", short)
+		assert.Falsef(t, strings.ContainsAny(short, "0Ol1"), "code %s should not contain ambiguous characters", short)
+		assert.Truef(t, hasher.Validate(short), "code %s should be valid", short)
+		assert.Falsef(t, seen[short], "code %s should not repeat", short)
+		seen[short] = true
+	}
+
+	assert.Falsef(t, hasher.Validate("abcdefghi"), "shorter codes should be invalid")
+	assert.Falsef(t, hasher.Validate("abcdefghi0"), "codes with ambiguous characters should be invalid")
+}
+
+func TestSequenceHasher(t *testing.T) {
+	sequence := &sequenceFake{}
+	hasher := NewSequenceHasher(sequence, Base62Alphabet, "salt", 4)
+
+	seen := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		short, err := hasher.Hash(context.Background(), "", "")
+		assert.NoErrorf(t, err, "unexpected error: %v", err)
+		assert.Lenf(t, short, 4, "code %s should have 4 characters", short)
+		assert.Truef(t, hasher.Validate(short), "code %s should be valid", short)
+		assert.Falsef(t, seen[short], "code %s should not repeat", short)
+		seen[short] = true
+	}
+
+	// numbers beyond the codes of the configured length get longer codes
+	long := hasher.encode(62 * 62 * 62 * 62)
+	assert.Lenf(t, long, 5, "code %s should have 5 characters", long)
+	assert.Truef(t, hasher.Validate(long), "code %s should be valid", long)
+
+	other := NewSequenceHasher(sequence, Base62Alphabet, "pepper", 4)
+	assert.NotEqualf(t, hasher.encode(1), other.encode(1), "codes should depend on the salt")
+	assert.Equalf(t, hasher.encode(1), NewSequenceHasher(sequence, Base62Alphabet, "salt", 4).encode(1), "codes should be stable for the same salt")
+
+	sequence.FailMode = true
+	_, err := hasher.Hash(context.Background(), "", "")
+	assert.Errorf(t, err, "expected error of the sequence")
+}
+
+func TestWordHasher(t *testing.T) {
+	hasher := NewWordHasher(3)
+
+	short, err := hasher.Hash(context.Background(), "", "")
+	assert.NoErrorf(t, err, "unexpected error: %v", err)
+	assert.Lenf(t, strings.Split(short, "-"), 3, "code %s should have 3 words", short)
+	assert.Truef(t, hasher.Validate(short), "code %s should be valid", short)
+
+	tt := []struct {
+		short    string
+		expected bool
+	}{
+		{"maple-otter-quilt", true},
+		{"maple-otter", false},
+		{"maple-otter-quilt-zebra", false},
+		{"maple-otter-unknown", false},
+		{"Maple-Otter-Quilt", false},
+		{"", false},
+	}
+
+	for _, c := range tt {
+		result := hasher.Validate(c.short)
+		assert.Equalf(t, c.expected, result, "validation of '%v' should be %t, but is %t", c.short, c.expected, result)
+	}
+
+	assert.Lenf(t, wordSet, len(wordList), "words should not repeat")
+}
+
+type sequenceFake struct {
+	next     int64
+	FailMode bool
+}
+
+func (s *sequenceFake) Next(context.Context) (int64, error) {
+	if s.FailMode {
+		return 0, errors.New("fake error")
+	}
+
+	n := s.next
+	s.next++
+	return n, nil
+}
@@ -0,0 +1,48 @@
+package hasher
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+// RandomHasher hands out cryptographically random codes of a fixed length.
+type RandomHasher struct {
+	alphabet string
+	length   int
+	regex    *regexp.Regexp
+}
+
+func NewRandomHasher(alphabet string, length int) RandomHasher {
+	return RandomHasher{
+		alphabet: alphabet,
+		length:   length,
+		regex:    regexp.MustCompile(fmt.Sprintf(`^[%s]{%d}$`, alphabet, length)),
+	}
+}
+
+func (h RandomHasher) Hash(context.Context, string, string) (string, error) {
+	code := make([]byte, h.length)
+	for i := range code {
+		n, err := randomInt(len(h.alphabet))
+		if err != nil {
+			return "", err
+		}
+		code[i] = h.alphabet[n]
+	}
+	return string(code), nil
+}
+
+func (h RandomHasher) Validate(short string) bool {
+	return h.regex.MatchString(short)
+}
+
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
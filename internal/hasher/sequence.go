@@ -0,0 +1,81 @@
+package hasher
+
+import (
+	"context"
+	"fmt"
+	"github.com/pscheid92/dwarferl/internal"
+	"hash/fnv"
+	"math/bits"
+	"math/rand"
+	"regexp"
+)
+
+// spreadFactor scatters consecutive numbers over all codes of the configured length. Being a
+// prime larger than every alphabet, it is coprime to their size, which keeps codes unique.
+const spreadFactor = 1_000_000_007
+
+// SequenceHasher numbers the links with a database sequence and encodes the number with an
+// alphabet shuffled by a salt, like sqids. Codes never collide, but they only hide the order
+// of the links from those not knowing the salt.
+type SequenceHasher struct {
+	sequence internal.ShortCodeSequence
+	alphabet string
+	length   int
+	space    uint64
+	offset   uint64
+	regex    *regexp.Regexp
+}
+
+func NewSequenceHasher(sequence internal.ShortCodeSequence, alphabet string, salt string, length int) SequenceHasher {
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		space *= uint64(len(alphabet))
+	}
+
+	seed := fnv.New64a()
+	_, _ = seed.Write([]byte(salt))
+	sum := seed.Sum64()
+
+	shuffled := []byte(alphabet)
+	random := rand.New(rand.NewSource(int64(sum)))
+	random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	return SequenceHasher{
+		sequence: sequence,
+		alphabet: string(shuffled),
+		length:   length,
+		space:    space,
+		offset:   sum % space,
+		regex:    regexp.MustCompile(fmt.Sprintf(`^[%s]{%d,}$`, alphabet, length)),
+	}
+}
+
+func (h SequenceHasher) Hash(ctx context.Context, _ string, _ string) (string, error) {
+	n, err := h.sequence.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	return h.encode(uint64(n)), nil
+}
+
+// encode turns the number into a code of the configured length. Numbers beyond the codes of
+// that length get longer codes.
+func (h SequenceHasher) encode(n uint64) string {
+	if n < h.space {
+		hi, lo := bits.Mul64(n, spreadFactor)
+		_, n = bits.Div64(hi, lo, h.space)
+		n = (n + h.offset) % h.space
+	}
+
+	base := uint64(len(h.alphabet))
+	var code []byte
+	for len(code) < h.length || n > 0 {
+		code = append(code, h.alphabet[n%base])
+		n /= base
+	}
+	return string(code)
+}
+
+func (h SequenceHasher) Validate(short string) bool {
+	return h.regex.MatchString(short)
+}
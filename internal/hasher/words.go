@@ -0,0 +1,78 @@
+package hasher
+
+import (
+	"context"
+	"strings"
+)
+
+// wordList holds 256 short, distinct words, so every word of a code adds 8 bits.
+var wordList = []string{
+	"arch", "atom", "aunt", "baby", "back", "bake", "ball", "band", "bank", "barn", "base", "bath",
+	"bead", "beam", "bean", "bear", "beef", "bell", "belt", "bench", "berry", "bike", "bird",
+	"blue", "boat", "body", "bold", "bolt", "bone", "book", "boot", "brave", "bread", "brick",
+	"bride", "brook", "brush", "cabin", "cake", "calm", "camel", "camp", "candy", "cape", "card",
+	"cart", "cave", "cedar", "chalk", "charm", "chef", "chess", "chip", "city", "clay", "cliff",
+	"clock", "cloud", "coast", "coin", "comet", "coral", "corn", "couch", "crane", "creek",
+	"crisp", "crown", "cube", "curl", "daisy", "dance", "dawn", "deer", "desk", "dice", "dish",
+	"dove", "drum", "duck", "dune", "eagle", "earth", "echo", "elbow", "elm", "ember", "fable",
+	"fair", "fancy", "farm", "feast", "fern", "field", "fig", "film", "fish", "flag", "flute",
+	"foam", "fold", "forest", "fox", "frog", "frost", "fruit", "game", "gate", "gecko", "gem",
+	"giant", "glad", "glove", "goat", "gold", "grape", "grass", "gull", "hall", "harbor", "hare",
+	"hawk", "hazel", "heart", "hill", "honey", "hook", "horse", "house", "ice", "iron", "ivory",
+	"jade", "jam", "jelly", "jet", "juice", "kale", "kayak", "kettle", "key", "king", "kite",
+	"kiwi", "knot", "lake", "lamp", "lark", "lava", "leaf", "lemon", "lilac", "lily", "lime",
+	"lion", "lunar", "lynx", "magic", "mango", "maple", "mask", "meadow", "melon", "mint", "moon",
+	"moss", "moth", "mouse", "music", "nest", "noble", "north", "novel", "oak", "oasis", "ocean",
+	"olive", "onion", "opal", "orbit", "otter", "owl", "paint", "palm", "panda", "paper", "park",
+	"peach", "pearl", "pepper", "piano", "pilot", "pine", "plum", "polar", "pond", "pony", "quail",
+	"quiet", "quilt", "rabbit", "radio", "rain", "raven", "reef", "ridge", "river", "robin",
+	"rocket", "rose", "ruby", "sage", "sail", "salt", "sand", "scarf", "seal", "shell", "silk",
+	"sky", "snow", "solar", "spark", "spice", "star", "stone", "storm", "sugar", "sun", "swan",
+	"table", "tiger", "toast", "topaz", "tower", "train", "tulip", "tuna", "urban", "valley",
+	"velvet", "violet", "wagon", "walnut", "wave", "whale", "wheat", "willow", "wind", "wolf",
+	"wood", "yak", "yarn", "yellow", "zebra", "zinc",
+}
+
+var wordSet = func() map[string]bool {
+	set := make(map[string]bool, len(wordList))
+	for _, word := range wordList {
+		set[word] = true
+	}
+	return set
+}()
+
+// WordHasher hands out codes of random words joined by dashes, e.g. maple-otter-quilt,
+// which are easy to read out and type.
+type WordHasher struct {
+	words int
+}
+
+func NewWordHasher(words int) WordHasher {
+	return WordHasher{words: words}
+}
+
+func (h WordHasher) Hash(context.Context, string, string) (string, error) {
+	code := make([]string, h.words)
+	for i := range code {
+		n, err := randomInt(len(wordList))
+		if err != nil {
+			return "", err
+		}
+		code[i] = wordList[n]
+	}
+	return strings.Join(code, "-"), nil
+}
+
+func (h WordHasher) Validate(short string) bool {
+	words := strings.Split(short, "-")
+	if len(words) != h.words {
+		return false
+	}
+
+	for _, word := range words {
+		if !wordSet[word] {
+			return false
+		}
+	}
+	return true
+}
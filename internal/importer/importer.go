@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/pscheid92/dwarferl/internal"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columnAliases maps the headers used by dwarferl, YOURLS and Bitly exports to our fields.
+var columnAliases = map[string]string{
+	"short":        "short",
+	"keyword":      "short",
+	"bitlink":      "short",
+	"link":         "short",
+	"custom_link":  "short",
+	"url":          "url",
+	"long_url":     "url",
+	"destination":  "url",
+	"title":        "title",
+	"notes":        "notes",
+	"tags":         "tags",
+	"clicks":       "clicks",
+	"total_clicks": "clicks",
+	"created_at":   "created_at",
+	"created":      "created_at",
+	"timestamp":    "created_at",
+	"date":         "created_at",
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Parse reads links from a CSV file with a header row. Rows that cannot be read are returned
+// with their problem set, so they show up in the import report.
+func Parse(r io.Reader) ([]internal.ImportRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.ReplaceAll(name, " ", "_")
+		if field, ok := columnAliases[name]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("no url column found")
+	}
+
+	var records []internal.ImportRecord
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			records = append(records, internal.ImportRecord{Line: line, Problem: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, parseRow(line, row, columns))
+	}
+
+	return records, nil
+}
+
+func parseRow(line int, row []string, columns map[string]int) internal.ImportRecord {
+	get := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	record := internal.ImportRecord{
+		Line:  line,
+		Short: shortFromLink(get("short")),
+		URL:   get("url"),
+		Title: get("title"),
+		Notes: get("notes"),
+	}
+
+	if tags := get("tags"); tags != "" {
+		record.Tags = strings.Split(tags, ",")
+	}
+
+	if clicks := get("clicks"); clicks != "" {
+		n, err := strconv.Atoi(clicks)
+		if err != nil {
+			record.Problem = fmt.Sprintf("invalid clicks %q", clicks)
+			return record
+		}
+		record.Clicks = n
+	}
+
+	if created := get("created_at"); created != "" {
+		t, err := parseTime(created)
+		if err != nil {
+			record.Problem = fmt.Sprintf("invalid creation date %q", created)
+			return record
+		}
+		record.CreatedAt = t
+	}
+
+	return record
+}
+
+// shortFromLink turns full short links like Bitly's "bit.ly/3xYz" into their code.
+func shortFromLink(value string) string {
+	if !strings.Contains(value, "/") {
+		return value
+	}
+
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return value
+	}
+	return strings.Trim(parsed.Path, "/")
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	// unix timestamps in seconds
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Time{}, errors.New("unknown time format")
+}
@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("dwarferl export", func(t *testing.T) {
+		file := "short,url,title,tags,created_at\n" +
+			"abc123,https://example.com,Example,\"docs, q3\",2022-08-01T10:00:00Z\n" +
+			",https://example.org,,,\n"
+
+		records, err := Parse(strings.NewReader(file))
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+		assert.Lenf(t, records, 2, "Expected two records, got %d", len(records))
+
+		assert.Equalf(t, "abc123", records[0].Short, "Expected short abc123, got %s", records[0].Short)
+		assert.Equalf(t, []string{"docs", " q3"}, records[0].Tags, "Expected two tags, got %v", records[0].Tags)
+		assert.Equalf(t, time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC), records[0].CreatedAt, "Expected creation date, got %v", records[0].CreatedAt)
+		assert.Equalf(t, 3, records[1].Line, "Expected line 3, got %d", records[1].Line)
+		assert.Emptyf(t, records[1].Short, "Expected no short, got %s", records[1].Short)
+	})
+
+	t.Run("yourls export", func(t *testing.T) {
+		file := "keyword,url,title,timestamp,ip,clicks\n" +
+			"docs,https://example.com/docs,Docs,2021-03-04 05:06:07,127.0.0.1,42\n" +
+			"broken,https://example.com,Broken,yesterday,127.0.0.1,1\n"
+
+		records, err := Parse(strings.NewReader(file))
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+		assert.Equalf(t, "docs", records[0].Short, "Expected short docs, got %s", records[0].Short)
+		assert.Equalf(t, 42, records[0].Clicks, "Expected 42 clicks, got %d", records[0].Clicks)
+		assert.Emptyf(t, records[0].Problem, "Expected no problem, got %s", records[0].Problem)
+		assert.Containsf(t, records[1].Problem, "creation date", "Expected invalid date, got %s", records[1].Problem)
+	})
+
+	t.Run("bitly export", func(t *testing.T) {
+		file := "\ufeffTitle,Bitlink,Long URL,Created,Total Clicks\n" +
+			"Launch,bit.ly/3xYzAbc,https://example.com/launch,2021-03-04T10:11:12+0000,7\n" +
+			"Custom,https://bit.ly/spring-sale,https://example.com/sale,1614852672,1\n"
+
+		records, err := Parse(strings.NewReader(file))
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+		assert.Equalf(t, "3xYzAbc", records[0].Short, "Expected short 3xYzAbc, got %s", records[0].Short)
+		assert.Equalf(t, "https://example.com/launch", records[0].URL, "Expected long url, got %s", records[0].URL)
+		assert.Equalf(t, "Launch", records[0].Title, "Expected title Launch, got %s", records[0].Title)
+		assert.Equalf(t, "spring-sale", records[1].Short, "Expected short spring-sale, got %s", records[1].Short)
+		assert.Equalf(t, int64(1614852672), records[1].CreatedAt.Unix(), "Expected unix timestamp, got %v", records[1].CreatedAt)
+	})
+
+	t.Run("malformed rows are reported", func(t *testing.T) {
+		file := "short,url\n\"abc,https://example.com\n"
+
+		records, err := Parse(strings.NewReader(file))
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+		assert.Lenf(t, records, 1, "Expected one record, got %d", len(records))
+		assert.NotEmptyf(t, records[0].Problem, "Expected problem to be set")
+	})
+
+	t.Run("files without url column are rejected", func(t *testing.T) {
+		_, err := Parse(strings.NewReader("short,title\nabc,Example\n"))
+		assert.Errorf(t, err, "Expected error, got nil")
+
+		_, err = Parse(strings.NewReader(""))
+		assert.Errorf(t, err, "Expected error, got nil")
+	})
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTPMailer sends emails through an SMTP server. Authentication is optional; net/smtp
+// upgrades to TLS when the server offers STARTTLS.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port int, username string, password string, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{addr: net.JoinHostPort(host, strconv.Itoa(port)), auth: auth, from: from}
+}
+
+func (m *SMTPMailer) Send(_ context.Context, to string, subject string, body string) error {
+	msg, err := compose(m.from, to, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, msg)
+}
+
+// keptMessages bounds the memory of a LogMailer that runs for a long time.
+const keptMessages = 100
+
+// LogMailer only logs emails and keeps the latest ones for inspection. It is meant for development and tests.
+type LogMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(_ context.Context, to string, subject string, body string) error {
+	if err := checkHeader(to, subject); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, Message{To: to, Subject: subject, Body: body})
+	if len(m.messages) > keptMessages {
+		m.messages = m.messages[len(m.messages)-keptMessages:]
+	}
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+func (m *LogMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func compose(from string, to string, subject string, body string, date time.Time) ([]byte, error) {
+	if err := checkHeader(from, to, subject); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
+
+// checkHeader refuses line breaks, which would allow injecting headers.
+func checkHeader(values ...string) error {
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return errors.New("line break in mail header")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompose(t *testing.T) {
+	date := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	msg, err := compose("dwarferl@example.com", "user@example.com", "Verify your email", "Hello\nWorld", date)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	text := string(msg)
+	assert.Containsf(t, text, "To: user@example.com\r\n", "Expected recipient header, got %q", text)
+	assert.Containsf(t, text, "Date: Sat, 01 Oct 2022 12:00:00 +0000\r\n", "Expected date header, got %q", text)
+	assert.Truef(t, strings.HasSuffix(text, "\r\n\r\nHello\r\nWorld"), "Expected body with CRLF line endings, got %q", text)
+
+	_, err = compose("dwarferl@example.com", "user@example.com\r\nBcc: victim@example.com", "Hi", "", date)
+	assert.Errorf(t, err, "Expected error for header injection, got nil")
+}
+
+func TestLogMailer(t *testing.T) {
+	sut := NewLogMailer()
+
+	err := sut.Send(context.Background(), "user@example.com", "Reset your password", "body")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	messages := sut.Messages()
+	assert.Lenf(t, messages, 1, "Expected one message, got %d", len(messages))
+	assert.Equalf(t, "Reset your password", messages[0].Subject, "Expected subject, got %v", messages[0].Subject)
+
+	err = sut.Send(context.Background(), "user@example.com", "Hi\nBcc: victim@example.com", "body")
+	assert.Errorf(t, err, "Expected error for header injection, got nil")
+}
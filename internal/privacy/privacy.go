@@ -0,0 +1,258 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"io"
+	"strings"
+	"time"
+)
+
+type Service struct {
+	users     internal.UsersService
+	shortener internal.UrlShortenerService
+	presets   internal.UTMPresetService
+}
+
+func NewService(users internal.UsersService, shortener internal.UrlShortenerService, presets internal.UTMPresetService) *Service {
+	return &Service{users: users, shortener: shortener, presets: presets}
+}
+
+type profile struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Identities []identity `json:"identities"`
+}
+
+type identity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type link struct {
+	Domain            string                    `json:"domain,omitempty"`
+	Short             string                    `json:"short"`
+	URL               string                    `json:"url"`
+	Title             string                    `json:"title"`
+	Notes             string                    `json:"notes"`
+	Tags              []string                  `json:"tags"`
+	PasswordProtected bool                      `json:"password_protected"`
+	MaxClicks         int                       `json:"max_clicks"`
+	ForcePreview      bool                      `json:"force_preview"`
+	Passthrough       internal.Passthrough      `json:"passthrough"`
+	UTMCampaign       string                    `json:"utm_campaign"`
+	Rules             []internal.TargetingRule  `json:"rules"`
+	Targets           []internal.WeightedTarget `json:"targets"`
+	CreatedAt         time.Time                 `json:"created_at"`
+	DeletedAt         *time.Time                `json:"deleted_at,omitempty"`
+}
+
+type linkClicks struct {
+	Domain   string          `json:"domain,omitempty"`
+	Short    string          `json:"short"`
+	Clicks   int             `json:"clicks"`
+	Variants []variantClicks `json:"variants,omitempty"`
+}
+
+type variantClicks struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	Clicks int    `json:"clicks"`
+}
+
+type preset struct {
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	Medium    string    `json:"medium"`
+	Campaign  string    `json:"campaign"`
+	Term      string    `json:"term"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Export writes a ZIP archive with one JSON file each for the profile, the links including
+// the trash, their click statistics and the UTM presets.
+func (s *Service) Export(ctx context.Context, userID string, w io.Writer) error {
+	profile, err := s.profile(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	links, clicks, err := s.links(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	presets, err := s.userPresets(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// gather everything first, so a failure does not leave a truncated archive behind
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", profile},
+		{"links.json", links},
+		{"clicks.json", clicks},
+		{"utm_presets.json", presets},
+	}
+	for _, file := range files {
+		if err := writeJSON(archive, file.name, file.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (s *Service) profile(ctx context.Context, userID string) (profile, error) {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return profile{}, err
+	}
+
+	identities, err := s.users.Identities(ctx, userID)
+	if err != nil {
+		return profile{}, err
+	}
+
+	result := profile{ID: user.ID, Email: user.Email, Role: string(user.Role), Identities: []identity{}}
+	for _, i := range identities {
+		result.Identities = append(result.Identities, identity{Provider: i.Provider, Email: i.Email, CreatedAt: i.CreatedAt.UTC()})
+	}
+	return result, nil
+}
+
+func (s *Service) links(ctx context.Context, userID string) ([]link, []linkClicks, error) {
+	links := []link{}
+	clicks := []linkClicks{}
+
+	err := s.shortener.Export(ctx, userID, func(redirect internal.Redirect) error {
+		stats := linkClicks{Domain: redirect.Domain, Short: redirect.Short, Clicks: redirect.Clicks}
+		if len(redirect.Targets) > 0 {
+			variants, err := s.shortener.VariantStats(ctx, redirect.Domain, redirect.Short, userID)
+			if err != nil {
+				return err
+			}
+			for _, variant := range variants {
+				stats.Variants = append(stats.Variants, variantClicks{URL: variant.URL, Weight: variant.Weight, Clicks: variant.Clicks})
+			}
+		}
+
+		links = append(links, toLink(redirect))
+		clicks = append(clicks, stats)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// variant statistics are gone once a link is in the trash
+	trash, err := s.shortener.Trash(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, redirect := range trash {
+		links = append(links, toLink(redirect))
+		clicks = append(clicks, linkClicks{Domain: redirect.Domain, Short: redirect.Short, Clicks: redirect.Clicks})
+	}
+
+	return links, clicks, nil
+}
+
+func toLink(redirect internal.Redirect) link {
+	result := link{
+		Domain:            redirect.Domain,
+		Short:             redirect.Short,
+		URL:               redirect.URL,
+		Title:             redirect.Title,
+		Notes:             redirect.Notes,
+		Tags:              redirect.Tags,
+		PasswordProtected: redirect.IsProtected(),
+		MaxClicks:         redirect.MaxClicks,
+		ForcePreview:      redirect.ForcePreview,
+		Passthrough:       redirect.Passthrough,
+		UTMCampaign:       redirect.UTMCampaign,
+		Rules:             redirect.Rules,
+		Targets:           redirect.Targets,
+		CreatedAt:         redirect.CreatedAt.UTC(),
+	}
+	if result.Tags == nil {
+		result.Tags = []string{}
+	}
+	if result.Rules == nil {
+		result.Rules = []internal.TargetingRule{}
+	}
+	if result.Targets == nil {
+		result.Targets = []internal.WeightedTarget{}
+	}
+	if redirect.IsTrashed() {
+		deletedAt := redirect.DeletedAt.UTC()
+		result.DeletedAt = &deletedAt
+	}
+	return result
+}
+
+func (s *Service) userPresets(ctx context.Context, userID string) ([]preset, error) {
+	list, err := s.presets.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	presets := make([]preset, len(list))
+	for i, p := range list {
+		presets[i] = preset{
+			Name:      p.Name,
+			Source:    p.Source,
+			Medium:    p.Medium,
+			Campaign:  p.Campaign,
+			Term:      p.Term,
+			Content:   p.Content,
+			CreatedAt: p.CreatedAt.UTC(),
+		}
+	}
+	return presets, nil
+}
+
+func writeJSON(archive *zip.Writer, name string, content any) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(content)
+}
+
+// DeleteAccount deletes the user with their links, presets, logins and sessions. With an heir,
+// the links that are not in the trash are handed over to them first.
+func (s *Service) DeleteAccount(ctx context.Context, userID string, heirEmail string) error {
+	heirEmail = strings.TrimSpace(heirEmail)
+	if heirEmail != "" {
+		heir, err := s.users.GetByEmail(ctx, heirEmail)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return internal.ErrInvalidHeir
+		}
+		if err != nil {
+			return err
+		}
+		if heir.ID == userID || heir.Disabled {
+			return internal.ErrInvalidHeir
+		}
+
+		if _, err := s.shortener.TransferAll(ctx, userID, heir.ID); err != nil {
+			return err
+		}
+	}
+
+	return s.users.Delete(ctx, userID)
+}
@@ -0,0 +1,304 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+const (
+	testUser  = "00000000-0000-0000-0000-000000000000"
+	testHeir  = "11111111-1111-1111-1111-111111111111"
+	testEmail = "user@example.com"
+	testURL   = "https://example.com"
+)
+
+func TestService_Export(t *testing.T) {
+	sut, _, _ := setupService()
+
+	var buf bytes.Buffer
+	err := sut.Export(context.Background(), testUser, &buf)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoErrorf(t, err, "Expected a ZIP archive, got %v", err)
+
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		files[file.Name] = readFile(t, file)
+	}
+
+	expected := []string{"profile.json", "links.json", "clicks.json", "utm_presets.json"}
+	for _, name := range expected {
+		assert.Containsf(t, files, name, "Expected %v in the archive, got %v", name, files)
+	}
+
+	assert.Containsf(t, files["profile.json"], testEmail, "Expected email in the profile, got %s", files["profile.json"])
+	assert.Containsf(t, files["profile.json"], `"provider": "github"`, "Expected identities in the profile, got %s", files["profile.json"])
+	assert.Containsf(t, files["utm_presets.json"], `"name": "Newsletter"`, "Expected presets, got %s", files["utm_presets.json"])
+
+	var links []link
+	err = json.Unmarshal([]byte(files["links.json"]), &links)
+	assert.NoErrorf(t, err, "Expected valid JSON, got %v", err)
+	assert.Lenf(t, links, 2, "Expected live and trashed link, got %v", links)
+	assert.Truef(t, links[0].PasswordProtected, "Expected protection to be exported, got %v", links[0])
+	assert.NotNilf(t, links[1].DeletedAt, "Expected trashed link to carry its deletion time, got %v", links[1])
+	assert.NotContainsf(t, files["links.json"], "hash", "Expected password hash to stay out of the export, got %s", files["links.json"])
+
+	var clicks []linkClicks
+	err = json.Unmarshal([]byte(files["clicks.json"]), &clicks)
+	assert.NoErrorf(t, err, "Expected valid JSON, got %v", err)
+	assert.Equalf(t, 42, clicks[0].Clicks, "Expected clicks of the link, got %v", clicks[0])
+	assert.Lenf(t, clicks[0].Variants, 2, "Expected clicks per variant, got %v", clicks[0].Variants)
+
+	err = sut.Export(context.Background(), "unknown", &buf)
+	assert.Errorf(t, err, "Expected error for unknown user, got nil")
+}
+
+func TestService_DeleteAccount(t *testing.T) {
+	sut, users, shortener := setupService()
+	ctx := context.Background()
+
+	err := sut.DeleteAccount(ctx, testUser, "nobody@example.com")
+	assert.ErrorIsf(t, err, internal.ErrInvalidHeir, "Expected %v, got %v", internal.ErrInvalidHeir, err)
+
+	err = sut.DeleteAccount(ctx, testUser, testEmail)
+	assert.ErrorIsf(t, err, internal.ErrInvalidHeir, "Expected %v for yourself, got %v", internal.ErrInvalidHeir, err)
+
+	err = sut.DeleteAccount(ctx, testUser, "disabled@example.com")
+	assert.ErrorIsf(t, err, internal.ErrInvalidHeir, "Expected %v for disabled user, got %v", internal.ErrInvalidHeir, err)
+	assert.Containsf(t, users.users, testUser, "Expected user to be kept after a failed transfer")
+
+	err = sut.DeleteAccount(ctx, testUser, " heir@example.com ")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testHeir, shortener.transferredTo, "Expected links to go to the heir, got %v", shortener.transferredTo)
+	assert.NotContainsf(t, users.users, testUser, "Expected user to be deleted")
+}
+
+func TestService_DeleteAccount_WithoutHeir(t *testing.T) {
+	sut, users, shortener := setupService()
+
+	err := sut.DeleteAccount(context.Background(), testUser, "")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Emptyf(t, shortener.transferredTo, "Expected no transfer, got %v", shortener.transferredTo)
+	assert.NotContainsf(t, users.users, testUser, "Expected user to be deleted")
+
+	shortener.FailMode = true
+	users.users[testUser] = internal.User{ID: testUser, Email: testEmail}
+	err = sut.DeleteAccount(context.Background(), testUser, "heir@example.com")
+	assert.Errorf(t, err, "Expected error, got nil")
+	assert.Containsf(t, users.users, testUser, "Expected user to be kept after a failed transfer")
+}
+
+func setupService() (*Service, *usersServiceFake, *urlShortenerServiceFake) {
+	users := &usersServiceFake{users: map[string]internal.User{
+		testUser:   {ID: testUser, Email: testEmail, Role: internal.RoleUser},
+		testHeir:   {ID: testHeir, Email: "heir@example.com", Role: internal.RoleUser},
+		"disabled": {ID: "disabled", Email: "disabled@example.com", Role: internal.RoleUser, Disabled: true},
+	}}
+	shortener := &urlShortenerServiceFake{}
+	return NewService(users, shortener, presetServiceFake{}), users, shortener
+}
+
+func readFile(t *testing.T, file *zip.File) string {
+	reader, err := file.Open()
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	return string(content)
+}
+
+type usersServiceFake struct {
+	users map[string]internal.User
+}
+
+func (u *usersServiceFake) List(context.Context, string) ([]internal.User, error) {
+	return nil, nil
+}
+
+func (u *usersServiceFake) Get(_ context.Context, id string) (internal.User, error) {
+	user, ok := u.users[id]
+	if !ok {
+		return internal.User{}, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+func (u *usersServiceFake) GetByEmail(_ context.Context, email string) (internal.User, error) {
+	for _, user := range u.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return internal.User{}, pgx.ErrNoRows
+}
+
+func (u *usersServiceFake) SignIn(context.Context, internal.Identity) (internal.User, error) {
+	return internal.User{}, nil
+}
+
+func (u *usersServiceFake) Identities(_ context.Context, userID string) ([]internal.Identity, error) {
+	identity := internal.Identity{Provider: "github", Subject: "42", UserID: userID, Email: testEmail, CreatedAt: time.Now()}
+	return []internal.Identity{identity}, nil
+}
+
+func (u *usersServiceFake) Link(context.Context, string, internal.Identity) error {
+	return nil
+}
+
+func (u *usersServiceFake) Unlink(context.Context, string, string, string) error {
+	return nil
+}
+
+func (u *usersServiceFake) SetDisabled(context.Context, string, bool) error {
+	return nil
+}
+
+func (u *usersServiceFake) Delete(_ context.Context, id string) error {
+	delete(u.users, id)
+	return nil
+}
+
+type urlShortenerServiceFake struct {
+	transferredTo string
+	FailMode      bool
+}
+
+func (u *urlShortenerServiceFake) List(context.Context, string, internal.RedirectFilter, internal.PageRequest) (internal.RedirectPage, error) {
+	return internal.RedirectPage{}, nil
+}
+
+func (u *urlShortenerServiceFake) ListAll(context.Context, string, string, internal.PageRequest) (internal.RedirectPage, error) {
+	return internal.RedirectPage{}, nil
+}
+
+func (u *urlShortenerServiceFake) Tags(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func (u *urlShortenerServiceFake) Campaigns(context.Context, string) ([]internal.CampaignStats, error) {
+	return nil, nil
+}
+
+func (u *urlShortenerServiceFake) GetRedirectByShort(context.Context, string, string, string) (internal.Redirect, error) {
+	return internal.Redirect{}, nil
+}
+
+func (u *urlShortenerServiceFake) LookupShortURL(context.Context, string, string) (internal.Redirect, error) {
+	return internal.Redirect{}, nil
+}
+
+func (u *urlShortenerServiceFake) ShortenURL(context.Context, string, string, internal.RedirectOptions) (internal.Redirect, error) {
+	return internal.Redirect{}, nil
+}
+
+func (u *urlShortenerServiceFake) Import(context.Context, string, []internal.ImportRecord) (internal.ImportReport, error) {
+	return internal.ImportReport{}, nil
+}
+
+func (u *urlShortenerServiceFake) Export(_ context.Context, userID string, fn func(internal.Redirect) error) error {
+	redirect := internal.Redirect{
+		Short:        "short",
+		URL:          testURL,
+		UserID:       userID,
+		CreatedAt:    time.Now(),
+		PasswordHash: "hash",
+		Clicks:       42,
+		Targets:      []internal.WeightedTarget{{URL: testURL + "/a", Weight: 1}, {URL: testURL + "/b", Weight: 1}},
+	}
+	return fn(redirect)
+}
+
+func (u *urlShortenerServiceFake) UnlockShortURL(context.Context, string, string, string) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) UpdateDetails(context.Context, string, string, string, internal.RedirectDetails) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) UpdateRules(context.Context, string, string, string, []internal.TargetingRule) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) UpdateTargets(context.Context, string, string, string, []internal.WeightedTarget) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) VariantStats(context.Context, string, string, string) ([]internal.VariantStats, error) {
+	stats := []internal.VariantStats{
+		{WeightedTarget: internal.WeightedTarget{URL: testURL + "/a", Weight: 1}, Clicks: 30},
+		{WeightedTarget: internal.WeightedTarget{URL: testURL + "/b", Weight: 1}, Clicks: 12},
+	}
+	return stats, nil
+}
+
+func (u *urlShortenerServiceFake) ExpandShortURL(context.Context, string, string, internal.Visit) (string, error) {
+	return "", nil
+}
+
+func (u *urlShortenerServiceFake) DeleteShortURL(context.Context, string, string, string) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) Trash(_ context.Context, userID string) ([]internal.Redirect, error) {
+	redirect := internal.Redirect{Short: "trashed", URL: testURL, UserID: userID, CreatedAt: time.Now(), DeletedAt: time.Now()}
+	return []internal.Redirect{redirect}, nil
+}
+
+func (u *urlShortenerServiceFake) RestoreShortURL(context.Context, string, string, string) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) PurgeShortURL(context.Context, string, string, string) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) PurgeExpiredTrash(context.Context, time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (u *urlShortenerServiceFake) TransferShortURL(context.Context, string, string, string) error {
+	return nil
+}
+
+func (u *urlShortenerServiceFake) TransferAll(_ context.Context, _ string, toUserID string) (int, error) {
+	if u.FailMode {
+		return 0, errors.New("fake error")
+	}
+	u.transferredTo = toUserID
+	return 1, nil
+}
+
+func (u *urlShortenerServiceFake) RemoveShortURL(context.Context, string, string) error {
+	return nil
+}
+
+type presetServiceFake struct{}
+
+func (p presetServiceFake) List(_ context.Context, userID string) ([]internal.UTMPreset, error) {
+	preset := internal.UTMPreset{ID: "preset", UserID: userID, Name: "Newsletter", Source: "newsletter", CreatedAt: time.Now()}
+	return []internal.UTMPreset{preset}, nil
+}
+
+func (p presetServiceFake) Get(context.Context, string, string) (internal.UTMPreset, error) {
+	return internal.UTMPreset{}, nil
+}
+
+func (p presetServiceFake) Create(_ context.Context, preset internal.UTMPreset) (internal.UTMPreset, error) {
+	return preset, nil
+}
+
+func (p presetServiceFake) Delete(context.Context, string, string) error {
+	return nil
+}
@@ -0,0 +1,158 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+type Format string
+
+const (
+	PNG Format = "png"
+	SVG Format = "svg"
+)
+
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+type Options struct {
+	Size   int
+	Level  string
+	Margin int
+}
+
+func DefaultOptions() Options {
+	return Options{Size: 256, Level: "M", Margin: 4}
+}
+
+func (o Options) Validate() error {
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return errors.New("level must be one of L, M, Q or H")
+	}
+	return nil
+}
+
+func (f Format) ContentType() string {
+	if f == SVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case PNG, "":
+		return PNG, nil
+	case SVG:
+		return SVG, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q", s)
+	}
+}
+
+// Write encodes content as QR code and writes it in the given format to w.
+func Write(w io.Writer, content string, format Format, options Options) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	code, err := qrcode.New(content, levels[options.Level])
+	if err != nil {
+		return err
+	}
+
+	// we draw the quiet zone ourselves to make the margin configurable
+	code.DisableBorder = true
+	modules := withMargin(code.Bitmap(), options.Margin)
+
+	if format == SVG {
+		return writeSVG(w, modules, options.Size)
+	}
+	return png.Encode(w, toImage(modules, options.Size))
+}
+
+func withMargin(bitmap [][]bool, margin int) [][]bool {
+	n := len(bitmap) + 2*margin
+
+	modules := make([][]bool, n)
+	for y := range modules {
+		modules[y] = make([]bool, n)
+	}
+
+	for y, row := range bitmap {
+		copy(modules[y+margin][margin:], row)
+	}
+	return modules
+}
+
+func toImage(modules [][]bool, size int) image.Image {
+	n := len(modules)
+	scale := size / n
+	if scale < 1 {
+		scale = 1
+	}
+
+	// center the code if the size is not a multiple of the module count
+	canvas := size
+	if scale*n > canvas {
+		canvas = scale * n
+	}
+	offset := (canvas - scale*n) / 2
+
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, canvas, canvas), palette)
+
+	for y, row := range modules {
+		for x, set := range row {
+			if !set {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func writeSVG(w io.Writer, modules [][]bool, size int) error {
+	n := len(modules)
+
+	var path strings.Builder
+	for y, row := range modules {
+		for x, set := range row {
+			if set {
+				_, _ = fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`,
+		size, size, n, n, path.String())
+	return err
+}
@@ -0,0 +1,78 @@
+package qrcode
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const testContent = "https://example.com/hYhahA"
+
+func TestOptions_Validate(t *testing.T) {
+	tt := []struct {
+		name    string
+		options Options
+		valid   bool
+	}{
+		{"defaults", DefaultOptions(), true},
+		{"too small", Options{Size: 10, Level: "M", Margin: 4}, false},
+		{"too large", Options{Size: 4096, Level: "M", Margin: 4}, false},
+		{"negative margin", Options{Size: 256, Level: "M", Margin: -1}, false},
+		{"huge margin", Options{Size: 256, Level: "M", Margin: 100}, false},
+		{"unknown level", Options{Size: 256, Level: "X", Margin: 4}, false},
+		{"highest level", Options{Size: 256, Level: "H", Margin: 0}, true},
+	}
+
+	for _, c := range tt {
+		err := c.options.Validate()
+		assert.Equalf(t, c.valid, err == nil, "validation of %s should be %t, got error %v", c.name, c.valid, err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, PNG, format, "Expected default format to be png, got %s", format)
+
+	format, err = ParseFormat("SVG")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, SVG, format, "Expected format to be svg, got %s", format)
+
+	_, err = ParseFormat("gif")
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestWrite_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	options := Options{Size: 300, Level: "Q", Margin: 2}
+
+	err := Write(&buf, testContent, PNG, options)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	img, err := png.Decode(&buf)
+	assert.NoErrorf(t, err, "Expected valid png, got %v", err)
+	assert.Equalf(t, 300, img.Bounds().Dx(), "Expected width to be 300, got %d", img.Bounds().Dx())
+	assert.Equalf(t, 300, img.Bounds().Dy(), "Expected height to be 300, got %d", img.Bounds().Dy())
+}
+
+func TestWrite_SVG(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := Write(&buf, testContent, SVG, DefaultOptions())
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	svg := buf.String()
+	assert.Truef(t, strings.HasPrefix(svg, "<svg"), "Expected svg document, got %s", svg)
+	assert.Containsf(t, svg, `width="256"`, "Expected svg to have configured size")
+
+	// version 2 code with 25 modules plus the default margin on both sides
+	assert.Containsf(t, svg, `viewBox="0 0 33 33"`, "Expected svg to include the margin")
+}
+
+func TestWrite_InvalidOptions(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, testContent, PNG, Options{Size: 1, Level: "M"})
+	assert.Errorf(t, err, "Expected error, got nil")
+}
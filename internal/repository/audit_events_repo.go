@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+)
+
+type DBAuditEventsRepository struct {
+	queries *database.Queries
+}
+
+func NewDBAuditEventsRepository(pool *pgxpool.Pool) *DBAuditEventsRepository {
+	return &DBAuditEventsRepository{queries: database.New(pool)}
+}
+
+func (d *DBAuditEventsRepository) Save(ctx context.Context, event internal.AuditEvent) error {
+	return d.queries.SaveAuditEvent(ctx, database.SaveAuditEventParams{
+		ID:          event.ID,
+		ActorID:     event.ActorID,
+		Action:      string(event.Action),
+		TargetType:  event.TargetType,
+		TargetID:    event.TargetID,
+		BeforeValue: jsonbOrNull(event.Before),
+		AfterValue:  jsonbOrNull(event.After),
+		RequestID:   event.RequestID,
+		Ip:          event.IP,
+		CreatedAt:   event.CreatedAt,
+	})
+}
+
+func (d *DBAuditEventsRepository) List(ctx context.Context, filter internal.AuditFilter) ([]internal.AuditEvent, error) {
+	before := filter.Before
+	if before.IsZero() {
+		before = endOfTime
+	}
+
+	dtos, err := d.queries.ListAuditEvents(ctx, database.ListAuditEventsParams{
+		ActorID:       filter.ActorID,
+		Action:        string(filter.Action),
+		TargetType:    filter.TargetType,
+		TargetID:      filter.TargetID,
+		CreatedBefore: before,
+		PageSize:      int32(filter.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]internal.AuditEvent, len(dtos))
+	for i, e := range dtos {
+		events[i] = dtoToAuditEvent(e)
+	}
+	return events, nil
+}
+
+func jsonbOrNull(value []byte) pgtype.JSONB {
+	if value == nil {
+		return pgtype.JSONB{Status: pgtype.Null}
+	}
+	return pgtype.JSONB{Bytes: value, Status: pgtype.Present}
+}
+
+func dtoToAuditEvent(dto database.AuditEvent) internal.AuditEvent {
+	event := internal.AuditEvent{
+		ID:         dto.ID,
+		ActorID:    dto.ActorID,
+		Action:     internal.AuditAction(dto.Action),
+		TargetType: dto.TargetType,
+		TargetID:   dto.TargetID,
+		RequestID:  dto.RequestID,
+		IP:         dto.Ip,
+		CreatedAt:  dto.CreatedAt,
+	}
+	if dto.BeforeValue.Status == pgtype.Present {
+		event.Before = dto.BeforeValue.Bytes
+	}
+	if dto.AfterValue.Status == pgtype.Present {
+		event.After = dto.AfterValue.Bytes
+	}
+	return event
+}
@@ -5,18 +5,149 @@
 package database
 
 import (
+	"database/sql"
 	"time"
+
+	"github.com/jackc/pgtype"
 )
 
+type AccountToken struct {
+	ID        string
+	Purpose   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Email     string
+}
+
+type AuditEvent struct {
+	ID          string
+	ActorID     string
+	Action      string
+	TargetType  string
+	TargetID    string
+	BeforeValue pgtype.JSONB
+	AfterValue  pgtype.JSONB
+	RequestID   string
+	Ip          string
+	CreatedAt   time.Time
+}
+
+type Invitation struct {
+	ID        string
+	Email     string
+	InvitedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type LocalAccount struct {
+	UserID        sql.NullString
+	PasswordHash  string
+	EmailVerified bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Email         string
+}
+
+type RecoveryCode struct {
+	UserID    string
+	CodeHash  string
+	CreatedAt time.Time
+}
+
 type Redirect struct {
-	Short     string
-	Url       string
+	Short        string
+	Url          string
+	UserID       string
+	CreatedAt    time.Time
+	PasswordHash string
+	MaxClicks    int32
+	Clicks       int64
+	Title        string
+	ForcePreview bool
+	Passthrough  string
+	UtmPresetID  sql.NullString
+	UtmCampaign  string
+	Rules        pgtype.JSONB
+	Targets      pgtype.JSONB
+	Notes        string
+	Tags         []string
+	DeletedAt    sql.NullTime
+	Domain       string
+}
+
+type RedirectVariantClick struct {
+	Short   string
+	Variant int32
+	Clicks  int64
+	Domain  string
+}
+
+type Session struct {
+	ID         string
+	UserID     sql.NullString
+	Data       []byte
+	UserAgent  string
+	Ip         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+type TwoFactor struct {
+	UserID      string
+	Secret      string
+	Enabled     bool
+	LastCounter int64
+	CreatedAt   time.Time
+}
+
+type UtmPreset struct {
+	ID        string
 	UserID    string
+	Name      string
+	Source    string
+	Medium    string
+	Campaign  string
+	Term      string
+	Content   string
 	CreatedAt time.Time
 }
 
 type User struct {
-	ID               string
-	Email            string
-	GoogleProviderID string
+	ID       string
+	Email    string
+	Role     string
+	Disabled bool
+}
+
+type UserIdentity struct {
+	Provider  string
+	Subject   string
+	UserID    string
+	Email     string
+	CreatedAt time.Time
+}
+
+type Webhook struct {
+	ID        string
+	UserID    string
+	Url       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID             string
+	WebhookID      string
+	Event          string
+	Payload        pgtype.JSONB
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	ResponseStatus int32
+	Error          string
+	CreatedAt      time.Time
+	DeliveredAt    sql.NullTime
 }
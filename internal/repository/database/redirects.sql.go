@@ -7,68 +7,204 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
+
+	"github.com/jackc/pgtype"
 )
 
-const deleteRedirect = `-- name: DeleteRedirect :exec
-DELETE FROM redirects
-WHERE short = $1 and user_id = $2
+const countVariantClick = `-- name: CountVariantClick :exec
+INSERT INTO redirect_variant_clicks (domain, short, variant, clicks)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (domain, short, variant) DO UPDATE SET clicks = redirect_variant_clicks.clicks + 1
 `
 
-type DeleteRedirectParams struct {
-	Short  string
-	UserID string
+type CountVariantClickParams struct {
+	Domain  string
+	Short   string
+	Variant int32
 }
 
-func (q *Queries) DeleteRedirect(ctx context.Context, arg DeleteRedirectParams) error {
-	_, err := q.db.Exec(ctx, deleteRedirect, arg.Short, arg.UserID)
+func (q *Queries) CountVariantClick(ctx context.Context, arg CountVariantClickParams) error {
+	_, err := q.db.Exec(ctx, countVariantClick, arg.Domain, arg.Short, arg.Variant)
 	return err
 }
 
 const expandRedirect = `-- name: ExpandRedirect :one
-SELECT url
+UPDATE redirects
+SET clicks = clicks + 1
+WHERE domain = $1 and short = $2 and deleted_at is null and (max_clicks = 0 or clicks < max_clicks)
+RETURNING short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
+`
+
+type ExpandRedirectParams struct {
+	Domain string
+	Short  string
+}
+
+func (q *Queries) ExpandRedirect(ctx context.Context, arg ExpandRedirectParams) (Redirect, error) {
+	row := q.db.QueryRow(ctx, expandRedirect, arg.Domain, arg.Short)
+	var i Redirect
+	err := row.Scan(
+		&i.Short,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.PasswordHash,
+		&i.MaxClicks,
+		&i.Clicks,
+		&i.Title,
+		&i.ForcePreview,
+		&i.Passthrough,
+		&i.UtmPresetID,
+		&i.UtmCampaign,
+		&i.Rules,
+		&i.Targets,
+		&i.Notes,
+		&i.Tags,
+		&i.DeletedAt,
+		&i.Domain,
+	)
+	return i, err
+}
+
+const getRedirect = `-- name: GetRedirect :one
+SELECT short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
 FROM redirects
-WHERE short = $1
+WHERE domain = $1 and short = $2 and deleted_at is null
 `
 
-func (q *Queries) ExpandRedirect(ctx context.Context, short string) (string, error) {
-	row := q.db.QueryRow(ctx, expandRedirect, short)
-	var url string
-	err := row.Scan(&url)
-	return url, err
+type GetRedirectParams struct {
+	Domain string
+	Short  string
+}
+
+func (q *Queries) GetRedirect(ctx context.Context, arg GetRedirectParams) (Redirect, error) {
+	row := q.db.QueryRow(ctx, getRedirect, arg.Domain, arg.Short)
+	var i Redirect
+	err := row.Scan(
+		&i.Short,
+		&i.Url,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.PasswordHash,
+		&i.MaxClicks,
+		&i.Clicks,
+		&i.Title,
+		&i.ForcePreview,
+		&i.Passthrough,
+		&i.UtmPresetID,
+		&i.UtmCampaign,
+		&i.Rules,
+		&i.Targets,
+		&i.Notes,
+		&i.Tags,
+		&i.DeletedAt,
+		&i.Domain,
+	)
+	return i, err
 }
 
 const getRedirectByShort = `-- name: GetRedirectByShort :one
-SELECT short, url, user_id, created_at
+SELECT short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
 FROM redirects
-WHERE short = $1 and user_id = $2
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is null
 `
 
 type GetRedirectByShortParams struct {
+	Domain string
 	Short  string
 	UserID string
 }
 
 func (q *Queries) GetRedirectByShort(ctx context.Context, arg GetRedirectByShortParams) (Redirect, error) {
-	row := q.db.QueryRow(ctx, getRedirectByShort, arg.Short, arg.UserID)
+	row := q.db.QueryRow(ctx, getRedirectByShort, arg.Domain, arg.Short, arg.UserID)
 	var i Redirect
 	err := row.Scan(
 		&i.Short,
 		&i.Url,
 		&i.UserID,
 		&i.CreatedAt,
+		&i.PasswordHash,
+		&i.MaxClicks,
+		&i.Clicks,
+		&i.Title,
+		&i.ForcePreview,
+		&i.Passthrough,
+		&i.UtmPresetID,
+		&i.UtmCampaign,
+		&i.Rules,
+		&i.Targets,
+		&i.Notes,
+		&i.Tags,
+		&i.DeletedAt,
+		&i.Domain,
 	)
 	return i, err
 }
 
-const listRedirectsByUserId = `-- name: ListRedirectsByUserId :many
-SELECT short, url, user_id, created_at
+const importRedirect = `-- name: ImportRedirect :execrows
+INSERT INTO redirects (short, url, user_id, created_at, title, notes, tags, clicks)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (domain, short) DO NOTHING
+`
+
+type ImportRedirectParams struct {
+	Short     string
+	Url       string
+	UserID    string
+	CreatedAt time.Time
+	Title     string
+	Notes     string
+	Tags      []string
+	Clicks    int64
+}
+
+func (q *Queries) ImportRedirect(ctx context.Context, arg ImportRedirectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, importRedirect,
+		arg.Short,
+		arg.Url,
+		arg.UserID,
+		arg.CreatedAt,
+		arg.Title,
+		arg.Notes,
+		arg.Tags,
+		arg.Clicks,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listAllRedirects = `-- name: ListAllRedirects :many
+SELECT short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
 FROM redirects
-WHERE user_id = $1
+WHERE ($1::text = '' or user_id = $1::text) and deleted_at is null
+  and ($2::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', $2::text))
+  and (created_at, short, domain) < ($3::timestamptz, $4::text, $5::text)
+ORDER BY created_at DESC, short DESC, domain DESC
+LIMIT $6
 `
 
-func (q *Queries) ListRedirectsByUserId(ctx context.Context, userID string) ([]Redirect, error) {
-	rows, err := q.db.Query(ctx, listRedirectsByUserId, userID)
+type ListAllRedirectsParams struct {
+	UserID          string
+	Query           string
+	CursorCreatedAt time.Time
+	CursorShort     string
+	CursorDomain    string
+	PageSize        int32
+}
+
+func (q *Queries) ListAllRedirects(ctx context.Context, arg ListAllRedirectsParams) ([]Redirect, error) {
+	rows, err := q.db.Query(ctx, listAllRedirects,
+		arg.UserID,
+		arg.Query,
+		arg.CursorCreatedAt,
+		arg.CursorShort,
+		arg.CursorDomain,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +217,20 @@ func (q *Queries) ListRedirectsByUserId(ctx context.Context, userID string) ([]R
 			&i.Url,
 			&i.UserID,
 			&i.CreatedAt,
+			&i.PasswordHash,
+			&i.MaxClicks,
+			&i.Clicks,
+			&i.Title,
+			&i.ForcePreview,
+			&i.Passthrough,
+			&i.UtmPresetID,
+			&i.UtmCampaign,
+			&i.Rules,
+			&i.Targets,
+			&i.Notes,
+			&i.Tags,
+			&i.DeletedAt,
+			&i.Domain,
 		); err != nil {
 			return nil, err
 		}
@@ -92,26 +242,644 @@ func (q *Queries) ListRedirectsByUserId(ctx context.Context, userID string) ([]R
 	return items, nil
 }
 
-const saveRedirect = `-- name: SaveRedirect :exec
-INSERT INTO redirects (short, url, user_id, created_at)
-VALUES ($1, $2, $3, $4)
-ON CONFLICT (short) DO NOTHING
-RETURNING short, url, user_id, created_at
+const listCampaignsByUserId = `-- name: ListCampaignsByUserId :many
+SELECT utm_campaign, count(*) AS links, sum(clicks)::bigint AS clicks
+FROM redirects
+WHERE user_id = $1 and utm_campaign <> '' and deleted_at is null
+GROUP BY utm_campaign
+ORDER BY utm_campaign
+`
+
+type ListCampaignsByUserIdRow struct {
+	UtmCampaign string
+	Links       int64
+	Clicks      int64
+}
+
+func (q *Queries) ListCampaignsByUserId(ctx context.Context, userID string) ([]ListCampaignsByUserIdRow, error) {
+	rows, err := q.db.Query(ctx, listCampaignsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListCampaignsByUserIdRow
+	for rows.Next() {
+		var i ListCampaignsByUserIdRow
+		if err := rows.Scan(&i.UtmCampaign, &i.Links, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRedirectsByClicks = `-- name: ListRedirectsByClicks :many
+SELECT short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
+FROM redirects
+WHERE user_id = $1 and deleted_at is null
+  and ($2::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', $2::text))
+  and ($3::text = '' or $3::text = any(tags))
+  and created_at >= $4 and created_at < $5
+  and (clicks, short, domain) < ($6::bigint, $7::text, $8::text)
+ORDER BY clicks DESC, short DESC, domain DESC
+LIMIT $9
+`
+
+type ListRedirectsByClicksParams struct {
+	UserID       string
+	Query        string
+	Tag          string
+	CreatedFrom  time.Time
+	CreatedUntil time.Time
+	CursorClicks int64
+	CursorShort  string
+	CursorDomain string
+	PageSize     int32
+}
+
+func (q *Queries) ListRedirectsByClicks(ctx context.Context, arg ListRedirectsByClicksParams) ([]Redirect, error) {
+	rows, err := q.db.Query(ctx, listRedirectsByClicks,
+		arg.UserID,
+		arg.Query,
+		arg.Tag,
+		arg.CreatedFrom,
+		arg.CreatedUntil,
+		arg.CursorClicks,
+		arg.CursorShort,
+		arg.CursorDomain,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Redirect
+	for rows.Next() {
+		var i Redirect
+		if err := rows.Scan(
+			&i.Short,
+			&i.Url,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.PasswordHash,
+			&i.MaxClicks,
+			&i.Clicks,
+			&i.Title,
+			&i.ForcePreview,
+			&i.Passthrough,
+			&i.UtmPresetID,
+			&i.UtmCampaign,
+			&i.Rules,
+			&i.Targets,
+			&i.Notes,
+			&i.Tags,
+			&i.DeletedAt,
+			&i.Domain,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRedirectsByCreatedAt = `-- name: ListRedirectsByCreatedAt :many
+SELECT short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
+FROM redirects
+WHERE user_id = $1 and deleted_at is null
+  and ($2::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', $2::text))
+  and ($3::text = '' or $3::text = any(tags))
+  and created_at >= $4 and created_at < $5
+  and (created_at, short, domain) < ($6::timestamptz, $7::text, $8::text)
+ORDER BY created_at DESC, short DESC, domain DESC
+LIMIT $9
+`
+
+type ListRedirectsByCreatedAtParams struct {
+	UserID          string
+	Query           string
+	Tag             string
+	CreatedFrom     time.Time
+	CreatedUntil    time.Time
+	CursorCreatedAt time.Time
+	CursorShort     string
+	CursorDomain    string
+	PageSize        int32
+}
+
+func (q *Queries) ListRedirectsByCreatedAt(ctx context.Context, arg ListRedirectsByCreatedAtParams) ([]Redirect, error) {
+	rows, err := q.db.Query(ctx, listRedirectsByCreatedAt,
+		arg.UserID,
+		arg.Query,
+		arg.Tag,
+		arg.CreatedFrom,
+		arg.CreatedUntil,
+		arg.CursorCreatedAt,
+		arg.CursorShort,
+		arg.CursorDomain,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Redirect
+	for rows.Next() {
+		var i Redirect
+		if err := rows.Scan(
+			&i.Short,
+			&i.Url,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.PasswordHash,
+			&i.MaxClicks,
+			&i.Clicks,
+			&i.Title,
+			&i.ForcePreview,
+			&i.Passthrough,
+			&i.UtmPresetID,
+			&i.UtmCampaign,
+			&i.Rules,
+			&i.Targets,
+			&i.Notes,
+			&i.Tags,
+			&i.DeletedAt,
+			&i.Domain,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRedirectsByShort = `-- name: ListRedirectsByShort :many
+SELECT short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
+FROM redirects
+WHERE user_id = $1 and deleted_at is null
+  and ($2::text = '' or redirect_search_document(url, title, notes, tags) @@ websearch_to_tsquery('simple', $2::text))
+  and ($3::text = '' or $3::text = any(tags))
+  and created_at >= $4 and created_at < $5
+  and (short, domain) > ($6::text, $7::text)
+ORDER BY short, domain
+LIMIT $8
+`
+
+type ListRedirectsByShortParams struct {
+	UserID       string
+	Query        string
+	Tag          string
+	CreatedFrom  time.Time
+	CreatedUntil time.Time
+	CursorShort  string
+	CursorDomain string
+	PageSize     int32
+}
+
+func (q *Queries) ListRedirectsByShort(ctx context.Context, arg ListRedirectsByShortParams) ([]Redirect, error) {
+	rows, err := q.db.Query(ctx, listRedirectsByShort,
+		arg.UserID,
+		arg.Query,
+		arg.Tag,
+		arg.CreatedFrom,
+		arg.CreatedUntil,
+		arg.CursorShort,
+		arg.CursorDomain,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Redirect
+	for rows.Next() {
+		var i Redirect
+		if err := rows.Scan(
+			&i.Short,
+			&i.Url,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.PasswordHash,
+			&i.MaxClicks,
+			&i.Clicks,
+			&i.Title,
+			&i.ForcePreview,
+			&i.Passthrough,
+			&i.UtmPresetID,
+			&i.UtmCampaign,
+			&i.Rules,
+			&i.Targets,
+			&i.Notes,
+			&i.Tags,
+			&i.DeletedAt,
+			&i.Domain,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTagsByUserId = `-- name: ListTagsByUserId :many
+SELECT DISTINCT unnest(tags)::text AS tag
+FROM redirects
+WHERE user_id = $1 and deleted_at is null
+ORDER BY tag
+`
+
+func (q *Queries) ListTagsByUserId(ctx context.Context, userID string) ([]string, error) {
+	rows, err := q.db.Query(ctx, listTagsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		items = append(items, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrashedRedirectsByUserId = `-- name: ListTrashedRedirectsByUserId :many
+SELECT short, url, user_id, created_at, password_hash, max_clicks, clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, rules, targets, notes, tags, deleted_at, domain
+FROM redirects
+WHERE user_id = $1 and deleted_at is not null
+ORDER BY deleted_at DESC
+`
+
+func (q *Queries) ListTrashedRedirectsByUserId(ctx context.Context, userID string) ([]Redirect, error) {
+	rows, err := q.db.Query(ctx, listTrashedRedirectsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Redirect
+	for rows.Next() {
+		var i Redirect
+		if err := rows.Scan(
+			&i.Short,
+			&i.Url,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.PasswordHash,
+			&i.MaxClicks,
+			&i.Clicks,
+			&i.Title,
+			&i.ForcePreview,
+			&i.Passthrough,
+			&i.UtmPresetID,
+			&i.UtmCampaign,
+			&i.Rules,
+			&i.Targets,
+			&i.Notes,
+			&i.Tags,
+			&i.DeletedAt,
+			&i.Domain,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listVariantClicks = `-- name: ListVariantClicks :many
+SELECT variant, clicks
+FROM redirect_variant_clicks
+WHERE domain = $1 and short = $2
+ORDER BY variant
+`
+
+type ListVariantClicksParams struct {
+	Domain string
+	Short  string
+}
+
+type ListVariantClicksRow struct {
+	Variant int32
+	Clicks  int64
+}
+
+func (q *Queries) ListVariantClicks(ctx context.Context, arg ListVariantClicksParams) ([]ListVariantClicksRow, error) {
+	rows, err := q.db.Query(ctx, listVariantClicks, arg.Domain, arg.Short)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListVariantClicksRow
+	for rows.Next() {
+		var i ListVariantClicksRow
+		if err := rows.Scan(&i.Variant, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeRedirect = `-- name: PurgeRedirect :execrows
+DELETE FROM redirects
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is not null
+`
+
+type PurgeRedirectParams struct {
+	Domain string
+	Short  string
+	UserID string
+}
+
+func (q *Queries) PurgeRedirect(ctx context.Context, arg PurgeRedirectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeRedirect, arg.Domain, arg.Short, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeTrashedRedirects = `-- name: PurgeTrashedRedirects :execrows
+DELETE FROM redirects
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeTrashedRedirects(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeTrashedRedirects, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeRedirect = `-- name: RemoveRedirect :execrows
+DELETE FROM redirects
+WHERE domain = $1 and short = $2
+`
+
+type RemoveRedirectParams struct {
+	Domain string
+	Short  string
+}
+
+func (q *Queries) RemoveRedirect(ctx context.Context, arg RemoveRedirectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeRedirect, arg.Domain, arg.Short)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const resetVariantClicks = `-- name: ResetVariantClicks :exec
+DELETE FROM redirect_variant_clicks
+WHERE domain = $1 and short = $2
+`
+
+type ResetVariantClicksParams struct {
+	Domain string
+	Short  string
+}
+
+func (q *Queries) ResetVariantClicks(ctx context.Context, arg ResetVariantClicksParams) error {
+	_, err := q.db.Exec(ctx, resetVariantClicks, arg.Domain, arg.Short)
+	return err
+}
+
+const restoreRedirect = `-- name: RestoreRedirect :execrows
+UPDATE redirects
+SET deleted_at = null
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is not null
+`
+
+type RestoreRedirectParams struct {
+	Domain string
+	Short  string
+	UserID string
+}
+
+func (q *Queries) RestoreRedirect(ctx context.Context, arg RestoreRedirectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreRedirect, arg.Domain, arg.Short, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const saveRedirect = `-- name: SaveRedirect :execrows
+INSERT INTO redirects (domain, short, url, user_id, created_at, password_hash, max_clicks, title, force_preview, passthrough, utm_preset_id, utm_campaign, notes, tags)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (domain, short) DO NOTHING
 `
 
 type SaveRedirectParams struct {
-	Short     string
-	Url       string
-	UserID    string
-	CreatedAt time.Time
+	Domain       string
+	Short        string
+	Url          string
+	UserID       string
+	CreatedAt    time.Time
+	PasswordHash string
+	MaxClicks    int32
+	Title        string
+	ForcePreview bool
+	Passthrough  string
+	UtmPresetID  sql.NullString
+	UtmCampaign  string
+	Notes        string
+	Tags         []string
 }
 
-func (q *Queries) SaveRedirect(ctx context.Context, arg SaveRedirectParams) error {
-	_, err := q.db.Exec(ctx, saveRedirect,
+func (q *Queries) SaveRedirect(ctx context.Context, arg SaveRedirectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, saveRedirect,
+		arg.Domain,
 		arg.Short,
 		arg.Url,
 		arg.UserID,
 		arg.CreatedAt,
+		arg.PasswordHash,
+		arg.MaxClicks,
+		arg.Title,
+		arg.ForcePreview,
+		arg.Passthrough,
+		arg.UtmPresetID,
+		arg.UtmCampaign,
+		arg.Notes,
+		arg.Tags,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const transferAllRedirects = `-- name: TransferAllRedirects :many
+UPDATE redirects
+SET user_id = $1
+WHERE user_id = $2 and deleted_at is null
+RETURNING domain, short
+`
+
+type TransferAllRedirectsParams struct {
+	ToUserID   string
+	FromUserID string
+}
+
+type TransferAllRedirectsRow struct {
+	Domain string
+	Short  string
+}
+
+func (q *Queries) TransferAllRedirects(ctx context.Context, arg TransferAllRedirectsParams) ([]TransferAllRedirectsRow, error) {
+	rows, err := q.db.Query(ctx, transferAllRedirects, arg.ToUserID, arg.FromUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TransferAllRedirectsRow
+	for rows.Next() {
+		var i TransferAllRedirectsRow
+		if err := rows.Scan(&i.Domain, &i.Short); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const transferRedirect = `-- name: TransferRedirect :execrows
+UPDATE redirects
+SET user_id = $3
+WHERE domain = $1 and short = $2 and deleted_at is null
+`
+
+type TransferRedirectParams struct {
+	Domain string
+	Short  string
+	UserID string
+}
+
+func (q *Queries) TransferRedirect(ctx context.Context, arg TransferRedirectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, transferRedirect, arg.Domain, arg.Short, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const trashRedirect = `-- name: TrashRedirect :execrows
+UPDATE redirects
+SET deleted_at = now()
+WHERE domain = $1 and short = $2 and user_id = $3 and deleted_at is null
+`
+
+type TrashRedirectParams struct {
+	Domain string
+	Short  string
+	UserID string
+}
+
+func (q *Queries) TrashRedirect(ctx context.Context, arg TrashRedirectParams) (int64, error) {
+	result, err := q.db.Exec(ctx, trashRedirect, arg.Domain, arg.Short, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateRedirectDetails = `-- name: UpdateRedirectDetails :exec
+UPDATE redirects
+SET title = $4, notes = $5, tags = $6
+WHERE domain = $1 and short = $2 and user_id = $3
+`
+
+type UpdateRedirectDetailsParams struct {
+	Domain string
+	Short  string
+	UserID string
+	Title  string
+	Notes  string
+	Tags   []string
+}
+
+func (q *Queries) UpdateRedirectDetails(ctx context.Context, arg UpdateRedirectDetailsParams) error {
+	_, err := q.db.Exec(ctx, updateRedirectDetails,
+		arg.Domain,
+		arg.Short,
+		arg.UserID,
+		arg.Title,
+		arg.Notes,
+		arg.Tags,
+	)
+	return err
+}
+
+const updateRedirectRules = `-- name: UpdateRedirectRules :exec
+UPDATE redirects
+SET rules = $4
+WHERE domain = $1 and short = $2 and user_id = $3
+`
+
+type UpdateRedirectRulesParams struct {
+	Domain string
+	Short  string
+	UserID string
+	Rules  pgtype.JSONB
+}
+
+func (q *Queries) UpdateRedirectRules(ctx context.Context, arg UpdateRedirectRulesParams) error {
+	_, err := q.db.Exec(ctx, updateRedirectRules,
+		arg.Domain,
+		arg.Short,
+		arg.UserID,
+		arg.Rules,
+	)
+	return err
+}
+
+const updateRedirectTargets = `-- name: UpdateRedirectTargets :exec
+UPDATE redirects
+SET targets = $4
+WHERE domain = $1 and short = $2 and user_id = $3
+`
+
+type UpdateRedirectTargetsParams struct {
+	Domain  string
+	Short   string
+	UserID  string
+	Targets pgtype.JSONB
+}
+
+func (q *Queries) UpdateRedirectTargets(ctx context.Context, arg UpdateRedirectTargetsParams) error {
+	_, err := q.db.Exec(ctx, updateRedirectTargets,
+		arg.Domain,
+		arg.Short,
+		arg.UserID,
+		arg.Targets,
 	)
 	return err
 }
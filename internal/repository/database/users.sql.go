@@ -9,30 +9,134 @@ import (
 	"context"
 )
 
-const getUserByGoogleId = `-- name: GetUserByGoogleId :one
-select id, email, google_provider_id from users where google_provider_id = $1
+const deleteUser = `-- name: DeleteUser :execrows
+delete from users where id = $1
 `
 
-func (q *Queries) GetUserByGoogleId(ctx context.Context, googleProviderID string) (User, error) {
-	row := q.db.QueryRow(ctx, getUserByGoogleId, googleProviderID)
+func (q *Queries) DeleteUser(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getUser = `-- name: GetUser :one
+select id, email, role, disabled from users where id = $1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id string) (User, error) {
+	row := q.db.QueryRow(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.Disabled,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+select id, email, role, disabled from users where email = $1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, email)
 	var i User
-	err := row.Scan(&i.ID, &i.Email, &i.GoogleProviderID)
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.Disabled,
+	)
 	return i, err
 }
 
+const listUsers = `-- name: ListUsers :many
+select id, email, role, disabled
+from users
+where $1::text = '' or id = $1::text or email ilike '%' || $1::text || '%'
+order by email
+limit $2
+`
+
+type ListUsersParams struct {
+	Query    string
+	PageSize int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsers, arg.Query, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Role,
+			&i.Disabled,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const saveUser = `-- name: SaveUser :exec
-INSERT INTO users (id, email, google_provider_id)
-VALUES ($1, $2, $3)
-ON CONFLICT (id) DO UPDATE SET email = excluded.email, google_provider_id = excluded.google_provider_id
+INSERT INTO users (id, email)
+VALUES ($1, $2)
+ON CONFLICT (id) DO UPDATE SET email = excluded.email
 `
 
 type SaveUserParams struct {
-	ID               string
-	Email            string
-	GoogleProviderID string
+	ID    string
+	Email string
 }
 
 func (q *Queries) SaveUser(ctx context.Context, arg SaveUserParams) error {
-	_, err := q.db.Exec(ctx, saveUser, arg.ID, arg.Email, arg.GoogleProviderID)
+	_, err := q.db.Exec(ctx, saveUser, arg.ID, arg.Email)
 	return err
 }
+
+const updateUserDisabled = `-- name: UpdateUserDisabled :execrows
+update users set disabled = $2 where id = $1
+`
+
+type UpdateUserDisabledParams struct {
+	ID       string
+	Disabled bool
+}
+
+func (q *Queries) UpdateUserDisabled(ctx context.Context, arg UpdateUserDisabledParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserDisabled, arg.ID, arg.Disabled)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserRole = `-- name: UpdateUserRole :execrows
+update users set role = $2 where id = $1
+`
+
+type UpdateUserRoleParams struct {
+	ID   string
+	Role string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
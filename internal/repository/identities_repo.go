@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+)
+
+type DBIdentitiesRepository struct {
+	queries *database.Queries
+}
+
+func NewDBIdentitiesRepository(pool *pgxpool.Pool) *DBIdentitiesRepository {
+	return &DBIdentitiesRepository{queries: database.New(pool)}
+}
+
+func (d *DBIdentitiesRepository) Get(ctx context.Context, provider string, subject string) (internal.Identity, error) {
+	dto, err := d.queries.GetUserIdentity(ctx, database.GetUserIdentityParams{Provider: provider, Subject: subject})
+	if err != nil {
+		return internal.Identity{}, err
+	}
+	return dtoToIdentity(dto), nil
+}
+
+func (d *DBIdentitiesRepository) ListByUser(ctx context.Context, userID string) ([]internal.Identity, error) {
+	dtos, err := d.queries.ListUserIdentitiesByUserId(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := make([]internal.Identity, len(dtos))
+	for i, dto := range dtos {
+		identities[i] = dtoToIdentity(dto)
+	}
+	return identities, nil
+}
+
+func (d *DBIdentitiesRepository) Save(ctx context.Context, identity internal.Identity) error {
+	return d.queries.SaveUserIdentity(ctx, database.SaveUserIdentityParams{
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		UserID:    identity.UserID,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	})
+}
+
+func (d *DBIdentitiesRepository) Delete(ctx context.Context, provider string, subject string, userID string) error {
+	rows, err := d.queries.DeleteUserIdentity(ctx, database.DeleteUserIdentityParams{Provider: provider, Subject: subject, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func dtoToIdentity(dto database.UserIdentity) internal.Identity {
+	return internal.Identity{
+		Provider:  dto.Provider,
+		Subject:   dto.Subject,
+		UserID:    dto.UserID,
+		Email:     dto.Email,
+		CreatedAt: dto.CreatedAt,
+	}
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+)
+
+type DBInvitationsRepository struct {
+	queries *database.Queries
+}
+
+func NewDBInvitationsRepository(pool *pgxpool.Pool) *DBInvitationsRepository {
+	return &DBInvitationsRepository{queries: database.New(pool)}
+}
+
+func (d *DBInvitationsRepository) List(ctx context.Context) ([]internal.Invitation, error) {
+	dtos, err := d.queries.ListInvitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := make([]internal.Invitation, len(dtos))
+	for i, dto := range dtos {
+		invitations[i] = dtoToInvitation(dto)
+	}
+	return invitations, nil
+}
+
+// Save invites the email, replacing an earlier invitation of it.
+func (d *DBInvitationsRepository) Save(ctx context.Context, invitation internal.Invitation) error {
+	return d.queries.SaveInvitation(ctx, database.SaveInvitationParams{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		InvitedBy: invitation.InvitedBy,
+		CreatedAt: invitation.CreatedAt,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+}
+
+// Consume returns and deletes the invitation of the email if it has not expired yet.
+func (d *DBInvitationsRepository) Consume(ctx context.Context, email string) (internal.Invitation, error) {
+	dto, err := d.queries.ConsumeInvitation(ctx, email)
+	if err != nil {
+		return internal.Invitation{}, err
+	}
+	return dtoToInvitation(dto), nil
+}
+
+func (d *DBInvitationsRepository) Delete(ctx context.Context, id string) error {
+	rows, err := d.queries.DeleteInvitation(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func dtoToInvitation(dto database.Invitation) internal.Invitation {
+	return internal.Invitation{
+		ID:        dto.ID,
+		Email:     dto.Email,
+		InvitedBy: dto.InvitedBy,
+		CreatedAt: dto.CreatedAt,
+		ExpiresAt: dto.ExpiresAt,
+	}
+}
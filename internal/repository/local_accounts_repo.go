@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+)
+
+type DBLocalAccountsRepository struct {
+	queries *database.Queries
+}
+
+func NewDBLocalAccountsRepository(pool *pgxpool.Pool) *DBLocalAccountsRepository {
+	return &DBLocalAccountsRepository{queries: database.New(pool)}
+}
+
+func (d *DBLocalAccountsRepository) Get(ctx context.Context, email string) (internal.LocalAccount, error) {
+	dto, err := d.queries.GetLocalAccount(ctx, email)
+	if err != nil {
+		return internal.LocalAccount{}, err
+	}
+
+	account := internal.LocalAccount{
+		Email:         dto.Email,
+		UserID:        dto.UserID.String,
+		PasswordHash:  dto.PasswordHash,
+		EmailVerified: dto.EmailVerified,
+		CreatedAt:     dto.CreatedAt,
+		UpdatedAt:     dto.UpdatedAt,
+	}
+	return account, nil
+}
+
+func (d *DBLocalAccountsRepository) Save(ctx context.Context, account internal.LocalAccount) error {
+	return d.queries.SaveLocalAccount(ctx, database.SaveLocalAccountParams{
+		Email:         account.Email,
+		UserID:        nullString(account.UserID),
+		PasswordHash:  account.PasswordHash,
+		EmailVerified: account.EmailVerified,
+		CreatedAt:     account.CreatedAt,
+		UpdatedAt:     account.UpdatedAt,
+	})
+}
+
+// Delete removes the account together with its tokens.
+func (d *DBLocalAccountsRepository) Delete(ctx context.Context, email string) error {
+	return d.queries.DeleteLocalAccount(ctx, email)
+}
+
+type DBAccountTokensRepository struct {
+	queries *database.Queries
+}
+
+func NewDBAccountTokensRepository(pool *pgxpool.Pool) *DBAccountTokensRepository {
+	return &DBAccountTokensRepository{queries: database.New(pool)}
+}
+
+func (d *DBAccountTokensRepository) Save(ctx context.Context, token internal.AccountToken) error {
+	return d.queries.SaveAccountToken(ctx, database.SaveAccountTokenParams{
+		ID:        token.ID,
+		Email:     token.Email,
+		Purpose:   string(token.Purpose),
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
+
+// Consume returns and deletes a token that has not expired yet, so every token works only once.
+func (d *DBAccountTokensRepository) Consume(ctx context.Context, id string, purpose internal.TokenPurpose) (internal.AccountToken, error) {
+	dto, err := d.queries.ConsumeAccountToken(ctx, database.ConsumeAccountTokenParams{ID: id, Purpose: string(purpose)})
+	if err != nil {
+		return internal.AccountToken{}, err
+	}
+
+	token := internal.AccountToken{
+		ID:        dto.ID,
+		Email:     dto.Email,
+		Purpose:   internal.TokenPurpose(dto.Purpose),
+		CreatedAt: dto.CreatedAt,
+		ExpiresAt: dto.ExpiresAt,
+	}
+	return token, nil
+}
+
+func (d *DBAccountTokensRepository) DeleteExpired(ctx context.Context) (int, error) {
+	rows, err := d.queries.DeleteExpiredAccountTokens(ctx)
+	return int(rows), err
+}
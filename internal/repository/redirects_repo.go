@@ -2,76 +2,473 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pscheid92/dwarferl/internal"
 	"github.com/pscheid92/dwarferl/internal/repository/database"
+	"math"
+	"time"
 )
 
 type DBRedirectsRepository struct {
+	pool    *pgxpool.Pool
 	queries *database.Queries
 }
 
 func NewDBRedirectsRepository(pool *pgxpool.Pool) *DBRedirectsRepository {
-	return &DBRedirectsRepository{queries: database.New(pool)}
+	return &DBRedirectsRepository{pool: pool, queries: database.New(pool)}
 }
 
-func (d DBRedirectsRepository) List(ctx context.Context, userID string) ([]internal.Redirect, error) {
-	dtos, err := d.queries.ListRedirectsByUserId(ctx, userID)
+// endOfTime is used for open ranges and as start of descending listings, no link is ever created after it.
+var endOfTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+func (d DBRedirectsRepository) List(ctx context.Context, userID string, filter internal.RedirectFilter, sort internal.RedirectSort, after *internal.RedirectCursor, limit int) ([]internal.Redirect, error) {
+	until := filter.CreatedUntil
+	if until.IsZero() {
+		until = endOfTime
+	}
+
+	// the first page starts before every possible key
+	cursor := internal.RedirectCursor{CreatedAt: endOfTime, Clicks: math.MaxInt64}
+	if after != nil {
+		cursor = *after
+	}
+
+	var dtos []database.Redirect
+	var err error
+
+	switch sort {
+	case internal.SortByShort:
+		dtos, err = d.queries.ListRedirectsByShort(ctx, database.ListRedirectsByShortParams{
+			UserID:       userID,
+			Query:        filter.Query,
+			Tag:          filter.Tag,
+			CreatedFrom:  filter.CreatedFrom,
+			CreatedUntil: until,
+			CursorShort:  cursor.Short,
+			CursorDomain: cursor.Domain,
+			PageSize:     int32(limit),
+		})
+	case internal.SortByClicks:
+		dtos, err = d.queries.ListRedirectsByClicks(ctx, database.ListRedirectsByClicksParams{
+			UserID:       userID,
+			Query:        filter.Query,
+			Tag:          filter.Tag,
+			CreatedFrom:  filter.CreatedFrom,
+			CreatedUntil: until,
+			CursorClicks: int64(cursor.Clicks),
+			CursorShort:  cursor.Short,
+			CursorDomain: cursor.Domain,
+			PageSize:     int32(limit),
+		})
+	default:
+		dtos, err = d.queries.ListRedirectsByCreatedAt(ctx, database.ListRedirectsByCreatedAtParams{
+			UserID:          userID,
+			Query:           filter.Query,
+			Tag:             filter.Tag,
+			CreatedFrom:     filter.CreatedFrom,
+			CreatedUntil:    until,
+			CursorCreatedAt: cursor.CreatedAt,
+			CursorShort:     cursor.Short,
+			CursorDomain:    cursor.Domain,
+			PageSize:        int32(limit),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redirects := make([]internal.Redirect, len(dtos))
+	for i, r := range dtos {
+		if redirects[i], err = dtoToRedirect(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return redirects, nil
+}
+
+func (d DBRedirectsRepository) ListAll(ctx context.Context, ownerID string, query string, after *internal.RedirectCursor, limit int) ([]internal.Redirect, error) {
+	cursor := internal.RedirectCursor{CreatedAt: endOfTime}
+	if after != nil {
+		cursor = *after
+	}
+
+	dtos, err := d.queries.ListAllRedirects(ctx, database.ListAllRedirectsParams{
+		UserID:          ownerID,
+		Query:           query,
+		CursorCreatedAt: cursor.CreatedAt,
+		CursorShort:     cursor.Short,
+		CursorDomain:    cursor.Domain,
+		PageSize:        int32(limit),
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	redirects := make([]internal.Redirect, len(dtos))
 	for i, r := range dtos {
-		redirects[i] = dtoToRedirect(r)
+		if redirects[i], err = dtoToRedirect(r); err != nil {
+			return nil, err
+		}
 	}
 
 	return redirects, nil
 }
 
-func (d DBRedirectsRepository) GetRedirectByShort(ctx context.Context, short string, userID string) (internal.Redirect, error) {
-	args := database.GetRedirectByShortParams{Short: short, UserID: userID}
+func (d DBRedirectsRepository) Tags(ctx context.Context, userID string) ([]string, error) {
+	return d.queries.ListTagsByUserId(ctx, userID)
+}
+
+func (d DBRedirectsRepository) Campaigns(ctx context.Context, userID string) ([]internal.CampaignStats, error) {
+	rows, err := d.queries.ListCampaignsByUserId(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]internal.CampaignStats, len(rows))
+	for i, r := range rows {
+		stats[i] = internal.CampaignStats{
+			Campaign: r.UtmCampaign,
+			Links:    int(r.Links),
+			Clicks:   int(r.Clicks),
+		}
+	}
+
+	return stats, nil
+}
+
+func (d DBRedirectsRepository) GetRedirectByShort(ctx context.Context, domain string, short string, userID string) (internal.Redirect, error) {
+	args := database.GetRedirectByShortParams{Domain: domain, Short: short, UserID: userID}
 	dto, err := d.queries.GetRedirectByShort(ctx, args)
 	if err != nil {
 		return internal.Redirect{}, err
 	}
-	return dtoToRedirect(dto), nil
+	return dtoToRedirect(dto)
+}
+
+func (d DBRedirectsRepository) Lookup(ctx context.Context, domain string, short string) (internal.Redirect, error) {
+	dto, err := d.queries.GetRedirect(ctx, database.GetRedirectParams{Domain: domain, Short: short})
+	if err != nil {
+		return internal.Redirect{}, err
+	}
+	return dtoToRedirect(dto)
 }
 
 func (d DBRedirectsRepository) Save(ctx context.Context, redirect internal.Redirect) error {
 	params := database.SaveRedirectParams{
-		Short:     redirect.Short,
-		Url:       redirect.URL,
-		UserID:    redirect.UserID,
-		CreatedAt: redirect.CreatedAt,
+		Domain:       redirect.Domain,
+		Short:        redirect.Short,
+		Url:          redirect.URL,
+		UserID:       redirect.UserID,
+		CreatedAt:    redirect.CreatedAt,
+		PasswordHash: redirect.PasswordHash,
+		MaxClicks:    int32(redirect.MaxClicks),
+		Title:        redirect.Title,
+		ForcePreview: redirect.ForcePreview,
+		Passthrough:  string(redirect.Passthrough),
+		UtmPresetID:  sql.NullString{String: redirect.UTMPresetID, Valid: redirect.UTMPresetID != ""},
+		UtmCampaign:  redirect.UTMCampaign,
+		Notes:        redirect.Notes,
+		Tags:         nonNilTags(redirect.Tags),
 	}
-	err := d.queries.SaveRedirect(ctx, params)
+	rows, err := d.queries.SaveRedirect(ctx, params)
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return internal.ErrShortTaken
+	}
 	return nil
 }
 
-func (d DBRedirectsRepository) Expand(ctx context.Context, short string) (string, error) {
-	url, err := d.queries.ExpandRedirect(ctx, short)
+// Import inserts the redirects on the default domain in one transaction and reports for each
+// whether it was created. Redirects whose short is already taken are left untouched.
+func (d DBRedirectsRepository) Import(ctx context.Context, redirects []internal.Redirect) ([]bool, error) {
+	tx, err := d.pool.Begin(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	queries := d.queries.WithTx(tx)
+	created := make([]bool, len(redirects))
+	for i, redirect := range redirects {
+		rows, err := queries.ImportRedirect(ctx, database.ImportRedirectParams{
+			Short:     redirect.Short,
+			Url:       redirect.URL,
+			UserID:    redirect.UserID,
+			CreatedAt: redirect.CreatedAt,
+			Title:     redirect.Title,
+			Notes:     redirect.Notes,
+			Tags:      nonNilTags(redirect.Tags),
+			Clicks:    int64(redirect.Clicks),
+		})
+		if err != nil {
+			return nil, err
+		}
+		created[i] = rows == 1
 	}
-	return url, nil
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return created, nil
 }
 
-func (d DBRedirectsRepository) Delete(ctx context.Context, short string, userID string) error {
-	return d.queries.DeleteRedirect(ctx, database.DeleteRedirectParams{
+func (d DBRedirectsRepository) UpdateDetails(ctx context.Context, domain string, short string, userID string, details internal.RedirectDetails) error {
+	return d.queries.UpdateRedirectDetails(ctx, database.UpdateRedirectDetailsParams{
+		Domain: domain,
 		Short:  short,
 		UserID: userID,
+		Title:  details.Title,
+		Notes:  details.Notes,
+		Tags:   nonNilTags(details.Tags),
 	})
 }
 
-func dtoToRedirect(dto database.Redirect) internal.Redirect {
-	return internal.Redirect{
-		Short:     dto.Short,
-		URL:       dto.Url,
-		UserID:    dto.UserID,
-		CreatedAt: dto.CreatedAt,
+func (d DBRedirectsRepository) UpdateRules(ctx context.Context, domain string, short string, userID string, rules []internal.TargetingRule) error {
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	return d.queries.UpdateRedirectRules(ctx, database.UpdateRedirectRulesParams{
+		Domain: domain,
+		Short:  short,
+		UserID: userID,
+		Rules:  pgtype.JSONB{Bytes: encoded, Status: pgtype.Present},
+	})
+}
+
+func (d DBRedirectsRepository) UpdateTargets(ctx context.Context, domain string, short string, userID string, targets []internal.WeightedTarget) error {
+	encoded, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	queries := d.queries.WithTx(tx)
+	params := database.UpdateRedirectTargetsParams{
+		Domain:  domain,
+		Short:   short,
+		UserID:  userID,
+		Targets: pgtype.JSONB{Bytes: encoded, Status: pgtype.Present},
+	}
+	if err := queries.UpdateRedirectTargets(ctx, params); err != nil {
+		return err
+	}
+
+	// variant numbers refer to positions in the old target list
+	if err := queries.ResetVariantClicks(ctx, database.ResetVariantClicksParams{Domain: domain, Short: short}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (d DBRedirectsRepository) CountVariantClick(ctx context.Context, domain string, short string, variant int) error {
+	return d.queries.CountVariantClick(ctx, database.CountVariantClickParams{
+		Domain:  domain,
+		Short:   short,
+		Variant: int32(variant),
+	})
+}
+
+func (d DBRedirectsRepository) VariantClicks(ctx context.Context, domain string, short string) (map[int]int, error) {
+	rows, err := d.queries.ListVariantClicks(ctx, database.ListVariantClicksParams{Domain: domain, Short: short})
+	if err != nil {
+		return nil, err
+	}
+
+	clicks := make(map[int]int, len(rows))
+	for _, r := range rows {
+		clicks[int(r.Variant)] = int(r.Clicks)
+	}
+	return clicks, nil
+}
+
+func (d DBRedirectsRepository) Expand(ctx context.Context, domain string, short string) (internal.Redirect, error) {
+	dto, err := d.queries.ExpandRedirect(ctx, database.ExpandRedirectParams{Domain: domain, Short: short})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return internal.Redirect{}, err
+	}
+
+	if err == nil {
+		return dtoToRedirect(dto)
+	}
+
+	// the update matched nothing: either the short is unknown or its clicks are used up
+	if _, err := d.queries.GetRedirect(ctx, database.GetRedirectParams{Domain: domain, Short: short}); err != nil {
+		return internal.Redirect{}, err
+	}
+	return internal.Redirect{}, internal.ErrClicksExhausted
+}
+
+// Delete moves the redirect to the trash. Its short stays taken until the redirect is purged.
+func (d DBRedirectsRepository) Delete(ctx context.Context, domain string, short string, userID string) error {
+	rows, err := d.queries.TrashRedirect(ctx, database.TrashRedirectParams{
+		Domain: domain,
+		Short:  short,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d DBRedirectsRepository) Trash(ctx context.Context, userID string) ([]internal.Redirect, error) {
+	dtos, err := d.queries.ListTrashedRedirectsByUserId(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	redirects := make([]internal.Redirect, len(dtos))
+	for i, r := range dtos {
+		if redirects[i], err = dtoToRedirect(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return redirects, nil
+}
+
+func (d DBRedirectsRepository) Restore(ctx context.Context, domain string, short string, userID string) error {
+	rows, err := d.queries.RestoreRedirect(ctx, database.RestoreRedirectParams{
+		Domain: domain,
+		Short:  short,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d DBRedirectsRepository) Purge(ctx context.Context, domain string, short string, userID string) error {
+	rows, err := d.queries.PurgeRedirect(ctx, database.PurgeRedirectParams{
+		Domain: domain,
+		Short:  short,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d DBRedirectsRepository) PurgeTrashedBefore(ctx context.Context, before time.Time) (int, error) {
+	rows, err := d.queries.PurgeTrashedRedirects(ctx, sql.NullTime{Time: before, Valid: true})
+	if err != nil {
+		return 0, err
+	}
+	return int(rows), nil
+}
+
+func (d DBRedirectsRepository) Transfer(ctx context.Context, domain string, short string, userID string) error {
+	rows, err := d.queries.TransferRedirect(ctx, database.TransferRedirectParams{
+		Domain: domain,
+		Short:  short,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// TransferAll returns the link IDs of the transferred redirects.
+func (d DBRedirectsRepository) TransferAll(ctx context.Context, fromUserID string, toUserID string) ([]string, error) {
+	rows, err := d.queries.TransferAllRedirects(ctx, database.TransferAllRedirectsParams{
+		ToUserID:   toUserID,
+		FromUserID: fromUserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = internal.LinkID(r.Domain, r.Short)
+	}
+	return ids, nil
+}
+
+func (d DBRedirectsRepository) Remove(ctx context.Context, domain string, short string) error {
+	rows, err := d.queries.RemoveRedirect(ctx, database.RemoveRedirectParams{Domain: domain, Short: short})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func dtoToRedirect(dto database.Redirect) (internal.Redirect, error) {
+	var rules []internal.TargetingRule
+	if dto.Rules.Status == pgtype.Present {
+		if err := json.Unmarshal(dto.Rules.Bytes, &rules); err != nil {
+			return internal.Redirect{}, err
+		}
+	}
+
+	var targets []internal.WeightedTarget
+	if dto.Targets.Status == pgtype.Present {
+		if err := json.Unmarshal(dto.Targets.Bytes, &targets); err != nil {
+			return internal.Redirect{}, err
+		}
+	}
+
+	redirect := internal.Redirect{
+		Domain:       dto.Domain,
+		Short:        dto.Short,
+		URL:          dto.Url,
+		UserID:       dto.UserID,
+		CreatedAt:    dto.CreatedAt,
+		PasswordHash: dto.PasswordHash,
+		MaxClicks:    int(dto.MaxClicks),
+		Clicks:       int(dto.Clicks),
+		Title:        dto.Title,
+		ForcePreview: dto.ForcePreview,
+		Passthrough:  internal.Passthrough(dto.Passthrough),
+		UTMPresetID:  dto.UtmPresetID.String,
+		UTMCampaign:  dto.UtmCampaign,
+		Rules:        rules,
+		Targets:      targets,
+		Notes:        dto.Notes,
+		Tags:         dto.Tags,
+		DeletedAt:    dto.DeletedAt.Time,
+	}
+	return redirect, nil
+}
+
+// nonNilTags avoids a nil slice being stored as NULL in the not null tags column.
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
 	}
+	return tags
 }
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+	"time"
+)
+
+type DBSessionsRepository struct {
+	queries *database.Queries
+}
+
+func NewDBSessionsRepository(pool *pgxpool.Pool) *DBSessionsRepository {
+	return &DBSessionsRepository{queries: database.New(pool)}
+}
+
+func (d *DBSessionsRepository) Get(ctx context.Context, id string) (internal.Session, error) {
+	dto, err := d.queries.GetSession(ctx, id)
+	if err != nil {
+		return internal.Session{}, err
+	}
+	return dtoToSession(dto), nil
+}
+
+func (d *DBSessionsRepository) Save(ctx context.Context, session internal.Session) error {
+	return d.queries.SaveSession(ctx, database.SaveSessionParams{
+		ID:         session.ID,
+		UserID:     nullString(session.UserID),
+		Data:       session.Data,
+		UserAgent:  session.UserAgent,
+		Ip:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+	})
+}
+
+func (d *DBSessionsRepository) Touch(ctx context.Context, id string, lastSeen time.Time, ip string) error {
+	return d.queries.TouchSession(ctx, database.TouchSessionParams{ID: id, LastSeenAt: lastSeen, Ip: ip})
+}
+
+func (d *DBSessionsRepository) Delete(ctx context.Context, id string) error {
+	return d.queries.DeleteSession(ctx, id)
+}
+
+func (d *DBSessionsRepository) ListByUser(ctx context.Context, userID string) ([]internal.Session, error) {
+	dtos, err := d.queries.ListSessionsByUserId(ctx, nullString(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]internal.Session, len(dtos))
+	for i, s := range dtos {
+		sessions[i] = dtoToSession(s)
+	}
+	return sessions, nil
+}
+
+func (d *DBSessionsRepository) DeleteForUser(ctx context.Context, id string, userID string) error {
+	rows, err := d.queries.DeleteUserSession(ctx, database.DeleteUserSessionParams{ID: id, UserID: nullString(userID)})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DBSessionsRepository) DeleteAllForUser(ctx context.Context, userID string) (int, error) {
+	rows, err := d.queries.DeleteSessionsByUserId(ctx, nullString(userID))
+	return int(rows), err
+}
+
+func (d *DBSessionsRepository) DeleteExpired(ctx context.Context) (int, error) {
+	rows, err := d.queries.DeleteExpiredSessions(ctx)
+	return int(rows), err
+}
+
+func dtoToSession(dto database.Session) internal.Session {
+	return internal.Session{
+		ID:         dto.ID,
+		UserID:     dto.UserID.String,
+		Data:       dto.Data,
+		UserAgent:  dto.UserAgent,
+		IP:         dto.Ip,
+		CreatedAt:  dto.CreatedAt,
+		LastSeenAt: dto.LastSeenAt,
+		ExpiresAt:  dto.ExpiresAt,
+	}
+}
+
+// nullString stores empty strings as null, like anonymous sessions without an owner.
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+)
+
+type DBShortCodeSequence struct {
+	queries *database.Queries
+}
+
+func NewDBShortCodeSequence(pool *pgxpool.Pool) *DBShortCodeSequence {
+	return &DBShortCodeSequence{queries: database.New(pool)}
+}
+
+func (d *DBShortCodeSequence) Next(ctx context.Context) (int64, error) {
+	return d.queries.NextShortCode(ctx)
+}
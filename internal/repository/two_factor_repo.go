@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+	"time"
+)
+
+type DBTwoFactorRepository struct {
+	pool    *pgxpool.Pool
+	queries *database.Queries
+}
+
+func NewDBTwoFactorRepository(pool *pgxpool.Pool) *DBTwoFactorRepository {
+	return &DBTwoFactorRepository{pool: pool, queries: database.New(pool)}
+}
+
+func (d *DBTwoFactorRepository) Get(ctx context.Context, userID string) (internal.TwoFactor, error) {
+	dto, err := d.queries.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return internal.TwoFactor{}, err
+	}
+
+	twoFactor := internal.TwoFactor{
+		UserID:      dto.UserID,
+		Secret:      dto.Secret,
+		Enabled:     dto.Enabled,
+		LastCounter: dto.LastCounter,
+		CreatedAt:   dto.CreatedAt,
+	}
+	return twoFactor, nil
+}
+
+// Save stores a pending secret. The secret of enabled two-factor authentication is left untouched.
+func (d *DBTwoFactorRepository) Save(ctx context.Context, twoFactor internal.TwoFactor) error {
+	return d.queries.SaveTwoFactor(ctx, database.SaveTwoFactorParams{
+		UserID:    twoFactor.UserID,
+		Secret:    twoFactor.Secret,
+		CreatedAt: twoFactor.CreatedAt,
+	})
+}
+
+func (d *DBTwoFactorRepository) Enable(ctx context.Context, userID string, counter int64, recoveryCodes []string) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	queries := d.queries.WithTx(tx)
+	rows, err := queries.EnableTwoFactor(ctx, database.EnableTwoFactorParams{UserID: userID, LastCounter: counter})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+
+	if err := saveRecoveryCodes(ctx, queries, userID, recoveryCodes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *DBTwoFactorRepository) UseCounter(ctx context.Context, userID string, counter int64) error {
+	rows, err := d.queries.UseTwoFactorCounter(ctx, database.UseTwoFactorCounterParams{UserID: userID, LastCounter: counter})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DBTwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	queries := d.queries.WithTx(tx)
+	if err := saveRecoveryCodes(ctx, queries, userID, recoveryCodes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *DBTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID string, recoveryCode string) error {
+	rows, err := d.queries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{UserID: userID, CodeHash: recoveryCode})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DBTwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	count, err := d.queries.CountRecoveryCodes(ctx, userID)
+	return int(count), err
+}
+
+// Delete removes the secret together with the recovery codes.
+func (d *DBTwoFactorRepository) Delete(ctx context.Context, userID string) error {
+	return d.queries.DeleteTwoFactor(ctx, userID)
+}
+
+// saveRecoveryCodes replaces all recovery codes of the user.
+func saveRecoveryCodes(ctx context.Context, queries *database.Queries, userID string, recoveryCodes []string) error {
+	if err := queries.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, code := range recoveryCodes {
+		params := database.SaveRecoveryCodeParams{UserID: userID, CodeHash: code, CreatedAt: now}
+		if err := queries.SaveRecoveryCode(ctx, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,40 +2,105 @@ package repository
 
 import (
 	"context"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pscheid92/dwarferl/internal"
 	"github.com/pscheid92/dwarferl/internal/repository/database"
 )
 
 type DBUsersRepository struct {
+	pool    *pgxpool.Pool
 	queries *database.Queries
 }
 
 func NewDBUsersRepository(pool *pgxpool.Pool) *DBUsersRepository {
-	return &DBUsersRepository{queries: database.New(pool)}
+	return &DBUsersRepository{pool: pool, queries: database.New(pool)}
 }
 
-func (d *DBUsersRepository) Save(ctx context.Context, user internal.User) error {
-	return d.queries.SaveUser(ctx, database.SaveUserParams{
-		ID:               user.ID,
-		Email:            user.Email,
-		GoogleProviderID: user.GoogleID,
-	})
+func (d *DBUsersRepository) List(ctx context.Context, query string, limit int) ([]internal.User, error) {
+	dtos, err := d.queries.ListUsers(ctx, database.ListUsersParams{Query: query, PageSize: int32(limit)})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]internal.User, len(dtos))
+	for i, u := range dtos {
+		users[i] = dtoToUser(u)
+	}
+	return users, nil
 }
 
-func (d *DBUsersRepository) GetByGoogleID(ctx context.Context, googleID string) (internal.User, error) {
-	userDTO, err := d.queries.GetUserByGoogleId(ctx, googleID)
+func (d *DBUsersRepository) Get(ctx context.Context, id string) (internal.User, error) {
+	userDTO, err := d.queries.GetUser(ctx, id)
 	if err != nil {
 		return internal.User{}, err
 	}
+	return dtoToUser(userDTO), nil
+}
 
+func (d *DBUsersRepository) GetByEmail(ctx context.Context, email string) (internal.User, error) {
+	userDTO, err := d.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		return internal.User{}, err
+	}
 	return dtoToUser(userDTO), nil
 }
 
+func (d *DBUsersRepository) Save(ctx context.Context, user internal.User) error {
+	return d.queries.SaveUser(ctx, database.SaveUserParams{ID: user.ID, Email: user.Email})
+}
+
+func (d *DBUsersRepository) UpdateRole(ctx context.Context, id string, role internal.Role) error {
+	rows, err := d.queries.UpdateUserRole(ctx, database.UpdateUserRoleParams{ID: id, Role: string(role)})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DBUsersRepository) UpdateDisabled(ctx context.Context, id string, disabled bool) error {
+	rows, err := d.queries.UpdateUserDisabled(ctx, database.UpdateUserDisabledParams{ID: id, Disabled: disabled})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Delete removes the user together with everything they own. Their audit events are kept, but
+// lose the client IPs and the snapshots of the user's profile.
+func (d *DBUsersRepository) Delete(ctx context.Context, id string) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	queries := d.queries.WithTx(tx)
+	if err := queries.AnonymizeAuditEvents(ctx, id); err != nil {
+		return err
+	}
+
+	rows, err := queries.DeleteUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return tx.Commit(ctx)
+}
+
 func dtoToUser(dto database.User) internal.User {
 	return internal.User{
 		ID:       dto.ID,
 		Email:    dto.Email,
-		GoogleID: dto.GoogleProviderID,
+		Role:     internal.Role(dto.Role),
+		Disabled: dto.Disabled,
 	}
 }
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+)
+
+type DBUTMPresetsRepository struct {
+	queries *database.Queries
+}
+
+func NewDBUTMPresetsRepository(pool *pgxpool.Pool) *DBUTMPresetsRepository {
+	return &DBUTMPresetsRepository{queries: database.New(pool)}
+}
+
+func (d *DBUTMPresetsRepository) List(ctx context.Context, userID string) ([]internal.UTMPreset, error) {
+	dtos, err := d.queries.ListUTMPresetsByUserId(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	presets := make([]internal.UTMPreset, len(dtos))
+	for i, p := range dtos {
+		presets[i] = dtoToUTMPreset(p)
+	}
+
+	return presets, nil
+}
+
+func (d *DBUTMPresetsRepository) Get(ctx context.Context, id string, userID string) (internal.UTMPreset, error) {
+	dto, err := d.queries.GetUTMPreset(ctx, database.GetUTMPresetParams{ID: id, UserID: userID})
+	if err != nil {
+		return internal.UTMPreset{}, err
+	}
+	return dtoToUTMPreset(dto), nil
+}
+
+func (d *DBUTMPresetsRepository) Save(ctx context.Context, preset internal.UTMPreset) error {
+	return d.queries.SaveUTMPreset(ctx, database.SaveUTMPresetParams{
+		ID:        preset.ID,
+		UserID:    preset.UserID,
+		Name:      preset.Name,
+		Source:    preset.Source,
+		Medium:    preset.Medium,
+		Campaign:  preset.Campaign,
+		Term:      preset.Term,
+		Content:   preset.Content,
+		CreatedAt: preset.CreatedAt,
+	})
+}
+
+func (d *DBUTMPresetsRepository) Delete(ctx context.Context, id string, userID string) error {
+	return d.queries.DeleteUTMPreset(ctx, database.DeleteUTMPresetParams{ID: id, UserID: userID})
+}
+
+func dtoToUTMPreset(dto database.UtmPreset) internal.UTMPreset {
+	return internal.UTMPreset{
+		ID:        dto.ID,
+		UserID:    dto.UserID,
+		Name:      dto.Name,
+		Source:    dto.Source,
+		Medium:    dto.Medium,
+		Campaign:  dto.Campaign,
+		Term:      dto.Term,
+		Content:   dto.Content,
+		CreatedAt: dto.CreatedAt,
+	}
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/repository/database"
+	"time"
+)
+
+type DBWebhooksRepository struct {
+	pool    *pgxpool.Pool
+	queries *database.Queries
+}
+
+func NewDBWebhooksRepository(pool *pgxpool.Pool) *DBWebhooksRepository {
+	return &DBWebhooksRepository{pool: pool, queries: database.New(pool)}
+}
+
+func (d *DBWebhooksRepository) List(ctx context.Context, userID string) ([]internal.Webhook, error) {
+	dtos, err := d.queries.ListWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return dtosToWebhooks(dtos), nil
+}
+
+func (d *DBWebhooksRepository) ListSubscribed(ctx context.Context, userID string, event internal.WebhookEvent) ([]internal.Webhook, error) {
+	dtos, err := d.queries.ListSubscribedWebhooks(ctx, database.ListSubscribedWebhooksParams{UserID: userID, Event: string(event)})
+	if err != nil {
+		return nil, err
+	}
+	return dtosToWebhooks(dtos), nil
+}
+
+func (d *DBWebhooksRepository) Get(ctx context.Context, id string, userID string) (internal.Webhook, error) {
+	dto, err := d.queries.GetWebhook(ctx, database.GetWebhookParams{ID: id, UserID: userID})
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+	return dtoToWebhook(dto), nil
+}
+
+func (d *DBWebhooksRepository) Find(ctx context.Context, id string) (internal.Webhook, error) {
+	dto, err := d.queries.FindWebhook(ctx, id)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+	return dtoToWebhook(dto), nil
+}
+
+func (d *DBWebhooksRepository) Save(ctx context.Context, webhook internal.Webhook) error {
+	events := make([]string, len(webhook.Events))
+	for i, event := range webhook.Events {
+		events[i] = string(event)
+	}
+
+	return d.queries.SaveWebhook(ctx, database.SaveWebhookParams{
+		ID:        webhook.ID,
+		UserID:    webhook.UserID,
+		Url:       webhook.URL,
+		Secret:    webhook.Secret,
+		Events:    events,
+		CreatedAt: webhook.CreatedAt,
+	})
+}
+
+func (d *DBWebhooksRepository) Delete(ctx context.Context, id string, userID string) error {
+	rows, err := d.queries.DeleteWebhook(ctx, database.DeleteWebhookParams{ID: id, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Enqueue adds the deliveries of one event to the outbox, either all of them or none.
+func (d *DBWebhooksRepository) Enqueue(ctx context.Context, deliveries []internal.WebhookDelivery) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	queries := d.queries.WithTx(tx)
+	for _, delivery := range deliveries {
+		err := queries.SaveWebhookDelivery(ctx, database.SaveWebhookDeliveryParams{
+			ID:            delivery.ID,
+			WebhookID:     delivery.WebhookID,
+			Event:         string(delivery.Event),
+			Payload:       pgtype.JSONB{Bytes: delivery.Payload, Status: pgtype.Present},
+			NextAttemptAt: delivery.NextAttemptAt,
+			CreatedAt:     delivery.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *DBWebhooksRepository) Claim(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]internal.WebhookDelivery, error) {
+	dtos, err := d.queries.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		LeaseUntil: leaseUntil,
+		Now:        now,
+		BatchSize:  int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dtosToDeliveries(dtos), nil
+}
+
+func (d *DBWebhooksRepository) UpdateDelivery(ctx context.Context, delivery internal.WebhookDelivery) error {
+	return d.queries.UpdateWebhookDelivery(ctx, database.UpdateWebhookDeliveryParams{
+		ID:             delivery.ID,
+		Status:         string(delivery.Status),
+		Attempts:       int32(delivery.Attempts),
+		NextAttemptAt:  delivery.NextAttemptAt,
+		ResponseStatus: int32(delivery.ResponseStatus),
+		Error:          delivery.Error,
+		DeliveredAt:    sql.NullTime{Time: delivery.DeliveredAt, Valid: !delivery.DeliveredAt.IsZero()},
+	})
+}
+
+func (d *DBWebhooksRepository) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]internal.WebhookDelivery, error) {
+	dtos, err := d.queries.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{WebhookID: webhookID, Limit: int32(limit)})
+	if err != nil {
+		return nil, err
+	}
+	return dtosToDeliveries(dtos), nil
+}
+
+func (d *DBWebhooksRepository) DeleteDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	rows, err := d.queries.DeleteWebhookDeliveriesBefore(ctx, before)
+	return int(rows), err
+}
+
+func dtosToWebhooks(dtos []database.Webhook) []internal.Webhook {
+	webhooks := make([]internal.Webhook, len(dtos))
+	for i, dto := range dtos {
+		webhooks[i] = dtoToWebhook(dto)
+	}
+	return webhooks
+}
+
+func dtoToWebhook(dto database.Webhook) internal.Webhook {
+	events := make([]internal.WebhookEvent, len(dto.Events))
+	for i, event := range dto.Events {
+		events[i] = internal.WebhookEvent(event)
+	}
+
+	return internal.Webhook{
+		ID:        dto.ID,
+		UserID:    dto.UserID,
+		URL:       dto.Url,
+		Secret:    dto.Secret,
+		Events:    events,
+		CreatedAt: dto.CreatedAt,
+	}
+}
+
+func dtosToDeliveries(dtos []database.WebhookDelivery) []internal.WebhookDelivery {
+	deliveries := make([]internal.WebhookDelivery, len(dtos))
+	for i, dto := range dtos {
+		deliveries[i] = internal.WebhookDelivery{
+			ID:             dto.ID,
+			WebhookID:      dto.WebhookID,
+			Event:          internal.WebhookEvent(dto.Event),
+			Payload:        dto.Payload.Bytes,
+			Status:         internal.DeliveryStatus(dto.Status),
+			Attempts:       int(dto.Attempts),
+			NextAttemptAt:  dto.NextAttemptAt,
+			ResponseStatus: int(dto.ResponseStatus),
+			Error:          dto.Error,
+			CreatedAt:      dto.CreatedAt,
+			DeliveredAt:    dto.DeliveredAt.Time,
+		}
+	}
+	return deliveries
+}
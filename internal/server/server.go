@@ -1,17 +1,54 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-contrib/multitemplate"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/securecookie"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
+	"github.com/markbates/goth/providers/github"
 	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/openidConnect"
 	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
 	"github.com/pscheid92/dwarferl/internal/config"
+	"github.com/pscheid92/dwarferl/internal/exporter"
+	"github.com/pscheid92/dwarferl/internal/importer"
+	"github.com/pscheid92/dwarferl/internal/qrcode"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	visitorCookie         = "dwarferl_visitor"
+	visitorCookieLifetime = 365 * 24 * time.Hour
+
+	// confirmations of the preview page, valid for the redirect that follows
+	previewCookie         = "dwarferl_preview"
+	previewCookieLifetime = time.Minute
+
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 64
+
+	auditPageSize = 100
+
+	// sign-ins waiting for the second factor
+	challengeLifetime    = 5 * time.Minute
+	maxChallengeAttempts = 5
 )
 
 type Server struct {
@@ -22,25 +59,118 @@ type Server struct {
 	SessionStore sessions.Store
 
 	// services
-	Shortener internal.UrlShortenerService
-	Users     internal.UsersService
+	Shortener   internal.UrlShortenerService
+	Users       internal.UsersService
+	Presets     internal.UTMPresetService
+	Audit       internal.AuditService
+	Sessions    internal.SessionService
+	Accounts    internal.AccountService
+	TwoFactor   internal.TwoFactorService
+	Invitations internal.InvitationService
+	Privacy     internal.PrivacyService
+	Webhooks    internal.WebhookService
+
+	// configured external logins
+	providers []loginProvider
+
+	// reverse proxies whose forwarded headers are trusted
+	trustedProxies []*net.IPNet
+
+	// signs the preview confirmations, so anonymous visitors need no server-side session
+	previews *securecookie.SecureCookie
+}
+
+// loginProvider is an external login offered on the login and profile pages.
+type loginProvider struct {
+	Name  string
+	Label string
 }
 
-func New(config config.Configuration, store sessions.Store, shortener internal.UrlShortenerService, users internal.UsersService) *Server {
+func New(config config.Configuration, store sessions.Store, shortener internal.UrlShortenerService, users internal.UsersService, presets internal.UTMPresetService, audit internal.AuditService, sessionService internal.SessionService, accounts internal.AccountService, twoFactor internal.TwoFactorService, invitations internal.InvitationService, privacy internal.PrivacyService, webhooks internal.WebhookService) *Server {
 	svr := &Server{
 		Engine:       gin.New(),
 		Config:       config,
 		SessionStore: store,
 		Shortener:    shortener,
 		Users:        users,
+		Presets:      presets,
+		Audit:        audit,
+		Sessions:     sessionService,
+		Accounts:     accounts,
+		TwoFactor:    twoFactor,
+		Invitations:  invitations,
+		Privacy:      privacy,
+		Webhooks:     webhooks,
 	}
 
-	goth.UseProviders(google.New(config.GoogleClientKey, config.GoogleSecret, config.GoogleCallbackURL))
-	_ = svr.SetTrustedProxies(nil)
+	previewKey := sha256.Sum256([]byte("preview:" + config.SessionSecret))
+	svr.previews = securecookie.New(previewKey[:], nil).MaxAge(int(previewCookieLifetime.Seconds()))
+
+	store.Options(svr.sessionOptions(int(config.SessionLifetime.Seconds())))
+	svr.initProviders()
+	svr.initTrustedProxies()
 	svr.initHTMLRender()
 	return svr
 }
 
+// initTrustedProxies makes gin and requestDomain honour the forwarded headers of the
+// configured reverse proxies. Without any, forwarded headers are ignored.
+func (s *Server) initTrustedProxies() {
+	if len(s.Config.TrustedProxies) == 0 {
+		_ = s.SetTrustedProxies(nil)
+		return
+	}
+	_ = s.SetTrustedProxies(s.Config.TrustedProxies)
+
+	for _, proxy := range s.Config.TrustedProxies {
+		// single addresses are ranges of their own
+		if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+			proxy += "/32"
+		} else if ip != nil {
+			proxy += "/128"
+		}
+		if _, cidr, err := net.ParseCIDR(proxy); err == nil {
+			s.trustedProxies = append(s.trustedProxies, cidr)
+		}
+	}
+}
+
+// initProviders registers the external logins that are configured.
+func (s *Server) initProviders() {
+	var providers []goth.Provider
+
+	if s.Config.GoogleClientKey != "" {
+		providers = append(providers, google.New(s.Config.GoogleClientKey, s.Config.GoogleSecret, s.Config.GoogleCallbackURL))
+		s.providers = append(s.providers, loginProvider{Name: "google", Label: "Google"})
+	}
+
+	if s.Config.GitHubClientKey != "" {
+		providers = append(providers, github.New(s.Config.GitHubClientKey, s.Config.GitHubSecret, s.Config.GitHubCallbackURL, "user:email"))
+		s.providers = append(s.providers, loginProvider{Name: "github", Label: "GitHub"})
+	}
+
+	if s.Config.OIDCClientKey != "" {
+		provider, err := openidConnect.New(s.Config.OIDCClientKey, s.Config.OIDCSecret, s.Config.OIDCCallbackURL, s.Config.OIDCDiscoveryURL)
+		if err != nil {
+			log.Printf("error setting up %s login: %v", s.Config.OIDCName, err)
+		} else {
+			provider.SetName("oidc")
+			providers = append(providers, provider)
+			s.providers = append(s.providers, loginProvider{Name: "oidc", Label: s.Config.OIDCName})
+		}
+	}
+
+	goth.UseProviders(providers...)
+}
+
+func (s *Server) providerLabels() map[string]string {
+	labels := map[string]string{internal.ProviderLocal: "Email and password"}
+	for _, provider := range s.providers {
+		labels[provider.Name] = provider.Label
+	}
+	return labels
+}
+
 func (s *Server) initHTMLRender() {
 	renderer := multitemplate.NewRenderer()
 
@@ -71,6 +201,7 @@ func (s *Server) initHTMLRender() {
 }
 
 func (s *Server) InitRoutes() {
+	s.Use(requestContextMiddleware())
 	s.Use(sessions.Sessions("dwarferl_session", s.SessionStore))
 
 	// public routes
@@ -80,24 +211,120 @@ func (s *Server) InitRoutes() {
 
 		public.GET("/health", s.handleHealth())
 		public.GET("/:short", s.handleRedirect())
+		public.GET("/:short/*path", s.handleRedirect())
+		public.POST("/:short", s.handleUnlock())
+		public.GET("/preview/:short", s.handlePreview())
+		public.POST("/preview/:short", s.handleContinue())
 
 		public.GET("/login", s.handleLoginPage())
 		public.GET("/auth/:provider/callback", s.handleAuthCallback())
 		public.GET("/auth/:provider", s.handleAuth())
-		public.GET("/logout/:provider", s.handleLogout())
+		public.GET("/logout", s.handleLogout())
+
+		public.GET("/login/2fa", s.handleGetChallengePage())
+		public.POST("/login/2fa", s.handlePostChallengePage())
+	}
+
+	// local accounts
+	if s.Config.LocalAccounts {
+		public.POST("/login", s.handlePostLoginPage())
+
+		if s.Config.LocalRegistration {
+			public.GET("/register", s.handleGetRegistrationPage())
+			public.POST("/register", s.handlePostRegistrationPage())
+		}
+
+		public.GET("/verify", s.handleEmailVerification())
+		public.POST("/verify/resend", s.handlePostVerificationResend())
+
+		public.GET("/forgot", s.handleGetForgotPage())
+		public.POST("/forgot", s.handlePostForgotPage())
+		public.GET("/reset", s.handleGetResetPage())
+		public.POST("/reset", s.handlePostResetPage())
 	}
 
 	// private routes
 	authorized := public.Group("")
-	authorized.Use(s.authRequiredMiddleware())
+	authorized.Use(s.authRequiredMiddleware(), s.twoFactorPolicyMiddleware())
 	{
 		authorized.GET("/", s.handleIndexPage())
 
 		authorized.GET("/create", s.handleGetCreationPage())
 		authorized.POST("/create", s.handlePostCreationPage())
 
+		authorized.GET("/qr/:short", s.handleQRCode())
+
+		authorized.GET("/export", s.handleExport())
+
+		authorized.GET("/import", s.handleGetImportPage())
+		authorized.POST("/import", s.handlePostImportPage())
+
+		authorized.GET("/edit/:short", s.handleGetEditPage())
+		authorized.POST("/edit/:short", s.handlePostEditPage())
+
+		authorized.GET("/rules/:short", s.handleGetRulesPage())
+		authorized.POST("/rules/:short", s.handlePostRulesPage())
+
+		authorized.GET("/variants/:short", s.handleGetVariantsPage())
+		authorized.POST("/variants/:short", s.handlePostVariantsPage())
+
+		authorized.GET("/utm", s.handleGetPresetsPage())
+		authorized.POST("/utm", s.handlePostPresetsPage())
+		authorized.POST("/utm/delete/:id", s.handlePostPresetDeletion())
+
+		authorized.GET("/webhooks", s.handleWebhooksPage())
+		authorized.POST("/webhooks", s.handlePostWebhook())
+		authorized.GET("/webhooks/:id", s.handleWebhookPage())
+		authorized.POST("/webhooks/:id/test", s.handlePostWebhookTest())
+		authorized.POST("/webhooks/:id/delete", s.handlePostWebhookDeletion())
+
 		authorized.GET("/delete/:short", s.handleGetDeletionPage())
 		authorized.POST("/delete/:short", s.handlePostDeletionPage())
+
+		authorized.GET("/trash", s.handleTrashPage())
+		authorized.POST("/trash/restore/:short", s.handlePostRestoration())
+		authorized.POST("/trash/purge/:short", s.handlePostPurge())
+
+		authorized.GET("/audit", s.handleAuditPage(false))
+		authorized.GET("/audit/:short", s.handleLinkHistoryPage())
+
+		authorized.GET("/profile", s.handleProfilePage())
+		authorized.POST("/profile/unlink", s.handlePostIdentityUnlink())
+
+		authorized.GET("/profile/2fa", s.handleTwoFactorPage())
+		authorized.GET("/profile/2fa/qr", s.handleTwoFactorQRCode())
+		authorized.POST("/profile/2fa", s.handlePostTwoFactorEnable())
+		authorized.POST("/profile/2fa/recovery", s.handlePostRecoveryCodes())
+		authorized.POST("/profile/2fa/disable", s.handlePostTwoFactorDisable())
+
+		authorized.GET("/sessions", s.handleSessionsPage())
+		authorized.POST("/sessions/revoke/:id", s.handlePostSessionRevocation())
+		authorized.POST("/sessions/revoke-all", s.handlePostSessionRevocationAll())
+
+		authorized.GET("/account", s.handleAccountPage())
+		authorized.GET("/account/export", s.handleAccountExport())
+		authorized.POST("/account/delete", s.handlePostAccountDeletion())
+	}
+
+	// admin routes
+	admin := authorized.Group("/admin")
+	admin.Use(s.adminRequiredMiddleware())
+	{
+		admin.GET("", s.handleAdminIndex())
+
+		admin.GET("/users", s.handleAdminUsersPage())
+		admin.POST("/users/:id/disable", s.handlePostUserDisabled(true))
+		admin.POST("/users/:id/enable", s.handlePostUserDisabled(false))
+
+		admin.GET("/links", s.handleAdminLinksPage())
+		admin.POST("/links/:short/transfer", s.handlePostLinkTransfer())
+		admin.POST("/links/:short/remove", s.handlePostLinkRemoval())
+
+		admin.GET("/invitations", s.handleAdminInvitationsPage())
+		admin.POST("/invitations", s.handlePostInvitation())
+		admin.POST("/invitations/:id/revoke", s.handlePostInvitationRevocation())
+
+		admin.GET("/audit", s.handleAuditPage(true))
 	}
 }
 
@@ -110,207 +337,2408 @@ func (s *Server) handleHealth() gin.HandlerFunc {
 func (s *Server) handleRedirect() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
+		domain := s.requestDomain(c)
 		short := c.Param("short")
-		redirect, err := s.Shortener.ExpandShortURL(ctx, short)
+
+		redirect, err := s.Shortener.LookupShortURL(ctx, domain, short)
 		if err != nil {
 			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
 
-		c.Header("Cache-Control", "private, max-age=90")
-		c.Header("Referrer-Policy", "unsafe-url")
-		c.Redirect(http.StatusMovedPermanently, redirect)
-	}
-}
+		// only passthrough redirects know what to do with a path suffix
+		visit := internal.Visit{
+			Path:           c.Param("path"),
+			Query:          c.Request.URL.Query(),
+			UserAgent:      c.GetHeader("User-Agent"),
+			AcceptLanguage: c.GetHeader("Accept-Language"),
+		}
+		if len(redirect.Targets) > 0 {
+			visit.VisitorID = s.visitorID(c)
+		}
+		if strings.Trim(visit.Path, "/") != "" && redirect.Passthrough == internal.PassthroughNone {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		if redirect.IsExhausted() {
+			c.AbortWithStatus(http.StatusGone)
+			return
+		}
 
-func (s *Server) handleLoginPage() gin.HandlerFunc {
-	return func(c *gin.Context) {
 		session := sessions.Default(c)
-		userID := session.Get("user_id")
 
-		if userID != nil {
-			c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+		if redirect.IsProtected() && !isUnlocked(session, domain, short) {
+			s.renderUnlockPage(c, http.StatusUnauthorized, short, "")
 			return
 		}
 
-		data := gin.H{
-			"userID":     userID,
-			"linkPrefix": s.Config.ForwardedPrefix,
+		if (s.Config.ForcePreview || redirect.ForcePreview) && !s.consumePreviewConfirmation(c, domain, short) {
+			s.renderPreviewPage(c, redirect)
+			return
 		}
-		c.HTML(http.StatusOK, "login.gohtml", data)
-	}
-}
 
-func (s *Server) handleAuthCallback() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		externalUser, err := gothic.CompleteUserAuth(c.Writer, c.Request)
-		if err != nil {
-			_ = c.AbortWithError(http.StatusInternalServerError, err)
+		url, err := s.Shortener.ExpandShortURL(ctx, domain, short, visit)
+		if errors.Is(err, internal.ErrClicksExhausted) {
+			c.AbortWithStatus(http.StatusGone)
 			return
 		}
-
-		ctx := c.Request.Context()
-		user, err := s.Users.GetOrCreateByGoogle(ctx, externalUser.UserID, externalUser.Email)
 		if err != nil {
-			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
 
-		session := sessions.Default(c)
-		session.Set("user_id", user.ID)
-		if err := session.Save(); err != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
+		c.Header("Referrer-Policy", "unsafe-url")
+
+		// every click of a limited or split redirect has to reach us to be counted
+		if redirect.HasClickBudget() || len(redirect.Targets) > 0 {
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, url)
 			return
 		}
 
-		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+		c.Header("Cache-Control", "private, max-age=90")
+		c.Redirect(http.StatusMovedPermanently, url)
 	}
 }
 
-func (s *Server) handleLogout() gin.HandlerFunc {
-	redirect := s.Config.ForwardedPrefix + "login"
+// visitorID returns the ID stored in the visitor cookie and hands out a new one to
+// first-time visitors, so split redirects keep sending them to the same variant.
+func (s *Server) visitorID(c *gin.Context) string {
+	if id, err := c.Cookie(visitorCookie); err == nil && id != "" {
+		return id
+	}
+
+	id := uuid.NewString()
+	c.SetCookie(visitorCookie, id, int(visitorCookieLifetime.Seconds()), s.Config.ForwardedPrefix, "", s.Config.CookieSecure, true)
+	return id
+}
+
+func (s *Server) handleUnlock() gin.HandlerFunc {
+	type request struct {
+		Password string `form:"password"`
+	}
 
 	return func(c *gin.Context) {
-		_ = gothic.Logout(c.Writer, c.Request)
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return
+		}
+
+		ctx := c.Request.Context()
+		domain := s.requestDomain(c)
+		short := c.Param("short")
+
+		err := s.Shortener.UnlockShortURL(ctx, domain, short, req.Password)
+		switch {
+		case errors.Is(err, internal.ErrTooManyAttempts):
+			s.renderUnlockPage(c, http.StatusTooManyRequests, short, "Too many attempts. Please try again later.")
+			return
+		case errors.Is(err, internal.ErrWrongPassword):
+			s.renderUnlockPage(c, http.StatusUnauthorized, short, "Wrong password.")
+			return
+		case err != nil:
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
 
 		session := sessions.Default(c)
-		session.Clear()
+		session.Set(unlockKey(domain, short), time.Now().Add(s.Config.UnlockDuration).Unix())
 		if err := session.Save(); err != nil {
 			_ = c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 
-		c.Redirect(http.StatusTemporaryRedirect, redirect)
+		c.Redirect(http.StatusSeeOther, s.Config.ForwardedPrefix+short)
 	}
 }
 
-func (s *Server) handleAuth() gin.HandlerFunc {
+func (s *Server) renderUnlockPage(c *gin.Context, status int, short string, message string) {
+	data := gin.H{
+		"short":      short,
+		"message":    message,
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "unlock.gohtml", data)
+}
+
+func (s *Server) handlePreview() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		q := c.Request.URL.Query()
-		q.Add("provider", c.Param("provider"))
-		c.Request.URL.RawQuery = q.Encode()
+		ctx := c.Request.Context()
+		domain := s.requestDomain(c)
+		short := c.Param("short")
 
-		user, err := gothic.CompleteUserAuth(c.Writer, c.Request)
+		redirect, err := s.Shortener.LookupShortURL(ctx, domain, short)
 		if err != nil {
-			gothic.BeginAuthHandler(c.Writer, c.Request)
+			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
 
-		session := sessions.Default(c)
-		session.Set("user_id", user.UserID)
-		if err := session.Save(); err != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
+		if redirect.IsProtected() && !isUnlocked(sessions.Default(c), domain, short) {
+			s.renderUnlockPage(c, http.StatusUnauthorized, short, "")
 			return
 		}
+
+		s.renderPreviewPage(c, redirect)
 	}
 }
 
-func (s *Server) handleIndexPage() gin.HandlerFunc {
+func (s *Server) handleContinue() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-
 		ctx := c.Request.Context()
-		list, err := s.Shortener.List(ctx, userID)
+		domain := s.requestDomain(c)
+		short := c.Param("short")
+
+		if _, err := s.Shortener.LookupShortURL(ctx, domain, short); err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		confirmation, err := s.previews.Encode(previewCookie, internal.LinkID(domain, short))
 		if err != nil {
 			_ = c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
+		c.SetCookie(previewCookie, confirmation, int(previewCookieLifetime.Seconds()), s.Config.ForwardedPrefix, "", s.Config.CookieSecure, true)
 
-		data := gin.H{
-			"redirects":  list,
-			"userID":     userID,
-			"linkPrefix": s.Config.ForwardedPrefix,
-		}
-		c.HTML(http.StatusOK, "index.gohtml", data)
+		c.Redirect(http.StatusSeeOther, s.Config.ForwardedPrefix+short)
 	}
 }
 
-func (s *Server) handleGetCreationPage() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
+func (s *Server) renderPreviewPage(c *gin.Context, redirect internal.Redirect) {
+	c.Header("Cache-Control", "no-store")
 
-		data := gin.H{
-			"userID":     userID,
-			"linkPrefix": s.Config.ForwardedPrefix,
-		}
-		c.HTML(http.StatusOK, "create.gohtml", data)
+	data := gin.H{
+		"redirect":   redirect,
+		"linkPrefix": s.Config.ForwardedPrefix,
 	}
+	c.HTML(http.StatusOK, "preview.gohtml", data)
 }
 
-func (s *Server) handlePostCreationPage() gin.HandlerFunc {
-	type request struct {
-		Url string `form:"url"`
+// consumePreviewConfirmation reports whether the visitor just confirmed the preview page of
+// the link and removes the confirmation, so the preview is shown again on the next visit.
+func (s *Server) consumePreviewConfirmation(c *gin.Context, domain string, short string) bool {
+	confirmation, err := c.Cookie(previewCookie)
+	if err != nil {
+		return false
 	}
+	c.SetCookie(previewCookie, "", -1, s.Config.ForwardedPrefix, "", s.Config.CookieSecure, true)
 
-	return func(c *gin.Context) {
-		var req request
-		if err := c.Bind(&req); err != nil {
-			return
-		}
+	var linkID string
+	if err := s.previews.Decode(previewCookie, confirmation, &linkID); err != nil {
+		return false
+	}
+	return linkID == internal.LinkID(domain, short)
+}
 
-		if req.Url == "" {
-			_ = c.AbortWithError(http.StatusBadRequest, errors.New("url is required"))
-			return
+// absoluteURL turns a path into an absolute URL based on the host the request was sent to.
+func absoluteURL(c *gin.Context, path string) string {
+	return absoluteURLOn(c, c.Request.Host, path)
+}
+
+// absoluteURLOn turns a path into an absolute URL on the given host, using the scheme the
+// request was sent with.
+func absoluteURLOn(c *gin.Context, host string, path string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, host, path)
+}
+
+// requestDomain returns the short domain the request was sent to, or the default domain
+// for every other host. Behind a trusted proxy, the forwarded host takes precedence.
+func (s *Server) requestDomain(c *gin.Context) string {
+	host := c.Request.Host
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" && s.isTrustedProxy(c.RemoteIP()) {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	host = strings.ToLower(host)
+	if !s.Config.IsShortDomain(host) {
+		return ""
+	}
+	return host
+}
+
+func (s *Server) isTrustedProxy(remoteIP string) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range s.trustedProxies {
+		if cidr.Contains(ip) {
+			return true
 		}
+	}
+	return false
+}
 
-		ctx := c.Request.Context()
-		userID := c.GetString("user_id")
-		if _, err := s.Shortener.ShortenURL(ctx, req.Url, userID); err != nil {
-			_ = c.AbortWithError(http.StatusInternalServerError, err)
+// domainQuery returns the query string selecting a link on the given domain in the management pages.
+func domainQuery(domain string) string {
+	if domain == "" {
+		return ""
+	}
+	return "?domain=" + url.QueryEscape(domain)
+}
+
+func unlockKey(domain string, short string) string {
+	return fmt.Sprintf("unlocked:%s", internal.LinkID(domain, short))
+}
+
+func isUnlocked(session sessions.Session, domain string, short string) bool {
+	until, ok := session.Get(unlockKey(domain, short)).(int64)
+	return ok && time.Now().Unix() < until
+}
+
+func (s *Server) handleLoginPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		userID := session.Get("user_id")
+
+		if userID != nil {
+			c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
 			return
 		}
 
-		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+		s.renderLoginPage(c, http.StatusOK, "")
 	}
 }
 
-func (s *Server) handleGetDeletionPage() gin.HandlerFunc {
+func (s *Server) renderLoginPage(c *gin.Context, status int, message string) {
+	s.renderLogin(c, status, gin.H{"message": message})
+}
+
+// renderLoginNotice shows the login page with a success message.
+func (s *Server) renderLoginNotice(c *gin.Context, notice string) {
+	s.renderLogin(c, http.StatusOK, gin.H{"notice": notice})
+}
+
+func (s *Server) renderLogin(c *gin.Context, status int, data gin.H) {
+	data["providers"] = s.providers
+	data["localAccounts"] = s.Config.LocalAccounts
+	data["registration"] = s.Config.LocalAccounts && s.Config.LocalRegistration
+	data["linkPrefix"] = s.Config.ForwardedPrefix
+	c.HTML(status, "login.gohtml", data)
+}
+
+func (s *Server) handleAuthCallback() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		short := c.Param("short")
-		userID := c.GetString("user_id")
+		withProvider(c)
 
-		ctx := c.Request.Context()
-		redirect, err := s.Shortener.GetRedirectByShort(ctx, short, userID)
+		externalUser, err := gothic.CompleteUserAuth(c.Writer, c.Request)
 		if err != nil {
 			_ = c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 
-		data := gin.H{
-			"redirect":   redirect,
-			"userID":     userID,
-			"linkPrefix": s.Config.ForwardedPrefix,
+		identity, err := externalIdentity(c.Request.Context(), externalUser)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadGateway, err)
+			return
 		}
-		c.HTML(http.StatusOK, "delete.gohtml", data)
+		s.completeAuth(c, identity)
 	}
 }
 
-func (s *Server) handlePostDeletionPage() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ctx := c.Request.Context()
-		short := c.Param("short")
-		userID := c.GetString("user_id")
-		if err := s.Shortener.DeleteShortURL(ctx, short, userID); err != nil {
-			_ = c.AbortWithError(http.StatusNotFound, err)
-			return
+// githubEmailsURL lists the emails of the GitHub user, along with whether they are verified.
+var githubEmailsURL = "https://api.github.com/user/emails"
+
+// externalIdentity turns the account at the provider into an identity. Only emails the
+// provider verified count as verified: GitHub's verified primary email, Google's
+// verified_email and the email_verified claim of OpenID Connect.
+func externalIdentity(ctx context.Context, externalUser goth.User) (internal.Identity, error) {
+	identity := internal.Identity{
+		Provider: externalUser.Provider,
+		Subject:  externalUser.UserID,
+		Email:    externalUser.Email,
+	}
+
+	switch externalUser.Provider {
+	case "github":
+		email, verified, err := githubPrimaryEmail(ctx, externalUser.AccessToken)
+		if err != nil {
+			return internal.Identity{}, err
 		}
-		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+		identity.Email = email
+		identity.EmailVerified = verified
+	case "google":
+		identity.EmailVerified = isTrue(externalUser.RawData["verified_email"])
+	default:
+		identity.EmailVerified = isTrue(externalUser.RawData["email_verified"])
 	}
+	return identity, nil
 }
 
-func (s *Server) authRequiredMiddleware() gin.HandlerFunc {
-	loginPage := s.Config.ForwardedPrefix + "login"
+func githubPrimaryEmail(ctx context.Context, accessToken string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubEmailsURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		userID := session.Get("user_id")
-		if userID == nil {
-			c.Redirect(http.StatusFound, loginPage)
-			c.Abort()
-			return
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("listing GitHub emails: %s", resp.Status)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		return "", false, err
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			return email.Email, email.Verified, nil
 		}
+	}
+	return "", false, nil
+}
 
-		c.Set("user_id", userID)
+// isTrue reads a boolean claim, which some providers send as a string.
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
+
+// completeAuth signs in with the external account, or links it to the user who is signed in already.
+func (s *Server) completeAuth(c *gin.Context, identity internal.Identity) {
+	session := sessions.Default(c)
+	if userID, ok := session.Get("user_id").(string); ok {
+		s.linkIdentity(c, userID, identity)
+		return
+	}
+
+	user, err := s.Users.SignIn(c.Request.Context(), identity)
+	switch {
+	case errors.Is(err, internal.ErrUserDisabled):
+		s.renderLoginPage(c, http.StatusForbidden, "Your account has been disabled.")
+		return
+	case errors.Is(err, internal.ErrEmailInUse):
+		s.renderLoginPage(c, http.StatusConflict, "An account with this email exists already. Sign in with it and connect this login on your profile.")
+		return
+	case errors.Is(err, internal.ErrEmailMissing):
+		s.renderLoginPage(c, http.StatusForbidden, "Your account does not share an email address with us.")
+		return
+	case errors.Is(err, internal.ErrEmailUnverified):
+		s.renderLoginPage(c, http.StatusForbidden, "Please verify your email address with your login provider first.")
+		return
+	case errors.Is(err, internal.ErrNotInvited):
+		s.renderRejectedPage(c, identity.Email)
+		return
+	case err != nil:
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	s.startSession(c, user)
+}
+
+// renderRejectedPage explains why no account was created for the email.
+func (s *Server) renderRejectedPage(c *gin.Context, email string) {
+	data := gin.H{
+		"email":      email,
+		"domains":    s.Config.AllowedDomains,
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(http.StatusForbidden, "rejected.gohtml", data)
+}
+
+// startSession signs the user in, or asks for the second factor first if it is enabled.
+func (s *Server) startSession(c *gin.Context, user internal.User) {
+	status, err := s.TwoFactor.Status(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	session := sessions.Default(c)
+	if status.Enabled {
+		s.startChallenge(c, session, user.ID)
+		return
+	}
+
+	session.Set("user_id", user.ID)
+	if err := session.Save(); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+}
+
+// startChallenge remembers the user who passed the first factor. The session only gets the
+// user_id once the second factor is verified.
+func (s *Server) startChallenge(c *gin.Context, session sessions.Session, userID string) {
+	session.Delete("user_id")
+	session.Set("pending_user_id", userID)
+	session.Set("pending_until", time.Now().Add(challengeLifetime).Unix())
+	session.Set("pending_attempts", 0)
+	if err := session.Save(); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"login/2fa")
+}
+
+func pendingUser(session sessions.Session) (string, bool) {
+	userID, ok := session.Get("pending_user_id").(string)
+	until, _ := session.Get("pending_until").(int64)
+	return userID, ok && time.Now().Unix() < until
+}
+
+func clearChallenge(session sessions.Session) {
+	session.Delete("pending_user_id")
+	session.Delete("pending_until")
+	session.Delete("pending_attempts")
+}
+
+func (s *Server) handleGetChallengePage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := pendingUser(sessions.Default(c)); !ok {
+			c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"login")
+			return
+		}
+		s.renderChallengePage(c, http.StatusOK, "")
+	}
+}
+
+func (s *Server) handlePostChallengePage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		userID, ok := pendingUser(session)
+		if !ok {
+			clearChallenge(session)
+			_ = session.Save()
+			s.renderLoginPage(c, http.StatusUnauthorized, "Your sign-in has expired. Please sign in again.")
+			return
+		}
+
+		// a second factor disabled in the meantime leaves nothing to check
+		err := s.TwoFactor.Verify(c.Request.Context(), userID, c.PostForm("code"))
+		if errors.Is(err, internal.ErrInvalidCode) {
+			attempts, _ := session.Get("pending_attempts").(int)
+			attempts++
+			if attempts >= maxChallengeAttempts {
+				clearChallenge(session)
+				_ = session.Save()
+				s.renderLoginPage(c, http.StatusUnauthorized, "Too many wrong codes. Please sign in again.")
+				return
+			}
+
+			session.Set("pending_attempts", attempts)
+			_ = session.Save()
+			s.renderChallengePage(c, http.StatusUnauthorized, "Wrong code, please try again.")
+			return
+		}
+		if err != nil && !errors.Is(err, internal.ErrTwoFactorOff) {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		clearChallenge(session)
+		session.Set("user_id", userID)
+		session.Set("two_factor", true)
+		if err := session.Save(); err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+	}
+}
+
+func (s *Server) renderChallengePage(c *gin.Context, status int, message string) {
+	data := gin.H{
+		"message":    message,
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "challenge.gohtml", data)
+}
+
+func (s *Server) handlePostLoginPage() gin.HandlerFunc {
+	type request struct {
+		Email    string `form:"email" binding:"required"`
+		Password string `form:"password" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			s.renderLoginPage(c, http.StatusBadRequest, "Please enter your email and password.")
+			return
+		}
+
+		user, err := s.Accounts.Login(c.Request.Context(), req.Email, req.Password)
+		switch {
+		case errors.Is(err, internal.ErrWrongPassword):
+			s.renderLoginPage(c, http.StatusUnauthorized, "Wrong email or password.")
+			return
+		case errors.Is(err, internal.ErrEmailUnverified):
+			s.renderLogin(c, http.StatusForbidden, gin.H{"message": "Please confirm your email address first.", "unverified": req.Email})
+			return
+		case errors.Is(err, internal.ErrUserDisabled):
+			s.renderLoginPage(c, http.StatusForbidden, "Your account has been disabled.")
+			return
+		case errors.Is(err, internal.ErrNotInvited):
+			s.renderRejectedPage(c, req.Email)
+			return
+		case err != nil:
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		s.startSession(c, user)
+	}
+}
+
+func (s *Server) handleGetRegistrationPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderRegistrationPage(c, http.StatusOK, "", "")
+	}
+}
+
+func (s *Server) handlePostRegistrationPage() gin.HandlerFunc {
+	type request struct {
+		Email           string `form:"email"`
+		Password        string `form:"password"`
+		PasswordConfirm string `form:"password_confirm"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		if req.Password != req.PasswordConfirm {
+			s.renderRegistrationPage(c, http.StatusBadRequest, req.Email, "The passwords do not match.")
+			return
+		}
+
+		user, err := s.Accounts.Register(c.Request.Context(), req.Email, req.Password)
+		switch {
+		case errors.Is(err, internal.ErrEmailInvalid):
+			s.renderRegistrationPage(c, http.StatusBadRequest, req.Email, "Please enter a valid email address.")
+			return
+		case errors.Is(err, internal.ErrWeakPassword):
+			s.renderRegistrationPage(c, http.StatusBadRequest, req.Email, "Passwords need at least 10 characters.")
+			return
+		case errors.Is(err, internal.ErrEmailInUse):
+			s.renderRegistrationPage(c, http.StatusConflict, req.Email, "An account with this email exists already.")
+			return
+		case errors.Is(err, internal.ErrNotInvited):
+			s.renderRejectedPage(c, req.Email)
+			return
+		case err != nil:
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		if s.Config.EmailVerification {
+			s.renderLoginNotice(c, "Almost done! We sent you an email to confirm your address.")
+			return
+		}
+		s.startSession(c, user)
+	}
+}
+
+func (s *Server) renderRegistrationPage(c *gin.Context, status int, email string, message string) {
+	data := gin.H{
+		"email":      email,
+		"message":    message,
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "register.gohtml", data)
+}
+
+func (s *Server) handleEmailVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := s.Accounts.VerifyEmail(c.Request.Context(), c.Query("token"))
+		switch {
+		case errors.Is(err, internal.ErrInvalidToken):
+			s.renderLoginPage(c, http.StatusBadRequest, "This link is invalid or has expired.")
+			return
+		case errors.Is(err, internal.ErrEmailInUse):
+			s.renderLoginPage(c, http.StatusConflict, "An account with this email exists already.")
+			return
+		case errors.Is(err, internal.ErrNotInvited):
+			s.renderRejectedPage(c, "")
+			return
+		case err != nil:
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		s.renderLoginNotice(c, "Your email address is confirmed. You can sign in now.")
+	}
+}
+
+func (s *Server) handlePostVerificationResend() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.Accounts.ResendVerification(c.Request.Context(), c.PostForm("email")); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		s.renderLoginNotice(c, "If the address needs confirming, we sent you a new link.")
+	}
+}
+
+func (s *Server) handleGetForgotPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.HTML(http.StatusOK, "forgot.gohtml", gin.H{"linkPrefix": s.Config.ForwardedPrefix})
+	}
+}
+
+func (s *Server) handlePostForgotPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.Accounts.RequestPasswordReset(c.Request.Context(), c.PostForm("email")); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		s.renderLoginNotice(c, "If an account exists for this address, we sent you a link to choose a new password.")
+	}
+}
+
+func (s *Server) handleGetResetPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderResetPage(c, http.StatusOK, c.Query("token"), "")
+	}
+}
+
+func (s *Server) handlePostResetPage() gin.HandlerFunc {
+	type request struct {
+		Token           string `form:"token"`
+		Password        string `form:"password"`
+		PasswordConfirm string `form:"password_confirm"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		if req.Password != req.PasswordConfirm {
+			s.renderResetPage(c, http.StatusBadRequest, req.Token, "The passwords do not match.")
+			return
+		}
+
+		err := s.Accounts.ResetPassword(c.Request.Context(), req.Token, req.Password)
+		switch {
+		case errors.Is(err, internal.ErrWeakPassword):
+			s.renderResetPage(c, http.StatusBadRequest, req.Token, "Passwords need at least 10 characters.")
+			return
+		case errors.Is(err, internal.ErrInvalidToken):
+			s.renderLoginPage(c, http.StatusBadRequest, "This link is invalid or has expired.")
+			return
+		case errors.Is(err, internal.ErrEmailInUse):
+			s.renderLoginPage(c, http.StatusConflict, "An account with this email exists already.")
+			return
+		case errors.Is(err, internal.ErrNotInvited):
+			s.renderRejectedPage(c, "")
+			return
+		case err != nil:
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		s.renderLoginNotice(c, "Your password has been changed. Please sign in again.")
+	}
+}
+
+func (s *Server) renderResetPage(c *gin.Context, status int, token string, message string) {
+	data := gin.H{
+		"token":      token,
+		"message":    message,
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "reset.gohtml", data)
+}
+
+func (s *Server) linkIdentity(c *gin.Context, userID string, identity internal.Identity) {
+	ctx := c.Request.Context()
+	user, err := s.Users.Get(ctx, userID)
+	if err != nil || user.Disabled {
+		_ = s.endSession(sessions.Default(c))
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"login")
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("user", user)
+
+	err = s.Users.Link(ctx, user.ID, identity)
+	if errors.Is(err, internal.ErrIdentityInUse) {
+		s.renderProfilePage(c, http.StatusConflict, "This login belongs to another account.")
+		return
+	}
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"profile")
+}
+
+// withProvider passes the provider of the route on to gothic, which expects it in the query.
+func withProvider(c *gin.Context) {
+	q := c.Request.URL.Query()
+	q.Set("provider", c.Param("provider"))
+	c.Request.URL.RawQuery = q.Encode()
+}
+
+func (s *Server) handleLogout() gin.HandlerFunc {
+	redirect := s.Config.ForwardedPrefix + "login"
+
+	return func(c *gin.Context) {
+		_ = gothic.Logout(c.Writer, c.Request)
+
+		if err := s.endSession(sessions.Default(c)); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Redirect(http.StatusTemporaryRedirect, redirect)
+	}
+}
+
+func (s *Server) handleAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		withProvider(c)
+
+		// a provider session that is still valid saves the round trip to the provider
+		externalUser, err := gothic.CompleteUserAuth(c.Writer, c.Request)
+		if err != nil {
+			gothic.BeginAuthHandler(c.Writer, c.Request)
+			return
+		}
+
+		identity, err := externalIdentity(c.Request.Context(), externalUser)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadGateway, err)
+			return
+		}
+		s.completeAuth(c, identity)
+	}
+}
+
+func (s *Server) handleIndexPage() gin.HandlerFunc {
+	type request struct {
+		Query string `form:"q"`
+		Tag   string `form:"tag"`
+		From  string `form:"from"`
+		Until string `form:"until"`
+		Sort  string `form:"sort"`
+		Size  int    `form:"size"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		from, err := parseDate(req.From)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		until, err := parseDate(req.Until)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		// the until date is inclusive
+		if !until.IsZero() {
+			until = until.AddDate(0, 0, 1)
+		}
+
+		filter := internal.RedirectFilter{
+			Query:        req.Query,
+			Tag:          req.Tag,
+			CreatedFrom:  from,
+			CreatedUntil: until,
+		}
+
+		size := req.Size
+		if size == 0 {
+			size = s.Config.PageSize
+		}
+
+		page := internal.PageRequest{
+			Sort:   internal.RedirectSort(req.Sort),
+			Size:   size,
+			Cursor: c.Query("cursor"),
+		}
+
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		result, err := s.Shortener.List(ctx, userID, filter, page)
+		if errors.Is(err, internal.ErrInvalidCursor) {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		tags, err := s.Shortener.Tags(ctx, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		// page links keep search and sort order
+		query := c.Request.URL.Query()
+		query.Del("cursor")
+		firstPage := "?" + query.Encode()
+
+		var nextPage string
+		if result.NextCursor != "" {
+			query.Set("cursor", result.NextCursor)
+			nextPage = "?" + query.Encode()
+		}
+
+		data := gin.H{
+			"redirects":  result.Redirects,
+			"firstPage":  firstPage,
+			"nextPage":   nextPage,
+			"paged":      page.Cursor != "",
+			"tags":       tags,
+			"search":     req,
+			"filtered":   req.Query != "" || req.Tag != "" || req.From != "" || req.Until != "",
+			"isAdmin":    currentUser(c).IsAdmin(),
+			"userID":     userID,
+			"linkPrefix": s.Config.ForwardedPrefix,
+		}
+		c.HTML(http.StatusOK, "index.gohtml", data)
+	}
+}
+
+// parseDate parses a date as sent by date inputs, an empty value results in the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// splitTags splits a comma separated list of tags as entered in forms.
+func splitTags(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func (s *Server) handleGetCreationPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderCreationPage(c, http.StatusOK, "")
+	}
+}
+
+func (s *Server) renderCreationPage(c *gin.Context, status int, message string) {
+	userID := c.GetString("user_id")
+
+	ctx := c.Request.Context()
+	presets, err := s.Presets.List(ctx, userID)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	data := gin.H{
+		"presets":    presets,
+		"domains":    s.Config.ShortDomains,
+		"message":    message,
+		"userID":     userID,
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "create.gohtml", data)
+}
+
+func (s *Server) handlePostCreationPage() gin.HandlerFunc {
+	type request struct {
+		Url          string `form:"url"`
+		Domain       string `form:"domain"`
+		Password     string `form:"password"`
+		MaxClicks    int    `form:"max_clicks"`
+		Title        string `form:"title"`
+		ForcePreview bool   `form:"force_preview"`
+		Passthrough  string `form:"passthrough"`
+		UTMPresetID  string `form:"utm_preset"`
+		Notes        string `form:"notes"`
+		Tags         string `form:"tags"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return
+		}
+
+		if req.Url == "" {
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("url is required"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		options := internal.RedirectOptions{
+			Domain:       req.Domain,
+			Password:     req.Password,
+			MaxClicks:    req.MaxClicks,
+			Title:        req.Title,
+			ForcePreview: req.ForcePreview,
+			Passthrough:  internal.Passthrough(req.Passthrough),
+			Notes:        req.Notes,
+			Tags:         splitTags(req.Tags),
+		}
+		if req.UTMPresetID != "" {
+			preset, err := s.Presets.Get(ctx, req.UTMPresetID, userID)
+			if err != nil {
+				_ = c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			options.UTMPreset = preset
+		}
+
+		_, err := s.Shortener.ShortenURL(ctx, req.Url, userID, options)
+		if errors.Is(err, internal.ErrUnknownDomain) {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, internal.ErrLinkTrashed) {
+			s.renderCreationPage(c, http.StatusConflict, "This link is already in your trash. Restore it from there instead of creating it again.")
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+	}
+}
+
+func (s *Server) handleExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, err := exporter.ParseFormat(c.Query("format"))
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		filename := fmt.Sprintf("dwarferl-links-%s.%s", time.Now().Format("2006-01-02"), format)
+		c.Header("Content-Type", format.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+
+		// the response is already on its way, errors can only cut it short
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		writer := exporter.NewWriter(c.Writer, format)
+		if err := s.Shortener.Export(ctx, userID, writer.Write); err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if err := writer.Close(); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+func (s *Server) handleGetImportPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderImportPage(c, http.StatusOK, nil, "")
+	}
+}
+
+func (s *Server) handlePostImportPage() gin.HandlerFunc {
+	const maxImportSize = 10 << 20
+
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			s.renderImportPage(c, http.StatusBadRequest, nil, "Please choose a file of at most 10 MB.")
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		defer file.Close()
+
+		records, err := importer.Parse(file)
+		if err != nil {
+			s.renderImportPage(c, http.StatusBadRequest, nil, err.Error())
+			return
+		}
+
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		report, err := s.Shortener.Import(ctx, userID, records)
+		if err != nil {
+			// earlier batches are already stored, running the import again picks up from there
+			s.renderImportPage(c, http.StatusInternalServerError, &report, "The import stopped early, upload the file again to continue.")
+			return
+		}
+
+		s.renderImportPage(c, http.StatusOK, &report, "")
+	}
+}
+
+func (s *Server) renderImportPage(c *gin.Context, status int, report *internal.ImportReport, message string) {
+	data := gin.H{
+		"report":     report,
+		"message":    message,
+		"userID":     c.GetString("user_id"),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "import.gohtml", data)
+}
+
+func (s *Server) handleGetEditPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		ctx := c.Request.Context()
+		redirect, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		details := internal.RedirectDetails{Title: redirect.Title, Notes: redirect.Notes, Tags: redirect.Tags}
+		s.renderEditPage(c, http.StatusOK, redirect, details, "")
+	}
+}
+
+func (s *Server) handlePostEditPage() gin.HandlerFunc {
+	type request struct {
+		Title string `form:"title"`
+		Notes string `form:"notes"`
+		Tags  string `form:"tags"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return
+		}
+
+		ctx := c.Request.Context()
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		redirect, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		details := internal.RedirectDetails{
+			Title: strings.TrimSpace(req.Title),
+			Notes: strings.TrimSpace(req.Notes),
+			Tags:  splitTags(req.Tags),
+		}
+		if err := s.Shortener.UpdateDetails(ctx, domain, short, userID, details); err != nil {
+			s.renderEditPage(c, http.StatusBadRequest, redirect, details, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+	}
+}
+
+func (s *Server) renderEditPage(c *gin.Context, status int, redirect internal.Redirect, details internal.RedirectDetails, message string) {
+	data := gin.H{
+		"redirect":   redirect,
+		"details":    details,
+		"tags":       strings.Join(details.Tags, ", "),
+		"message":    message,
+		"userID":     c.GetString("user_id"),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "edit.gohtml", data)
+}
+
+func (s *Server) handleGetRulesPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		ctx := c.Request.Context()
+		redirect, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		s.renderRulesPage(c, http.StatusOK, redirect, redirect.Rules, "")
+	}
+}
+
+func (s *Server) handlePostRulesPage() gin.HandlerFunc {
+	type request struct {
+		Kinds  []string `form:"kind"`
+		Keys   []string `form:"key"`
+		Values []string `form:"value"`
+		URLs   []string `form:"url"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return
+		}
+
+		if len(req.Keys) != len(req.Kinds) || len(req.Values) != len(req.Kinds) || len(req.URLs) != len(req.Kinds) {
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("incomplete rules"))
+			return
+		}
+
+		// rows without target are left empty on purpose and get dropped
+		rules := make([]internal.TargetingRule, 0, len(req.Kinds))
+		for i := range req.Kinds {
+			if strings.TrimSpace(req.URLs[i]) == "" {
+				continue
+			}
+			rules = append(rules, internal.TargetingRule{
+				Kind:  internal.RuleKind(req.Kinds[i]),
+				Key:   strings.TrimSpace(req.Keys[i]),
+				Value: strings.TrimSpace(req.Values[i]),
+				URL:   strings.TrimSpace(req.URLs[i]),
+			})
+		}
+
+		ctx := c.Request.Context()
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		redirect, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		if err := s.Shortener.UpdateRules(ctx, domain, short, userID, rules); err != nil {
+			s.renderRulesPage(c, http.StatusBadRequest, redirect, rules, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+	}
+}
+
+func (s *Server) renderRulesPage(c *gin.Context, status int, redirect internal.Redirect, rules []internal.TargetingRule, message string) {
+	// offer a few blank rows for new rules
+	rows := make([]internal.TargetingRule, len(rules), len(rules)+3)
+	copy(rows, rules)
+	rows = append(rows, internal.TargetingRule{}, internal.TargetingRule{}, internal.TargetingRule{})
+
+	data := gin.H{
+		"redirect":   redirect,
+		"rules":      rows,
+		"message":    message,
+		"userID":     c.GetString("user_id"),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "rules.gohtml", data)
+}
+
+func (s *Server) handleGetVariantsPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		ctx := c.Request.Context()
+		redirect, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		stats, err := s.Shortener.VariantStats(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		s.renderVariantsPage(c, http.StatusOK, redirect, stats, "")
+	}
+}
+
+func (s *Server) handlePostVariantsPage() gin.HandlerFunc {
+	type request struct {
+		URLs    []string `form:"url"`
+		Weights []string `form:"weight"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return
+		}
+
+		if len(req.Weights) != len(req.URLs) {
+			_ = c.AbortWithError(http.StatusBadRequest, errors.New("incomplete targets"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		redirect, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		// rows without target are left empty on purpose and get dropped
+		targets := make([]internal.WeightedTarget, 0, len(req.URLs))
+		stats := make([]internal.VariantStats, 0, len(req.URLs))
+		var message string
+		for i := range req.URLs {
+			if strings.TrimSpace(req.URLs[i]) == "" {
+				continue
+			}
+
+			weight, err := strconv.Atoi(strings.TrimSpace(req.Weights[i]))
+			if err != nil && message == "" {
+				message = fmt.Sprintf("target %d: weight must be a number", len(targets)+1)
+			}
+
+			target := internal.WeightedTarget{URL: strings.TrimSpace(req.URLs[i]), Weight: weight}
+			targets = append(targets, target)
+			stats = append(stats, internal.VariantStats{WeightedTarget: target})
+		}
+
+		if message == "" {
+			if err := s.Shortener.UpdateTargets(ctx, domain, short, userID, targets); err != nil {
+				message = err.Error()
+			}
+		}
+
+		if message != "" {
+			s.renderVariantsPage(c, http.StatusBadRequest, redirect, stats, message)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"variants/"+short+domainQuery(domain))
+	}
+}
+
+func (s *Server) renderVariantsPage(c *gin.Context, status int, redirect internal.Redirect, stats []internal.VariantStats, message string) {
+	// offer a few blank rows for new targets
+	rows := make([]internal.VariantStats, len(stats), len(stats)+3)
+	copy(rows, stats)
+	rows = append(rows, internal.VariantStats{}, internal.VariantStats{}, internal.VariantStats{})
+
+	data := gin.H{
+		"redirect":   redirect,
+		"variants":   rows,
+		"message":    message,
+		"userID":     c.GetString("user_id"),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "variants.gohtml", data)
+}
+
+func (s *Server) handleGetPresetsPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+
+		ctx := c.Request.Context()
+		presets, err := s.Presets.List(ctx, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		campaigns, err := s.Shortener.Campaigns(ctx, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		data := gin.H{
+			"presets":    presets,
+			"campaigns":  campaigns,
+			"userID":     userID,
+			"linkPrefix": s.Config.ForwardedPrefix,
+		}
+		c.HTML(http.StatusOK, "utm.gohtml", data)
+	}
+}
+
+func (s *Server) handlePostPresetsPage() gin.HandlerFunc {
+	type request struct {
+		Name     string `form:"name"`
+		Source   string `form:"source"`
+		Medium   string `form:"medium"`
+		Campaign string `form:"campaign"`
+		Term     string `form:"term"`
+		Content  string `form:"content"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return
+		}
+
+		preset := internal.UTMPreset{
+			UserID:   c.GetString("user_id"),
+			Name:     req.Name,
+			Source:   req.Source,
+			Medium:   req.Medium,
+			Campaign: req.Campaign,
+			Term:     req.Term,
+			Content:  req.Content,
+		}
+
+		ctx := c.Request.Context()
+		if _, err := s.Presets.Create(ctx, preset); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"utm")
+	}
+}
+
+func (s *Server) handlePostPresetDeletion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id := c.Param("id")
+		userID := c.GetString("user_id")
+		if err := s.Presets.Delete(ctx, id, userID); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"utm")
+	}
+}
+
+func (s *Server) handleWebhooksPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderWebhooksPage(c, http.StatusOK, "")
+	}
+}
+
+func (s *Server) renderWebhooksPage(c *gin.Context, status int, message string) {
+	user := currentUser(c)
+	webhooks, err := s.Webhooks.List(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	data := gin.H{
+		"webhooks":   webhooks,
+		"events":     internal.WebhookEvents,
+		"message":    message,
+		"userID":     user.ID,
+		"isAdmin":    user.IsAdmin(),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "webhooks.gohtml", data)
+}
+
+func (s *Server) handlePostWebhook() gin.HandlerFunc {
+	type request struct {
+		URL    string   `form:"url"`
+		Events []string `form:"events"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		events := make([]internal.WebhookEvent, len(req.Events))
+		for i, event := range req.Events {
+			events[i] = internal.WebhookEvent(event)
+		}
+
+		webhook, err := s.Webhooks.Create(c.Request.Context(), c.GetString("user_id"), req.URL, events)
+		switch {
+		case errors.Is(err, internal.ErrInvalidWebhook):
+			s.renderWebhooksPage(c, http.StatusBadRequest, "Please enter an http or https URL and choose at least one event.")
+			return
+		case errors.Is(err, internal.ErrTooManyWebhooks):
+			s.renderWebhooksPage(c, http.StatusConflict, "You cannot add any more webhooks.")
+			return
+		case err != nil:
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"webhooks/"+webhook.ID)
+	}
+}
+
+func (s *Server) handleWebhookPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		user := currentUser(c)
+		webhook, err := s.Webhooks.Get(ctx, c.Param("id"), user.ID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		deliveries, err := s.Webhooks.Deliveries(ctx, webhook.ID, user.ID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		data := gin.H{
+			"webhook":    webhook,
+			"deliveries": deliveries,
+			"userID":     user.ID,
+			"isAdmin":    user.IsAdmin(),
+			"linkPrefix": s.Config.ForwardedPrefix,
+		}
+		c.HTML(http.StatusOK, "webhook.gohtml", data)
+	}
+}
+
+func (s *Server) handlePostWebhookTest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := s.Webhooks.Test(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		// the outcome shows up in the delivery log
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"webhooks/"+id)
+	}
+}
+
+func (s *Server) handlePostWebhookDeletion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.Webhooks.Delete(c.Request.Context(), c.Param("id"), c.GetString("user_id")); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"webhooks")
+	}
+}
+
+func (s *Server) handleQRCode() gin.HandlerFunc {
+	type request struct {
+		Format   string `form:"format"`
+		Size     int    `form:"size"`
+		Level    string `form:"level"`
+		Margin   *int   `form:"margin"`
+		Download bool   `form:"download"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		format, err := qrcode.ParseFormat(req.Format)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		options := qrcode.DefaultOptions()
+		if req.Size != 0 {
+			options.Size = req.Size
+		}
+		if req.Level != "" {
+			options.Level = req.Level
+		}
+		if req.Margin != nil {
+			options.Margin = *req.Margin
+		}
+		if err := options.Validate(); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+		if _, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		if req.Download {
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, short, format))
+		}
+
+		link := absoluteURL(c, s.Config.ForwardedPrefix+short)
+		if domain != "" {
+			link = absoluteURLOn(c, domain, s.Config.ForwardedPrefix+short)
+		}
+
+		c.Header("Content-Type", format.ContentType())
+		if err := qrcode.Write(c.Writer, link, format, options); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (s *Server) handleGetDeletionPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		ctx := c.Request.Context()
+		redirect, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		data := gin.H{
+			"redirect":   redirect,
+			"userID":     userID,
+			"linkPrefix": s.Config.ForwardedPrefix,
+		}
+		c.HTML(http.StatusOK, "delete.gohtml", data)
+	}
+}
+
+func (s *Server) handlePostDeletionPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+		if err := s.Shortener.DeleteShortURL(ctx, domain, short, userID); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix)
+	}
+}
+
+func (s *Server) handleTrashPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		redirects, err := s.Shortener.Trash(ctx, userID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		data := gin.H{
+			"redirects":  redirects,
+			"retention":  int(s.Config.TrashRetention.Hours() / 24),
+			"userID":     userID,
+			"linkPrefix": s.Config.ForwardedPrefix,
+		}
+		c.HTML(http.StatusOK, "trash.gohtml", data)
+	}
+}
+
+func (s *Server) handlePostRestoration() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+		if err := s.Shortener.RestoreShortURL(ctx, domain, short, userID); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"trash")
+	}
+}
+
+func (s *Server) handlePostPurge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+		if err := s.Shortener.PurgeShortURL(ctx, domain, short, userID); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"trash")
+	}
+}
+
+func (s *Server) handleProfilePage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderProfilePage(c, http.StatusOK, "")
+	}
+}
+
+func (s *Server) renderProfilePage(c *gin.Context, status int, message string) {
+	user := currentUser(c)
+	identities, err := s.Users.Identities(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// offer the providers that are not connected yet
+	linked := make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		linked[identity.Provider] = true
+	}
+	var available []loginProvider
+	for _, provider := range s.providers {
+		if !linked[provider.Name] {
+			available = append(available, provider)
+		}
+	}
+
+	twoFactor, err := s.TwoFactor.Status(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	data := gin.H{
+		"user":       user,
+		"identities": identities,
+		"twoFactor":  twoFactor,
+		"providers":  available,
+		"labels":     s.providerLabels(),
+		"message":    message,
+		"userID":     user.ID,
+		"isAdmin":    user.IsAdmin(),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "profile.gohtml", data)
+}
+
+func (s *Server) handlePostIdentityUnlink() gin.HandlerFunc {
+	type request struct {
+		Provider string `form:"provider" binding:"required"`
+		Subject  string `form:"subject" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		err := s.Users.Unlink(ctx, userID, req.Provider, req.Subject)
+		if errors.Is(err, internal.ErrLastIdentity) {
+			s.renderProfilePage(c, http.StatusConflict, "You cannot remove your only login.")
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"profile")
+	}
+}
+
+func (s *Server) handleTwoFactorPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderTwoFactorPage(c, http.StatusOK, gin.H{})
+	}
+}
+
+// renderTwoFactorPage shows the status, or enrolls users who have not set up two-factor authentication yet.
+func (s *Server) renderTwoFactorPage(c *gin.Context, status int, data gin.H) {
+	ctx := c.Request.Context()
+	user := currentUser(c)
+	twoFactor, err := s.TwoFactor.Status(ctx, user.ID)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	if !twoFactor.Enabled {
+		enrollment, err := s.TwoFactor.Enroll(ctx, user)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		data["secret"] = enrollment.Secret
+	}
+
+	data["twoFactor"] = twoFactor
+	data["required"] = s.Config.TwoFactorRequired(user.Role)
+	data["userID"] = user.ID
+	data["isAdmin"] = user.IsAdmin()
+	data["linkPrefix"] = s.Config.ForwardedPrefix
+	c.HTML(status, "twofactor.gohtml", data)
+}
+
+// handleTwoFactorQRCode encodes the provisioning URI of the pending secret for authenticator apps.
+func (s *Server) handleTwoFactorQRCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enrollment, err := s.TwoFactor.Enroll(c.Request.Context(), currentUser(c))
+		if errors.Is(err, internal.ErrTwoFactorOn) {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Header("Content-Type", qrcode.PNG.ContentType())
+		if err := qrcode.Write(c.Writer, enrollment.URI, qrcode.PNG, qrcode.DefaultOptions()); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (s *Server) handlePostTwoFactorEnable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		codes, err := s.TwoFactor.Enable(c.Request.Context(), c.GetString("user_id"), c.PostForm("code"))
+		switch {
+		case errors.Is(err, internal.ErrInvalidCode):
+			s.renderTwoFactorPage(c, http.StatusBadRequest, gin.H{"message": "Wrong code, please check the time on your device and try again."})
+			return
+		case errors.Is(err, internal.ErrTwoFactorOn), errors.Is(err, internal.ErrTwoFactorOff):
+			_ = c.AbortWithError(http.StatusConflict, err)
+			return
+		case err != nil:
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		// the code just proved the second factor for this session
+		session := sessions.Default(c)
+		session.Set("two_factor", true)
+		if err := session.Save(); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		s.renderTwoFactorPage(c, http.StatusOK, gin.H{"recoveryCodes": codes})
+	}
+}
+
+func (s *Server) handlePostRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		codes, err := s.TwoFactor.RegenerateRecoveryCodes(c.Request.Context(), c.GetString("user_id"), c.PostForm("code"))
+		if errors.Is(err, internal.ErrInvalidCode) {
+			s.renderTwoFactorPage(c, http.StatusBadRequest, gin.H{"message": "Wrong code."})
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		s.renderTwoFactorPage(c, http.StatusOK, gin.H{"recoveryCodes": codes})
+	}
+}
+
+func (s *Server) handlePostTwoFactorDisable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if s.Config.TwoFactorRequired(user.Role) {
+			s.renderTwoFactorPage(c, http.StatusConflict, gin.H{"message": "Your role requires two-factor authentication."})
+			return
+		}
+
+		err := s.TwoFactor.Disable(c.Request.Context(), user.ID, c.PostForm("code"))
+		if errors.Is(err, internal.ErrInvalidCode) {
+			s.renderTwoFactorPage(c, http.StatusBadRequest, gin.H{"message": "Wrong code."})
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"profile")
+	}
+}
+
+func (s *Server) handleAccountPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderAccountPage(c, http.StatusOK, "")
+	}
+}
+
+func (s *Server) renderAccountPage(c *gin.Context, status int, message string) {
+	user := currentUser(c)
+	data := gin.H{
+		"user":       user,
+		"message":    message,
+		"userID":     user.ID,
+		"isAdmin":    user.IsAdmin(),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "account.gohtml", data)
+}
+
+func (s *Server) handleAccountExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// the archive is built in memory, so failures can still be reported properly
+		var buf bytes.Buffer
+		if err := s.Privacy.Export(c.Request.Context(), c.GetString("user_id"), &buf); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		filename := fmt.Sprintf("dwarferl-account-%s.zip", time.Now().Format("2006-01-02"))
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+	}
+}
+
+func (s *Server) handlePostAccountDeletion() gin.HandlerFunc {
+	type request struct {
+		Confirm string `form:"confirm"`
+		Heir    string `form:"heir"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		user := currentUser(c)
+		if !strings.EqualFold(strings.TrimSpace(req.Confirm), user.Email) {
+			s.renderAccountPage(c, http.StatusBadRequest, "Please enter your email to confirm.")
+			return
+		}
+
+		err := s.Privacy.DeleteAccount(c.Request.Context(), user.ID, req.Heir)
+		if errors.Is(err, internal.ErrInvalidHeir) {
+			s.renderAccountPage(c, http.StatusBadRequest, "There is no other active user with this email to take over your links.")
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		_ = gothic.Logout(c.Writer, c.Request)
+		if err := s.endSession(sessions.Default(c)); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"login")
+	}
+}
+
+func (s *Server) handleSessionsPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		list, err := s.Sessions.List(ctx, userID, sessions.Default(c).ID())
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		data := gin.H{
+			"sessions":   list,
+			"userID":     userID,
+			"isAdmin":    currentUser(c).IsAdmin(),
+			"linkPrefix": s.Config.ForwardedPrefix,
+		}
+		c.HTML(http.StatusOK, "sessions.gohtml", data)
+	}
+}
+
+func (s *Server) handlePostSessionRevocation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		if err := s.Sessions.Revoke(ctx, c.Param("id"), userID); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"sessions")
+	}
+}
+
+// handlePostSessionRevocationAll signs the user out on every device, including this one.
+func (s *Server) handlePostSessionRevocationAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.GetString("user_id")
+		if _, err := s.Sessions.RevokeAll(ctx, userID); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := s.endSession(sessions.Default(c)); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"login")
+	}
+}
+
+// handleAuditPage lists the events caused by the signed-in user. For administrators,
+// allUsers widens the listing to everyone and allows filtering by actor.
+func (s *Server) handleAuditPage(allUsers bool) gin.HandlerFunc {
+	type request struct {
+		Actor  string `form:"actor"`
+		Action string `form:"action"`
+		Target string `form:"target"`
+		Before string `form:"before"`
+	}
+
+	basePath := "audit"
+	if allUsers {
+		basePath = "admin/audit"
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		before, err := parseBefore(req.Before)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		filter := internal.AuditFilter{
+			ActorID:  c.GetString("user_id"),
+			Action:   internal.AuditAction(strings.TrimSpace(req.Action)),
+			TargetID: strings.TrimSpace(req.Target),
+			Before:   before,
+		}
+		if allUsers {
+			filter.ActorID = strings.TrimSpace(req.Actor)
+		}
+
+		data := gin.H{
+			"basePath": basePath,
+			"allUsers": allUsers,
+			"actor":    req.Actor,
+			"action":   req.Action,
+			"target":   req.Target,
+		}
+		s.renderAuditPage(c, filter, data)
+	}
+}
+
+func (s *Server) handleAdminIndex() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"admin/users")
+	}
+}
+
+func (s *Server) handleAdminUsersPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Query("q")
+
+		ctx := c.Request.Context()
+		users, err := s.Users.List(ctx, query)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		data := gin.H{
+			"users":      users,
+			"query":      query,
+			"isAdmin":    true,
+			"userID":     c.GetString("user_id"),
+			"linkPrefix": s.Config.ForwardedPrefix,
+		}
+		c.HTML(http.StatusOK, "admin_users.gohtml", data)
+	}
+}
+
+func (s *Server) handlePostUserDisabled(disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id := c.Param("id")
+		if err := s.Users.SetDisabled(ctx, id, disabled); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"admin/users")
+	}
+}
+
+func (s *Server) handleAdminLinksPage() gin.HandlerFunc {
+	type request struct {
+		Query  string `form:"q"`
+		Owner  string `form:"owner"`
+		Cursor string `form:"cursor"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		page, err := s.Shortener.ListAll(ctx, strings.TrimSpace(req.Owner), req.Query, internal.PageRequest{Size: s.Config.PageSize, Cursor: req.Cursor})
+		if errors.Is(err, internal.ErrInvalidCursor) {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		s.renderAdminLinksPage(c, http.StatusOK, page, req.Query, req.Owner, "")
+	}
+}
+
+func (s *Server) renderAdminLinksPage(c *gin.Context, status int, page internal.RedirectPage, query string, owner string, message string) {
+	data := gin.H{
+		"redirects":  page.Redirects,
+		"nextCursor": page.NextCursor,
+		"query":      query,
+		"owner":      owner,
+		"message":    message,
+		"isAdmin":    true,
+		"userID":     c.GetString("user_id"),
+		"linkPrefix": s.Config.ForwardedPrefix,
+	}
+	c.HTML(status, "admin_links.gohtml", data)
+}
+
+func (s *Server) handlePostLinkTransfer() gin.HandlerFunc {
+	type request struct {
+		Email string `form:"email" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		recipient, err := s.Users.GetByEmail(ctx, req.Email)
+		if err != nil {
+			s.renderAdminLinksPage(c, http.StatusBadRequest, internal.RedirectPage{}, "", "", "There is no user with the email "+req.Email+".")
+			return
+		}
+
+		short := c.Param("short")
+		if err := s.Shortener.TransferShortURL(ctx, c.Query("domain"), short, recipient.ID); err != nil {
+			s.renderAdminLinksPage(c, http.StatusBadRequest, internal.RedirectPage{}, "", "", err.Error())
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"admin/links?owner="+url.QueryEscape(recipient.ID))
+	}
+}
+
+func (s *Server) handlePostLinkRemoval() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		short := c.Param("short")
+		if err := s.Shortener.RemoveShortURL(ctx, c.Query("domain"), short); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"admin/links")
+	}
+}
+
+func (s *Server) handleAdminInvitationsPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.renderAdminInvitationsPage(c, http.StatusOK, gin.H{})
+	}
+}
+
+func (s *Server) renderAdminInvitationsPage(c *gin.Context, status int, data gin.H) {
+	invitations, err := s.Invitations.Invitations(c.Request.Context())
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	data["invitations"] = invitations
+	data["domains"] = s.Config.AllowedDomains
+	data["emails"] = s.Config.AllowedEmails
+	data["isAdmin"] = true
+	data["userID"] = c.GetString("user_id")
+	data["linkPrefix"] = s.Config.ForwardedPrefix
+	c.HTML(status, "admin_invitations.gohtml", data)
+}
+
+func (s *Server) handlePostInvitation() gin.HandlerFunc {
+	type request struct {
+		Email string `form:"email" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		invitation, err := s.Invitations.Invite(c.Request.Context(), req.Email)
+		switch {
+		case errors.Is(err, internal.ErrEmailInvalid):
+			s.renderAdminInvitationsPage(c, http.StatusBadRequest, gin.H{"message": "Please enter a valid email address."})
+			return
+		case errors.Is(err, internal.ErrEmailInUse):
+			s.renderAdminInvitationsPage(c, http.StatusConflict, gin.H{"message": "There is a user with this email already."})
+			return
+		case err != nil:
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		data := gin.H{
+			"invited":   invitation,
+			"loginLink": absoluteURL(c, s.Config.ForwardedPrefix+"login"),
+		}
+		s.renderAdminInvitationsPage(c, http.StatusOK, data)
+	}
+}
+
+func (s *Server) handlePostInvitationRevocation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.Invitations.RevokeInvitation(c.Request.Context(), c.Param("id")); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.Redirect(http.StatusFound, s.Config.ForwardedPrefix+"admin/invitations")
+	}
+}
+
+func (s *Server) handleLinkHistoryPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := c.Query("domain")
+		short := c.Param("short")
+		userID := c.GetString("user_id")
+
+		ctx := c.Request.Context()
+		if _, err := s.Shortener.GetRedirectByShort(ctx, domain, short, userID); err != nil {
+			_ = c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		before, err := parseBefore(c.Query("before"))
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		filter := internal.AuditFilter{
+			TargetType: internal.AuditTargetLink,
+			TargetID:   internal.LinkID(domain, short),
+			Before:     before,
+		}
+		s.renderAuditPage(c, filter, gin.H{"short": short, "domain": domain})
+	}
+}
+
+func (s *Server) renderAuditPage(c *gin.Context, filter internal.AuditFilter, data gin.H) {
+	filter.Limit = auditPageSize
+
+	ctx := c.Request.Context()
+	events, err := s.Audit.List(ctx, filter)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// a full page suggests there are older events
+	older := ""
+	if len(events) > 0 && len(events) == auditPageSize {
+		older = events[len(events)-1].CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	data["events"] = events
+	data["older"] = older
+	data["isAdmin"] = currentUser(c).IsAdmin()
+	data["userID"] = c.GetString("user_id")
+	data["linkPrefix"] = s.Config.ForwardedPrefix
+	c.HTML(http.StatusOK, "audit.gohtml", data)
+}
+
+func parseBefore(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// requestContextMiddleware passes request ID and client IP on to the audit log.
+func requestContextMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.New().String()
+		}
+		c.Header(requestIDHeader, requestID)
+
+		ctx := audit.WithRequest(c.Request.Context(), requestID, c.ClientIP())
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func (s *Server) authRequiredMiddleware() gin.HandlerFunc {
+	loginPage := s.Config.ForwardedPrefix + "login"
+
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		userID := session.Get("user_id")
+		if userID == nil {
+			c.Redirect(http.StatusFound, loginPage)
+			c.Abort()
+			return
+		}
+
+		// disabled or removed users lose access right away, not only on their next login
+		id, _ := userID.(string)
+		user, err := s.Users.Get(c.Request.Context(), id)
+		if err != nil || user.Disabled {
+			_ = s.endSession(session)
+			c.Redirect(http.StatusFound, loginPage)
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("user", user)
+		c.Request = c.Request.WithContext(audit.WithActor(c.Request.Context(), user.ID))
+		c.Next()
+	}
+}
+
+// twoFactorPolicyMiddleware must run after authRequiredMiddleware. Users whose role requires
+// two-factor authentication are sent to set it up, or to the challenge if it was enabled
+// in another session.
+func (s *Server) twoFactorPolicyMiddleware() gin.HandlerFunc {
+	setupPage := s.Config.ForwardedPrefix + "profile/2fa"
+
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		session := sessions.Default(c)
+		if !s.Config.TwoFactorRequired(user.Role) || session.Get("two_factor") == true || strings.HasPrefix(c.FullPath(), setupPage) {
+			c.Next()
+			return
+		}
+
+		status, err := s.TwoFactor.Status(c.Request.Context(), user.ID)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		if status.Enabled {
+			s.startChallenge(c, session, user.ID)
+		} else {
+			c.Redirect(http.StatusFound, setupPage)
+		}
+		c.Abort()
+	}
+}
+
+// sessionOptions applies the configured cookie settings. A negative max age removes the cookie.
+func (s *Server) sessionOptions(maxAge int) sessions.Options {
+	return sessions.Options{
+		Path:     "/",
+		Domain:   s.Config.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   s.Config.CookieSecure,
+		HttpOnly: true,
+		SameSite: s.Config.SameSite(),
+	}
+}
+
+// endSession clears the session and expires its cookie, which deletes it from a server-side store.
+func (s *Server) endSession(session sessions.Session) error {
+	session.Clear()
+	session.Options(s.sessionOptions(-1))
+	return session.Save()
+}
+
+// currentUser returns the user loaded by authRequiredMiddleware.
+func currentUser(c *gin.Context) internal.User {
+	user, _ := c.Get("user")
+	u, _ := user.(internal.User)
+	return u
+}
+
+// adminRequiredMiddleware must run after authRequiredMiddleware, which provides the user.
+func (s *Server) adminRequiredMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentUser(c).IsAdmin() {
+			_ = c.AbortWithError(http.StatusForbidden, errors.New("admin required"))
+			return
+		}
 		c.Next()
 	}
 }
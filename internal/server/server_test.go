@@ -6,9 +6,13 @@ import (
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
+	"github.com/markbates/goth"
 	"github.com/pscheid92/dwarferl/internal"
 	"github.com/pscheid92/dwarferl/internal/config"
+	"github.com/pscheid92/dwarferl/internal/shortener"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -18,8 +22,31 @@ import (
 
 const (
 	testUser  = "00000000-0000-0000-0000-000000000000"
+	testAdmin = "11111111-1111-1111-1111-111111111111"
 	testShort = "short"
 	testURL   = "https://www.google.com"
+
+	testDisabledUser = "22222222-2222-2222-2222-222222222222"
+	testSession      = "session"
+	testToken        = "token"
+	testCode         = "123456"
+
+	testLockedShort  = "locked"
+	testLimitedShort = "limited"
+	testSpentShort   = "spent"
+	testPreviewShort = "preview"
+	testThroughShort = "through"
+	testSplitShort   = "split"
+
+	testCursor   = "cursor"
+	testPreset   = "preset"
+	testPassword = "secret"
+
+	testTrashedURL = "https://www.google.com/trashed"
+
+	testDomain    = "go.example.com"
+	testDomainURL = "https://www.example.com"
+	testProxy     = "10.0.0.1"
 )
 
 func TestHandleHealth(t *testing.T) {
@@ -56,6 +83,217 @@ func TestHandleRedirect(t *testing.T) {
 	})
 }
 
+func TestHandleDomainRedirect(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	redirect := func(host string, remoteAddr string, forwardedHost string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/"+testShort, nil)
+		r.Host = host
+		r.RemoteAddr = remoteAddr
+		if forwardedHost != "" {
+			r.Header.Set("X-Forwarded-Host", forwardedHost)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("short domain has its own namespace", func(t *testing.T) {
+		w := redirect("GO.example.com:8080", "192.0.2.1:1234", "")
+		location := w.Header().Get("Location")
+		assert.Equalf(t, testDomainURL, location, "Expected location header to be %s, got %s", testDomainURL, location)
+	})
+
+	t.Run("other hosts serve the default namespace", func(t *testing.T) {
+		w := redirect("dwarferl.example.com", "192.0.2.1:1234", "")
+		location := w.Header().Get("Location")
+		assert.Equalf(t, testURL, location, "Expected location header to be %s, got %s", testURL, location)
+	})
+
+	t.Run("forwarded host of trusted proxy is used", func(t *testing.T) {
+		w := redirect("dwarferl.internal", testProxy+":1234", testDomain)
+		location := w.Header().Get("Location")
+		assert.Equalf(t, testDomainURL, location, "Expected location header to be %s, got %s", testDomainURL, location)
+	})
+
+	t.Run("forwarded host of other clients is ignored", func(t *testing.T) {
+		w := redirect("dwarferl.internal", "192.0.2.1:1234", testDomain)
+		location := w.Header().Get("Location")
+		assert.Equalf(t, testURL, location, "Expected location header to be %s, got %s", testURL, location)
+	})
+
+	t.Run("links are managed per domain", func(t *testing.T) {
+		w := srv.call("GET", "/edit/"+testShort+"?domain="+testDomain, "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), testDomain+"/"+testShort, "Expected domain in heading")
+
+		w = srv.call("GET", "/edit/"+testShort+"?domain=unknown.example.com", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+}
+
+func TestHandlePassthroughRedirect(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	t.Run("path suffix is rejected without passthrough", func(t *testing.T) {
+		w := srv.call("GET", "/"+testShort+"/sub/page", "", nil)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("trailing slash is accepted without passthrough", func(t *testing.T) {
+		w := srv.call("GET", "/"+testShort+"/", "", nil)
+		assert.Equalf(t, http.StatusMovedPermanently, w.Code, "Expected status code to be 301, got %d", w.Code)
+	})
+
+	t.Run("path suffix and query are passed through", func(t *testing.T) {
+		w := srv.call("GET", "/"+testThroughShort+"/sub/page?utm_source=mail", "", nil)
+		location := w.Header().Get("Location")
+		expected := testURL + "/sub/page?utm_source=mail"
+		assert.Equalf(t, http.StatusMovedPermanently, w.Code, "Expected status code to be 301, got %d", w.Code)
+		assert.Equalf(t, expected, location, "Expected location header to be %s, got %s", expected, location)
+	})
+}
+
+func TestRoutesAreReserved(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	for _, route := range srv.Routes() {
+		segment := strings.Split(strings.TrimPrefix(route.Path, "/"), "/")[0]
+		if segment == "" || strings.HasPrefix(segment, ":") || segment == "test_login" {
+			continue
+		}
+		assert.Truef(t, shortener.IsReserved(segment), "Expected %s of %s %s to be a reserved short code", segment, route.Method, route.Path)
+	}
+}
+
+func TestHandleSplitRedirect(t *testing.T) {
+	srv, _, _ := setupTestServer()
+	srv.Config.CookieSecure = true
+
+	plain := srv.call("GET", "/"+testShort, "", nil)
+	assert.Emptyf(t, plain.Result().Cookies(), "Expected no visitor cookie without split, got %v", plain.Result().Cookies())
+
+	first := srv.call("GET", "/"+testSplitShort, "", nil)
+	assert.Equalf(t, http.StatusFound, first.Code, "Expected status code to be 302, got %d", first.Code)
+
+	cacheControl := first.Header().Get("Cache-Control")
+	assert.Equalf(t, "no-store", cacheControl, "Expected cache-control header to be no-store, got %s", cacheControl)
+
+	cookies := first.Result().Cookies()
+	assert.Lenf(t, cookies, 1, "Expected visitor cookie to be set, got %v", cookies)
+	assert.Equalf(t, srv.Config.ForwardedPrefix, cookies[0].Path, "Expected cookie path to be the prefix, got %v", cookies[0].Path)
+	assert.Truef(t, cookies[0].Secure, "Expected secure visitor cookie, got %v", cookies[0])
+
+	second := srv.call("GET", "/"+testSplitShort, "", cookies)
+	location := second.Header().Get("Location")
+	assert.Equalf(t, first.Header().Get("Location"), location, "Expected returning visitor to keep variant, got %s", location)
+	assert.Emptyf(t, second.Result().Cookies(), "Expected no new visitor cookie, got %v", second.Result().Cookies())
+}
+
+func TestHandleLimitedRedirect(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	t.Run("limited redirect is not cached", func(t *testing.T) {
+		w := srv.call("GET", "/"+testLimitedShort, "", nil)
+		cacheControl := w.Header().Get("Cache-Control")
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "no-store", cacheControl, "Expected cache-control header to be no-store, got %s", cacheControl)
+	})
+
+	t.Run("exhausted redirect is gone", func(t *testing.T) {
+		w := srv.call("GET", "/"+testSpentShort, "", nil)
+		assert.Equalf(t, http.StatusGone, w.Code, "Expected status code to be 410, got %d", w.Code)
+	})
+}
+
+func TestHandleProtectedRedirect(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	t.Run("protected redirect shows unlock form", func(t *testing.T) {
+		w := srv.call("GET", "/"+testLockedShort, "", nil)
+		assert.Equalf(t, http.StatusUnauthorized, w.Code, "Expected status code to be 401, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), `name="password"`, "Expected unlock form to be rendered")
+	})
+
+	t.Run("wrong password is rejected", func(t *testing.T) {
+		w := srv.call("POST", "/"+testLockedShort, "password=wrong", nil)
+		assert.Equalf(t, http.StatusUnauthorized, w.Code, "Expected status code to be 401, got %d", w.Code)
+	})
+
+	t.Run("unlocking non-existent redirect fails", func(t *testing.T) {
+		w := srv.call("POST", "/nonexistent", "password="+testPassword, nil)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("correct password unlocks redirect", func(t *testing.T) {
+		w := srv.call("POST", "/"+testLockedShort, "password="+testPassword, nil)
+		assert.Equalf(t, http.StatusSeeOther, w.Code, "Expected status code to be 303, got %d", w.Code)
+
+		w = srv.call("GET", "/"+testLockedShort, "", w.Result().Cookies())
+		location := w.Header().Get("Location")
+		assert.Equalf(t, http.StatusMovedPermanently, w.Code, "Expected status code to be 301, got %d", w.Code)
+		assert.Equalf(t, testURL, location, "Expected location header to be %s, got %s", testURL, location)
+	})
+}
+
+func TestHandlePreview(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	t.Run("preview of non-existent redirect fails", func(t *testing.T) {
+		w := srv.call("GET", "/preview/nonexistent", "", nil)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("preview shows destination", func(t *testing.T) {
+		w := srv.call("GET", "/preview/"+testShort, "", nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), testURL, "Expected preview to contain destination %s", testURL)
+	})
+
+	t.Run("preview of protected redirect demands unlock", func(t *testing.T) {
+		w := srv.call("GET", "/preview/"+testLockedShort, "", nil)
+		assert.Equalf(t, http.StatusUnauthorized, w.Code, "Expected status code to be 401, got %d", w.Code)
+		assert.NotContainsf(t, w.Body.String(), testURL, "Expected preview to hide destination")
+	})
+
+	t.Run("forced preview is shown until continued", func(t *testing.T) {
+		w := srv.call("GET", "/"+testPreviewShort, "", nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), testURL, "Expected preview to contain destination %s", testURL)
+
+		w = srv.call("POST", "/preview/"+testPreviewShort, "", nil)
+		assert.Equalf(t, http.StatusSeeOther, w.Code, "Expected status code to be 303, got %d", w.Code)
+		cookies := w.Result().Cookies()
+		assert.Lenf(t, cookies, 1, "Expected only the preview cookie, got %v", cookies)
+		assert.Equalf(t, previewCookie, cookies[0].Name, "Expected preview cookie, got %v", cookies[0].Name)
+
+		srv.Config.ForcePreview = true
+		other := srv.call("GET", "/"+testShort, "", cookies)
+		srv.Config.ForcePreview = false
+		assert.Equalf(t, http.StatusOK, other.Code, "Expected confirmation to be limited to its link, got %d", other.Code)
+
+		w = srv.call("GET", "/"+testPreviewShort, "", w.Result().Cookies())
+		assert.Equalf(t, http.StatusMovedPermanently, w.Code, "Expected status code to be 301, got %d", w.Code)
+
+		w = srv.call("GET", "/"+testPreviewShort, "", w.Result().Cookies())
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected preview to be shown again, got %d", w.Code)
+	})
+
+	t.Run("continuing needs an existing redirect", func(t *testing.T) {
+		w := srv.call("POST", "/preview/nonexistent", "", nil)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+		assert.Emptyf(t, w.Result().Cookies(), "Expected no cookies, got %v", w.Result().Cookies())
+	})
+
+	t.Run("global option forces preview for every redirect", func(t *testing.T) {
+		srv.Config.ForcePreview = true
+		defer func() { srv.Config.ForcePreview = false }()
+
+		w := srv.call("GET", "/"+testShort, "", nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+	})
+}
+
 func TestHandleGetLoginPage(t *testing.T) {
 	srv, cookies, _ := setupTestServer()
 
@@ -83,6 +321,38 @@ func TestHandleIndexPage(t *testing.T) {
 		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d %v", w.Code, w)
 	})
 
+	t.Run("index page filters by tag and search", func(t *testing.T) {
+		w := srv.call("GET", "/?q=google&tag=docs&from=2022-01-01&until=2022-12-31", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), testShort, "Expected matching redirect to be shown")
+
+		w = srv.call("GET", "/?tag=marketing", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "No matches", "Expected empty search result")
+	})
+
+	t.Run("index page links to the next page", func(t *testing.T) {
+		w := srv.call("GET", "/?sort=clicks&size=1", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "cursor="+testCursor, "Expected link to next page")
+		assert.Containsf(t, w.Body.String(), "sort=clicks", "Expected next page to keep sort order")
+
+		w = srv.call("GET", "/?sort=clicks&size=1&cursor="+testCursor, "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "First page", "Expected link to first page")
+		assert.NotContainsf(t, w.Body.String(), "Next page", "Expected no link to another page")
+	})
+
+	t.Run("index page rejects invalid cursors", func(t *testing.T) {
+		w := srv.call("GET", "/?cursor=garbage", "", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("index page rejects invalid dates", func(t *testing.T) {
+		w := srv.call("GET", "/?from=yesterday", "", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
 	t.Run("index page show dead-end error", func(t *testing.T) {
 		shortener.FailMode = true
 		w := srv.call("GET", "/", "", cookies)
@@ -118,6 +388,37 @@ func TestHandlePostCreationPage(t *testing.T) {
 		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
 	})
 
+	t.Run("creation post applies utm preset", func(t *testing.T) {
+		w := srv.call("POST", "/create", "url="+testURL+"&utm_preset="+testPreset, cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("creation post offers short domains", func(t *testing.T) {
+		w := srv.call("GET", "/create", "", cookies)
+		assert.Containsf(t, w.Body.String(), `<option value="`+testDomain+`">`, "Expected short domain to be offered")
+	})
+
+	t.Run("creation post accepts short domain", func(t *testing.T) {
+		w := srv.call("POST", "/create", "url="+testURL+"&domain="+testDomain, cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("creation post points to trashed link", func(t *testing.T) {
+		w := srv.call("POST", "/create", "url="+testTrashedURL, cookies)
+		assert.Equalf(t, http.StatusConflict, w.Code, "Expected status code to be 409, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "already in your trash", "Expected hint to restore the link")
+	})
+
+	t.Run("creation post rejects unknown domain", func(t *testing.T) {
+		w := srv.call("POST", "/create", "url="+testURL+"&domain=unknown.example.com", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("creation post rejects unknown utm preset", func(t *testing.T) {
+		w := srv.call("POST", "/create", "url="+testURL+"&utm_preset=unknown", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
 	t.Run("creation post shows dead-end error", func(t *testing.T) {
 		shortener.FailMode = true
 		w := srv.call("POST", "/create", "url="+testURL, cookies)
@@ -125,146 +426,1261 @@ func TestHandlePostCreationPage(t *testing.T) {
 	})
 }
 
-func TestHandleGetDeletionPage(t *testing.T) {
+func TestHandleQRCode(t *testing.T) {
 	srv, cookies, _ := setupTestServer()
 
-	t.Run("deletion page demands login", func(t *testing.T) {
-		w := srv.call("GET", "/delete/"+testShort, "url="+testURL, nil)
+	t.Run("qr code demands login", func(t *testing.T) {
+		w := srv.call("GET", "/qr/"+testShort, "", nil)
 		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
 	})
 
-	t.Run("deletion of nonexistent short fails", func(t *testing.T) {
-		w := srv.call("GET", "/delete/nonexistent", "", cookies)
-		assert.Equalf(t, http.StatusInternalServerError, w.Code, "Expected status code to be 500, got %d", w.Code)
+	t.Run("qr code of nonexistent short fails", func(t *testing.T) {
+		w := srv.call("GET", "/qr/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
 	})
 
-	t.Run("deletion page served successfully", func(t *testing.T) {
-		w := srv.call("GET", "/delete/"+testShort, "", cookies)
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		w := srv.call("GET", "/qr/"+testShort+"?size=1", "", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+
+		w = srv.call("GET", "/qr/"+testShort+"?format=gif", "", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("png qr code is served", func(t *testing.T) {
+		w := srv.call("GET", "/qr/"+testShort, "", cookies)
+		contentType := w.Header().Get("Content-Type")
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Equalf(t, "image/png", contentType, "Expected content type to be image/png, got %s", contentType)
+	})
+
+	t.Run("svg qr code is downloaded", func(t *testing.T) {
+		w := srv.call("GET", "/qr/"+testShort+"?format=svg&size=512&level=H&margin=0&download=true", "", cookies)
+		contentType := w.Header().Get("Content-Type")
+		disposition := w.Header().Get("Content-Disposition")
 		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Equalf(t, "image/svg+xml", contentType, "Expected content type to be image/svg+xml, got %s", contentType)
+		assert.Containsf(t, disposition, "short.svg", "Expected attachment file name, got %s", disposition)
 	})
 }
 
-func TestHandlePostDeletionPage(t *testing.T) {
+func TestHandleExport(t *testing.T) {
 	srv, cookies, _ := setupTestServer()
 
-	t.Run("deletion post demands login", func(t *testing.T) {
-		w := srv.call("GET", "/delete/"+testShort, "url="+testURL, nil)
+	t.Run("export demands login", func(t *testing.T) {
+		w := srv.call("GET", "/export", "", nil)
 		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
 	})
 
-	t.Run("deletion post for non-existing redirect show not found", func(t *testing.T) {
-		w := srv.call("POST", "/delete/nonexistent", "", cookies)
-		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	t.Run("export rejects unknown formats", func(t *testing.T) {
+		w := srv.call("GET", "/export?format=xml", "", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
 	})
 
-	t.Run("deletion post successfully deletes", func(t *testing.T) {
-		w := srv.call("POST", "/delete/"+testShort, "", cookies)
-		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	t.Run("export as csv", func(t *testing.T) {
+		w := srv.call("GET", "/export?format=csv", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Header().Get("Content-Disposition"), ".csv", "Expected csv attachment, got %s", w.Header().Get("Content-Disposition"))
+		assert.Containsf(t, w.Body.String(), "short,url,title", "Expected csv header, got %s", w.Body.String())
+		assert.Containsf(t, w.Body.String(), testShort+","+testURL, "Expected redirect row, got %s", w.Body.String())
+	})
+
+	t.Run("export as json", func(t *testing.T) {
+		w := srv.call("GET", "/export?format=json", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Equalf(t, "application/json", w.Header().Get("Content-Type"), "Expected json content type, got %s", w.Header().Get("Content-Type"))
+		assert.Containsf(t, w.Body.String(), `"short":"`+testShort+`"`, "Expected redirect entry, got %s", w.Body.String())
 	})
 }
 
-func setupTestServer() (*Server, []*http.Cookie, *urlShortenerServiceFake) {
-	c := config.Configuration{
-		ForwardedPrefix: "/",
-		TemplatePath:    "../../templates",
-	}
+func TestHandleImportPage(t *testing.T) {
+	srv, cookies, shortener := setupTestServer()
 
-	shortener := &urlShortenerServiceFake{}
-	users := &usersServiceFake{}
-	store := cookie.NewStore([]byte(c.SessionSecret))
+	upload := func(content string) *httptest.ResponseRecorder {
+		var body strings.Builder
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "links.csv")
+		_, _ = part.Write([]byte(content))
+		_ = form.Close()
 
-	gin.SetMode(gin.TestMode)
-	svr := New(c, store, shortener, users)
-	svr.InitRoutes()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/import", strings.NewReader(body.String()))
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		srv.ServeHTTP(w, r)
+		return w
+	}
 
-	cookies := svr.autologin()
-	return svr, cookies, shortener
-}
+	t.Run("import page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/import", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
 
-func (s *Server) autologin() []*http.Cookie {
-	// setup route for automatic login in tests
-	s.POST("/test_login", func(c *gin.Context) {
-		session := sessions.Default(c)
-		session.Set("user_id", testUser)
-		if err := session.Save(); err != nil {
-			_ = c.AbortWithError(http.StatusInternalServerError, err)
-			return
-		}
-		c.Status(200)
+	t.Run("import page is shown successfully", func(t *testing.T) {
+		w := srv.call("GET", "/import", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
 	})
 
-	// login and extract valid session cookies
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest("POST", "/test_login", nil)
-	s.ServeHTTP(w, r)
-	return w.Result().Cookies()
-}
+	t.Run("import without file is rejected", func(t *testing.T) {
+		w := srv.call("POST", "/import", "", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
 
-func (s *Server) call(method string, url string, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest(method, url, strings.NewReader(body))
-	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	t.Run("import without url column is rejected", func(t *testing.T) {
+		w := upload("short,title\nabc,Example\n")
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "no url column", "Expected parse error to be shown")
+	})
 
-	// add session cookies to call
-	for _, c := range cookies {
-		r.AddCookie(c)
-	}
+	t.Run("import reports every row", func(t *testing.T) {
+		w := upload("keyword,url\ndocs,https://example.com/docs\ntaken,https://example.com\n")
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "1 created", "Expected created count to be shown")
+		assert.Containsf(t, w.Body.String(), "1 conflicts", "Expected conflict count to be shown")
+	})
 
-	s.ServeHTTP(w, r)
-	return w
-}
+	t.Run("failed import shows partial report", func(t *testing.T) {
+		shortener.FailMode = true
+		defer func() { shortener.FailMode = false }()
 
-type urlShortenerServiceFake struct {
-	FailMode bool
+		w := upload("url\nhttps://example.com\n")
+		assert.Equalf(t, http.StatusInternalServerError, w.Code, "Expected status code to be 500, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "upload the file again", "Expected hint to resume")
+	})
 }
 
-func (s urlShortenerServiceFake) List(_ context.Context, userID string) ([]internal.Redirect, error) {
-	if s.FailMode {
-		return nil, errors.New("fake error")
-	}
-
-	if userID != testUser {
-		return nil, errors.New("user not found")
-	}
+func TestHandleEditPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
 
-	redirect := internal.Redirect{
-		Short:     testShort,
-		URL:       testURL,
-		UserID:    userID,
-		CreatedAt: time.Now(),
-	}
+	t.Run("edit page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/edit/"+testShort, "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
 
-	return []internal.Redirect{redirect}, nil
-}
+	t.Run("edit page of nonexistent short fails", func(t *testing.T) {
+		w := srv.call("GET", "/edit/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
 
-func (s urlShortenerServiceFake) GetRedirectByShort(_ context.Context, short string, userID string) (internal.Redirect, error) {
-	if s.FailMode {
-		return internal.Redirect{}, errors.New("fake error")
-	}
+	t.Run("edit page shows current tags", func(t *testing.T) {
+		w := srv.call("GET", "/edit/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "docs, search", "Expected tags to be prefilled")
+	})
 
-	if short != "short" || userID != testUser {
-		return internal.Redirect{}, errors.New("not found")
-	}
+	t.Run("details are saved", func(t *testing.T) {
+		w := srv.call("POST", "/edit/"+testShort, "title=Search&notes=main+engine&tags=docs,+search", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
 
-	redirect := internal.Redirect{
-		Short:     testShort,
-		URL:       testURL,
-		UserID:    testUser,
-		CreatedAt: time.Now(),
-	}
-	return redirect, nil
+	t.Run("invalid tags are rejected", func(t *testing.T) {
+		w := srv.call("POST", "/edit/"+testShort, "title=Search&tags="+strings.Repeat("x", 40), cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "Search", "Expected submitted details to be shown again")
+	})
 }
 
-func (s urlShortenerServiceFake) ShortenURL(_ context.Context, url string, _ string) (internal.Redirect, error) {
-	if s.FailMode {
-		return internal.Redirect{}, errors.New("fake error")
+func TestHandleRulesPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("rules page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/rules/"+testShort, "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("rules page of nonexistent short fails", func(t *testing.T) {
+		w := srv.call("GET", "/rules/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("rules page is shown successfully", func(t *testing.T) {
+		w := srv.call("GET", "/rules/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+	})
+
+	t.Run("rules are saved", func(t *testing.T) {
+		body := "kind=os&key=&value=ios&url=https://apps.apple.com&kind=language&key=&value=&url="
+		w := srv.call("POST", "/rules/"+testShort, body, cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("invalid rules are rejected", func(t *testing.T) {
+		body := "kind=os&key=&value=beos&url=https://example.com"
+		w := srv.call("POST", "/rules/"+testShort, body, cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "beos", "Expected submitted rules to be shown again")
+	})
+
+	t.Run("incomplete rules are rejected", func(t *testing.T) {
+		w := srv.call("POST", "/rules/"+testShort, "kind=os&value=ios", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+}
+
+func TestHandleVariantsPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("variants page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/variants/"+testShort, "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("variants page of nonexistent short fails", func(t *testing.T) {
+		w := srv.call("GET", "/variants/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("variants page shows distribution", func(t *testing.T) {
+		w := srv.call("GET", "/variants/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "75.0 %", "Expected click share to be shown")
+	})
+
+	t.Run("targets are saved", func(t *testing.T) {
+		body := "url=https://a.example.com&weight=2&url=https://b.example.com&weight=1&url=&weight=1"
+		w := srv.call("POST", "/variants/"+testShort, body, cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("invalid weights are rejected", func(t *testing.T) {
+		for _, weight := range []string{"-1", "many"} {
+			w := srv.call("POST", "/variants/"+testShort, "url=https://a.example.com&weight="+weight, cookies)
+			assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+			assert.Containsf(t, w.Body.String(), "a.example.com", "Expected submitted targets to be shown again")
+		}
+	})
+
+	t.Run("incomplete targets are rejected", func(t *testing.T) {
+		w := srv.call("POST", "/variants/"+testShort, "url=https://a.example.com", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+}
+
+func TestHandlePresetsPage(t *testing.T) {
+	srv, cookies, shortener := setupTestServer()
+
+	t.Run("presets page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/utm", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("presets page is shown successfully", func(t *testing.T) {
+		w := srv.call("GET", "/utm", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "spring_launch", "Expected campaign report to be shown")
+	})
+
+	t.Run("preset is created", func(t *testing.T) {
+		w := srv.call("POST", "/utm", "name=Newsletter&source=newsletter", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("invalid preset is rejected", func(t *testing.T) {
+		w := srv.call("POST", "/utm", "name=Newsletter", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("preset is deleted", func(t *testing.T) {
+		w := srv.call("POST", "/utm/delete/"+testPreset, "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("presets page shows dead-end error", func(t *testing.T) {
+		shortener.FailMode = true
+		w := srv.call("GET", "/utm", "", cookies)
+		assert.Equalf(t, http.StatusInternalServerError, w.Code, "Expected status code to be 500, got %d", w.Code)
+	})
+}
+
+func TestHandleGetDeletionPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("deletion page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/delete/"+testShort, "url="+testURL, nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("deletion of nonexistent short fails", func(t *testing.T) {
+		w := srv.call("GET", "/delete/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusInternalServerError, w.Code, "Expected status code to be 500, got %d", w.Code)
+	})
+
+	t.Run("deletion page served successfully", func(t *testing.T) {
+		w := srv.call("GET", "/delete/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+	})
+}
+
+func TestHandlePostDeletionPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("deletion post demands login", func(t *testing.T) {
+		w := srv.call("GET", "/delete/"+testShort, "url="+testURL, nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("deletion post for non-existing redirect show not found", func(t *testing.T) {
+		w := srv.call("POST", "/delete/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("deletion post successfully deletes", func(t *testing.T) {
+		w := srv.call("POST", "/delete/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+}
+
+func TestHandleTrashPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("trash page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/trash", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("trash page lists deleted links", func(t *testing.T) {
+		w := srv.call("GET", "/trash", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "trash/restore/"+testShort, "Expected restore action, got %s", w.Body.String())
+	})
+
+	t.Run("restoring a non-existing link shows not found", func(t *testing.T) {
+		w := srv.call("POST", "/trash/restore/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("restoring a link redirects back to the trash", func(t *testing.T) {
+		w := srv.call("POST", "/trash/restore/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/trash", w.Header().Get("Location"), "Expected redirect to trash, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("purging a non-existing link shows not found", func(t *testing.T) {
+		w := srv.call("POST", "/trash/purge/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("purging a link redirects back to the trash", func(t *testing.T) {
+		w := srv.call("POST", "/trash/purge/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+}
+
+func TestHandleAuditPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("audit page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/audit", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("audit page lists own events", func(t *testing.T) {
+		w := srv.call("GET", "/audit?action=link.update", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "link.update", "Expected event in page, got %s", w.Body.String())
+	})
+
+	t.Run("audit page rejects malformed paging", func(t *testing.T) {
+		w := srv.call("GET", "/audit?before=yesterday", "", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("history of a foreign link is not found", func(t *testing.T) {
+		w := srv.call("GET", "/audit/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("history of a link lists its events", func(t *testing.T) {
+		w := srv.call("GET", "/audit/"+testShort, "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "History of "+testShort, "Expected link history, got %s", w.Body.String())
+	})
+}
+
+func TestAdminPages(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+	adminCookies := srv.loginAs(testAdmin)
+
+	t.Run("admin pages are forbidden for regular users", func(t *testing.T) {
+		for _, path := range []string{"/admin/users", "/admin/links", "/admin/audit"} {
+			w := srv.call("GET", path, "", cookies)
+			assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403 for %s, got %d", path, w.Code)
+		}
+
+		w := srv.call("POST", "/admin/links/"+testShort+"/remove", "", cookies)
+		assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403, got %d", w.Code)
+	})
+
+	t.Run("admin index leads to the users", func(t *testing.T) {
+		w := srv.call("GET", "/admin", "", adminCookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/admin/users", w.Header().Get("Location"), "Expected redirect to users, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("admin sees all users", func(t *testing.T) {
+		w := srv.call("GET", "/admin/users?q=example", "", adminCookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "user@example.com", "Expected user in listing, got %s", w.Body.String())
+	})
+
+	t.Run("admin disables and enables users", func(t *testing.T) {
+		w := srv.call("POST", "/admin/users/"+testUser+"/disable", "", adminCookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+
+		w = srv.call("POST", "/admin/users/"+testUser+"/enable", "", adminCookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+
+		w = srv.call("POST", "/admin/users/nonexistent/disable", "", adminCookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("admin sees all links", func(t *testing.T) {
+		w := srv.call("GET", "/admin/links?owner="+testUser, "", adminCookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), testURL, "Expected link in listing, got %s", w.Body.String())
+
+		w = srv.call("GET", "/admin/links?cursor=garbage", "", adminCookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("admin transfers links", func(t *testing.T) {
+		w := srv.call("POST", "/admin/links/"+testShort+"/transfer", "email=nobody@example.com", adminCookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "no user with the email", "Expected error message, got %s", w.Body.String())
+
+		w = srv.call("POST", "/admin/links/"+testShort+"/transfer", "email=user@example.com", adminCookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("admin removes links", func(t *testing.T) {
+		w := srv.call("POST", "/admin/links/nonexistent/remove", "", adminCookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+
+		w = srv.call("POST", "/admin/links/"+testShort+"/remove", "", adminCookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("admin audit log covers all users", func(t *testing.T) {
+		w := srv.call("GET", "/admin/audit?actor="+testUser, "", adminCookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "link.update", "Expected event in page, got %s", w.Body.String())
+	})
+}
+
+func TestDisabledUser(t *testing.T) {
+	srv, _, _ := setupTestServer()
+	cookies := srv.loginAs(testDisabledUser)
+
+	w := srv.call("GET", "/", "", cookies)
+	assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	assert.Equalf(t, "/login", w.Header().Get("Location"), "Expected redirect to login, got %s", w.Header().Get("Location"))
+}
+
+func TestRequestID(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	w := srv.call("GET", "/health", "", nil)
+	assert.NotEmptyf(t, w.Header().Get(requestIDHeader), "Expected generated request ID, got none")
+
+	r := httptest.NewRequest("GET", "/health", nil)
+	r.Header.Set(requestIDHeader, "request-1")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	assert.Equalf(t, "request-1", w.Header().Get(requestIDHeader), "Expected request ID to be passed on, got %s", w.Header().Get(requestIDHeader))
+}
+
+func TestHandleSessionsPage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("sessions page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/sessions", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("sessions page lists devices", func(t *testing.T) {
+		w := srv.call("GET", "/sessions", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "Firefox on Linux", "Expected device, got %s", w.Body.String())
+		assert.Containsf(t, w.Body.String(), "sessions/revoke/"+testSession, "Expected revoke action, got %s", w.Body.String())
+	})
+
+	t.Run("revoking a foreign session shows not found", func(t *testing.T) {
+		w := srv.call("POST", "/sessions/revoke/nonexistent", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("revoking a session redirects back", func(t *testing.T) {
+		w := srv.call("POST", "/sessions/revoke/"+testSession, "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/sessions", w.Header().Get("Location"), "Expected redirect to sessions, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("signing out everywhere ends this session too", func(t *testing.T) {
+		w := srv.call("POST", "/sessions/revoke-all", "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/login", w.Header().Get("Location"), "Expected redirect to login, got %s", w.Header().Get("Location"))
+
+		expired := w.Result().Cookies()
+		assert.Lenf(t, expired, 1, "Expected session cookie to be reset, got %v", expired)
+		assert.Truef(t, expired[0].MaxAge < 0, "Expected session cookie to expire, got max age %d", expired[0].MaxAge)
+	})
+}
+
+func TestCompleteAuth(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	// stands in for the provider round trip, which cannot run in tests
+	srv.POST("/test_auth", func(c *gin.Context) {
+		identity := internal.Identity{
+			Provider:      c.Query("provider"),
+			Subject:       c.Query("subject"),
+			Email:         c.Query("email"),
+			EmailVerified: c.Query("unverified") == "",
+		}
+		srv.completeAuth(c, identity)
+	})
+
+	t.Run("signing in redirects to the homepage", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&subject=42&email=user@example.com", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/", w.Header().Get("Location"), "Expected redirect to homepage, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("signing in with a taken email explains how to link", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&subject=42&email=taken@example.com", "", nil)
+		assert.Equalf(t, http.StatusConflict, w.Code, "Expected status code to be 409, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "connect this login on your profile", "Expected explanation, got %s", w.Body.String())
+	})
+
+	t.Run("signing in without email is refused", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&subject=42", "", nil)
+		assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403, got %d", w.Code)
+	})
+
+	t.Run("signing in with an unverified email is refused", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&subject=42&email=user@example.com&unverified=1", "", nil)
+		assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "verify your email address", "Expected explanation, got %s", w.Body.String())
+	})
+
+	t.Run("uninvited users are rejected", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&subject=42&email=stranger@example.org", "", nil)
+		assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "ask an administrator to invite you", "Expected rejection page, got %s", w.Body.String())
+		assert.Containsf(t, w.Body.String(), "example.com", "Expected allowed domains, got %s", w.Body.String())
+	})
+
+	t.Run("disabled users cannot sign in", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&email=disabled@example.com&subject="+testDisabledUser, "", nil)
+		assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403, got %d", w.Code)
+	})
+
+	t.Run("signed in users link the identity", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&subject=42&email=octocat@example.com", "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/profile", w.Header().Get("Location"), "Expected redirect to profile, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("linking an identity of another user is refused", func(t *testing.T) {
+		w := srv.call("POST", "/test_auth?provider=github&subject=taken&email=octocat@example.com", "", cookies)
+		assert.Equalf(t, http.StatusConflict, w.Code, "Expected status code to be 409, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "belongs to another account", "Expected explanation, got %s", w.Body.String())
+	})
+}
+
+func TestExternalIdentity(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer verified" {
+			_, _ = w.Write([]byte(`[{"email":"octocat@example.com","primary":true,"verified":false}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"email":"public@example.com","primary":false,"verified":true},{"email":"octocat@example.com","primary":true,"verified":true}]`))
+	}))
+	defer github.Close()
+	githubEmailsURL = github.URL
+
+	tests := []struct {
+		name     string
+		user     goth.User
+		email    string
+		verified bool
+	}{
+		{"github uses the verified primary email", goth.User{Provider: "github", Email: "public@example.com", AccessToken: "verified"}, "octocat@example.com", true},
+		{"github primary email is unverified", goth.User{Provider: "github", AccessToken: "unverified"}, "octocat@example.com", false},
+		{"google verified email", goth.User{Provider: "google", Email: "user@example.com", RawData: map[string]any{"verified_email": true}}, "user@example.com", true},
+		{"google unverified email", goth.User{Provider: "google", Email: "user@example.com", RawData: map[string]any{"verified_email": false}}, "user@example.com", false},
+		{"oidc verified claim", goth.User{Provider: "oidc", Email: "user@example.com", RawData: map[string]any{"email_verified": true}}, "user@example.com", true},
+		{"oidc claim as string", goth.User{Provider: "oidc", Email: "user@example.com", RawData: map[string]any{"email_verified": "true"}}, "user@example.com", true},
+		{"oidc without claim", goth.User{Provider: "oidc", Email: "user@example.com"}, "user@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := externalIdentity(context.Background(), tt.user)
+			assert.NoErrorf(t, err, "Expected no error, got %v", err)
+			assert.Equalf(t, tt.email, identity.Email, "Expected email %v, got %v", tt.email, identity.Email)
+			assert.Equalf(t, tt.verified, identity.EmailVerified, "Expected verified to be %v, got %v", tt.verified, identity.EmailVerified)
+		})
+	}
+}
+
+func TestHandleProfilePage(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("profile page demands login", func(t *testing.T) {
+		w := srv.call("GET", "/profile", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+
+	t.Run("profile page lists connected logins", func(t *testing.T) {
+		w := srv.call("GET", "/profile", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "google-subject", "Expected identity, got %s", w.Body.String())
+	})
+
+	t.Run("the only login cannot be removed", func(t *testing.T) {
+		w := srv.call("POST", "/profile/unlink", "provider=google&subject=google-subject", cookies)
+		assert.Equalf(t, http.StatusConflict, w.Code, "Expected status code to be 409, got %d", w.Code)
+	})
+
+	t.Run("unlinking an unknown login shows not found", func(t *testing.T) {
+		w := srv.call("POST", "/profile/unlink", "provider=github&subject=unknown", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("unlinking redirects back to the profile", func(t *testing.T) {
+		w := srv.call("POST", "/profile/unlink", "provider=github&subject=42", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/profile", w.Header().Get("Location"), "Expected redirect to profile, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("logout ends the session", func(t *testing.T) {
+		w := srv.call("GET", "/logout", "", cookies)
+		assert.Equalf(t, http.StatusTemporaryRedirect, w.Code, "Expected status code to be 307, got %d", w.Code)
+		assert.Equalf(t, "/login", w.Header().Get("Location"), "Expected redirect to login, got %s", w.Header().Get("Location"))
+	})
+}
+
+func TestLocalAccounts(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	t.Run("login page offers the password form", func(t *testing.T) {
+		w := srv.call("GET", "/login", "", nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), `name="password"`, "Expected password form, got %s", w.Body.String())
+	})
+
+	t.Run("signing in with the right password redirects to the homepage", func(t *testing.T) {
+		w := srv.call("POST", "/login", "email=user@example.com&password="+testPassword, nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/", w.Header().Get("Location"), "Expected redirect to homepage, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("signing in with a wrong password fails", func(t *testing.T) {
+		w := srv.call("POST", "/login", "email=user@example.com&password=wrong", nil)
+		assert.Equalf(t, http.StatusUnauthorized, w.Code, "Expected status code to be 401, got %d", w.Code)
+	})
+
+	t.Run("unverified users can ask for another email", func(t *testing.T) {
+		w := srv.call("POST", "/login", "email=unverified@example.com&password="+testPassword, nil)
+		assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "verify/resend", "Expected resend form, got %s", w.Body.String())
+	})
+
+	t.Run("registration asks to confirm the email", func(t *testing.T) {
+		body := "email=new@example.com&password=" + testPassword + "&password_confirm=" + testPassword
+		w := srv.call("POST", "/register", body, nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "We sent you an email", "Expected notice, got %s", w.Body.String())
+	})
+
+	t.Run("registration checks the repeated password", func(t *testing.T) {
+		body := "email=new@example.com&password=" + testPassword + "&password_confirm=other"
+		w := srv.call("POST", "/register", body, nil)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("registration refuses taken emails", func(t *testing.T) {
+		body := "email=user@example.com&password=" + testPassword + "&password_confirm=" + testPassword
+		w := srv.call("POST", "/register", body, nil)
+		assert.Equalf(t, http.StatusConflict, w.Code, "Expected status code to be 409, got %d", w.Code)
+	})
+
+	t.Run("verification links work once", func(t *testing.T) {
+		w := srv.call("GET", "/verify?token="+testToken, "", nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+
+		w = srv.call("GET", "/verify?token=invalid", "", nil)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+
+	t.Run("forgot page always confirms", func(t *testing.T) {
+		w := srv.call("POST", "/forgot", "email=unknown@example.com", nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+	})
+
+	t.Run("reset page changes the password", func(t *testing.T) {
+		w := srv.call("GET", "/reset?token="+testToken, "", nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), testToken, "Expected token in form, got %s", w.Body.String())
+
+		body := "token=" + testToken + "&password=" + testPassword + "&password_confirm=" + testPassword
+		w = srv.call("POST", "/reset", body, nil)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+
+		body = "token=invalid&password=" + testPassword + "&password_confirm=" + testPassword
+		w = srv.call("POST", "/reset", body, nil)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+	})
+}
+
+func TestAdminInvitations(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+	admin := srv.loginAs(testAdmin)
+
+	t.Run("regular users cannot invite", func(t *testing.T) {
+		w := srv.call("GET", "/admin/invitations", "", cookies)
+		assert.Equalf(t, http.StatusForbidden, w.Code, "Expected status code to be 403, got %d", w.Code)
+	})
+
+	t.Run("lists open invitations", func(t *testing.T) {
+		w := srv.call("GET", "/admin/invitations", "", admin)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "guest@partner.org", "Expected invitation, got %s", w.Body.String())
+	})
+
+	t.Run("inviting shows the sign-in link", func(t *testing.T) {
+		w := srv.call("POST", "/admin/invitations", "email=new@partner.org", admin)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "new@partner.org can sign up at", "Expected notice, got %s", w.Body.String())
+
+		w = srv.call("POST", "/admin/invitations", "email=user@example.com", admin)
+		assert.Equalf(t, http.StatusConflict, w.Code, "Expected status code to be 409, got %d", w.Code)
+	})
+
+	t.Run("revoking redirects to the list", func(t *testing.T) {
+		w := srv.call("POST", "/admin/invitations/invitation/revoke", "", admin)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+
+		w = srv.call("POST", "/admin/invitations/unknown/revoke", "", admin)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+}
+
+func TestTwoFactorChallenge(t *testing.T) {
+	srv, _, _ := setupTestServer()
+
+	signIn := func(t *testing.T) []*http.Cookie {
+		w := srv.call("POST", "/login", "email=admin@example.com&password="+testPassword, nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/login/2fa", w.Header().Get("Location"), "Expected redirect to challenge, got %s", w.Header().Get("Location"))
+		return w.Result().Cookies()
+	}
+
+	t.Run("users without second factor are signed in right away", func(t *testing.T) {
+		w := srv.call("POST", "/login", "email=user@example.com&password="+testPassword, nil)
+		assert.Equalf(t, "/", w.Header().Get("Location"), "Expected redirect to homepage, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("pending users are not signed in", func(t *testing.T) {
+		cookies := signIn(t)
+
+		w := srv.call("GET", "/profile", "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/login", w.Header().Get("Location"), "Expected redirect to login, got %s", w.Header().Get("Location"))
+
+		w = srv.call("GET", "/login/2fa", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+	})
+
+	t.Run("right code signs in", func(t *testing.T) {
+		cookies := signIn(t)
+
+		w := srv.call("POST", "/login/2fa", "code=000000", cookies)
+		assert.Equalf(t, http.StatusUnauthorized, w.Code, "Expected status code to be 401, got %d", w.Code)
+
+		w = srv.call("POST", "/login/2fa", "code="+testCode, cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/", w.Header().Get("Location"), "Expected redirect to homepage, got %s", w.Header().Get("Location"))
+
+		w = srv.call("GET", "/profile", "", w.Result().Cookies())
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+	})
+
+	t.Run("too many wrong codes end the sign-in", func(t *testing.T) {
+		cookies := signIn(t)
+
+		for i := 0; i < maxChallengeAttempts; i++ {
+			w := srv.call("POST", "/login/2fa", "code=000000", cookies)
+			cookies = w.Result().Cookies()
+		}
+
+		w := srv.call("POST", "/login/2fa", "code="+testCode, cookies)
+		assert.Equalf(t, http.StatusUnauthorized, w.Code, "Expected status code to be 401, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "sign in again", "Expected expired sign-in, got %s", w.Body.String())
+	})
+
+	t.Run("challenge needs a pending sign-in", func(t *testing.T) {
+		w := srv.call("GET", "/login/2fa", "", nil)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+	})
+}
+
+func TestTwoFactorPolicy(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+	srv.Config.TwoFactorRoles = []string{"user", "admin"}
+
+	t.Run("users are sent to set up two-factor authentication", func(t *testing.T) {
+		w := srv.call("GET", "/", "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/profile/2fa", w.Header().Get("Location"), "Expected redirect to setup, got %s", w.Header().Get("Location"))
+
+		w = srv.call("GET", "/profile/2fa", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "SECRET", "Expected secret, got %s", w.Body.String())
+
+		w = srv.call("GET", "/profile/2fa/qr", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Equalf(t, "image/png", w.Header().Get("Content-Type"), "Expected png, got %s", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("enabling shows recovery codes and unlocks the session", func(t *testing.T) {
+		w := srv.call("POST", "/profile/2fa", "code=000000", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+
+		w = srv.call("POST", "/profile/2fa", "code="+testCode, cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "aaaaa-bbbbb", "Expected recovery codes, got %s", w.Body.String())
+
+		w = srv.call("GET", "/", "", w.Result().Cookies())
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+	})
+
+	t.Run("sessions from before enabling are challenged", func(t *testing.T) {
+		w := srv.call("GET", "/profile", "", srv.loginAs(testAdmin))
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/login/2fa", w.Header().Get("Location"), "Expected redirect to challenge, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("required two-factor authentication cannot be disabled", func(t *testing.T) {
+		cookies := srv.loginAs(testAdmin)
+		w := srv.call("POST", "/login/2fa", "code="+testCode, srv.call("GET", "/profile", "", cookies).Result().Cookies())
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+
+		w = srv.call("POST", "/profile/2fa/disable", "code="+testCode, w.Result().Cookies())
+		assert.Equalf(t, http.StatusConflict, w.Code, "Expected status code to be 409, got %d", w.Code)
+	})
+}
+
+func TestTwoFactorSettings(t *testing.T) {
+	srv, _, _ := setupTestServer()
+	cookies := srv.loginAs(testAdmin)
+
+	t.Run("profile shows the status", func(t *testing.T) {
+		w := srv.call("GET", "/profile", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "10 recovery codes left", "Expected status, got %s", w.Body.String())
+	})
+
+	t.Run("recovery codes can be replaced", func(t *testing.T) {
+		w := srv.call("POST", "/profile/2fa/recovery", "code=000000", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+
+		w = srv.call("POST", "/profile/2fa/recovery", "code="+testCode, cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "aaaaa-bbbbb", "Expected recovery codes, got %s", w.Body.String())
+	})
+
+	t.Run("optional two-factor authentication can be disabled", func(t *testing.T) {
+		w := srv.call("POST", "/profile/2fa/disable", "code="+testCode, cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/profile", w.Header().Get("Location"), "Expected redirect to profile, got %s", w.Header().Get("Location"))
+	})
+}
+
+func TestAccount(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("account page offers export and deletion", func(t *testing.T) {
+		w := srv.call("GET", "/account", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "Download my data", "Expected export link, got %s", w.Body.String())
+		assert.Containsf(t, w.Body.String(), "Delete my account", "Expected deletion form, got %s", w.Body.String())
+	})
+
+	t.Run("export downloads a zip archive", func(t *testing.T) {
+		w := srv.call("GET", "/account/export", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Equalf(t, "application/zip", w.Header().Get("Content-Type"), "Expected zip content type, got %s", w.Header().Get("Content-Type"))
+		assert.Containsf(t, w.Header().Get("Content-Disposition"), "attachment", "Expected a download, got %s", w.Header().Get("Content-Disposition"))
+		assert.Equalf(t, "archive", w.Body.String(), "Expected archive, got %s", w.Body.String())
+	})
+
+	t.Run("deletion needs the email as confirmation", func(t *testing.T) {
+		w := srv.call("POST", "/account/delete", "confirm=someone@example.com", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "enter your email to confirm", "Expected message, got %s", w.Body.String())
+	})
+
+	t.Run("deletion refuses unknown heirs", func(t *testing.T) {
+		w := srv.call("POST", "/account/delete", "confirm=user@example.com&heir=nobody@example.com", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "take over your links", "Expected message, got %s", w.Body.String())
+	})
+
+	t.Run("deletion signs out", func(t *testing.T) {
+		w := srv.call("POST", "/account/delete", "confirm=User@Example.com&heir=admin@example.com", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/login", w.Header().Get("Location"), "Expected redirect to login, got %s", w.Header().Get("Location"))
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	srv, cookies, _ := setupTestServer()
+
+	t.Run("webhooks page lists webhooks and events", func(t *testing.T) {
+		w := srv.call("GET", "/webhooks", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "https://example.com/hook", "Expected webhook, got %s", w.Body.String())
+		assert.Containsf(t, w.Body.String(), "link.clicked", "Expected event choice, got %s", w.Body.String())
+	})
+
+	t.Run("webhook can be created", func(t *testing.T) {
+		w := srv.call("POST", "/webhooks", "url=https://example.com/new&events=link.created", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/webhooks/webhook", w.Header().Get("Location"), "Expected redirect to webhook, got %s", w.Header().Get("Location"))
+	})
+
+	t.Run("invalid webhook is rejected", func(t *testing.T) {
+		w := srv.call("POST", "/webhooks", "url=ftp://example.com", cookies)
+		assert.Equalf(t, http.StatusBadRequest, w.Code, "Expected status code to be 400, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "http or https URL", "Expected message, got %s", w.Body.String())
+	})
+
+	t.Run("webhook page shows deliveries", func(t *testing.T) {
+		w := srv.call("GET", "/webhooks/webhook", "", cookies)
+		assert.Equalf(t, http.StatusOK, w.Code, "Expected status code to be 200, got %d", w.Code)
+		assert.Containsf(t, w.Body.String(), "X-Dwarferl-Signature", "Expected signature instructions, got %s", w.Body.String())
+		assert.Containsf(t, w.Body.String(), "unexpected status 500", "Expected delivery error, got %s", w.Body.String())
+
+		w = srv.call("GET", "/webhooks/unknown", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("webhook can be tested", func(t *testing.T) {
+		w := srv.call("POST", "/webhooks/webhook/test", "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/webhooks/webhook", w.Header().Get("Location"), "Expected redirect to webhook, got %s", w.Header().Get("Location"))
+
+		w = srv.call("POST", "/webhooks/unknown/test", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+
+	t.Run("webhook can be deleted", func(t *testing.T) {
+		w := srv.call("POST", "/webhooks/webhook/delete", "", cookies)
+		assert.Equalf(t, http.StatusFound, w.Code, "Expected status code to be 302, got %d", w.Code)
+		assert.Equalf(t, "/webhooks", w.Header().Get("Location"), "Expected redirect to webhooks, got %s", w.Header().Get("Location"))
+
+		w = srv.call("POST", "/webhooks/unknown/delete", "", cookies)
+		assert.Equalf(t, http.StatusNotFound, w.Code, "Expected status code to be 404, got %d", w.Code)
+	})
+}
+
+func setupTestServer() (*Server, []*http.Cookie, *urlShortenerServiceFake) {
+	c := config.Configuration{
+		ForwardedPrefix: "/",
+		TemplatePath:    "../../templates",
+		UnlockDuration:  time.Hour,
+		PageSize:        50,
+
+		LocalAccounts:     true,
+		LocalRegistration: true,
+		EmailVerification: true,
+
+		AllowedDomains: []string{"example.com"},
+
+		ShortDomains:   []string{testDomain},
+		TrustedProxies: []string{testProxy},
+	}
+
+	shortener := &urlShortenerServiceFake{}
+	users := &usersServiceFake{}
+	presets := &utmPresetServiceFake{}
+	auditor := &auditServiceFake{}
+	sessionService := &sessionServiceFake{}
+	accounts := &accountServiceFake{}
+	twoFactor := &twoFactorServiceFake{}
+	invitations := &invitationServiceFake{}
+	privacy := &privacyServiceFake{}
+	webhooks := &webhookServiceFake{}
+	store := cookie.NewStore([]byte(c.SessionSecret))
+
+	gin.SetMode(gin.TestMode)
+	svr := New(c, store, shortener, users, presets, auditor, sessionService, accounts, twoFactor, invitations, privacy, webhooks)
+	svr.InitRoutes()
+
+	cookies := svr.autologin()
+	return svr, cookies, shortener
+}
+
+func (s *Server) autologin() []*http.Cookie {
+	// setup route for automatic login in tests
+	s.POST("/test_login", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("user_id", c.DefaultQuery("user_id", testUser))
+		if err := session.Save(); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(200)
+	})
+
+	return s.loginAs(testUser)
+}
+
+// loginAs extracts valid session cookies for the given user.
+func (s *Server) loginAs(userID string) []*http.Cookie {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/test_login?user_id="+userID, nil)
+	s.ServeHTTP(w, r)
+	return w.Result().Cookies()
+}
+
+func (s *Server) call(method string, url string, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// add session cookies to call
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+
+	s.ServeHTTP(w, r)
+	return w
+}
+
+type urlShortenerServiceFake struct {
+	FailMode bool
+}
+
+func (s urlShortenerServiceFake) List(_ context.Context, userID string, filter internal.RedirectFilter, page internal.PageRequest) (internal.RedirectPage, error) {
+	if s.FailMode {
+		return internal.RedirectPage{}, errors.New("fake error")
+	}
+
+	if userID != testUser {
+		return internal.RedirectPage{}, errors.New("user not found")
+	}
+
+	if page.Cursor != "" && page.Cursor != testCursor {
+		return internal.RedirectPage{}, internal.ErrInvalidCursor
+	}
+
+	redirect := internal.Redirect{
+		Short:     testShort,
+		URL:       testURL,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		Tags:      []string{"docs", "search"},
+	}
+
+	if filter.Tag != "" && filter.Tag != "docs" && filter.Tag != "search" {
+		return internal.RedirectPage{}, nil
+	}
+
+	result := internal.RedirectPage{Redirects: []internal.Redirect{redirect}}
+	if page.Size == 1 && page.Cursor == "" {
+		result.NextCursor = testCursor
+	}
+	return result, nil
+}
+
+func (s urlShortenerServiceFake) Tags(context.Context, string) ([]string, error) {
+	if s.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	return []string{"docs", "search"}, nil
+}
+
+func (s urlShortenerServiceFake) Campaigns(context.Context, string) ([]internal.CampaignStats, error) {
+	if s.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	return []internal.CampaignStats{{Campaign: "spring_launch", Links: 2, Clicks: 42}}, nil
+}
+
+func (s urlShortenerServiceFake) GetRedirectByShort(_ context.Context, domain string, short string, userID string) (internal.Redirect, error) {
+	if s.FailMode {
+		return internal.Redirect{}, errors.New("fake error")
+	}
+
+	if short != "short" || userID != testUser || !isTestDomain(domain) {
+		return internal.Redirect{}, errors.New("not found")
+	}
+
+	redirect := internal.Redirect{
+		Domain:    domain,
+		Short:     testShort,
+		URL:       testURL,
+		UserID:    testUser,
+		CreatedAt: time.Now(),
+		Tags:      []string{"docs", "search"},
+	}
+	return redirect, nil
+}
+
+func (s urlShortenerServiceFake) LookupShortURL(_ context.Context, domain string, short string) (internal.Redirect, error) {
+	if s.FailMode {
+		return internal.Redirect{}, errors.New("fake error")
+	}
+
+	redirect := internal.Redirect{
+		Short:     short,
+		URL:       testURL,
+		UserID:    testUser,
+		CreatedAt: time.Now(),
+	}
+
+	// the short domain has a namespace of its own
+	if domain == testDomain {
+		if short != testShort {
+			return internal.Redirect{}, errors.New("not found")
+		}
+		redirect.Domain = domain
+		redirect.URL = testDomainURL
+		return redirect, nil
+	}
+
+	switch short {
+	case testShort:
+		return redirect, nil
+	case testLockedShort:
+		redirect.PasswordHash = "hashed"
+		return redirect, nil
+	case testLimitedShort:
+		redirect.MaxClicks = 2
+		return redirect, nil
+	case testSpentShort:
+		redirect.MaxClicks = 1
+		redirect.Clicks = 1
+		return redirect, nil
+	case testPreviewShort:
+		redirect.ForcePreview = true
+		return redirect, nil
+	case testThroughShort:
+		redirect.Passthrough = internal.PassthroughMerge
+		return redirect, nil
+	case testSplitShort:
+		redirect.Targets = []internal.WeightedTarget{{URL: testURL, Weight: 1}, {URL: testURL + "/b", Weight: 1}}
+		return redirect, nil
+	default:
+		return internal.Redirect{}, errors.New("not found")
+	}
+}
+
+func (s urlShortenerServiceFake) UnlockShortURL(ctx context.Context, domain string, short string, password string) error {
+	redirect, err := s.LookupShortURL(ctx, domain, short)
+	if err != nil {
+		return err
+	}
+
+	if redirect.IsProtected() && password != testPassword {
+		return internal.ErrWrongPassword
+	}
+	return nil
+}
+
+func (s urlShortenerServiceFake) UpdateDetails(_ context.Context, domain string, short string, _ string, details internal.RedirectDetails) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+
+	if short != testShort || !isTestDomain(domain) {
+		return errors.New("not found")
+	}
+
+	for _, tag := range details.Tags {
+		if len(tag) > 32 {
+			return errors.New("tag too long")
+		}
+	}
+	return nil
+}
+
+func (s urlShortenerServiceFake) UpdateRules(_ context.Context, domain string, short string, _ string, rules []internal.TargetingRule) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+
+	if short != testShort || !isTestDomain(domain) {
+		return errors.New("not found")
+	}
+
+	for _, rule := range rules {
+		if rule.Kind == internal.RuleOS && rule.Value != "ios" && rule.Value != "android" {
+			return errors.New("unknown operating system")
+		}
+	}
+	return nil
+}
+
+func (s urlShortenerServiceFake) UpdateTargets(_ context.Context, domain string, short string, _ string, targets []internal.WeightedTarget) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+
+	if short != testShort || !isTestDomain(domain) {
+		return errors.New("not found")
+	}
+
+	for _, target := range targets {
+		if target.Weight < 0 {
+			return errors.New("weight must not be negative")
+		}
+	}
+	return nil
+}
+
+func (s urlShortenerServiceFake) VariantStats(_ context.Context, domain string, short string, _ string) ([]internal.VariantStats, error) {
+	if s.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	if short != testShort || !isTestDomain(domain) {
+		return nil, errors.New("not found")
+	}
+
+	stats := []internal.VariantStats{
+		{WeightedTarget: internal.WeightedTarget{URL: testURL, Weight: 1}, Clicks: 3, Share: 75},
+		{WeightedTarget: internal.WeightedTarget{URL: testURL + "/b", Weight: 1}, Clicks: 1, Share: 25},
+	}
+	return stats, nil
+}
+
+func (s urlShortenerServiceFake) ShortenURL(_ context.Context, url string, _ string, options internal.RedirectOptions) (internal.Redirect, error) {
+	if s.FailMode {
+		return internal.Redirect{}, errors.New("fake error")
+	}
+
+	if url == testTrashedURL {
+		return internal.Redirect{}, internal.ErrLinkTrashed
 	}
 
 	if url != testURL {
 		return internal.Redirect{}, errors.New("not found")
 	}
 
+	if !isTestDomain(options.Domain) {
+		return internal.Redirect{}, internal.ErrUnknownDomain
+	}
+
 	redirect := internal.Redirect{
+		Domain:    options.Domain,
 		Short:     testShort,
 		URL:       testURL,
 		UserID:    testUser,
@@ -273,42 +1689,523 @@ func (s urlShortenerServiceFake) ShortenURL(_ context.Context, url string, _ str
 	return redirect, nil
 }
 
-func (s urlShortenerServiceFake) ExpandShortURL(_ context.Context, short string) (string, error) {
+func (s urlShortenerServiceFake) Import(_ context.Context, _ string, records []internal.ImportRecord) (internal.ImportReport, error) {
+	var report internal.ImportReport
+	if s.FailMode {
+		return report, errors.New("fake error")
+	}
+
+	for _, record := range records {
+		status := internal.ImportCreated
+		if record.Short == "taken" {
+			status = internal.ImportConflict
+		}
+		report.Add(internal.ImportResult{Line: record.Line, Short: record.Short, URL: record.URL, Status: status})
+	}
+	return report, nil
+}
+
+func (s urlShortenerServiceFake) Export(_ context.Context, userID string, fn func(internal.Redirect) error) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+
+	redirect := internal.Redirect{Short: testShort, URL: testURL, UserID: userID, CreatedAt: time.Now(), Tags: []string{"docs"}}
+	return fn(redirect)
+}
+
+func (s urlShortenerServiceFake) ExpandShortURL(_ context.Context, domain string, short string, visit internal.Visit) (string, error) {
 	if s.FailMode {
 		return "", errors.New("fake error")
 	}
 
-	if short != testShort {
+	if domain == testDomain {
+		if short != testShort {
+			return "", errors.New("not found")
+		}
+		return testDomainURL, nil
+	}
+
+	switch short {
+	case testThroughShort:
+		return testURL + visit.Path + "?" + visit.Query.Encode(), nil
+	case testSplitShort:
+		return testURL + "?visitor=" + visit.VisitorID, nil
+	case testShort, testLockedShort, testLimitedShort, testPreviewShort:
+		return testURL, nil
+	case testSpentShort:
+		return "", internal.ErrClicksExhausted
+	default:
 		return "", errors.New("not found")
 	}
+}
+
+func (s urlShortenerServiceFake) DeleteShortURL(_ context.Context, domain string, short string, _ string) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+
+	if short != testShort || !isTestDomain(domain) {
+		return errors.New("not found")
+	}
+
+	return nil
+}
+
+func (s urlShortenerServiceFake) ListAll(_ context.Context, ownerID string, _ string, page internal.PageRequest) (internal.RedirectPage, error) {
+	if s.FailMode {
+		return internal.RedirectPage{}, errors.New("fake error")
+	}
+
+	if page.Cursor != "" && page.Cursor != testCursor {
+		return internal.RedirectPage{}, internal.ErrInvalidCursor
+	}
+
+	if ownerID != "" && ownerID != testUser {
+		return internal.RedirectPage{}, nil
+	}
+
+	redirect := internal.Redirect{Short: testShort, URL: testURL, UserID: testUser, CreatedAt: time.Now()}
+	return internal.RedirectPage{Redirects: []internal.Redirect{redirect}}, nil
+}
+
+func (s urlShortenerServiceFake) TransferShortURL(_ context.Context, domain string, short string, userID string) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+
+	if short != testShort || !isTestDomain(domain) {
+		return errors.New("not found")
+	}
+
+	if userID == testUser {
+		return errors.New("link already belongs to this user")
+	}
+	return nil
+}
+
+func (s urlShortenerServiceFake) TransferAll(context.Context, string, string) (int, error) {
+	if s.FailMode {
+		return 0, errors.New("fake error")
+	}
+	return 1, nil
+}
+
+func (s urlShortenerServiceFake) RemoveShortURL(_ context.Context, domain string, short string) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+
+	if short != testShort || !isTestDomain(domain) {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+func (s urlShortenerServiceFake) Trash(_ context.Context, userID string) ([]internal.Redirect, error) {
+	if s.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	redirect := internal.Redirect{Short: testShort, URL: testURL, UserID: userID, CreatedAt: time.Now(), DeletedAt: time.Now()}
+	return []internal.Redirect{redirect}, nil
+}
+
+func (s urlShortenerServiceFake) RestoreShortURL(_ context.Context, domain string, short string, _ string) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
 
-	return testURL, nil
+	if short != testShort || !isTestDomain(domain) {
+		return errors.New("not found")
+	}
+
+	return nil
 }
 
-func (s urlShortenerServiceFake) DeleteShortURL(_ context.Context, short string, _ string) error {
+func (s urlShortenerServiceFake) PurgeShortURL(_ context.Context, domain string, short string, _ string) error {
 	if s.FailMode {
 		return errors.New("fake error")
 	}
 
-	if short != testShort {
+	if short != testShort || !isTestDomain(domain) {
 		return errors.New("not found")
 	}
 
 	return nil
 }
 
+func (s urlShortenerServiceFake) PurgeExpiredTrash(context.Context, time.Duration) (int, error) {
+	if s.FailMode {
+		return 0, errors.New("fake error")
+	}
+
+	return 0, nil
+}
+
+func isTestDomain(domain string) bool {
+	return domain == "" || domain == testDomain
+}
+
 type usersServiceFake struct {
 	FailMode bool
 }
 
-func (u usersServiceFake) CreateWithGoogleID(context.Context, string, string) (internal.User, error) {
-	// TODO: find a way to test goth/gothic
-	// Not implemented, since we cannot test goth/gothic here
-	panic("create with google id - implement me")
+func (u usersServiceFake) List(context.Context, string) ([]internal.User, error) {
+	if u.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	return []internal.User{
+		{ID: testAdmin, Email: "admin@example.com", Role: internal.RoleAdmin},
+		{ID: testUser, Email: "user@example.com", Role: internal.RoleUser},
+	}, nil
+}
+
+func (u usersServiceFake) Get(_ context.Context, id string) (internal.User, error) {
+	if u.FailMode {
+		return internal.User{}, errors.New("fake error")
+	}
+
+	switch id {
+	case testUser:
+		return internal.User{ID: testUser, Email: "user@example.com", Role: internal.RoleUser}, nil
+	case testAdmin:
+		return internal.User{ID: testAdmin, Email: "admin@example.com", Role: internal.RoleAdmin}, nil
+	case testDisabledUser:
+		return internal.User{ID: testDisabledUser, Email: "disabled@example.com", Role: internal.RoleUser, Disabled: true}, nil
+	default:
+		return internal.User{}, errors.New("not found")
+	}
+}
+
+func (u usersServiceFake) GetByEmail(ctx context.Context, email string) (internal.User, error) {
+	if email != "user@example.com" {
+		return internal.User{}, errors.New("not found")
+	}
+	return u.Get(ctx, testUser)
+}
+
+func (u usersServiceFake) SetDisabled(_ context.Context, id string, _ bool) error {
+	if u.FailMode {
+		return errors.New("fake error")
+	}
+
+	if id != testUser {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+func (u usersServiceFake) SignIn(ctx context.Context, identity internal.Identity) (internal.User, error) {
+	switch {
+	case identity.Email == "":
+		return internal.User{}, internal.ErrEmailMissing
+	case !identity.EmailVerified:
+		return internal.User{}, internal.ErrEmailUnverified
+	case identity.Email == "taken@example.com":
+		return internal.User{}, internal.ErrEmailInUse
+	case identity.Email == "stranger@example.org":
+		return internal.User{}, internal.ErrNotInvited
+	case identity.Subject == testDisabledUser:
+		return internal.User{}, internal.ErrUserDisabled
+	default:
+		return u.Get(ctx, testUser)
+	}
+}
+
+func (u usersServiceFake) Identities(_ context.Context, userID string) ([]internal.Identity, error) {
+	identity := internal.Identity{Provider: "google", Subject: "google-subject", UserID: userID, Email: "user@example.com", CreatedAt: time.Now()}
+	return []internal.Identity{identity}, nil
+}
+
+func (u usersServiceFake) Link(_ context.Context, _ string, identity internal.Identity) error {
+	if identity.Subject == "taken" {
+		return internal.ErrIdentityInUse
+	}
+	return nil
+}
+
+func (u usersServiceFake) Unlink(_ context.Context, _ string, provider string, subject string) error {
+	switch {
+	case provider == "google":
+		return internal.ErrLastIdentity
+	case provider == "github" && subject == "42":
+		return nil
+	default:
+		return errors.New("not found")
+	}
+}
+
+func (u usersServiceFake) Delete(_ context.Context, id string) error {
+	if u.FailMode {
+		return errors.New("fake error")
+	}
+
+	if id != testUser {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+type utmPresetServiceFake struct{}
+
+func (u utmPresetServiceFake) List(context.Context, string) ([]internal.UTMPreset, error) {
+	preset := internal.UTMPreset{ID: testPreset, UserID: testUser, Name: "Newsletter", Source: "newsletter", Campaign: "spring_launch"}
+	return []internal.UTMPreset{preset}, nil
+}
+
+func (u utmPresetServiceFake) Get(_ context.Context, id string, userID string) (internal.UTMPreset, error) {
+	if id != testPreset || userID != testUser {
+		return internal.UTMPreset{}, errors.New("not found")
+	}
+	return internal.UTMPreset{ID: testPreset, UserID: testUser, Name: "Newsletter", Source: "newsletter", Campaign: "spring_launch"}, nil
+}
+
+func (u utmPresetServiceFake) Create(_ context.Context, preset internal.UTMPreset) (internal.UTMPreset, error) {
+	if preset.Name == "" || preset.Source == "" {
+		return internal.UTMPreset{}, errors.New("invalid preset")
+	}
+	preset.ID = testPreset
+	return preset, nil
+}
+
+func (u utmPresetServiceFake) Delete(_ context.Context, id string, _ string) error {
+	if id != testPreset {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+type auditServiceFake struct{}
+
+func (a auditServiceFake) Record(context.Context, internal.AuditAction, string, string, any, any) error {
+	return nil
+}
+
+func (a auditServiceFake) List(_ context.Context, filter internal.AuditFilter) ([]internal.AuditEvent, error) {
+	if filter.ActorID != testUser && filter.TargetID != testShort {
+		return nil, nil
+	}
+
+	event := internal.AuditEvent{
+		ID:         "event",
+		ActorID:    testUser,
+		Action:     internal.AuditLinkUpdate,
+		TargetType: internal.AuditTargetLink,
+		TargetID:   testShort,
+		Before:     []byte(`{"title":"old"}`),
+		After:      []byte(`{"title":"new"}`),
+		CreatedAt:  time.Now(),
+	}
+	return []internal.AuditEvent{event}, nil
+}
+
+type sessionServiceFake struct{}
+
+func (s sessionServiceFake) List(_ context.Context, userID string, _ string) ([]internal.Session, error) {
+	current := internal.Session{ID: "current", UserID: userID, Device: "Chrome on Windows", Current: true}
+	other := internal.Session{ID: testSession, UserID: userID, Device: "Firefox on Linux"}
+	return []internal.Session{current, other}, nil
+}
+
+func (s sessionServiceFake) Revoke(_ context.Context, id string, _ string) error {
+	if id != testSession {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+func (s sessionServiceFake) RevokeAll(context.Context, string) (int, error) {
+	return 2, nil
+}
+
+type accountServiceFake struct{}
+
+func (a accountServiceFake) Register(_ context.Context, email string, _ string) (internal.User, error) {
+	if email == "user@example.com" {
+		return internal.User{}, internal.ErrEmailInUse
+	}
+	return internal.User{ID: "new", Email: email, Role: internal.RoleUser}, nil
+}
+
+func (a accountServiceFake) Login(_ context.Context, email string, password string) (internal.User, error) {
+	switch {
+	case password != testPassword:
+		return internal.User{}, internal.ErrWrongPassword
+	case email == "unverified@example.com":
+		return internal.User{}, internal.ErrEmailUnverified
+	case email == "admin@example.com":
+		return internal.User{ID: testAdmin, Email: email, Role: internal.RoleAdmin}, nil
+	default:
+		return internal.User{ID: testUser, Email: email, Role: internal.RoleUser}, nil
+	}
+}
+
+func (a accountServiceFake) ResendVerification(context.Context, string) error {
+	return nil
+}
+
+func (a accountServiceFake) VerifyEmail(_ context.Context, token string) error {
+	if token != testToken {
+		return internal.ErrInvalidToken
+	}
+	return nil
+}
+
+func (a accountServiceFake) RequestPasswordReset(context.Context, string) error {
+	return nil
+}
+
+func (a accountServiceFake) ResetPassword(_ context.Context, token string, _ string) error {
+	if token != testToken {
+		return internal.ErrInvalidToken
+	}
+	return nil
+}
+
+// twoFactorServiceFake has two-factor authentication enabled for the admin only.
+type twoFactorServiceFake struct{}
+
+func (f twoFactorServiceFake) Status(_ context.Context, userID string) (internal.TwoFactorStatus, error) {
+	if userID != testAdmin {
+		return internal.TwoFactorStatus{}, nil
+	}
+	return internal.TwoFactorStatus{Enabled: true, RecoveryCodes: 10}, nil
+}
+
+func (f twoFactorServiceFake) Enroll(_ context.Context, user internal.User) (internal.TwoFactorEnrollment, error) {
+	if user.ID == testAdmin {
+		return internal.TwoFactorEnrollment{}, internal.ErrTwoFactorOn
+	}
+	return internal.TwoFactorEnrollment{Secret: "SECRET", URI: "otpauth://totp/dwarferl:" + user.Email + "?secret=SECRET"}, nil
+}
+
+func (f twoFactorServiceFake) Enable(_ context.Context, _ string, code string) ([]string, error) {
+	if code != testCode {
+		return nil, internal.ErrInvalidCode
+	}
+	return []string{"aaaaa-bbbbb"}, nil
+}
+
+func (f twoFactorServiceFake) Verify(_ context.Context, userID string, code string) error {
+	if userID != testAdmin {
+		return internal.ErrTwoFactorOff
+	}
+	if code != testCode {
+		return internal.ErrInvalidCode
+	}
+	return nil
+}
+
+func (f twoFactorServiceFake) Disable(ctx context.Context, userID string, code string) error {
+	return f.Verify(ctx, userID, code)
+}
+
+func (f twoFactorServiceFake) RegenerateRecoveryCodes(ctx context.Context, userID string, code string) ([]string, error) {
+	if err := f.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return []string{"aaaaa-bbbbb"}, nil
+}
+
+type invitationServiceFake struct{}
+
+func (i invitationServiceFake) Invitations(context.Context) ([]internal.Invitation, error) {
+	invitation := internal.Invitation{ID: "invitation", Email: "guest@partner.org", InvitedBy: testAdmin, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	return []internal.Invitation{invitation}, nil
+}
+
+func (i invitationServiceFake) Invite(_ context.Context, email string) (internal.Invitation, error) {
+	if email == "user@example.com" {
+		return internal.Invitation{}, internal.ErrEmailInUse
+	}
+	return internal.Invitation{ID: "new", Email: email, InvitedBy: testAdmin, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func (i invitationServiceFake) RevokeInvitation(_ context.Context, id string) error {
+	if id != "invitation" {
+		return errors.New("not found")
+	}
+	return nil
+}
+
+type privacyServiceFake struct{}
+
+func (p privacyServiceFake) Export(_ context.Context, userID string, w io.Writer) error {
+	if userID != testUser {
+		return errors.New("not found")
+	}
+	_, err := io.WriteString(w, "archive")
+	return err
+}
+
+func (p privacyServiceFake) DeleteAccount(_ context.Context, _ string, heirEmail string) error {
+	if heirEmail != "" && heirEmail != "admin@example.com" {
+		return internal.ErrInvalidHeir
+	}
+	return nil
+}
+
+type webhookServiceFake struct{}
+
+func (w webhookServiceFake) Publish(context.Context, string, internal.WebhookEvent, any) error {
+	return nil
+}
+
+func (w webhookServiceFake) List(ctx context.Context, userID string) ([]internal.Webhook, error) {
+	webhook, err := w.Get(ctx, "webhook", userID)
+	return []internal.Webhook{webhook}, err
 }
 
-func (u usersServiceFake) GetOrCreateByGoogle(context.Context, string, string) (internal.User, error) {
-	// TODO: find a way to test goth/gothic
-	// Not implemented, since we cannot test goth/gothic here
-	panic("get or create by google - implement me")
+func (w webhookServiceFake) Get(_ context.Context, id string, userID string) (internal.Webhook, error) {
+	if id != "webhook" {
+		return internal.Webhook{}, errors.New("not found")
+	}
+	webhook := internal.Webhook{
+		ID:        id,
+		UserID:    userID,
+		URL:       "https://example.com/hook",
+		Secret:    "secret",
+		Events:    []internal.WebhookEvent{internal.EventLinkCreated},
+		CreatedAt: time.Now(),
+	}
+	return webhook, nil
+}
+
+func (w webhookServiceFake) Create(_ context.Context, userID string, url string, events []internal.WebhookEvent) (internal.Webhook, error) {
+	if !strings.HasPrefix(url, "https://") || len(events) == 0 {
+		return internal.Webhook{}, internal.ErrInvalidWebhook
+	}
+	return internal.Webhook{ID: "webhook", UserID: userID, URL: url, Events: events}, nil
+}
+
+func (w webhookServiceFake) Delete(ctx context.Context, id string, userID string) error {
+	_, err := w.Get(ctx, id, userID)
+	return err
+}
+
+func (w webhookServiceFake) Deliveries(ctx context.Context, id string, userID string) ([]internal.WebhookDelivery, error) {
+	if _, err := w.Get(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	delivery := internal.WebhookDelivery{
+		ID:             "delivery",
+		WebhookID:      id,
+		Event:          internal.EventLinkCreated,
+		Status:         internal.DeliveryPending,
+		Attempts:       1,
+		ResponseStatus: 500,
+		Error:          "unexpected status 500",
+		NextAttemptAt:  time.Now().Add(time.Minute),
+		CreatedAt:      time.Now(),
+	}
+	return []internal.WebhookDelivery{delivery}, nil
+}
+
+func (w webhookServiceFake) Test(ctx context.Context, id string, userID string) (internal.WebhookDelivery, error) {
+	if _, err := w.Get(ctx, id, userID); err != nil {
+		return internal.WebhookDelivery{}, err
+	}
+	return internal.WebhookDelivery{ID: "ping", WebhookID: id, Event: internal.EventPing, Status: internal.DeliveryDelivered}, nil
 }
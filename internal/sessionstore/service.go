@@ -0,0 +1,76 @@
+package sessionstore
+
+import (
+	"context"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/useragent"
+	"strings"
+)
+
+type Service struct {
+	repository internal.SessionRepository
+}
+
+func NewService(repository internal.SessionRepository) *Service {
+	return &Service{repository: repository}
+}
+
+func (s *Service) List(ctx context.Context, userID string, token string) ([]internal.Session, error) {
+	list, err := s.repository.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := hashToken(token)
+	for i := range list {
+		list[i].Device = device(list[i].UserAgent)
+		list[i].Current = list[i].ID == current
+	}
+	return list, nil
+}
+
+func (s *Service) Revoke(ctx context.Context, id string, userID string) error {
+	return s.repository.DeleteForUser(ctx, id, userID)
+}
+
+func (s *Service) RevokeAll(ctx context.Context, userID string) (int, error) {
+	return s.repository.DeleteAllForUser(ctx, userID)
+}
+
+func (s *Service) DeleteExpired(ctx context.Context) (int, error) {
+	return s.repository.DeleteExpired(ctx)
+}
+
+// operatingSystems are the display names of the systems useragent.OS recognizes.
+var operatingSystems = map[string]string{
+	"ios":     "iOS",
+	"android": "Android",
+	"windows": "Windows",
+	"macos":   "macOS",
+	"linux":   "Linux",
+}
+
+// device summarizes a user agent as browser and operating system, e.g. "Firefox on Linux".
+func device(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	browser := "Unknown browser"
+	// the order matters: Edge and Opera claim to be Chrome, and Chrome claims to be Safari
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+
+	if name, ok := operatingSystems[useragent.OS(userAgent)]; ok {
+		return browser + " on " + name
+	}
+	return browser
+}
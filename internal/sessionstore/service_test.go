@@ -0,0 +1,79 @@
+package sessionstore
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const testUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:105.0) Gecko/20100101 Firefox/105.0"
+
+func TestService_List(t *testing.T) {
+	repo, sut := setupService()
+
+	list, err := sut.List(context.Background(), testUser, "current")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, list, 2, "Expected two sessions, got %d", len(list))
+
+	for _, session := range list {
+		assert.Equalf(t, session.ID == hashToken("current"), session.Current, "Expected only the requesting session to be current, got %v", session)
+		assert.Equalf(t, "Firefox on Linux", session.Device, "Expected device to be summarized, got %v", session.Device)
+	}
+
+	repo.FailMode = true
+	_, err = sut.List(context.Background(), testUser, "current")
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestService_Revoke(t *testing.T) {
+	repo, sut := setupService()
+
+	err := sut.Revoke(context.Background(), hashToken("current"), testOther)
+	assert.ErrorIsf(t, err, pgx.ErrNoRows, "Expected %v for a foreign session, got %v", pgx.ErrNoRows, err)
+
+	err = sut.Revoke(context.Background(), hashToken("current"), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, repo.sessions, 2, "Expected two sessions left, got %d", len(repo.sessions))
+
+	revoked, err := sut.RevokeAll(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, revoked, "Expected one revoked session, got %d", revoked)
+	assert.Lenf(t, repo.sessions, 1, "Expected the other user's session to stay, got %d", len(repo.sessions))
+}
+
+func TestService_DeleteExpired(t *testing.T) {
+	repo, sut := setupService()
+	repo.sessions["expired"] = internal.Session{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute)}
+
+	deleted, err := sut.DeleteExpired(context.Background())
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, deleted, "Expected one deleted session, got %d", deleted)
+}
+
+func TestDevice(t *testing.T) {
+	tests := map[string]string{
+		testUserAgent: "Firefox on Linux",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 Safari/537.36 Edg/106.0.1370.47":       "Edge on Windows",
+		"Mozilla/5.0 (Linux; Android 13) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 Mobile Safari/537.36":                            "Chrome on Android",
+		"curl/7.85.0": "Unknown browser",
+	}
+
+	for userAgent, expected := range tests {
+		got := device(userAgent)
+		assert.Equalf(t, expected, got, "Expected %v for %v, got %v", expected, userAgent, got)
+	}
+}
+
+func setupService() (*sessionRepositoryFake, *Service) {
+	repo := newSessionRepositoryFake()
+	expires := time.Now().Add(time.Hour)
+	for _, token := range []string{"current", "other"} {
+		repo.sessions[hashToken(token)] = internal.Session{ID: hashToken(token), UserID: testUser, UserAgent: testUserAgent, ExpiresAt: expires}
+	}
+	repo.sessions["foreign"] = internal.Session{ID: "foreign", UserID: testOther, ExpiresAt: expires}
+	return repo, NewService(repo)
+}
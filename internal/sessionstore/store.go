@@ -0,0 +1,196 @@
+package sessionstore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	tokenLength   = 32
+	defaultMaxAge = 30 * 24 * 60 * 60
+	touchInterval = 5 * time.Minute
+	userIDKey     = "user_id"
+)
+
+// Store keeps session values in the database. The cookie only carries a signed random token,
+// so sessions can be listed and revoked on the server.
+type Store struct {
+	repository internal.SessionRepository
+	codecs     []securecookie.Codec
+	options    *gsessions.Options
+}
+
+func NewStore(repository internal.SessionRepository, keyPairs ...[]byte) *Store {
+	store := &Store{repository: repository, codecs: securecookie.CodecsFromPairs(keyPairs...)}
+	store.Options(sessions.Options{Path: "/", MaxAge: defaultMaxAge, HttpOnly: true})
+	return store
+}
+
+func (s *Store) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+	if options.MaxAge > 0 {
+		for _, codec := range s.codecs {
+			if c, ok := codec.(*securecookie.SecureCookie); ok {
+				c.MaxAge(options.MaxAge)
+			}
+		}
+	}
+}
+
+func (s *Store) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the request. Missing, tampered, expired and revoked sessions
+// all result in a fresh session without an error.
+func (s *Store) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, s.codecs...); err != nil {
+		return session, nil
+	}
+
+	stored, err := s.repository.Get(r.Context(), hashToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err := (securecookie.GobEncoder{}).Deserialize(stored.Data, &session.Values); err != nil {
+		return session, err
+	}
+	session.ID = token
+	session.IsNew = false
+
+	if now := time.Now(); now.Sub(stored.LastSeenAt) > touchInterval {
+		if err := s.repository.Touch(r.Context(), stored.ID, now, clientIP(r)); err != nil {
+			return session, err
+		}
+	}
+	return session, nil
+}
+
+// Save writes the session and its cookie. A negative MaxAge ends the session. When the
+// session changes hands, it gets a new token, so a token known before login is worthless.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	ctx := r.Context()
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repository.Delete(ctx, hashToken(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	now := time.Now()
+	userID, _ := session.Values[userIDKey].(string)
+	createdAt := now
+
+	if session.ID != "" {
+		existing, err := s.repository.Get(ctx, hashToken(session.ID))
+		switch {
+		case err == nil && existing.UserID == userID:
+			createdAt = existing.CreatedAt
+		case err == nil:
+			if err := s.repository.Delete(ctx, existing.ID); err != nil {
+				return err
+			}
+			session.ID = ""
+		case errors.Is(err, pgx.ErrNoRows):
+			session.ID = ""
+		default:
+			return err
+		}
+	}
+
+	if session.ID == "" {
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	}
+
+	data, err := securecookie.GobEncoder{}.Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+
+	maxAge := session.Options.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+
+	stored := internal.Session{
+		ID:         hashToken(session.ID),
+		UserID:     userID,
+		Data:       data,
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		CreatedAt:  createdAt,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Duration(maxAge) * time.Second),
+	}
+	if err := s.repository.Save(ctx, stored); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+func newToken() (string, error) {
+	token := make([]byte, tokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashToken derives the stored ID, so a leaked sessions table cannot be used to log in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP prefers the IP resolved by the request middleware, which knows about proxies.
+func clientIP(r *http.Request) string {
+	if ip := audit.ClientIP(r.Context()); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,215 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-contrib/sessions"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testCookie = "dwarferl"
+	testUser   = "00000000-0000-0000-0000-000000000000"
+	testOther  = "11111111-1111-1111-1111-111111111111"
+)
+
+func TestStore_RoundTrip(t *testing.T) {
+	repo := newSessionRepositoryFake()
+	sut := NewStore(repo, []byte("secret"))
+
+	cookie := save(t, sut, nil, func(values map[any]any) { values["user_id"] = testUser })
+	assert.Lenf(t, repo.sessions, 1, "Expected one stored session, got %d", len(repo.sessions))
+	for _, stored := range repo.sessions {
+		assert.Equalf(t, testUser, stored.UserID, "Expected session owner %v, got %v", testUser, stored.UserID)
+		assert.NotContainsf(t, cookie.Value, stored.ID, "Expected cookie to not contain the stored ID, got %v", cookie.Value)
+	}
+
+	session, err := sut.New(requestWith(cookie), testCookie)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Falsef(t, session.IsNew, "Expected existing session")
+	assert.Equalf(t, testUser, session.Values["user_id"], "Expected user %v, got %v", testUser, session.Values["user_id"])
+
+	session, err = sut.New(requestWith(&http.Cookie{Name: testCookie, Value: "tampered"}), testCookie)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, session.IsNew, "Expected new session for a tampered cookie")
+}
+
+func TestStore_Revoked(t *testing.T) {
+	repo := newSessionRepositoryFake()
+	sut := NewStore(repo, []byte("secret"))
+
+	cookie := save(t, sut, nil, func(values map[any]any) { values["user_id"] = testUser })
+	_, err := repo.DeleteAllForUser(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	session, err := sut.New(requestWith(cookie), testCookie)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, session.IsNew, "Expected revoked session to be new")
+	assert.Emptyf(t, session.Values, "Expected no values, got %v", session.Values)
+}
+
+func TestStore_RotatesOnLogin(t *testing.T) {
+	repo := newSessionRepositoryFake()
+	sut := NewStore(repo, []byte("secret"))
+
+	anonymous := save(t, sut, nil, func(values map[any]any) { values["preview"] = true })
+	loggedIn := save(t, sut, anonymous, func(values map[any]any) { values["user_id"] = testUser })
+	assert.NotEqualf(t, anonymous.Value, loggedIn.Value, "Expected token to change on login")
+	assert.Lenf(t, repo.sessions, 1, "Expected old session to be deleted, got %d", len(repo.sessions))
+
+	same := save(t, sut, loggedIn, func(values map[any]any) { values["preview"] = false })
+	assert.Equalf(t, loggedIn.Value, same.Value, "Expected token to stay for the same user")
+
+	session, _ := sut.New(requestWith(anonymous), testCookie)
+	assert.Truef(t, session.IsNew, "Expected the pre-login token to be worthless")
+}
+
+func TestStore_Expire(t *testing.T) {
+	repo := newSessionRepositoryFake()
+	sut := NewStore(repo, []byte("secret"))
+
+	cookie := save(t, sut, nil, func(values map[any]any) { values["user_id"] = testUser })
+
+	request := requestWith(cookie)
+	session, _ := sut.New(request, testCookie)
+	session.Options.MaxAge = -1
+
+	recorder := httptest.NewRecorder()
+	err := sut.Save(request, recorder, session)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Emptyf(t, repo.sessions, "Expected session to be deleted, got %v", repo.sessions)
+
+	expired := recorder.Result().Cookies()[0]
+	assert.Truef(t, expired.MaxAge < 0, "Expected cookie to be expired, got max age %d", expired.MaxAge)
+}
+
+func TestStore_Options(t *testing.T) {
+	repo := newSessionRepositoryFake()
+	sut := NewStore(repo, []byte("secret"))
+	sut.Options(sessions.Options{Path: "/", MaxAge: 3600})
+
+	save(t, sut, nil, func(values map[any]any) { values["user_id"] = testUser })
+	for _, stored := range repo.sessions {
+		remaining := time.Until(stored.ExpiresAt)
+		assert.InDeltaf(t, time.Hour.Seconds(), remaining.Seconds(), 5, "Expected expiry in one hour, got %v", remaining)
+	}
+
+	repo.FailMode = true
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	session, _ := sut.New(request, testCookie)
+	err := sut.Save(request, httptest.NewRecorder(), session)
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func save(t *testing.T, store *Store, cookie *http.Cookie, change func(map[any]any)) *http.Cookie {
+	request := requestWith(cookie)
+	session, err := store.New(request, testCookie)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	change(session.Values)
+
+	recorder := httptest.NewRecorder()
+	err = store.Save(request, recorder, session)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	return recorder.Result().Cookies()[0]
+}
+
+func requestWith(cookie *http.Cookie) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+type sessionRepositoryFake struct {
+	sessions map[string]internal.Session
+	FailMode bool
+}
+
+func newSessionRepositoryFake() *sessionRepositoryFake {
+	return &sessionRepositoryFake{sessions: map[string]internal.Session{}}
+}
+
+func (s *sessionRepositoryFake) Get(_ context.Context, id string) (internal.Session, error) {
+	if s.FailMode {
+		return internal.Session{}, errors.New("fake error")
+	}
+
+	session, ok := s.sessions[id]
+	if !ok || session.ExpiresAt.Before(time.Now()) {
+		return internal.Session{}, pgx.ErrNoRows
+	}
+	return session, nil
+}
+
+func (s *sessionRepositoryFake) Save(_ context.Context, session internal.Session) error {
+	if s.FailMode {
+		return errors.New("fake error")
+	}
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *sessionRepositoryFake) Touch(_ context.Context, id string, lastSeen time.Time, ip string) error {
+	session := s.sessions[id]
+	session.LastSeenAt = lastSeen
+	session.IP = ip
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *sessionRepositoryFake) Delete(_ context.Context, id string) error {
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *sessionRepositoryFake) ListByUser(_ context.Context, userID string) ([]internal.Session, error) {
+	if s.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	var result []internal.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			result = append(result, session)
+		}
+	}
+	return result, nil
+}
+
+func (s *sessionRepositoryFake) DeleteForUser(_ context.Context, id string, userID string) error {
+	session, ok := s.sessions[id]
+	if !ok || session.UserID != userID {
+		return pgx.ErrNoRows
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *sessionRepositoryFake) DeleteAllForUser(_ context.Context, userID string) (int, error) {
+	count := 0
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *sessionRepositoryFake) DeleteExpired(context.Context) (int, error) {
+	count := 0
+	for id, session := range s.sessions {
+		if session.ExpiresAt.Before(time.Now()) {
+			delete(s.sessions, id)
+			count++
+		}
+	}
+	return count, nil
+}
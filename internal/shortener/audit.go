@@ -0,0 +1,34 @@
+package shortener
+
+import "github.com/pscheid92/dwarferl/internal"
+
+// linkSnapshot is what the audit log keeps of a redirect. The password hash stays out of it.
+type linkSnapshot struct {
+	URL          string                    `json:"url"`
+	Title        string                    `json:"title,omitempty"`
+	Notes        string                    `json:"notes,omitempty"`
+	Tags         []string                  `json:"tags,omitempty"`
+	Protected    bool                      `json:"protected,omitempty"`
+	MaxClicks    int                       `json:"max_clicks,omitempty"`
+	ForcePreview bool                      `json:"force_preview,omitempty"`
+	Passthrough  internal.Passthrough      `json:"passthrough,omitempty"`
+	UTMCampaign  string                    `json:"utm_campaign,omitempty"`
+	Rules        []internal.TargetingRule  `json:"rules,omitempty"`
+	Targets      []internal.WeightedTarget `json:"targets,omitempty"`
+}
+
+func snapshot(redirect internal.Redirect) linkSnapshot {
+	return linkSnapshot{
+		URL:          redirect.URL,
+		Title:        redirect.Title,
+		Notes:        redirect.Notes,
+		Tags:         redirect.Tags,
+		Protected:    redirect.IsProtected(),
+		MaxClicks:    redirect.MaxClicks,
+		ForcePreview: redirect.ForcePreview,
+		Passthrough:  redirect.Passthrough,
+		UTMCampaign:  redirect.UTMCampaign,
+		Rules:        redirect.Rules,
+		Targets:      redirect.Targets,
+	}
+}
@@ -0,0 +1,69 @@
+package shortener
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pscheid92/dwarferl/internal"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// cursor is the serialized form of internal.RedirectCursor. It remembers the sort order
+// it was created for, so it cannot be misused with another one.
+type cursor struct {
+	Sort      internal.RedirectSort `json:"o"`
+	CreatedAt time.Time             `json:"c"`
+	Short     string                `json:"s"`
+	Domain    string                `json:"d,omitempty"`
+	Clicks    int                   `json:"n"`
+}
+
+func encodeCursor(sort internal.RedirectSort, last internal.Redirect) string {
+	encoded, _ := json.Marshal(cursor{Sort: sort, CreatedAt: last.CreatedAt, Short: last.Short, Domain: last.Domain, Clicks: last.Clicks})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeCursor returns nil for an empty cursor, meaning the listing starts at its first page.
+func decodeCursor(sort internal.RedirectSort, value string) (*internal.RedirectCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, internal.ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != sort || c.Short == "" {
+		return nil, internal.ErrInvalidCursor
+	}
+
+	return &internal.RedirectCursor{CreatedAt: c.CreatedAt, Short: c.Short, Domain: c.Domain, Clicks: c.Clicks}, nil
+}
+
+// newPage cuts a listing fetched with one extra element down to size. The extra element
+// only signals that there is a next page.
+func newPage(sort internal.RedirectSort, list []internal.Redirect, size int) internal.RedirectPage {
+	page := internal.RedirectPage{Redirects: list}
+	if len(list) > size {
+		page.Redirects = list[:size]
+		page.NextCursor = encodeCursor(sort, list[size-1])
+	}
+	return page
+}
+
+func pageSize(requested int) int {
+	switch {
+	case requested <= 0:
+		return defaultPageSize
+	case requested > maxPageSize:
+		return maxPageSize
+	default:
+		return requested
+	}
+}
@@ -0,0 +1,47 @@
+package shortener
+
+import (
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	last := internal.Redirect{Domain: "go.example.com", Short: "abc123", CreatedAt: time.Date(2022, 8, 1, 12, 30, 0, 123000, time.UTC), Clicks: 7}
+
+	encoded := encodeCursor(internal.SortByClicks, last)
+	decoded, err := decodeCursor(internal.SortByClicks, encoded)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, "abc123", decoded.Short, "Expected short abc123, got %s", decoded.Short)
+	assert.Equalf(t, "go.example.com", decoded.Domain, "Expected domain go.example.com, got %s", decoded.Domain)
+	assert.Equalf(t, 7, decoded.Clicks, "Expected 7 clicks, got %d", decoded.Clicks)
+	assert.Truef(t, last.CreatedAt.Equal(decoded.CreatedAt), "Expected %v, got %v", last.CreatedAt, decoded.CreatedAt)
+
+	_, err = decodeCursor(internal.SortByShort, encoded)
+	assert.ErrorIsf(t, err, internal.ErrInvalidCursor, "Expected cursor of other sort order to be rejected, got %v", err)
+
+	_, err = decodeCursor(internal.SortByClicks, "not-a-cursor!")
+	assert.ErrorIsf(t, err, internal.ErrInvalidCursor, "Expected garbage to be rejected, got %v", err)
+
+	decoded, err = decodeCursor(internal.SortByCreated, "")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Nilf(t, decoded, "Expected no cursor for first page, got %v", decoded)
+}
+
+func TestPageSize(t *testing.T) {
+	tt := []struct {
+		requested int
+		expected  int
+	}{
+		{0, defaultPageSize},
+		{-5, defaultPageSize},
+		{20, 20},
+		{maxPageSize + 1, maxPageSize},
+	}
+
+	for _, c := range tt {
+		result := pageSize(c.requested)
+		assert.Equalf(t, c.expected, result, "Expected page size %d for %d, got %d", c.expected, c.requested, result)
+	}
+}
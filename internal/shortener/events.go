@@ -0,0 +1,72 @@
+package shortener
+
+import (
+	"github.com/pscheid92/dwarferl/internal"
+	"log"
+	"time"
+)
+
+// linkEvent is the webhook payload of created and deleted links.
+type linkEvent struct {
+	Domain    string    `json:"domain,omitempty"`
+	Short     string    `json:"short"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newLinkEvent(redirect internal.Redirect) linkEvent {
+	return linkEvent{
+		Domain:    redirect.Domain,
+		Short:     redirect.Short,
+		URL:       redirect.URL,
+		Title:     redirect.Title,
+		Tags:      redirect.Tags,
+		CreatedAt: redirect.CreatedAt.UTC(),
+	}
+}
+
+// clickEvent is the webhook payload of a visit. It names the chosen target before passthrough,
+// so nothing the visitor appended ends up at the receiver.
+type clickEvent struct {
+	Domain    string `json:"domain,omitempty"`
+	Short     string `json:"short"`
+	Target    string `json:"target"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Language  string `json:"language,omitempty"`
+}
+
+// workQueue runs work on a fixed number of goroutines. Work that finds the queue full is
+// dropped, so a burst of redirects cannot pile up goroutines and database queries.
+type workQueue chan func()
+
+func newWorkQueue(workers int, size int) workQueue {
+	queue := make(workQueue, size)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for fn := range queue {
+				fn()
+			}
+		}()
+	}
+	return queue
+}
+
+// submit queues the work and reports false if it had to be dropped.
+func (q workQueue) submit(fn func()) bool {
+	select {
+	case q <- fn:
+		return true
+	default:
+		return false
+	}
+}
+
+// publishClick runs as the service's background work, giving up on clicks while the workers
+// are behind.
+func (q workQueue) publishClick(fn func()) {
+	if !q.submit(fn) {
+		log.Printf("dropping %s event, the queue is full", internal.EventLinkClicked)
+	}
+}
@@ -0,0 +1,179 @@
+package shortener
+
+import (
+	"context"
+	"github.com/pscheid92/dwarferl/internal"
+	"regexp"
+	"time"
+)
+
+const importBatchSize = 500
+
+// customShortPattern accepts the codes of other shorteners, which are taken over on import.
+var customShortPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// reservedShorts would be shadowed by the routes of the web interface.
+var reservedShorts = map[string]bool{
+	"account":  true,
+	"admin":    true,
+	"assets":   true,
+	"audit":    true,
+	"auth":     true,
+	"create":   true,
+	"delete":   true,
+	"edit":     true,
+	"export":   true,
+	"forgot":   true,
+	"health":   true,
+	"import":   true,
+	"login":    true,
+	"logout":   true,
+	"preview":  true,
+	"profile":  true,
+	"qr":       true,
+	"register": true,
+	"reset":    true,
+	"rules":    true,
+	"sessions": true,
+	"trash":    true,
+	"utm":      true,
+	"variants": true,
+	"verify":   true,
+	"webhooks": true,
+}
+
+// IsReserved reports whether the short code is taken by a route of the web interface.
+func IsReserved(short string) bool {
+	return reservedShorts[short]
+}
+
+// validShort accepts every code a link can be stored under: the generated ones, whichever
+// generator was configured back then, and the imported ones.
+func validShort(short string) bool {
+	return customShortPattern.MatchString(short)
+}
+
+// Import creates the given records in batches, each batch in its own transaction. When an
+// error stops the import, the report covers all rows up to the failed batch.
+func (u UrlShortenerService) Import(ctx context.Context, userID string, records []internal.ImportRecord) (internal.ImportReport, error) {
+	var report internal.ImportReport
+	batch := make([]internal.Redirect, 0, importBatchSize)
+	lines := make([]int, 0, importBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		created, err := u.redirects.Import(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		for i, redirect := range batch {
+			result := internal.ImportResult{Line: lines[i], Short: redirect.Short, URL: redirect.URL, Status: internal.ImportCreated}
+			if created[i] {
+				if err := u.audit.Record(ctx, internal.AuditLinkImport, internal.AuditTargetLink, internal.LinkID(redirect.Domain, redirect.Short), nil, snapshot(redirect)); err != nil {
+					return err
+				}
+				u.publish(ctx, userID, internal.EventLinkCreated, newLinkEvent(redirect))
+			} else {
+				result.Status, result.Message = u.classifyTaken(ctx, userID, redirect)
+			}
+			report.Add(result)
+		}
+
+		batch = batch[:0]
+		lines = lines[:0]
+		return nil
+	}
+
+	for _, record := range records {
+		redirect, problem, err := u.recordToRedirect(ctx, userID, record)
+		if err != nil {
+			return report, err
+		}
+		if problem != "" {
+			report.Add(internal.ImportResult{Line: record.Line, Short: record.Short, URL: record.URL, Status: internal.ImportInvalid, Message: problem})
+			continue
+		}
+
+		batch = append(batch, redirect)
+		lines = append(lines, record.Line)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// recordToRedirect turns the record into a redirect or describes the problem with it. Errors are
+// left for failures of the hasher.
+func (u UrlShortenerService) recordToRedirect(ctx context.Context, userID string, record internal.ImportRecord) (internal.Redirect, string, error) {
+	if record.Problem != "" {
+		return internal.Redirect{}, record.Problem, nil
+	}
+
+	if err := validateTargetURL(record.URL); err != nil {
+		return internal.Redirect{}, err.Error(), nil
+	}
+
+	short := record.Short
+	if short == "" {
+		hashed, err := u.hasher.Hash(ctx, userID, record.URL)
+		if err != nil {
+			return internal.Redirect{}, "", err
+		}
+		if !u.hasher.Validate(hashed) {
+			return internal.Redirect{}, "generated short code is invalid", nil
+		}
+		short = hashed
+	}
+	if !customShortPattern.MatchString(short) {
+		return internal.Redirect{}, "short code may only contain letters, digits, - and _", nil
+	}
+	if reservedShorts[short] {
+		return internal.Redirect{}, "short code is reserved", nil
+	}
+
+	tags, err := normalizeTags(record.Tags)
+	if err != nil {
+		return internal.Redirect{}, err.Error(), nil
+	}
+
+	if record.Clicks < 0 {
+		return internal.Redirect{}, "clicks must not be negative", nil
+	}
+
+	createdAt := record.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	redirect := internal.Redirect{
+		Short:     short,
+		URL:       record.URL,
+		UserID:    userID,
+		CreatedAt: createdAt,
+		Title:     record.Title,
+		Notes:     record.Notes,
+		Tags:      tags,
+		Clicks:    record.Clicks,
+	}
+	return redirect, "", nil
+}
+
+// classifyTaken tells an earlier import of the same link apart from a real conflict.
+func (u UrlShortenerService) classifyTaken(ctx context.Context, userID string, redirect internal.Redirect) (internal.ImportStatus, string) {
+	existing, err := u.redirects.Lookup(ctx, redirect.Domain, redirect.Short)
+	if err == nil && existing.UserID == userID && existing.URL == redirect.URL {
+		return internal.ImportExisting, "already imported"
+	}
+	return internal.ImportConflict, "short code is already taken"
+}
@@ -0,0 +1,57 @@
+package shortener
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter counts attempts per key within a fixed window and refuses further attempts
+// once the maximum is reached. Every allowed attempt counts until a success resets the key,
+// so concurrent attempts cannot slip past the maximum.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts map[string]attempts
+	now      func() time.Time
+}
+
+type attempts struct {
+	count int
+	since time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		attempts: make(map[string]attempts),
+		now:      time.Now,
+	}
+}
+
+// Allow reserves an attempt, unless the maximum is reached already.
+func (l *attemptLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok || l.now().Sub(a.since) > l.window {
+		a = attempts{since: l.now()}
+	}
+
+	if a.count >= l.max {
+		return false
+	}
+
+	a.count++
+	l.attempts[key] = a
+	return true
+}
+
+// Reset forgets the attempts of a key after a success, including the one that succeeded.
+func (l *attemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
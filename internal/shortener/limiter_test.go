@@ -0,0 +1,25 @@
+package shortener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newAttemptLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	assert.Truef(t, limiter.Allow("key"), "Expected first attempt to be allowed")
+	assert.Truef(t, limiter.Allow("key"), "Expected second attempt to be allowed")
+	assert.Falsef(t, limiter.Allow("key"), "Expected attempt to be refused after reaching the maximum")
+	assert.Truef(t, limiter.Allow("other"), "Expected other keys to be unaffected")
+
+	now = now.Add(2 * time.Minute)
+	assert.Truef(t, limiter.Allow("key"), "Expected attempt to be allowed after the window passed")
+
+	assert.Truef(t, limiter.Allow("key"), "Expected second attempt to be allowed")
+	limiter.Reset("key")
+	assert.Truef(t, limiter.Allow("key"), "Expected attempt to be allowed after reset")
+}
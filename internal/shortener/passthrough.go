@@ -0,0 +1,38 @@
+package shortener
+
+import (
+	"github.com/pscheid92/dwarferl/internal"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// applyPassthrough carries the path suffix and query parameters of a visit over to the destination.
+func applyPassthrough(destination string, mode internal.Passthrough, visit internal.Visit) (string, error) {
+	if mode == internal.PassthroughNone {
+		return destination, nil
+	}
+
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	// cleaning against the root keeps the suffix from climbing above the destination path
+	if suffix := strings.Trim(path.Clean("/"+visit.Path), "/"); suffix != "" {
+		target = target.JoinPath(suffix)
+	}
+
+	if len(visit.Query) > 0 {
+		query := target.Query()
+		for key, values := range visit.Query {
+			if mode == internal.PassthroughMerge && query.Has(key) {
+				continue
+			}
+			query[key] = values
+		}
+		target.RawQuery = query.Encode()
+	}
+
+	return target.String(), nil
+}
@@ -0,0 +1,85 @@
+package shortener
+
+import (
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestApplyPassthrough(t *testing.T) {
+	tt := []struct {
+		name        string
+		destination string
+		mode        internal.Passthrough
+		path        string
+		query       url.Values
+		expected    string
+	}{
+		{
+			"disabled passthrough keeps destination",
+			"https://example.com/docs?lang=en",
+			internal.PassthroughNone,
+			"/sub/page",
+			url.Values{"utm_source": {"mail"}},
+			"https://example.com/docs?lang=en",
+		},
+		{
+			"empty visit keeps destination untouched",
+			"https://example.com/docs?b=2&a=1",
+			internal.PassthroughMerge,
+			"",
+			nil,
+			"https://example.com/docs?b=2&a=1",
+		},
+		{
+			"path suffix is appended",
+			"https://example.com/docs/",
+			internal.PassthroughMerge,
+			"/sub/page",
+			nil,
+			"https://example.com/docs/sub/page",
+		},
+		{
+			"path suffix cannot escape destination path",
+			"https://example.com/docs",
+			internal.PassthroughMerge,
+			"/../../admin",
+			nil,
+			"https://example.com/docs/admin",
+		},
+		{
+			"query parameters are added",
+			"https://example.com/docs",
+			internal.PassthroughMerge,
+			"",
+			url.Values{"utm_source": {"mail"}},
+			"https://example.com/docs?utm_source=mail",
+		},
+		{
+			"merge keeps destination parameters on conflict",
+			"https://example.com/docs?lang=en",
+			internal.PassthroughMerge,
+			"",
+			url.Values{"lang": {"de"}, "utm_source": {"mail"}},
+			"https://example.com/docs?lang=en&utm_source=mail",
+		},
+		{
+			"override prefers visit parameters on conflict",
+			"https://example.com/docs?lang=en",
+			internal.PassthroughOverride,
+			"/intro",
+			url.Values{"lang": {"de"}, "utm_source": {"mail"}},
+			"https://example.com/docs/intro?lang=de&utm_source=mail",
+		},
+	}
+
+	for _, c := range tt {
+		t.Run(c.name, func(t *testing.T) {
+			visit := internal.Visit{Path: c.path, Query: c.query}
+			result, err := applyPassthrough(c.destination, c.mode, visit)
+			assert.NoErrorf(t, err, "Expected no error, got %v", err)
+			assert.Equalf(t, c.expected, result, "Expected %s, got %s", c.expected, result)
+		})
+	}
+}
@@ -3,69 +3,548 @@ package shortener
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/pscheid92/dwarferl/internal"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strings"
 	"time"
 )
 
+const (
+	maxUnlockAttempts   = 5
+	unlockAttemptWindow = 15 * time.Minute
+	exportBatchSize     = 500
+
+	// generators not deriving the code from the link may hand out taken or reserved codes
+	maxCodeAttempts = 5
+
+	// clicks are announced to webhooks after the visitor was redirected, by a few workers
+	// that drop clicks once this many are waiting
+	clickPublishTimeout = 10 * time.Second
+	clickPublishWorkers = 4
+	clickQueueSize      = 1000
+)
+
 type UrlShortenerService struct {
 	hasher    internal.Hasher
 	redirects internal.RedirectRepository
+	audit     internal.AuditService
+	webhooks  internal.WebhookPublisher
+	domains   []string
+	unlocks   *attemptLimiter
+
+	// background runs work that must not hold up redirects; it may drop the work
+	background func(func())
 }
 
-func NewUrlShortenerService(hasher internal.Hasher, redirects internal.RedirectRepository) UrlShortenerService {
+// NewUrlShortenerService creates the service. Besides the default domain, links may be created
+// on the given short domains.
+func NewUrlShortenerService(hasher internal.Hasher, redirects internal.RedirectRepository, audit internal.AuditService, webhooks internal.WebhookPublisher, domains []string) UrlShortenerService {
 	return UrlShortenerService{
 		hasher:    hasher,
 		redirects: redirects,
+		audit:     audit,
+		webhooks:  webhooks,
+		domains:   domains,
+		unlocks:   newAttemptLimiter(maxUnlockAttempts, unlockAttemptWindow),
+
+		background: newWorkQueue(clickPublishWorkers, clickQueueSize).publishClick,
 	}
 }
 
-func (u UrlShortenerService) List(ctx context.Context, userID string) ([]internal.Redirect, error) {
-	list, err := u.redirects.List(ctx, userID)
+func (u UrlShortenerService) List(ctx context.Context, userID string, filter internal.RedirectFilter, page internal.PageRequest) (internal.RedirectPage, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	filter.Tag = strings.ToLower(strings.TrimSpace(filter.Tag))
+
+	if page.Sort == "" {
+		page.Sort = internal.SortByCreated
+	}
+	if !page.Sort.IsValid() {
+		return internal.RedirectPage{}, errors.New("invalid sort order")
+	}
+
+	after, err := decodeCursor(page.Sort, page.Cursor)
 	if err != nil {
-		return nil, err
+		return internal.RedirectPage{}, err
 	}
 
-	return list, nil
+	// fetching one more than requested tells whether there is a next page
+	size := pageSize(page.Size)
+	list, err := u.redirects.List(ctx, userID, filter, page.Sort, after, size+1)
+	if err != nil {
+		return internal.RedirectPage{}, err
+	}
+	return newPage(page.Sort, list, size), nil
 }
 
-func (u UrlShortenerService) GetRedirectByShort(ctx context.Context, short string, userID string) (internal.Redirect, error) {
-	if !u.hasher.Validate(short) {
+// ListAll lists the redirects of all users, newest first. It is meant for administrators.
+func (u UrlShortenerService) ListAll(ctx context.Context, ownerID string, query string, page internal.PageRequest) (internal.RedirectPage, error) {
+	after, err := decodeCursor(internal.SortByCreated, page.Cursor)
+	if err != nil {
+		return internal.RedirectPage{}, err
+	}
+
+	size := pageSize(page.Size)
+	list, err := u.redirects.ListAll(ctx, ownerID, strings.TrimSpace(query), after, size+1)
+	if err != nil {
+		return internal.RedirectPage{}, err
+	}
+	return newPage(internal.SortByCreated, list, size), nil
+}
+
+// Export hands all redirects of the user to fn. They are fetched page by page,
+// so large accounts are never held in memory as a whole.
+func (u UrlShortenerService) Export(ctx context.Context, userID string, fn func(internal.Redirect) error) error {
+	var after *internal.RedirectCursor
+	for {
+		list, err := u.redirects.List(ctx, userID, internal.RedirectFilter{}, internal.SortByShort, after, exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, redirect := range list {
+			if err := fn(redirect); err != nil {
+				return err
+			}
+		}
+
+		if len(list) < exportBatchSize {
+			return nil
+		}
+
+		last := list[len(list)-1]
+		after = &internal.RedirectCursor{CreatedAt: last.CreatedAt, Short: last.Short, Domain: last.Domain, Clicks: last.Clicks}
+	}
+}
+
+func (u UrlShortenerService) Tags(ctx context.Context, userID string) ([]string, error) {
+	return u.redirects.Tags(ctx, userID)
+}
+
+func (u UrlShortenerService) Campaigns(ctx context.Context, userID string) ([]internal.CampaignStats, error) {
+	return u.redirects.Campaigns(ctx, userID)
+}
+
+func (u UrlShortenerService) GetRedirectByShort(ctx context.Context, domain string, short string, userID string) (internal.Redirect, error) {
+	if !validShort(short) {
+		return internal.Redirect{}, errors.New("invalid short")
+	}
+
+	redirect, err := u.redirects.GetRedirectByShort(ctx, domain, short, userID)
+	if err != nil {
+		return internal.Redirect{}, err
+	}
+	return redirect, nil
+}
+
+func (u UrlShortenerService) LookupShortURL(ctx context.Context, domain string, short string) (internal.Redirect, error) {
+	if !validShort(short) {
 		return internal.Redirect{}, errors.New("invalid short")
 	}
 
-	redirect, err := u.redirects.GetRedirectByShort(ctx, short, userID)
+	redirect, err := u.redirects.Lookup(ctx, domain, short)
 	if err != nil {
 		return internal.Redirect{}, err
 	}
 	return redirect, nil
 }
 
-func (u UrlShortenerService) ShortenURL(ctx context.Context, url string, userID string) (internal.Redirect, error) {
+func (u UrlShortenerService) ShortenURL(ctx context.Context, url string, userID string, options internal.RedirectOptions) (internal.Redirect, error) {
+	if options.MaxClicks < 0 {
+		return internal.Redirect{}, errors.New("max clicks must not be negative")
+	}
+
+	if !options.Passthrough.IsValid() {
+		return internal.Redirect{}, errors.New("invalid passthrough mode")
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(options.Domain))
+	if domain != "" && !u.knownDomain(domain) {
+		return internal.Redirect{}, internal.ErrUnknownDomain
+	}
+
+	tags, err := normalizeTags(options.Tags)
+	if err != nil {
+		return internal.Redirect{}, err
+	}
+
+	// the composed URL is what gets stored and hashed, so every preset yields its own short
+	if options.UTMPreset.ID != "" {
+		composed, err := options.UTMPreset.Apply(url)
+		if err != nil {
+			return internal.Redirect{}, err
+		}
+		url = composed
+	}
+
 	redirect := internal.Redirect{
-		UserID:    userID,
-		Short:     u.hasher.Hash(userID, url),
-		URL:       url,
-		CreatedAt: time.Now(),
+		UserID:       userID,
+		Domain:       domain,
+		URL:          url,
+		CreatedAt:    time.Now(),
+		MaxClicks:    options.MaxClicks,
+		Title:        options.Title,
+		ForcePreview: options.ForcePreview,
+		Passthrough:  options.Passthrough,
+		UTMPresetID:  options.UTMPreset.ID,
+		UTMCampaign:  options.UTMPreset.Campaign,
+		Notes:        options.Notes,
+		Tags:         tags,
 	}
 
-	if err := u.redirects.Save(ctx, redirect); err != nil {
+	if options.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(options.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return redirect, err
+		}
+		redirect.PasswordHash = string(hash)
+	}
+
+	redirect, created, err := u.saveWithNewShort(ctx, redirect, options.Password)
+	if err != nil || !created {
+		return redirect, err
+	}
+
+	if err := u.audit.Record(ctx, internal.AuditLinkCreate, internal.AuditTargetLink, internal.LinkID(redirect.Domain, redirect.Short), nil, snapshot(redirect)); err != nil {
 		return redirect, err
 	}
+
+	u.publish(ctx, userID, internal.EventLinkCreated, newLinkEvent(redirect))
 	return redirect, nil
 }
 
-func (u UrlShortenerService) ExpandShortURL(ctx context.Context, short string) (string, error) {
-	if !u.hasher.Validate(short) {
+// publish announces the event to the user's webhooks. The change it announces already happened,
+// so a failing outbox is only logged.
+func (u UrlShortenerService) publish(ctx context.Context, userID string, event internal.WebhookEvent, data any) {
+	if err := u.webhooks.Publish(ctx, userID, event, data); err != nil {
+		log.Printf("error publishing %s: %v", event, err)
+	}
+}
+
+// saveWithNewShort saves the redirect under a newly generated short. Shortening a link again
+// yields the same hash code, which returns the existing redirect if it behaves the same, down
+// to the password, or ErrLinkTrashed if it waits in the trash. Otherwise, and for reserved
+// or invalid codes, the hash input is salted with the attempt to derive another short.
+func (u UrlShortenerService) saveWithNewShort(ctx context.Context, redirect internal.Redirect, password string) (internal.Redirect, bool, error) {
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		input := redirect.URL
+		if attempt > 0 {
+			input = fmt.Sprintf("%s#%d", redirect.URL, attempt)
+		}
+
+		short, err := u.hasher.Hash(ctx, redirect.UserID, input)
+		if err != nil {
+			return internal.Redirect{}, false, err
+		}
+		if reservedShorts[short] || !u.hasher.Validate(short) {
+			continue
+		}
+
+		redirect.Short = short
+		err = u.redirects.Save(ctx, redirect)
+		if errors.Is(err, internal.ErrShortTaken) {
+			existing, err := u.redirects.Lookup(ctx, redirect.Domain, short)
+			if err != nil {
+				existing, err = u.trashed(ctx, redirect.UserID, redirect.Domain, short)
+			}
+			if err == nil && sameBehaviour(existing, redirect, password) && !existing.IsExhausted() {
+				if existing.IsTrashed() {
+					return internal.Redirect{}, false, internal.ErrLinkTrashed
+				}
+				return existing, false, nil
+			}
+			continue
+		}
+		if err != nil {
+			return redirect, false, err
+		}
+		return redirect, true, nil
+	}
+	return internal.Redirect{}, false, internal.ErrShortTaken
+}
+
+// trashed returns the user's redirect in the trash with the given short.
+func (u UrlShortenerService) trashed(ctx context.Context, userID string, domain string, short string) (internal.Redirect, error) {
+	redirects, err := u.redirects.Trash(ctx, userID)
+	if err != nil {
+		return internal.Redirect{}, err
+	}
+
+	for _, redirect := range redirects {
+		if redirect.Domain == domain && redirect.Short == short {
+			return redirect, nil
+		}
+	}
+	return internal.Redirect{}, errors.New("not found")
+}
+
+// sameBehaviour reports whether the existing redirect treats visitors like the new one would.
+// Title, notes and tags only describe a link and are left out.
+func sameBehaviour(existing internal.Redirect, redirect internal.Redirect, password string) bool {
+	if password == "" {
+		if existing.IsProtected() {
+			return false
+		}
+	} else if !existing.IsProtected() || bcrypt.CompareHashAndPassword([]byte(existing.PasswordHash), []byte(password)) != nil {
+		return false
+	}
+
+	return existing.UserID == redirect.UserID &&
+		existing.URL == redirect.URL &&
+		existing.MaxClicks == redirect.MaxClicks &&
+		existing.ForcePreview == redirect.ForcePreview &&
+		existing.Passthrough == redirect.Passthrough &&
+		existing.UTMPresetID == redirect.UTMPresetID
+}
+
+// knownDomain reports whether links may be created on the short domain.
+func (u UrlShortenerService) knownDomain(domain string) bool {
+	for _, known := range u.domains {
+		if strings.EqualFold(domain, known) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u UrlShortenerService) UnlockShortURL(ctx context.Context, domain string, short string, password string) error {
+	redirect, err := u.LookupShortURL(ctx, domain, short)
+	if err != nil {
+		return err
+	}
+
+	if !redirect.IsProtected() {
+		return nil
+	}
+
+	id := internal.LinkID(domain, short)
+	if !u.unlocks.Allow(id) {
+		return internal.ErrTooManyAttempts
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(redirect.PasswordHash), []byte(password)); err != nil {
+		return internal.ErrWrongPassword
+	}
+
+	u.unlocks.Reset(id)
+	return nil
+}
+
+func (u UrlShortenerService) UpdateDetails(ctx context.Context, domain string, short string, userID string, details internal.RedirectDetails) error {
+	tags, err := normalizeTags(details.Tags)
+	if err != nil {
+		return err
+	}
+	details.Tags = tags
+
+	redirect, err := u.GetRedirectByShort(ctx, domain, short, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.redirects.UpdateDetails(ctx, domain, short, userID, details); err != nil {
+		return err
+	}
+
+	updated := redirect
+	updated.Title, updated.Notes, updated.Tags = details.Title, details.Notes, details.Tags
+	return u.audit.Record(ctx, internal.AuditLinkUpdate, internal.AuditTargetLink, internal.LinkID(domain, short), snapshot(redirect), snapshot(updated))
+}
+
+func (u UrlShortenerService) UpdateRules(ctx context.Context, domain string, short string, userID string, rules []internal.TargetingRule) error {
+	for i, rule := range rules {
+		if err := validateRule(rule); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+
+	redirect, err := u.GetRedirectByShort(ctx, domain, short, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.redirects.UpdateRules(ctx, domain, short, userID, rules); err != nil {
+		return err
+	}
+
+	updated := redirect
+	updated.Rules = rules
+	return u.audit.Record(ctx, internal.AuditLinkRules, internal.AuditTargetLink, internal.LinkID(domain, short), snapshot(redirect), snapshot(updated))
+}
+
+func (u UrlShortenerService) UpdateTargets(ctx context.Context, domain string, short string, userID string, targets []internal.WeightedTarget) error {
+	if err := validateTargets(targets); err != nil {
+		return err
+	}
+
+	redirect, err := u.GetRedirectByShort(ctx, domain, short, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.redirects.UpdateTargets(ctx, domain, short, userID, targets); err != nil {
+		return err
+	}
+
+	updated := redirect
+	updated.Targets = targets
+	return u.audit.Record(ctx, internal.AuditLinkTargets, internal.AuditTargetLink, internal.LinkID(domain, short), snapshot(redirect), snapshot(updated))
+}
+
+func (u UrlShortenerService) VariantStats(ctx context.Context, domain string, short string, userID string) ([]internal.VariantStats, error) {
+	redirect, err := u.GetRedirectByShort(ctx, domain, short, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	clicks, err := u.redirects.VariantClicks(ctx, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	return variantStats(redirect.Targets, clicks), nil
+}
+
+func (u UrlShortenerService) ExpandShortURL(ctx context.Context, domain string, short string, visit internal.Visit) (string, error) {
+	if !validShort(short) {
 		return "", errors.New("invalid short")
 	}
 
-	redirect, err := u.redirects.Expand(ctx, short)
+	redirect, err := u.redirects.Expand(ctx, domain, short)
 	if err != nil {
 		return "", err
 	}
-	return redirect, nil
+
+	target, ok := resolveTarget(redirect.Rules, visit)
+	if !ok {
+		target, err = u.chooseTarget(ctx, redirect, visit)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	click := clickEvent{Domain: domain, Short: short, Target: target, UserAgent: visit.UserAgent, Language: visit.AcceptLanguage}
+	u.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), clickPublishTimeout)
+		defer cancel()
+		u.publish(ctx, redirect.UserID, internal.EventLinkClicked, click)
+	})
+
+	return applyPassthrough(target, redirect.Passthrough, visit)
 }
 
-func (u UrlShortenerService) DeleteShortURL(ctx context.Context, short string, userID string) error {
-	return u.redirects.Delete(ctx, short, userID)
+func (u UrlShortenerService) chooseTarget(ctx context.Context, redirect internal.Redirect, visit internal.Visit) (string, error) {
+	if len(redirect.Targets) == 0 {
+		return redirect.URL, nil
+	}
+
+	variant := chooseVariant(redirect.Targets, redirect.Short, visit.VisitorID)
+	if err := u.redirects.CountVariantClick(ctx, redirect.Domain, redirect.Short, variant); err != nil {
+		return "", err
+	}
+	return redirect.Targets[variant].URL, nil
+}
+
+// DeleteShortURL moves the redirect to the trash, from where it can be restored until it gets purged.
+func (u UrlShortenerService) DeleteShortURL(ctx context.Context, domain string, short string, userID string) error {
+	redirect, err := u.GetRedirectByShort(ctx, domain, short, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.redirects.Delete(ctx, domain, short, userID); err != nil {
+		return err
+	}
+
+	if err := u.audit.Record(ctx, internal.AuditLinkDelete, internal.AuditTargetLink, internal.LinkID(domain, short), snapshot(redirect), nil); err != nil {
+		return err
+	}
+	u.publish(ctx, userID, internal.EventLinkDeleted, newLinkEvent(redirect))
+	return nil
+}
+
+func (u UrlShortenerService) Trash(ctx context.Context, userID string) ([]internal.Redirect, error) {
+	return u.redirects.Trash(ctx, userID)
+}
+
+func (u UrlShortenerService) RestoreShortURL(ctx context.Context, domain string, short string, userID string) error {
+	if err := u.redirects.Restore(ctx, domain, short, userID); err != nil {
+		return err
+	}
+	return u.audit.Record(ctx, internal.AuditLinkRestore, internal.AuditTargetLink, internal.LinkID(domain, short), nil, nil)
+}
+
+// PurgeShortURL removes a trashed redirect for good and frees its short.
+func (u UrlShortenerService) PurgeShortURL(ctx context.Context, domain string, short string, userID string) error {
+	if err := u.redirects.Purge(ctx, domain, short, userID); err != nil {
+		return err
+	}
+	return u.audit.Record(ctx, internal.AuditLinkPurge, internal.AuditTargetLink, internal.LinkID(domain, short), nil, nil)
+}
+
+// PurgeExpiredTrash removes redirects that have been in the trash for longer than the retention.
+func (u UrlShortenerService) PurgeExpiredTrash(ctx context.Context, retention time.Duration) (int, error) {
+	if retention <= 0 {
+		return 0, errors.New("retention must be positive")
+	}
+	purged, err := u.redirects.PurgeTrashedBefore(ctx, time.Now().Add(-retention))
+	if err != nil || purged == 0 {
+		return purged, err
+	}
+	return purged, u.audit.Record(ctx, internal.AuditTrashPurge, internal.AuditTargetTrash, "", nil, map[string]int{"purged": purged})
+}
+
+// TransferShortURL hands a redirect over to another user, regardless of its current owner.
+func (u UrlShortenerService) TransferShortURL(ctx context.Context, domain string, short string, userID string) error {
+	redirect, err := u.LookupShortURL(ctx, domain, short)
+	if err != nil {
+		return err
+	}
+
+	if redirect.UserID == userID {
+		return errors.New("link already belongs to this user")
+	}
+
+	if err := u.redirects.Transfer(ctx, domain, short, userID); err != nil {
+		return err
+	}
+
+	before := map[string]string{"user_id": redirect.UserID}
+	after := map[string]string{"user_id": userID}
+	return u.audit.Record(ctx, internal.AuditLinkTransfer, internal.AuditTargetLink, internal.LinkID(domain, short), before, after)
+}
+
+// TransferAll hands every link of a user over to another user. Links in the trash stay behind.
+func (u UrlShortenerService) TransferAll(ctx context.Context, fromUserID string, toUserID string) (int, error) {
+	ids, err := u.redirects.TransferAll(ctx, fromUserID, toUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	before := map[string]string{"user_id": fromUserID}
+	after := map[string]string{"user_id": toUserID}
+	for _, id := range ids {
+		if err := u.audit.Record(ctx, internal.AuditLinkTransfer, internal.AuditTargetLink, id, before, after); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// RemoveShortURL deletes a redirect of any user for good, skipping the trash. It is meant for abusive links.
+func (u UrlShortenerService) RemoveShortURL(ctx context.Context, domain string, short string) error {
+	redirect, err := u.LookupShortURL(ctx, domain, short)
+	if err != nil {
+		return err
+	}
+
+	if err := u.redirects.Remove(ctx, domain, short); err != nil {
+		return err
+	}
+
+	if err := u.audit.Record(ctx, internal.AuditLinkRemove, internal.AuditTargetLink, internal.LinkID(domain, short), snapshot(redirect), nil); err != nil {
+		return err
+	}
+	u.publish(ctx, redirect.UserID, internal.EventLinkDeleted, newLinkEvent(redirect))
+	return nil
 }
@@ -2,27 +2,167 @@ package shortener
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/hasher"
 	"github.com/stretchr/testify/assert"
+	"net/url"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 )
 
 const (
-	testUser = "00000000-0000-0000-0000-000000000000"
-	testURL  = "https://www.google.com"
+	testUser   = "00000000-0000-0000-0000-000000000000"
+	testURL    = "https://www.google.com"
+	testDomain = "go.example.com"
+
+	testPassword = "secret"
 )
 
 func TestUrlShortenerService_List(t *testing.T) {
 	redirects, sut := setupService()
 
-	list, err := sut.List(context.Background(), testUser)
+	page, err := sut.List(context.Background(), testUser, internal.RedirectFilter{}, internal.PageRequest{})
 	assert.NoErrorf(t, err, "list should not return error")
-	assert.Emptyf(t, list, "list should return empty list")
+	assert.Emptyf(t, page.Redirects, "list should return empty list")
+	assert.Emptyf(t, page.NextCursor, "Expected no next page, got %s", page.NextCursor)
+
+	_, err = sut.List(context.Background(), testUser, internal.RedirectFilter{}, internal.PageRequest{Sort: "random"})
+	assert.Errorf(t, err, "Expected error for unknown sort order, got nil")
+
+	_, err = sut.List(context.Background(), testUser, internal.RedirectFilter{}, internal.PageRequest{Cursor: "garbage"})
+	assert.ErrorIsf(t, err, internal.ErrInvalidCursor, "Expected invalid cursor error, got %v", err)
 
 	redirects.FailMode = true
-	_, err = sut.List(context.Background(), testUser)
+	_, err = sut.List(context.Background(), testUser, internal.RedirectFilter{}, internal.PageRequest{})
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_List_Pagination(t *testing.T) {
+	redirects, sut := setupService()
+
+	created := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	for i, short := range []string{"e", "c", "a", "d", "b"} {
+		redirect := internal.Redirect{Short: short, URL: testURL, UserID: testUser, CreatedAt: created.Add(time.Duration(i) * time.Hour), Clicks: i % 2}
+		assert.NoErrorf(t, redirects.Save(context.Background(), redirect), "Expected no error")
+	}
+
+	tt := []struct {
+		sort     internal.RedirectSort
+		expected []string
+	}{
+		{internal.SortByCreated, []string{"b", "d", "a", "c", "e"}},
+		{internal.SortByShort, []string{"a", "b", "c", "d", "e"}},
+		{internal.SortByClicks, []string{"d", "c", "e", "b", "a"}},
+	}
+
+	for _, c := range tt {
+		var shorts []string
+		request := internal.PageRequest{Sort: c.sort, Size: 2}
+		for pages := 1; ; pages++ {
+			page, err := sut.List(context.Background(), testUser, internal.RedirectFilter{}, request)
+			assert.NoErrorf(t, err, "Expected no error, got %v", err)
+			assert.LessOrEqualf(t, len(page.Redirects), 2, "Expected at most two redirects per page, got %d", len(page.Redirects))
+
+			for _, r := range page.Redirects {
+				shorts = append(shorts, r.Short)
+			}
+			if page.NextCursor == "" {
+				assert.Equalf(t, 3, pages, "Expected three pages, got %d", pages)
+				break
+			}
+
+			// a link sorting before the cursor must not shift the following pages
+			if pages == 1 {
+				late := internal.Redirect{Short: "0", URL: testURL, UserID: testUser, CreatedAt: created.Add(10 * time.Hour), Clicks: 5}
+				assert.NoErrorf(t, redirects.Save(context.Background(), late), "Expected no error")
+			}
+			request.Cursor = page.NextCursor
+		}
+		delete(redirects.redirects, "0")
+		assert.Equalf(t, c.expected, shorts, "%s: expected %v, got %v", c.sort, c.expected, shorts)
+	}
+}
+
+func TestUrlShortenerService_Export(t *testing.T) {
+	redirects, sut := setupService()
+
+	for i := 0; i < exportBatchSize+3; i++ {
+		redirect := internal.Redirect{Short: fmt.Sprintf("s%04d", i), URL: testURL, UserID: testUser, CreatedAt: time.Now()}
+		assert.NoErrorf(t, redirects.Save(context.Background(), redirect), "Expected no error")
+	}
+
+	var shorts []string
+	err := sut.Export(context.Background(), testUser, func(r internal.Redirect) error {
+		shorts = append(shorts, r.Short)
+		return nil
+	})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, shorts, exportBatchSize+3, "Expected every redirect once, got %d", len(shorts))
+	assert.Equalf(t, "s0000", shorts[0], "Expected export to be ordered by short, got %s", shorts[0])
+	assert.Equalf(t, fmt.Sprintf("s%04d", exportBatchSize+2), shorts[len(shorts)-1], "Expected last short, got %s", shorts[len(shorts)-1])
+
+	stop := errors.New("stop")
+	err = sut.Export(context.Background(), testUser, func(internal.Redirect) error { return stop })
+	assert.ErrorIsf(t, err, stop, "Expected callback error to end the export, got %v", err)
+
+	redirects.FailMode = true
+	err = sut.Export(context.Background(), testUser, func(internal.Redirect) error { return nil })
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_Tags(t *testing.T) {
+	redirects, sut := setupService()
+
+	_, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{Tags: []string{"a,b"}})
+	assert.Errorf(t, err, "Expected error for invalid tag, got nil")
+
+	options := internal.RedirectOptions{Notes: "search engine", Tags: []string{" Docs", "docs", "Q3 "}}
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, options)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, []string{"docs", "q3"}, redirect.Tags, "Expected normalized tags, got %v", redirect.Tags)
+
+	page, err := sut.List(context.Background(), testUser, internal.RedirectFilter{Tag: " DOCS "}, internal.PageRequest{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, page.Redirects, 1, "Expected tagged redirect to be found, got %v", page.Redirects)
+
+	page, err = sut.List(context.Background(), testUser, internal.RedirectFilter{Tag: "marketing"}, internal.PageRequest{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Emptyf(t, page.Redirects, "Expected no redirect for other tag, got %v", page.Redirects)
+
+	details := internal.RedirectDetails{Title: "Search", Notes: "updated", Tags: []string{"Marketing"}}
+	err = sut.UpdateDetails(context.Background(), "", redirect.Short, "nonexistent", details)
+	assert.Errorf(t, err, "Expected error for foreign redirect, got nil")
+
+	err = sut.UpdateDetails(context.Background(), "", redirect.Short, testUser, details)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	tags, err := sut.Tags(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, []string{"marketing"}, tags, "Expected updated tags, got %v", tags)
+
+	redirects.FailMode = true
+	err = sut.UpdateDetails(context.Background(), "", redirect.Short, testUser, details)
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_Campaigns(t *testing.T) {
+	redirects, sut := setupService()
+
+	preset := internal.UTMPreset{ID: "preset", Source: "newsletter", Campaign: "launch"}
+	_, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{UTMPreset: preset})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	campaigns, err := sut.Campaigns(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, []internal.CampaignStats{{Campaign: "launch", Links: 1}}, campaigns, "Expected one campaign, got %v", campaigns)
+
+	redirects.FailMode = true
+	_, err = sut.Campaigns(context.Background(), testUser)
 	assert.Errorf(t, err, "Expected error, got nil")
 }
 
@@ -30,111 +170,750 @@ func TestUrlShortenerService_GetRedirectByShort(t *testing.T) {
 	redirects, sut := setupService()
 
 	// invalid short
-	_, err := sut.GetRedirectByShort(context.Background(), "invalid", testUser)
+	_, err := sut.GetRedirectByShort(context.Background(), "", "invalid", testUser)
 	assert.Error(t, err, "Expected error, got nil")
 
 	// correct user and short
-	redirect, err := sut.GetRedirectByShort(context.Background(), "short", testUser)
+	redirect, err := sut.GetRedirectByShort(context.Background(), "", "short", testUser)
 	assert.NoErrorf(t, err, "get redirect by short should not return error")
 	assert.Equalf(t, testURL, redirect.URL, "get redirect by short should return correct redirect")
 	assert.Equalf(t, testUser, redirect.UserID, "get redirect by short should return correct redirect")
 
 	// false user correct short
-	redirect, err = sut.GetRedirectByShort(context.Background(), "short", "nonexistent")
+	redirect, err = sut.GetRedirectByShort(context.Background(), "", "short", "nonexistent")
 	assert.Errorf(t, err, "Expected error, got nil")
 
 	// user and false short
-	redirect, err = sut.GetRedirectByShort(context.Background(), "nonexistent", testUser)
+	redirect, err = sut.GetRedirectByShort(context.Background(), "", "nonexistent", testUser)
 	assert.Errorf(t, err, "Expected error, got nil")
 
 	// error
 	redirects.FailMode = true
-	_, err = sut.GetRedirectByShort(context.Background(), "short", testUser)
+	_, err = sut.GetRedirectByShort(context.Background(), "", "short", testUser)
 	assert.Errorf(t, err, "Expected error, got nil")
 }
 
 func TestUrlShortenerService_ShortenURL(t *testing.T) {
 	repo, sut := setupService()
 
-	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser)
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{})
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
 	assert.Equalf(t, "short", redirect.Short, "Expected short to be short, got %v", redirect.Short)
 
-	expanded, err := repo.Expand(context.Background(), redirect.Short)
+	expanded, err := repo.Expand(context.Background(), "", redirect.Short)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testURL, expanded.URL, "Expected redirect to be expanded to %s, got %s", testURL, expanded.URL)
+
+	repo.FailMode = true
+	_, err = sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{})
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_ShortenURL_TakenShort(t *testing.T) {
+	hasher := newHasherFake()
+	repo := newRedirectRepoFake()
+	sut := NewUrlShortenerService(hasher, repo, &auditServiceFake{}, &webhookPublisherFake{}, nil)
+	ctx := context.Background()
+
+	first, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{})
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
-	assert.Equalf(t, testURL, expanded, "Expected redirect to be expanded to %s, got %s", testURL, expanded)
+
+	again, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{Title: "again"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, first.Short, again.Short, "Expected existing link to be returned, got %v", again.Short)
+	assert.Emptyf(t, again.Title, "Expected existing link to be untouched, got title %v", again.Title)
+
+	hasher.codes = []string{"short", "login", "broken", "fresh"}
+	other, err := sut.ShortenURL(ctx, testURL+"/other", testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, "fresh", other.Short, "Expected taken, reserved and invalid codes to be skipped, got %v", other.Short)
+
+	_, err = sut.ShortenURL(ctx, testURL+"/third", testUser, internal.RedirectOptions{})
+	assert.ErrorIsf(t, err, internal.ErrShortTaken, "Expected %v, got %v", internal.ErrShortTaken, err)
+
+	hasher.FailMode = true
+	_, err = sut.ShortenURL(ctx, testURL+"/fourth", testUser, internal.RedirectOptions{})
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_ShortenURL_DifferentOptions(t *testing.T) {
+	repo := newRedirectRepoFake()
+	sut := NewUrlShortenerService(hasher.NewUrlHasher(), repo, &auditServiceFake{}, &webhookPublisherFake{}, nil)
+	ctx := context.Background()
+
+	unlimited, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	oneTime, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{MaxClicks: 1})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.NotEqualf(t, unlimited.Short, oneTime.Short, "Expected a new link for other max clicks, got %v", oneTime.Short)
+	assert.Equalf(t, 1, oneTime.MaxClicks, "Expected max clicks to be 1, got %d", oneTime.MaxClicks)
+
+	again, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{MaxClicks: 1})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, oneTime.Short, again.Short, "Expected unused one-time link to be returned, got %v", again.Short)
+
+	_, err = sut.ExpandShortURL(ctx, "", oneTime.Short, internal.Visit{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	fresh, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{MaxClicks: 1})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.NotEqualf(t, oneTime.Short, fresh.Short, "Expected a new link instead of the used one, got %v", fresh.Short)
+	assert.Lenf(t, repo.redirects, 3, "Expected three links, got %v", repo.redirects)
+}
+
+func TestUrlShortenerService_ShortenURL_AddedPassword(t *testing.T) {
+	repo := newRedirectRepoFake()
+	sut := NewUrlShortenerService(hasher.NewUrlHasher(), repo, &auditServiceFake{}, &webhookPublisherFake{}, nil)
+	ctx := context.Background()
+
+	open, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	protected, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{Password: "secret"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.NotEqualf(t, open.Short, protected.Short, "Expected a new link for the password, got %v", protected.Short)
+	assert.NotEmptyf(t, protected.PasswordHash, "Expected returned link to be protected")
+
+	again, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{Password: "secret"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, protected.Short, again.Short, "Expected link with the same password to be returned, got %v", again.Short)
+
+	other, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{Password: "other"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.NotEqualf(t, protected.Short, other.Short, "Expected a new link for another password, got %v", other.Short)
+	assert.NotEmptyf(t, other.PasswordHash, "Expected returned link to be protected")
+}
+
+func TestUrlShortenerService_ShortenURL_TrashedLink(t *testing.T) {
+	repo := newRedirectRepoFake()
+	sut := NewUrlShortenerService(hasher.NewUrlHasher(), repo, &auditServiceFake{}, &webhookPublisherFake{}, nil)
+	ctx := context.Background()
+
+	redirect, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = repo.Delete(ctx, "", redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	_, err = sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{})
+	assert.ErrorIsf(t, err, internal.ErrLinkTrashed, "Expected %v, got %v", internal.ErrLinkTrashed, err)
+}
+
+func TestUrlShortenerService_Domains(t *testing.T) {
+	repo, sut := setupService()
+	ctx := context.Background()
+
+	_, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{Domain: "unknown.example.com"})
+	assert.ErrorIsf(t, err, internal.ErrUnknownDomain, "Expected %v, got %v", internal.ErrUnknownDomain, err)
+
+	_, err = sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	redirect, err := sut.ShortenURL(ctx, testURL+"/other", testUser, internal.RedirectOptions{Domain: " Go.Example.com "})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testDomain, redirect.Domain, "Expected normalized domain, got %v", redirect.Domain)
+	assert.Lenf(t, repo.redirects, 2, "Expected the same short on both domains, got %v", repo.redirects)
+
+	expanded, err := sut.ExpandShortURL(ctx, testDomain, redirect.Short, internal.Visit{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testURL+"/other", expanded, "Expected target of the domain's link, got %s", expanded)
+
+	err = sut.DeleteShortURL(ctx, testDomain, redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	redirect, err = sut.LookupShortURL(ctx, "", redirect.Short)
+	assert.NoErrorf(t, err, "Expected link on the default domain to be untouched, got %v", err)
+	assert.Equalf(t, testURL, redirect.URL, "Expected url to be %s, got %s", testURL, redirect.URL)
+}
+
+func TestUrlShortenerService_LookupShortURL(t *testing.T) {
+	repo, sut := setupService()
+
+	_, err := sut.LookupShortURL(context.Background(), "", "invalid")
+	assert.Errorf(t, err, "Expected error, got nil")
+
+	_, err = sut.LookupShortURL(context.Background(), "", "short")
+	assert.Errorf(t, err, "Expected error, got nil")
+
+	_, err = sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	redirect, err := sut.LookupShortURL(context.Background(), "", "short")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testURL, redirect.URL, "Expected url to be %s, got %s", testURL, redirect.URL)
+	assert.Falsef(t, redirect.IsProtected(), "Expected redirect to be unprotected")
 
 	repo.FailMode = true
-	_, err = sut.ShortenURL(context.Background(), testURL, testUser)
+	_, err = sut.LookupShortURL(context.Background(), "", "short")
 	assert.Errorf(t, err, "Expected error, got nil")
 }
 
+func TestUrlShortenerService_UnlockShortURL(t *testing.T) {
+	_, sut := setupService()
+
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{Password: testPassword})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, redirect.IsProtected(), "Expected redirect to be protected")
+	assert.NotEqualf(t, testPassword, redirect.PasswordHash, "Expected password to be stored hashed")
+
+	err = sut.UnlockShortURL(context.Background(), "", redirect.Short, testPassword)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.UnlockShortURL(context.Background(), "", redirect.Short, "wrong")
+	assert.ErrorIsf(t, err, internal.ErrWrongPassword, "Expected wrong password error, got %v", err)
+
+	for i := 1; i < maxUnlockAttempts; i++ {
+		_ = sut.UnlockShortURL(context.Background(), "", redirect.Short, "wrong")
+	}
+
+	err = sut.UnlockShortURL(context.Background(), "", redirect.Short, testPassword)
+	assert.ErrorIsf(t, err, internal.ErrTooManyAttempts, "Expected too many attempts error, got %v", err)
+}
+
+func TestUrlShortenerService_UnlockShortURL_Concurrent(t *testing.T) {
+	_, sut := setupService()
+
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{Password: testPassword})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*maxUnlockAttempts)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- sut.UnlockShortURL(context.Background(), "", redirect.Short, "wrong")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	wrong := 0
+	for err := range errs {
+		if errors.Is(err, internal.ErrWrongPassword) {
+			wrong++
+		}
+	}
+	assert.Equalf(t, maxUnlockAttempts, wrong, "Expected only %d passwords to be checked, got %d", maxUnlockAttempts, wrong)
+}
+
 func TestUrlShortenerService_ExpandShortURL(t *testing.T) {
 	repo, sut := setupService()
 
-	_, err := sut.GetRedirectByShort(context.Background(), "invalid", testUser)
+	_, err := sut.GetRedirectByShort(context.Background(), "", "invalid", testUser)
 	assert.Error(t, err, "Expected error, got nil")
 
-	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser)
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{})
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
 
-	expanded, err := sut.ExpandShortURL(context.Background(), redirect.Short)
+	expanded, err := sut.ExpandShortURL(context.Background(), "", redirect.Short, internal.Visit{})
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
 	assert.Equalf(t, testURL, expanded, "Expected %s to be expanded to %s, got %s", redirect.Short, testURL, expanded)
 
 	repo.FailMode = true
-	_, err = sut.ExpandShortURL(context.Background(), redirect.Short)
+	_, err = sut.ExpandShortURL(context.Background(), "", redirect.Short, internal.Visit{})
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_ShortenURL_UTMPreset(t *testing.T) {
+	_, sut := setupService()
+
+	preset := internal.UTMPreset{ID: "preset", Source: "newsletter", Medium: "email", Campaign: "launch"}
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{UTMPreset: preset})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	expected := testURL + "?utm_campaign=launch&utm_medium=email&utm_source=newsletter"
+	assert.Equalf(t, expected, redirect.URL, "Expected composed url %s, got %s", expected, redirect.URL)
+	assert.Equalf(t, "preset", redirect.UTMPresetID, "Expected preset reference to be stored, got %s", redirect.UTMPresetID)
+	assert.Equalf(t, "launch", redirect.UTMCampaign, "Expected campaign to be stored, got %s", redirect.UTMCampaign)
+}
+
+func TestUrlShortenerService_ExpandShortURL_Passthrough(t *testing.T) {
+	_, sut := setupService()
+
+	_, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{Passthrough: "invalid"})
+	assert.Errorf(t, err, "Expected error for invalid passthrough mode, got nil")
+
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{Passthrough: internal.PassthroughMerge})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	visit := internal.Visit{Path: "/search", Query: url.Values{"q": {"dwarferl"}}}
+	expanded, err := sut.ExpandShortURL(context.Background(), "", redirect.Short, visit)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testURL+"/search?q=dwarferl", expanded, "Expected passthrough to be applied, got %s", expanded)
+}
+
+func TestUrlShortenerService_UpdateRules(t *testing.T) {
+	repo, sut := setupService()
+
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	invalid := []internal.TargetingRule{{Kind: internal.RuleOS, Value: "beos", URL: "https://example.com"}}
+	err = sut.UpdateRules(context.Background(), "", redirect.Short, testUser, invalid)
+	assert.Errorf(t, err, "Expected error for invalid rule, got nil")
+
+	rules := []internal.TargetingRule{{Kind: internal.RuleLanguage, Value: "de", URL: "https://example.com/de/"}}
+	err = sut.UpdateRules(context.Background(), "", redirect.Short, "nonexistent", rules)
+	assert.Errorf(t, err, "Expected error for foreign redirect, got nil")
+
+	err = sut.UpdateRules(context.Background(), "", redirect.Short, testUser, rules)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	visit := internal.Visit{AcceptLanguage: "de-DE,de;q=0.9"}
+	expanded, err := sut.ExpandShortURL(context.Background(), "", redirect.Short, visit)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, "https://example.com/de/", expanded, "Expected rule target, got %s", expanded)
+
+	expanded, err = sut.ExpandShortURL(context.Background(), "", redirect.Short, internal.Visit{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testURL, expanded, "Expected fallback url, got %s", expanded)
+
+	repo.FailMode = true
+	err = sut.UpdateRules(context.Background(), "", redirect.Short, testUser, rules)
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_UpdateTargets(t *testing.T) {
+	repo, sut := setupService()
+
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	invalid := []internal.WeightedTarget{{URL: "https://a.example.com", Weight: 0}}
+	err = sut.UpdateTargets(context.Background(), "", redirect.Short, testUser, invalid)
+	assert.Errorf(t, err, "Expected error for zero total weight, got nil")
+
+	targets := []internal.WeightedTarget{{URL: "https://a.example.com", Weight: 1}, {URL: "https://b.example.com", Weight: 0}}
+	err = sut.UpdateTargets(context.Background(), "", redirect.Short, "nonexistent", targets)
+	assert.Errorf(t, err, "Expected error for foreign redirect, got nil")
+
+	err = sut.UpdateTargets(context.Background(), "", redirect.Short, testUser, targets)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	for _, visitor := range []string{"alice", "bob", ""} {
+		expanded, err := sut.ExpandShortURL(context.Background(), "", redirect.Short, internal.Visit{VisitorID: visitor})
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+		assert.Equalf(t, "https://a.example.com", expanded, "Expected only weighted target, got %s", expanded)
+	}
+
+	stats, err := sut.VariantStats(context.Background(), "", redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, stats, 2, "Expected two variants, got %d", len(stats))
+	assert.Equalf(t, 3, stats[0].Clicks, "Expected three clicks on first variant, got %d", stats[0].Clicks)
+	assert.Equalf(t, 100.0, stats[0].Share, "Expected full share on first variant, got %v", stats[0].Share)
+	assert.Equalf(t, 0, stats[1].Clicks, "Expected no clicks on second variant, got %d", stats[1].Clicks)
+
+	repo.FailMode = true
+	_, err = sut.VariantStats(context.Background(), "", redirect.Short, testUser)
 	assert.Errorf(t, err, "Expected error, got nil")
 }
 
+func TestUrlShortenerService_Import(t *testing.T) {
+	repo, sut := setupService()
+
+	foreign := internal.Redirect{Short: "taken", URL: testURL, UserID: "someone else", CreatedAt: time.Now()}
+	assert.NoErrorf(t, repo.Save(context.Background(), foreign), "Expected no error")
+
+	records := []internal.ImportRecord{
+		{Line: 2, Short: "docs", URL: "https://example.com/docs", Tags: []string{"Docs"}, Clicks: 42},
+		{Line: 3, URL: testURL},
+		{Line: 4, Short: "taken", URL: testURL},
+		{Line: 5, Short: "bad code", URL: testURL},
+		{Line: 6, Short: "login", URL: testURL},
+		{Line: 7, Short: "ftp", URL: "ftp://example.com"},
+		{Line: 8, Problem: "invalid creation date"},
+		{Line: 9, Short: "export", URL: testURL},
+		{Line: 10, Short: "account", URL: testURL},
+		{Line: 11, Short: "webhooks", URL: testURL},
+	}
+
+	report, err := sut.Import(context.Background(), testUser, records)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 2, report.Created, "Expected two created links, got %d", report.Created)
+	assert.Equalf(t, 1, report.Conflicts, "Expected one conflict, got %d", report.Conflicts)
+	assert.Equalf(t, 7, report.Invalid, "Expected seven invalid rows, got %d", report.Invalid)
+
+	imported, err := sut.LookupShortURL(context.Background(), "", "docs")
+	assert.NoErrorf(t, err, "Expected imported short to be valid, got %v", err)
+	assert.Equalf(t, 42, imported.Clicks, "Expected clicks to be kept, got %d", imported.Clicks)
+	assert.Equalf(t, []string{"docs"}, imported.Tags, "Expected normalized tags, got %v", imported.Tags)
+
+	// running the same import again resumes without conflicts
+	report, err = sut.Import(context.Background(), testUser, records[:2])
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 2, report.Existing, "Expected two existing links, got %d", report.Existing)
+	assert.Equalf(t, 0, report.Conflicts, "Expected no conflicts, got %d", report.Conflicts)
+
+	// generated codes have to pass the generator's validation
+	sut.hasher.(*hasherFake).codes = []string{"broken"}
+	report, err = sut.Import(context.Background(), testUser, []internal.ImportRecord{{Line: 2, URL: testURL + "/generated"}})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, report.Invalid, "Expected invalid generated code, got %d", report.Invalid)
+
+	repo.FailMode = true
+	_, err = sut.Import(context.Background(), testUser, records)
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_ExpandShortURL_ClickBudget(t *testing.T) {
+	_, sut := setupService()
+
+	_, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{MaxClicks: -1})
+	assert.Errorf(t, err, "Expected error for negative max clicks, got nil")
+
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{MaxClicks: 1})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, redirect.RemainingClicks(), "Expected one remaining click, got %d", redirect.RemainingClicks())
+
+	expanded, err := sut.ExpandShortURL(context.Background(), "", redirect.Short, internal.Visit{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testURL, expanded, "Expected %s to be expanded to %s, got %s", redirect.Short, testURL, expanded)
+
+	_, err = sut.ExpandShortURL(context.Background(), "", redirect.Short, internal.Visit{})
+	assert.ErrorIsf(t, err, internal.ErrClicksExhausted, "Expected clicks exhausted error, got %v", err)
+
+	redirect, err = sut.LookupShortURL(context.Background(), "", redirect.Short)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, redirect.IsExhausted(), "Expected redirect to be exhausted")
+}
+
 func TestUrlShortenerService_DeleteShortURL(t *testing.T) {
 	repo, sut := setupService()
 
-	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser)
+	redirect, err := sut.ShortenURL(context.Background(), testURL, testUser, internal.RedirectOptions{})
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
 
-	_, err = repo.Expand(context.Background(), redirect.Short)
+	_, err = repo.Expand(context.Background(), "", redirect.Short)
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
 
-	err = sut.DeleteShortURL(context.Background(), redirect.Short, testUser)
+	err = sut.DeleteShortURL(context.Background(), "", redirect.Short, testUser)
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
 
-	_, err = repo.Expand(context.Background(), redirect.Short)
+	_, err = repo.Expand(context.Background(), "", redirect.Short)
 	assert.Errorf(t, err, "Expected error, got nil")
 }
 
+func TestUrlShortenerService_Trash(t *testing.T) {
+	repo, sut := setupService()
+	ctx := context.Background()
+
+	redirect, err := sut.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.DeleteShortURL(ctx, "", redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	trash, err := sut.Trash(ctx, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, trash, 1, "Expected one trashed redirect, got %v", trash)
+
+	err = sut.RestoreShortURL(ctx, "", redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	_, err = repo.Expand(ctx, "", redirect.Short)
+	assert.NoErrorf(t, err, "Expected restored redirect to expand, got %v", err)
+
+	err = sut.PurgeShortURL(ctx, "", redirect.Short, testUser)
+	assert.Errorf(t, err, "Expected error when purging a live redirect, got nil")
+
+	_ = sut.DeleteShortURL(ctx, "", redirect.Short, testUser)
+	err = sut.PurgeShortURL(ctx, "", redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	trash, _ = sut.Trash(ctx, testUser)
+	assert.Emptyf(t, trash, "Expected empty trash, got %v", trash)
+}
+
+func TestUrlShortenerService_PurgeExpiredTrash(t *testing.T) {
+	repo, sut := setupService()
+	ctx := context.Background()
+
+	repo.redirects["old"] = internal.Redirect{Short: "old", URL: testURL, UserID: testUser, DeletedAt: time.Now().Add(-48 * time.Hour)}
+	repo.redirects["new"] = internal.Redirect{Short: "new", URL: testURL, UserID: testUser, DeletedAt: time.Now()}
+
+	_, err := sut.PurgeExpiredTrash(ctx, 0)
+	assert.Errorf(t, err, "Expected error for zero retention, got nil")
+
+	purged, err := sut.PurgeExpiredTrash(ctx, 24*time.Hour)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, purged, "Expected one purged redirect, got %v", purged)
+
+	_, ok := repo.redirects["new"]
+	assert.Truef(t, ok, "Expected recent trash to be kept, got %v", ok)
+}
+
+func TestUrlShortenerService_Admin(t *testing.T) {
+	repo, sut := setupService()
+	ctx := context.Background()
+
+	repo.redirects["mine"] = internal.Redirect{Short: "mine", URL: testURL, UserID: testUser, CreatedAt: time.Now()}
+	repo.redirects["theirs"] = internal.Redirect{Short: "theirs", URL: testURL, UserID: "other", CreatedAt: time.Now().Add(-time.Hour)}
+
+	page, err := sut.ListAll(ctx, "", "", internal.PageRequest{Size: 1})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, page.Redirects, 1, "Expected one redirect, got %v", page.Redirects)
+	assert.NotEmptyf(t, page.NextCursor, "Expected a next page, got none")
+
+	page, err = sut.ListAll(ctx, "", "", internal.PageRequest{Size: 1, Cursor: page.NextCursor})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, "theirs", page.Redirects[0].Short, "Expected older redirect on second page, got %v", page.Redirects)
+
+	err = sut.TransferShortURL(ctx, "", "theirs", testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testUser, repo.redirects["theirs"].UserID, "Expected new owner, got %v", repo.redirects["theirs"].UserID)
+
+	err = sut.TransferShortURL(ctx, "", "theirs", testUser)
+	assert.Errorf(t, err, "Expected error when transferring to the current owner, got nil")
+
+	page, err = sut.ListAll(ctx, "other", "", internal.PageRequest{})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Emptyf(t, page.Redirects, "Expected no redirects left for the previous owner, got %v", page.Redirects)
+
+	err = sut.RemoveShortURL(ctx, "", "theirs")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	_, ok := repo.redirects["theirs"]
+	assert.Falsef(t, ok, "Expected redirect to be removed for good")
+
+	_, err = sut.ListAll(ctx, "", "", internal.PageRequest{Cursor: "garbage"})
+	assert.ErrorIsf(t, err, internal.ErrInvalidCursor, "Expected %v, got %v", internal.ErrInvalidCursor, err)
+}
+
+func TestUrlShortenerService_TransferAll(t *testing.T) {
+	repo, sut := setupService()
+	ctx := context.Background()
+
+	repo.redirects["first"] = internal.Redirect{Short: "first", URL: testURL, UserID: testUser}
+	repo.redirects["second"] = internal.Redirect{Short: "second", URL: testURL, UserID: testUser}
+	repo.redirects["trashed"] = internal.Redirect{Short: "trashed", URL: testURL, UserID: testUser, DeletedAt: time.Now()}
+	repo.redirects["theirs"] = internal.Redirect{Short: "theirs", URL: testURL, UserID: "other"}
+
+	transferred, err := sut.TransferAll(ctx, testUser, "heir")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 2, transferred, "Expected two transferred redirects, got %v", transferred)
+	assert.Equalf(t, "heir", repo.redirects["first"].UserID, "Expected new owner, got %v", repo.redirects["first"].UserID)
+	assert.Equalf(t, testUser, repo.redirects["trashed"].UserID, "Expected trash to stay behind, got %v", repo.redirects["trashed"].UserID)
+	assert.Equalf(t, "other", repo.redirects["theirs"].UserID, "Expected other links to be untouched, got %v", repo.redirects["theirs"].UserID)
+
+	repo.FailMode = true
+	_, err = sut.TransferAll(ctx, testUser, "heir")
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestUrlShortenerService_Audit(t *testing.T) {
+	auditor := &auditServiceFake{}
+	svc := NewUrlShortenerService(newHasherFake(), newRedirectRepoFake(), auditor, &webhookPublisherFake{}, nil)
+	ctx := context.Background()
+
+	redirect, err := svc.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{Password: "secret", Title: "Old"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = svc.UpdateDetails(ctx, "", redirect.Short, testUser, internal.RedirectDetails{Title: "New"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = svc.DeleteShortURL(ctx, "", redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	actions := make([]internal.AuditAction, len(auditor.events))
+	for i, event := range auditor.events {
+		actions[i] = event.Action
+		assert.NotContainsf(t, string(event.Before)+string(event.After), redirect.PasswordHash, "Expected password hash to stay out of the audit log, got %s", event.After)
+	}
+	expected := []internal.AuditAction{internal.AuditLinkCreate, internal.AuditLinkUpdate, internal.AuditLinkDelete}
+	assert.Equalf(t, expected, actions, "Expected actions %v, got %v", expected, actions)
+
+	update := auditor.events[1]
+	assert.Containsf(t, string(update.Before), `"title":"Old"`, "Expected old title before the update, got %s", update.Before)
+	assert.Containsf(t, string(update.After), `"title":"New"`, "Expected new title after the update, got %s", update.After)
+
+	auditor.FailMode = true
+	err = svc.RestoreShortURL(ctx, "", redirect.Short, testUser)
+	assert.Errorf(t, err, "Expected error when the audit log fails, got nil")
+}
+
+func TestUrlShortenerService_Webhooks(t *testing.T) {
+	webhooks := &webhookPublisherFake{}
+	repo := newRedirectRepoFake()
+	hasher := newHasherFake()
+	svc := NewUrlShortenerService(hasher, repo, &auditServiceFake{}, webhooks, nil)
+	svc.background = func(fn func()) { fn() }
+	ctx := context.Background()
+
+	redirect, err := svc.ShortenURL(ctx, testURL, testUser, internal.RedirectOptions{Password: "secret"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	_, err = svc.ExpandShortURL(ctx, "", redirect.Short, internal.Visit{Path: "/private", UserAgent: "curl/7.79.1"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = svc.DeleteShortURL(ctx, "", redirect.Short, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	expected := []internal.WebhookEvent{internal.EventLinkCreated, internal.EventLinkClicked, internal.EventLinkDeleted}
+	assert.Equalf(t, expected, webhooks.events, "Expected events %v, got %v", expected, webhooks.events)
+	for i, userID := range webhooks.userIDs {
+		assert.Equalf(t, testUser, userID, "Expected event %v for the owner, got %v", webhooks.events[i], userID)
+	}
+
+	payloads := string(webhooks.payloads)
+	assert.NotContainsf(t, payloads, redirect.PasswordHash, "Expected password hash to stay out of the payloads, got %s", payloads)
+	assert.NotContainsf(t, payloads, "/private", "Expected the visitor's path to stay out of the payloads, got %s", payloads)
+	assert.Containsf(t, payloads, `"user_agent":"curl/7.79.1"`, "Expected user agent in the click, got %s", payloads)
+
+	repo.redirects[redirect.Short] = internal.Redirect{Short: redirect.Short, URL: testURL, UserID: testUser, CreatedAt: time.Now()}
+	webhooks.FailMode = true
+	target, err := svc.ExpandShortURL(ctx, "", redirect.Short, internal.Visit{})
+	assert.NoErrorf(t, err, "Expected redirect despite the failing outbox, got %v", err)
+	assert.Equalf(t, testURL, target, "Expected target %s, got %s", testURL, target)
+
+	hasher.codes = []string{"other"}
+	_, err = svc.ShortenURL(ctx, testURL+"/other", testUser, internal.RedirectOptions{})
+	assert.NoErrorf(t, err, "Expected link to be created despite the failing outbox, got %v", err)
+}
+
+func TestWorkQueue(t *testing.T) {
+	queue := newWorkQueue(1, 1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	ok := queue.submit(func() { close(started); <-release })
+	assert.Truef(t, ok, "Expected work to be queued")
+	<-started
+
+	ok = queue.submit(func() { close(done) })
+	assert.Truef(t, ok, "Expected work to wait in the queue")
+
+	ok = queue.submit(func() { t.Error("Expected dropped work not to run") })
+	assert.Falsef(t, ok, "Expected work to be dropped while the queue is full")
+
+	close(release)
+	<-done
+}
+
 func setupService() (*redirectRepoFake, *UrlShortenerService) {
 	hasher := newHasherFake()
 	redirects := newRedirectRepoFake()
-	svc := NewUrlShortenerService(hasher, redirects)
+	svc := NewUrlShortenerService(hasher, redirects, &auditServiceFake{}, &webhookPublisherFake{}, []string{testDomain})
+	svc.background = func(fn func()) { fn() }
 	return redirects, &svc
 }
 
 type redirectRepoFake struct {
 	redirects map[string]internal.Redirect
+	variants  map[string]map[int]int
 	FailMode  bool
 }
 
 func newRedirectRepoFake() *redirectRepoFake {
 	return &redirectRepoFake{
 		redirects: make(map[string]internal.Redirect),
+		variants:  make(map[string]map[int]int),
 		FailMode:  false,
 	}
 }
 
-func (r redirectRepoFake) List(context.Context, string) ([]internal.Redirect, error) {
+func (r redirectRepoFake) List(_ context.Context, _ string, filter internal.RedirectFilter, order internal.RedirectSort, after *internal.RedirectCursor, limit int) ([]internal.Redirect, error) {
 	if r.FailMode {
 		return nil, errors.New("fake error")
 	}
 
 	result := make([]internal.Redirect, 0, len(r.redirects))
 	for _, redirect := range r.redirects {
+		if redirect.IsTrashed() {
+			continue
+		}
+		if filter.Tag != "" && !containsTag(redirect.Tags, filter.Tag) {
+			continue
+		}
 		result = append(result, redirect)
 	}
+
+	// mirrors the keyset ordering of the database queries
+	before := func(a internal.RedirectCursor, b internal.RedirectCursor) bool {
+		switch order {
+		case internal.SortByShort:
+			return a.Short < b.Short
+		case internal.SortByClicks:
+			return a.Clicks > b.Clicks || (a.Clicks == b.Clicks && a.Short > b.Short)
+		default:
+			return a.CreatedAt.After(b.CreatedAt) || (a.CreatedAt.Equal(b.CreatedAt) && a.Short > b.Short)
+		}
+	}
+	key := func(r internal.Redirect) internal.RedirectCursor {
+		return internal.RedirectCursor{CreatedAt: r.CreatedAt, Short: r.Short, Clicks: r.Clicks}
+	}
+	sort.Slice(result, func(i, j int) bool { return before(key(result[i]), key(result[j])) })
+
+	if after != nil {
+		start := 0
+		for start < len(result) && !before(*after, key(result[start])) {
+			start++
+		}
+		result = result[start:]
+	}
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (r redirectRepoFake) ListAll(ctx context.Context, ownerID string, _ string, after *internal.RedirectCursor, limit int) ([]internal.Redirect, error) {
+	list, err := r.List(ctx, "", internal.RedirectFilter{}, internal.SortByCreated, after, len(r.redirects))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]internal.Redirect, 0, len(list))
+	for _, redirect := range list {
+		if ownerID == "" || redirect.UserID == ownerID {
+			result = append(result, redirect)
+		}
+	}
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (r redirectRepoFake) Tags(context.Context, string) ([]string, error) {
+	if r.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	var result []string
+	for _, redirect := range r.redirects {
+		result = append(result, redirect.Tags...)
+	}
 	return result, nil
 }
 
-func (r redirectRepoFake) GetRedirectByShort(_ context.Context, short string, userID string) (internal.Redirect, error) {
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (r redirectRepoFake) Campaigns(context.Context, string) ([]internal.CampaignStats, error) {
+	if r.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	var result []internal.CampaignStats
+	for _, redirect := range r.redirects {
+		if redirect.UTMCampaign != "" {
+			result = append(result, internal.CampaignStats{Campaign: redirect.UTMCampaign, Links: 1, Clicks: redirect.Clicks})
+		}
+	}
+	return result, nil
+}
+
+func (r redirectRepoFake) GetRedirectByShort(_ context.Context, domain string, short string, userID string) (internal.Redirect, error) {
 	if r.FailMode {
 		return internal.Redirect{}, errors.New("fake error")
 	}
@@ -143,6 +922,13 @@ func (r redirectRepoFake) GetRedirectByShort(_ context.Context, short string, us
 		return internal.Redirect{}, errors.New("not found")
 	}
 
+	if redirect, ok := r.redirects[internal.LinkID(domain, short)]; ok {
+		if redirect.IsTrashed() {
+			return internal.Redirect{}, errors.New("not found")
+		}
+		return redirect, nil
+	}
+
 	result := internal.Redirect{
 		Short:     "short",
 		URL:       testURL,
@@ -152,47 +938,321 @@ func (r redirectRepoFake) GetRedirectByShort(_ context.Context, short string, us
 	return result, nil
 }
 
+func (r redirectRepoFake) Lookup(_ context.Context, domain string, short string) (internal.Redirect, error) {
+	if r.FailMode {
+		return internal.Redirect{}, errors.New("fake error")
+	}
+
+	redirect, ok := r.live(domain, short)
+	if !ok {
+		return internal.Redirect{}, errors.New("not found")
+	}
+	return redirect, nil
+}
+
+func (r redirectRepoFake) live(domain string, short string) (internal.Redirect, bool) {
+	redirect, ok := r.redirects[internal.LinkID(domain, short)]
+	return redirect, ok && !redirect.IsTrashed()
+}
+
 func (r redirectRepoFake) Save(_ context.Context, redirect internal.Redirect) error {
 	if r.FailMode {
 		return errors.New("fake error")
 	}
-	r.redirects[redirect.Short] = redirect
+	if _, ok := r.redirects[internal.LinkID(redirect.Domain, redirect.Short)]; ok {
+		return internal.ErrShortTaken
+	}
+	r.redirects[internal.LinkID(redirect.Domain, redirect.Short)] = redirect
 	return nil
 }
 
-func (r redirectRepoFake) Expand(_ context.Context, short string) (string, error) {
+func (r redirectRepoFake) Import(_ context.Context, redirects []internal.Redirect) ([]bool, error) {
 	if r.FailMode {
-		return "", errors.New("fake error")
+		return nil, errors.New("fake error")
 	}
 
-	url, ok := r.redirects[short]
+	created := make([]bool, len(redirects))
+	for i, redirect := range redirects {
+		if _, ok := r.redirects[internal.LinkID(redirect.Domain, redirect.Short)]; ok {
+			continue
+		}
+		r.redirects[internal.LinkID(redirect.Domain, redirect.Short)] = redirect
+		created[i] = true
+	}
+	return created, nil
+}
+
+func (r redirectRepoFake) UpdateDetails(_ context.Context, domain string, short string, _ string, details internal.RedirectDetails) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+
+	redirect, ok := r.redirects[internal.LinkID(domain, short)]
 	if !ok {
-		return "", errors.New("not found")
+		return errors.New("not found")
 	}
-	return url.URL, nil
+
+	redirect.Title = details.Title
+	redirect.Notes = details.Notes
+	redirect.Tags = details.Tags
+	r.redirects[internal.LinkID(domain, short)] = redirect
+	return nil
 }
 
-func (r redirectRepoFake) Delete(_ context.Context, short string, _ string) error {
+func (r redirectRepoFake) UpdateRules(_ context.Context, domain string, short string, _ string, rules []internal.TargetingRule) error {
 	if r.FailMode {
 		return errors.New("fake error")
 	}
-	if _, ok := r.redirects[short]; !ok {
+
+	redirect, ok := r.redirects[internal.LinkID(domain, short)]
+	if !ok {
 		return errors.New("not found")
 	}
-	delete(r.redirects, short)
+
+	redirect.Rules = rules
+	r.redirects[internal.LinkID(domain, short)] = redirect
 	return nil
 }
 
-type hasherFake struct{}
+func (r redirectRepoFake) UpdateTargets(_ context.Context, domain string, short string, _ string, targets []internal.WeightedTarget) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+
+	redirect, ok := r.redirects[internal.LinkID(domain, short)]
+	if !ok {
+		return errors.New("not found")
+	}
+
+	redirect.Targets = targets
+	r.redirects[internal.LinkID(domain, short)] = redirect
+	delete(r.variants, internal.LinkID(domain, short))
+	return nil
+}
+
+func (r redirectRepoFake) CountVariantClick(_ context.Context, domain string, short string, variant int) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+
+	if r.variants[internal.LinkID(domain, short)] == nil {
+		r.variants[internal.LinkID(domain, short)] = make(map[int]int)
+	}
+	r.variants[internal.LinkID(domain, short)][variant]++
+	return nil
+}
+
+func (r redirectRepoFake) VariantClicks(_ context.Context, domain string, short string) (map[int]int, error) {
+	if r.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	result := make(map[int]int)
+	for variant, clicks := range r.variants[internal.LinkID(domain, short)] {
+		result[variant] = clicks
+	}
+	return result, nil
+}
+
+func (r redirectRepoFake) Expand(_ context.Context, domain string, short string) (internal.Redirect, error) {
+	if r.FailMode {
+		return internal.Redirect{}, errors.New("fake error")
+	}
+
+	redirect, ok := r.live(domain, short)
+	if !ok {
+		return internal.Redirect{}, errors.New("not found")
+	}
+
+	if redirect.IsExhausted() {
+		return internal.Redirect{}, internal.ErrClicksExhausted
+	}
+
+	redirect.Clicks++
+	r.redirects[internal.LinkID(domain, short)] = redirect
+	return redirect, nil
+}
+
+func (r redirectRepoFake) Delete(_ context.Context, domain string, short string, _ string) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+	redirect, ok := r.live(domain, short)
+	if !ok {
+		return errors.New("not found")
+	}
+	redirect.DeletedAt = time.Now()
+	r.redirects[internal.LinkID(domain, short)] = redirect
+	return nil
+}
+
+func (r redirectRepoFake) Trash(context.Context, string) ([]internal.Redirect, error) {
+	if r.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	var result []internal.Redirect
+	for _, redirect := range r.redirects {
+		if redirect.IsTrashed() {
+			result = append(result, redirect)
+		}
+	}
+	return result, nil
+}
+
+func (r redirectRepoFake) Restore(_ context.Context, domain string, short string, _ string) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+
+	redirect, ok := r.redirects[internal.LinkID(domain, short)]
+	if !ok || !redirect.IsTrashed() {
+		return errors.New("not found")
+	}
+	redirect.DeletedAt = time.Time{}
+	r.redirects[internal.LinkID(domain, short)] = redirect
+	return nil
+}
+
+func (r redirectRepoFake) Purge(_ context.Context, domain string, short string, _ string) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+
+	redirect, ok := r.redirects[internal.LinkID(domain, short)]
+	if !ok || !redirect.IsTrashed() {
+		return errors.New("not found")
+	}
+	delete(r.redirects, internal.LinkID(domain, short))
+	return nil
+}
+
+func (r redirectRepoFake) Transfer(_ context.Context, domain string, short string, userID string) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+
+	redirect, ok := r.live(domain, short)
+	if !ok {
+		return errors.New("not found")
+	}
+	redirect.UserID = userID
+	r.redirects[internal.LinkID(domain, short)] = redirect
+	return nil
+}
+
+func (r redirectRepoFake) TransferAll(_ context.Context, fromUserID string, toUserID string) ([]string, error) {
+	if r.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	var ids []string
+	for id, redirect := range r.redirects {
+		if redirect.UserID != fromUserID || redirect.IsTrashed() {
+			continue
+		}
+		redirect.UserID = toUserID
+		r.redirects[id] = redirect
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r redirectRepoFake) Remove(_ context.Context, domain string, short string) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+
+	if _, ok := r.redirects[internal.LinkID(domain, short)]; !ok {
+		return errors.New("not found")
+	}
+	delete(r.redirects, internal.LinkID(domain, short))
+	return nil
+}
+
+func (r redirectRepoFake) PurgeTrashedBefore(_ context.Context, before time.Time) (int, error) {
+	if r.FailMode {
+		return 0, errors.New("fake error")
+	}
+
+	purged := 0
+	for id, redirect := range r.redirects {
+		if redirect.IsTrashed() && redirect.DeletedAt.Before(before) {
+			delete(r.redirects, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// hasherFake hands out the queued codes first and "short" afterwards.
+type hasherFake struct {
+	codes    []string
+	FailMode bool
+}
 
 func newHasherFake() *hasherFake {
 	return &hasherFake{}
 }
 
-func (h hasherFake) Hash(string, string) string {
-	return "short"
+func (h *hasherFake) Hash(context.Context, string, string) (string, error) {
+	if h.FailMode {
+		return "", errors.New("fake error")
+	}
+
+	if len(h.codes) > 0 {
+		code := h.codes[0]
+		h.codes = h.codes[1:]
+		return code, nil
+	}
+	return "short", nil
 }
 
 func (h hasherFake) Validate(short string) bool {
-	return short == "short"
+	return short != "broken"
+}
+
+type auditServiceFake struct {
+	events   []internal.AuditEvent
+	FailMode bool
+}
+
+func (a *auditServiceFake) Record(_ context.Context, action internal.AuditAction, targetType string, targetID string, before any, after any) error {
+	if a.FailMode {
+		return errors.New("fake error")
+	}
+
+	event := internal.AuditEvent{Action: action, TargetType: targetType, TargetID: targetID}
+	event.Before, _ = json.Marshal(before)
+	event.After, _ = json.Marshal(after)
+	a.events = append(a.events, event)
+	return nil
+}
+
+func (a *auditServiceFake) List(context.Context, internal.AuditFilter) ([]internal.AuditEvent, error) {
+	return a.events, nil
+}
+
+// webhookPublisherFake may be called from the goroutines announcing clicks.
+type webhookPublisherFake struct {
+	mu       sync.Mutex
+	events   []internal.WebhookEvent
+	userIDs  []string
+	payloads []byte
+	FailMode bool
+}
+
+func (w *webhookPublisherFake) Publish(_ context.Context, userID string, event internal.WebhookEvent, data any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.FailMode {
+		return errors.New("fake error")
+	}
+
+	w.events = append(w.events, event)
+	w.userIDs = append(w.userIDs, userID)
+	encoded, _ := json.Marshal(data)
+	w.payloads = append(w.payloads, encoded...)
+	return nil
 }
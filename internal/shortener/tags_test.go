@@ -0,0 +1,39 @@
+package shortener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tt := []struct {
+		name     string
+		tags     []string
+		expected []string
+		valid    bool
+	}{
+		{"no tags", nil, []string{}, true},
+		{"trimmed and lower-cased", []string{" Marketing ", "Q3"}, []string{"marketing", "q3"}, true},
+		{"empty and duplicate tags dropped", []string{"docs", "", "DOCS", "  "}, []string{"docs"}, true},
+		{"too long", []string{strings.Repeat("x", maxTagLength+1)}, nil, false},
+		{"comma", []string{"a,b"}, nil, false},
+	}
+
+	for _, c := range tt {
+		result, err := normalizeTags(c.tags)
+		if !c.valid {
+			assert.Errorf(t, err, "%s: expected error, got nil", c.name)
+			continue
+		}
+		assert.NoErrorf(t, err, "%s: expected no error, got %v", c.name, err)
+		assert.Equalf(t, c.expected, result, "%s: expected %v, got %v", c.name, c.expected, result)
+	}
+
+	many := make([]string, maxTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	_, err := normalizeTags(many)
+	assert.Errorf(t, err, "Expected error for too many tags, got nil")
+}
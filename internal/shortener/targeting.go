@@ -0,0 +1,128 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/useragent"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var operatingSystems = map[string]bool{
+	"ios":     true,
+	"android": true,
+	"windows": true,
+	"macos":   true,
+	"linux":   true,
+}
+
+// resolveTarget returns the URL of the first rule matching the visit.
+func resolveTarget(rules []internal.TargetingRule, visit internal.Visit) (string, bool) {
+	platform := useragent.OS(visit.UserAgent)
+	language := preferredLanguage(visit.AcceptLanguage)
+
+	for _, rule := range rules {
+		if matchesRule(rule, visit, platform, language) {
+			return rule.URL, true
+		}
+	}
+	return "", false
+}
+
+func matchesRule(rule internal.TargetingRule, visit internal.Visit, platform string, language string) bool {
+	switch rule.Kind {
+	case internal.RuleOS:
+		return platform != "" && strings.EqualFold(rule.Value, platform)
+	case internal.RuleLanguage:
+		value := strings.ToLower(rule.Value)
+		return language != "" && (language == value || strings.HasPrefix(language, value+"-"))
+	case internal.RuleQuery:
+		values, ok := visit.Query[rule.Key]
+		if !ok {
+			return false
+		}
+		if rule.Value == "" {
+			return true
+		}
+		for _, v := range values {
+			if v == rule.Value {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// preferredLanguage returns the lower-cased language tag with the highest quality of an Accept-Language header.
+func preferredLanguage(header string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if quality > 0 {
+			languages = append(languages, language{tag: tag, quality: quality})
+		}
+	}
+
+	if len(languages) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+func validateRule(rule internal.TargetingRule) error {
+	switch rule.Kind {
+	case internal.RuleOS:
+		if !operatingSystems[strings.ToLower(rule.Value)] {
+			return fmt.Errorf("unknown operating system %q", rule.Value)
+		}
+	case internal.RuleLanguage:
+		if rule.Value == "" {
+			return errors.New("language rules need a language")
+		}
+	case internal.RuleQuery:
+		if rule.Key == "" {
+			return errors.New("query rules need a parameter name")
+		}
+	default:
+		return fmt.Errorf("unknown rule kind %q", rule.Kind)
+	}
+
+	return validateTargetURL(rule.URL)
+}
+
+func validateTargetURL(rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid target url %q", rawURL)
+	}
+	return nil
+}
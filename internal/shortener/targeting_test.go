@@ -0,0 +1,92 @@
+package shortener
+
+import (
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 15_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.5 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 12; Pixel 6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/103.0.0.0 Mobile Safari/537.36"
+	windowsUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/103.0.0.0 Safari/537.36"
+	macUA     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.5 Safari/605.1.15"
+	linuxUA   = "Mozilla/5.0 (X11; Linux x86_64; rv:102.0) Gecko/20100101 Firefox/102.0"
+)
+
+func TestPreferredLanguage(t *testing.T) {
+	tt := []struct {
+		header   string
+		expected string
+	}{
+		{"de-DE,de;q=0.9,en;q=0.8", "de-de"},
+		{"en;q=0.5, fr;q=0.9", "fr"},
+		{"*, es;q=0.7", "es"},
+		{"de;q=0, en", "en"},
+		{"EN-us", "en-us"},
+		{"", ""},
+	}
+
+	for _, c := range tt {
+		result := preferredLanguage(c.header)
+		assert.Equalf(t, c.expected, result, "language of '%s' should be '%s', but is '%s'", c.header, c.expected, result)
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	const fallback = "https://example.com/docs/"
+
+	rules := []internal.TargetingRule{
+		{Kind: internal.RuleQuery, Key: "store", Value: "", URL: "https://example.com/store"},
+		{Kind: internal.RuleOS, Value: "ios", URL: "https://apps.apple.com/app"},
+		{Kind: internal.RuleOS, Value: "android", URL: "https://play.google.com/store/apps"},
+		{Kind: internal.RuleLanguage, Value: "de", URL: "https://example.com/de/"},
+		{Kind: internal.RuleQuery, Key: "lang", Value: "fr", URL: "https://example.com/fr/"},
+	}
+
+	tt := []struct {
+		name     string
+		visit    internal.Visit
+		expected string
+	}{
+		{"no match uses fallback", internal.Visit{UserAgent: windowsUA, AcceptLanguage: "en-US"}, fallback},
+		{"ios", internal.Visit{UserAgent: iPhoneUA, AcceptLanguage: "de-DE"}, "https://apps.apple.com/app"},
+		{"android", internal.Visit{UserAgent: androidUA}, "https://play.google.com/store/apps"},
+		{"german browser", internal.Visit{UserAgent: macUA, AcceptLanguage: "de-AT,en;q=0.5"}, "https://example.com/de/"},
+		{"german as secondary language", internal.Visit{UserAgent: macUA, AcceptLanguage: "en-US,de;q=0.5"}, fallback},
+		{"query value", internal.Visit{UserAgent: linuxUA, Query: url.Values{"lang": {"fr"}}}, "https://example.com/fr/"},
+		{"query value mismatch", internal.Visit{UserAgent: linuxUA, Query: url.Values{"lang": {"it"}}}, fallback},
+		{"query presence wins by order", internal.Visit{UserAgent: iPhoneUA, Query: url.Values{"store": {""}}}, "https://example.com/store"},
+	}
+
+	for _, c := range tt {
+		result, ok := resolveTarget(rules, c.visit)
+		if !ok {
+			result = fallback
+		}
+		assert.Equalf(t, c.expected, result, "%s: expected %s, got %s", c.name, c.expected, result)
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	tt := []struct {
+		rule  internal.TargetingRule
+		valid bool
+	}{
+		{internal.TargetingRule{Kind: internal.RuleOS, Value: "iOS", URL: "https://apps.apple.com"}, true},
+		{internal.TargetingRule{Kind: internal.RuleOS, Value: "beos", URL: "https://example.com"}, false},
+		{internal.TargetingRule{Kind: internal.RuleLanguage, Value: "de", URL: "https://example.com/de"}, true},
+		{internal.TargetingRule{Kind: internal.RuleLanguage, Value: "", URL: "https://example.com/de"}, false},
+		{internal.TargetingRule{Kind: internal.RuleQuery, Key: "ref", URL: "https://example.com"}, true},
+		{internal.TargetingRule{Kind: internal.RuleQuery, Value: "x", URL: "https://example.com"}, false},
+		{internal.TargetingRule{Kind: "planet", Value: "mars", URL: "https://example.com"}, false},
+		{internal.TargetingRule{Kind: internal.RuleOS, Value: "linux", URL: "javascript:alert(1)"}, false},
+		{internal.TargetingRule{Kind: internal.RuleOS, Value: "linux", URL: "/relative"}, false},
+	}
+
+	for _, c := range tt {
+		err := validateRule(c.rule)
+		assert.Equalf(t, c.valid, err == nil, "validation of %+v should be %t, got error %v", c.rule, c.valid, err)
+	}
+}
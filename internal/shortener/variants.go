@@ -0,0 +1,70 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pscheid92/dwarferl/internal"
+	"hash/fnv"
+	"math/rand"
+)
+
+// chooseVariant picks a target index in proportion to the weights. Visitors with
+// an ID always get the same variant, anonymous ones are assigned randomly.
+func chooseVariant(targets []internal.WeightedTarget, short string, visitorID string) int {
+	total := 0
+	for _, t := range targets {
+		total += t.Weight
+	}
+
+	var point int
+	if visitorID == "" {
+		point = rand.Intn(total)
+	} else {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(short))
+		_, _ = hash.Write([]byte(visitorID))
+		point = int(hash.Sum64() % uint64(total))
+	}
+
+	for i, t := range targets {
+		if point < t.Weight {
+			return i
+		}
+		point -= t.Weight
+	}
+	return len(targets) - 1
+}
+
+func validateTargets(targets []internal.WeightedTarget) error {
+	total := 0
+	for i, t := range targets {
+		if t.Weight < 0 {
+			return fmt.Errorf("target %d: weight must not be negative", i+1)
+		}
+		if err := validateTargetURL(t.URL); err != nil {
+			return fmt.Errorf("target %d: %w", i+1, err)
+		}
+		total += t.Weight
+	}
+
+	if len(targets) > 0 && total == 0 {
+		return errors.New("at least one target needs a positive weight")
+	}
+	return nil
+}
+
+func variantStats(targets []internal.WeightedTarget, clicks map[int]int) []internal.VariantStats {
+	total := 0
+	for _, c := range clicks {
+		total += c
+	}
+
+	stats := make([]internal.VariantStats, len(targets))
+	for i, t := range targets {
+		stats[i] = internal.VariantStats{WeightedTarget: t, Clicks: clicks[i]}
+		if total > 0 {
+			stats[i].Share = float64(clicks[i]) / float64(total) * 100
+		}
+	}
+	return stats
+}
@@ -0,0 +1,47 @@
+package shortener
+
+import (
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChooseVariant(t *testing.T) {
+	targets := []internal.WeightedTarget{
+		{URL: "https://a.example.com", Weight: 3},
+		{URL: "https://b.example.com", Weight: 0},
+		{URL: "https://c.example.com", Weight: 1},
+	}
+
+	counts := make(map[int]int)
+	for i := 0; i < 4000; i++ {
+		visitor := string(rune('a'+i%26)) + string(rune('a'+i/26%26)) + string(rune('a'+i/676))
+		variant := chooseVariant(targets, "short", visitor)
+		assert.Equalf(t, variant, chooseVariant(targets, "short", visitor), "Expected sticky variant for %s", visitor)
+		counts[variant]++
+	}
+
+	assert.Equalf(t, 0, counts[1], "Expected zero-weight variant never chosen, got %d", counts[1])
+	assert.InDeltaf(t, 3000, counts[0], 300, "Expected about 3000 visitors on first variant, got %d", counts[0])
+	assert.InDeltaf(t, 1000, counts[2], 300, "Expected about 1000 visitors on third variant, got %d", counts[2])
+}
+
+func TestValidateTargets(t *testing.T) {
+	tt := []struct {
+		name    string
+		targets []internal.WeightedTarget
+		valid   bool
+	}{
+		{"no targets", nil, true},
+		{"single target", []internal.WeightedTarget{{URL: "https://a.example.com", Weight: 1}}, true},
+		{"paused target", []internal.WeightedTarget{{URL: "https://a.example.com", Weight: 1}, {URL: "https://b.example.com", Weight: 0}}, true},
+		{"negative weight", []internal.WeightedTarget{{URL: "https://a.example.com", Weight: -1}}, false},
+		{"zero total", []internal.WeightedTarget{{URL: "https://a.example.com", Weight: 0}}, false},
+		{"relative url", []internal.WeightedTarget{{URL: "/relative", Weight: 1}}, false},
+	}
+
+	for _, c := range tt {
+		err := validateTargets(c.targets)
+		assert.Equalf(t, c.valid, err == nil, "%s: expected valid=%v, got error %v", c.name, c.valid, err)
+	}
+}
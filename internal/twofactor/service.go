@@ -0,0 +1,208 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+type Service struct {
+	repository internal.TwoFactorRepository
+	audit      internal.AuditService
+	issuer     string
+	now        func() time.Time
+}
+
+// NewService creates the two-factor service. The issuer names the account in authenticator apps.
+func NewService(repository internal.TwoFactorRepository, audit internal.AuditService, issuer string) *Service {
+	return &Service{
+		repository: repository,
+		audit:      audit,
+		issuer:     issuer,
+		now:        time.Now,
+	}
+}
+
+func (s *Service) Status(ctx context.Context, userID string) (internal.TwoFactorStatus, error) {
+	twoFactor, err := s.repository.Get(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !twoFactor.Enabled) {
+		return internal.TwoFactorStatus{}, nil
+	}
+	if err != nil {
+		return internal.TwoFactorStatus{}, err
+	}
+
+	count, err := s.repository.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		return internal.TwoFactorStatus{}, err
+	}
+	return internal.TwoFactorStatus{Enabled: true, RecoveryCodes: count}, nil
+}
+
+// Enroll creates a secret, which is pending until enabled with a first code. Enrolling again
+// returns the pending secret, so a reloaded page keeps working with an app set up already.
+func (s *Service) Enroll(ctx context.Context, user internal.User) (internal.TwoFactorEnrollment, error) {
+	twoFactor, err := s.repository.Get(ctx, user.ID)
+	switch {
+	case err == nil && twoFactor.Enabled:
+		return internal.TwoFactorEnrollment{}, internal.ErrTwoFactorOn
+	case errors.Is(err, pgx.ErrNoRows):
+		secret, err := generateSecret()
+		if err != nil {
+			return internal.TwoFactorEnrollment{}, err
+		}
+
+		twoFactor = internal.TwoFactor{UserID: user.ID, Secret: secret, CreatedAt: s.now()}
+		if err := s.repository.Save(ctx, twoFactor); err != nil {
+			return internal.TwoFactorEnrollment{}, err
+		}
+	case err != nil:
+		return internal.TwoFactorEnrollment{}, err
+	}
+
+	enrollment := internal.TwoFactorEnrollment{
+		Secret: twoFactor.Secret,
+		URI:    provisioningURI(s.issuer, user.Email, twoFactor.Secret),
+	}
+	return enrollment, nil
+}
+
+// Enable turns on the pending secret and returns the recovery codes. They are only stored
+// as hashes, so this is the only time they can be shown.
+func (s *Service) Enable(ctx context.Context, userID string, code string) ([]string, error) {
+	twoFactor, err := s.repository.Get(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, internal.ErrTwoFactorOff
+	}
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled {
+		return nil, internal.ErrTwoFactorOn
+	}
+
+	counter, ok := matchCode(twoFactor.Secret, normalizeCode(code), s.now())
+	if !ok {
+		return nil, internal.ErrInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repository.Enable(ctx, userID, counter, hashes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, internal.ErrTwoFactorOn
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.audit.Record(ctx, internal.AuditUserTwoFA, internal.AuditTargetUser, userID, statusSnapshot(false), statusSnapshot(true)); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify accepts every code once. Recovery codes are used up, TOTP codes are refused
+// for their period and all before.
+func (s *Service) Verify(ctx context.Context, userID string, code string) error {
+	twoFactor, err := s.repository.Get(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !twoFactor.Enabled) {
+		return internal.ErrTwoFactorOff
+	}
+	if err != nil {
+		return err
+	}
+
+	code = normalizeCode(code)
+	if counter, ok := matchCode(twoFactor.Secret, code, s.now()); ok {
+		err = s.repository.UseCounter(ctx, userID, counter)
+	} else {
+		err = s.repository.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return internal.ErrInvalidCode
+	}
+	return err
+}
+
+func (s *Service) Disable(ctx context.Context, userID string, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	if err := s.repository.Delete(ctx, userID); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, internal.AuditUserTwoFA, internal.AuditTargetUser, userID, statusSnapshot(true), statusSnapshot(false))
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, the old ones stop working.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID string, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit.Record(ctx, internal.AuditUserRecovery, internal.AuditTargetUser, userID, nil, nil); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func statusSnapshot(enabled bool) map[string]bool {
+	return map[string]bool{"enabled": enabled}
+}
+
+// newRecoveryCodes returns the codes to show, formatted like abcde-fghij, and their hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	raw := make([]byte, recoveryCodeLength*5/8)
+	for i := range codes {
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryEncoding.EncodeToString(raw)
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode ignores the spaces and dashes that make codes easier to read.
+func normalizeCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	return strings.ToLower(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,209 @@
+package twofactor
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var testUser = internal.User{ID: "user", Email: "user@example.com", Role: internal.RoleAdmin}
+
+func TestService_Enroll(t *testing.T) {
+	sut, repo := setupService()
+
+	enrollment, err := sut.Enroll(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Containsf(t, enrollment.URI, "secret="+enrollment.Secret, "Expected secret in URI, got %v", enrollment.URI)
+	assert.Falsef(t, repo.entries[testUser.ID].Enabled, "Expected pending secret")
+
+	again, err := sut.Enroll(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, enrollment.Secret, again.Secret, "Expected pending secret to be reused, got %v", again.Secret)
+
+	status, err := sut.Status(context.Background(), testUser.ID)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Falsef(t, status.Enabled, "Expected pending secret not to count as enabled")
+}
+
+func TestService_Enable(t *testing.T) {
+	sut, repo := setupService()
+
+	_, err := sut.Enable(context.Background(), testUser.ID, "123456")
+	assert.ErrorIsf(t, err, internal.ErrTwoFactorOff, "Expected %v, got %v", internal.ErrTwoFactorOff, err)
+
+	repo.entries[testUser.ID] = internal.TwoFactor{UserID: testUser.ID, Secret: rfcSecret}
+
+	_, err = sut.Enable(context.Background(), testUser.ID, "000000")
+	assert.ErrorIsf(t, err, internal.ErrInvalidCode, "Expected %v, got %v", internal.ErrInvalidCode, err)
+
+	codes, err := sut.Enable(context.Background(), testUser.ID, "050 471")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, codes, recoveryCodeCount, "Expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	assert.Regexpf(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0], "Expected formatted recovery code, got %v", codes[0])
+	assert.NotContainsf(t, repo.codes[testUser.ID], codes[0], "Expected recovery codes to be stored hashed")
+
+	status, err := sut.Status(context.Background(), testUser.ID)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, internal.TwoFactorStatus{Enabled: true, RecoveryCodes: recoveryCodeCount}, status, "Expected enabled status, got %v", status)
+
+	_, err = sut.Enroll(context.Background(), testUser)
+	assert.ErrorIsf(t, err, internal.ErrTwoFactorOn, "Expected %v, got %v", internal.ErrTwoFactorOn, err)
+}
+
+func TestService_Verify(t *testing.T) {
+	sut, repo := setupService()
+	repo.entries[testUser.ID] = internal.TwoFactor{UserID: testUser.ID, Secret: rfcSecret}
+	codes, err := sut.Enable(context.Background(), testUser.ID, "050471")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	t.Run("used codes are refused", func(t *testing.T) {
+		err := sut.Verify(context.Background(), testUser.ID, "050471")
+		assert.ErrorIsf(t, err, internal.ErrInvalidCode, "Expected %v, got %v", internal.ErrInvalidCode, err)
+	})
+
+	t.Run("code of the next period works once", func(t *testing.T) {
+		sut.now = func() time.Time { return time.Unix(1111111111+period, 0) }
+		code := hotp([]byte("12345678901234567890"), uint64(counterAt(sut.now())), codeDigits)
+
+		err := sut.Verify(context.Background(), testUser.ID, code)
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+		err = sut.Verify(context.Background(), testUser.ID, code)
+		assert.ErrorIsf(t, err, internal.ErrInvalidCode, "Expected %v, got %v", internal.ErrInvalidCode, err)
+	})
+
+	t.Run("recovery codes work once", func(t *testing.T) {
+		err := sut.Verify(context.Background(), testUser.ID, " "+codes[0][:5]+codes[0][6:])
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+		err = sut.Verify(context.Background(), testUser.ID, codes[0])
+		assert.ErrorIsf(t, err, internal.ErrInvalidCode, "Expected %v, got %v", internal.ErrInvalidCode, err)
+	})
+
+	t.Run("users without two-factor authentication", func(t *testing.T) {
+		err := sut.Verify(context.Background(), "someone", "050471")
+		assert.ErrorIsf(t, err, internal.ErrTwoFactorOff, "Expected %v, got %v", internal.ErrTwoFactorOff, err)
+	})
+}
+
+func TestService_RegenerateRecoveryCodes(t *testing.T) {
+	sut, repo := setupService()
+	repo.entries[testUser.ID] = internal.TwoFactor{UserID: testUser.ID, Secret: rfcSecret}
+	old, err := sut.Enable(context.Background(), testUser.ID, "050471")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	codes, err := sut.RegenerateRecoveryCodes(context.Background(), testUser.ID, old[0])
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, codes, recoveryCodeCount, "Expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+
+	err = sut.Verify(context.Background(), testUser.ID, old[1])
+	assert.ErrorIsf(t, err, internal.ErrInvalidCode, "Expected old recovery codes to stop working, got %v", err)
+}
+
+func TestService_Disable(t *testing.T) {
+	sut, repo := setupService()
+	repo.entries[testUser.ID] = internal.TwoFactor{UserID: testUser.ID, Secret: rfcSecret}
+	codes, err := sut.Enable(context.Background(), testUser.ID, "050471")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.Disable(context.Background(), testUser.ID, "wrong")
+	assert.ErrorIsf(t, err, internal.ErrInvalidCode, "Expected %v, got %v", internal.ErrInvalidCode, err)
+
+	err = sut.Disable(context.Background(), testUser.ID, codes[0])
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Emptyf(t, repo.entries, "Expected secret to be deleted, got %v", repo.entries)
+	assert.Emptyf(t, repo.codes, "Expected recovery codes to be deleted, got %v", repo.codes)
+}
+
+func setupService() (*Service, *twoFactorRepositoryFake) {
+	repo := &twoFactorRepositoryFake{
+		entries: make(map[string]internal.TwoFactor),
+		codes:   make(map[string]map[string]bool),
+	}
+
+	sut := NewService(repo, auditServiceFake{}, "dwarferl")
+	sut.now = func() time.Time { return time.Unix(1111111111, 0) }
+	return sut, repo
+}
+
+type twoFactorRepositoryFake struct {
+	entries map[string]internal.TwoFactor
+	codes   map[string]map[string]bool
+}
+
+func (r *twoFactorRepositoryFake) Get(_ context.Context, userID string) (internal.TwoFactor, error) {
+	twoFactor, ok := r.entries[userID]
+	if !ok {
+		return internal.TwoFactor{}, pgx.ErrNoRows
+	}
+	return twoFactor, nil
+}
+
+func (r *twoFactorRepositoryFake) Save(_ context.Context, twoFactor internal.TwoFactor) error {
+	if !r.entries[twoFactor.UserID].Enabled {
+		r.entries[twoFactor.UserID] = twoFactor
+	}
+	return nil
+}
+
+func (r *twoFactorRepositoryFake) Enable(ctx context.Context, userID string, counter int64, recoveryCodes []string) error {
+	twoFactor, ok := r.entries[userID]
+	if !ok || twoFactor.Enabled {
+		return pgx.ErrNoRows
+	}
+
+	twoFactor.Enabled = true
+	twoFactor.LastCounter = counter
+	r.entries[userID] = twoFactor
+	return r.ReplaceRecoveryCodes(ctx, userID, recoveryCodes)
+}
+
+func (r *twoFactorRepositoryFake) UseCounter(_ context.Context, userID string, counter int64) error {
+	twoFactor, ok := r.entries[userID]
+	if !ok || !twoFactor.Enabled || twoFactor.LastCounter >= counter {
+		return pgx.ErrNoRows
+	}
+
+	twoFactor.LastCounter = counter
+	r.entries[userID] = twoFactor
+	return nil
+}
+
+func (r *twoFactorRepositoryFake) ReplaceRecoveryCodes(_ context.Context, userID string, recoveryCodes []string) error {
+	r.codes[userID] = make(map[string]bool)
+	for _, code := range recoveryCodes {
+		r.codes[userID][code] = true
+	}
+	return nil
+}
+
+func (r *twoFactorRepositoryFake) UseRecoveryCode(_ context.Context, userID string, recoveryCode string) error {
+	if !r.codes[userID][recoveryCode] {
+		return pgx.ErrNoRows
+	}
+	delete(r.codes[userID], recoveryCode)
+	return nil
+}
+
+func (r *twoFactorRepositoryFake) CountRecoveryCodes(_ context.Context, userID string) (int, error) {
+	return len(r.codes[userID]), nil
+}
+
+func (r *twoFactorRepositoryFake) Delete(_ context.Context, userID string) error {
+	delete(r.entries, userID)
+	delete(r.codes, userID)
+	return nil
+}
+
+type auditServiceFake struct{}
+
+func (a auditServiceFake) Record(context.Context, internal.AuditAction, string, string, any, any) error {
+	return nil
+}
+
+func (a auditServiceFake) List(context.Context, internal.AuditFilter) ([]internal.AuditEvent, error) {
+	return nil, nil
+}
@@ -0,0 +1,87 @@
+package twofactor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// TOTP as in RFC 6238 with the parameters every authenticator app understands.
+const (
+	secretLength = 20
+	codeDigits   = 6
+	period       = 30
+
+	// codes of the previous and the next period are accepted as well, clocks drift
+	skew = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateSecret() (string, error) {
+	key := make([]byte, secretLength)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(key), nil
+}
+
+// hotp computes the code for a counter as in RFC 4226.
+func hotp(key []byte, counter uint64, digits int) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
+
+func counterAt(t time.Time) int64 {
+	return t.Unix() / period
+}
+
+// matchCode checks the code against the periods around now and returns the counter of the
+// matching one, so the code can be marked as used.
+func matchCode(secret string, code string, now time.Time) (int64, bool) {
+	key, err := secretEncoding.DecodeString(secret)
+	if err != nil || len(code) != codeDigits {
+		return 0, false
+	}
+
+	current := counterAt(now)
+	for counter := current - skew; counter <= current+skew; counter++ {
+		expected := hotp(key, uint64(counter), codeDigits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// provisioningURI builds the otpauth URI that authenticator apps scan to add an account.
+func provisioningURI(issuer string, account string, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(codeDigits)},
+		"period":    {strconv.Itoa(period)},
+	}
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + query.Encode()
+}
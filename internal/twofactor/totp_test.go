@@ -0,0 +1,69 @@
+package twofactor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the test vectors in RFC 6238, appendix B.
+var rfcSecret = secretEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTP_RFC6238(t *testing.T) {
+	vectors := []struct {
+		time int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	key := []byte("12345678901234567890")
+	for _, v := range vectors {
+		code := hotp(key, uint64(counterAt(time.Unix(v.time, 0))), 8)
+		assert.Equalf(t, v.code, code, "Expected %v at %d, got %v", v.code, v.time, code)
+	}
+}
+
+func TestMatchCode(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := counterAt(now)
+
+	// the last six digits of the eight digit vector
+	got, ok := matchCode(rfcSecret, "050471", now)
+	assert.Truef(t, ok, "Expected code to match")
+	assert.Equalf(t, counter, got, "Expected counter %d, got %d", counter, got)
+
+	_, ok = matchCode(rfcSecret, "050471", now.Add(period*time.Second))
+	assert.Truef(t, ok, "Expected code of the previous period to match")
+
+	_, ok = matchCode(rfcSecret, "050471", now.Add(3*period*time.Second))
+	assert.Falsef(t, ok, "Expected outdated code not to match")
+
+	_, ok = matchCode(rfcSecret, "050472", now)
+	assert.Falsef(t, ok, "Expected wrong code not to match")
+
+	_, ok = matchCode("not base32!", "050471", now)
+	assert.Falsef(t, ok, "Expected invalid secret not to match")
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := generateSecret()
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	key, err := secretEncoding.DecodeString(secret)
+	assert.NoErrorf(t, err, "Expected base32 secret, got %v", err)
+	assert.Lenf(t, key, secretLength, "Expected %d bytes, got %d", secretLength, len(key))
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := provisioningURI("dwarferl", "user@example.com", "SECRET")
+	assert.Truef(t, strings.HasPrefix(uri, "otpauth://totp/dwarferl:user@example.com?"), "Expected otpauth label, got %v", uri)
+	assert.Containsf(t, uri, "secret=SECRET", "Expected secret, got %v", uri)
+	assert.Containsf(t, uri, "issuer=dwarferl", "Expected issuer, got %v", uri)
+}
@@ -0,0 +1,25 @@
+package useragent
+
+import "strings"
+
+// OS derives a coarse operating system name from a user agent: ios, android, windows, macos
+// or linux. It is empty for anything else.
+func OS(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	// the order matters: iOS user agents claim to be "like Mac OS X" and Android ones contain "Linux"
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return "ios"
+	case strings.Contains(ua, "android"):
+		return "android"
+	case strings.Contains(ua, "windows"):
+		return "windows"
+	case strings.Contains(ua, "mac os x"), strings.Contains(ua, "macintosh"):
+		return "macos"
+	case strings.Contains(ua, "linux"):
+		return "linux"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,94 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Allowlist limits who can sign up, by the domain of the email or the whole address.
+// An empty allowlist lets everyone sign up.
+type Allowlist struct {
+	Domains []string
+	Emails  []string
+}
+
+func (a Allowlist) Allows(email string) bool {
+	if len(a.Domains) == 0 && len(a.Emails) == 0 {
+		return true
+	}
+
+	email = normalizeEmail(email)
+	for _, allowed := range a.Emails {
+		if normalizeEmail(allowed) == email {
+			return true
+		}
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range a.Domains {
+		if strings.TrimPrefix(normalizeEmail(allowed), "@") == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) Invitations(ctx context.Context) ([]internal.Invitation, error) {
+	return s.invitations.List(ctx)
+}
+
+// Invite lets the email sign up for two weeks. Inviting it again renews the invitation.
+func (s *Service) Invite(ctx context.Context, email string) (internal.Invitation, error) {
+	email = normalizeEmail(email)
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return internal.Invitation{}, internal.ErrEmailInvalid
+	}
+
+	_, err := s.repository.GetByEmail(ctx, email)
+	if err == nil {
+		return internal.Invitation{}, internal.ErrEmailInUse
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return internal.Invitation{}, err
+	}
+
+	now := time.Now()
+	invitation := internal.Invitation{
+		ID:        uuid.New().String(),
+		Email:     email,
+		InvitedBy: audit.Actor(ctx),
+		CreatedAt: now,
+		ExpiresAt: now.Add(invitationLifetime),
+	}
+	if err := s.invitations.Save(ctx, invitation); err != nil {
+		return internal.Invitation{}, err
+	}
+
+	after := map[string]string{"email": invitation.Email}
+	if err := s.audit.Record(ctx, internal.AuditInviteCreate, internal.AuditTargetInvite, invitation.ID, nil, after); err != nil {
+		return internal.Invitation{}, err
+	}
+	return invitation, nil
+}
+
+func (s *Service) RevokeInvitation(ctx context.Context, id string) error {
+	if err := s.invitations.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, internal.AuditInviteRevoke, internal.AuditTargetInvite, id, nil, nil)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
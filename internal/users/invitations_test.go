@@ -0,0 +1,140 @@
+package users
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const testInviter = "11111111-1111-1111-1111-111111111111"
+
+func TestAllowlist_Allows(t *testing.T) {
+	allowlist := Allowlist{Domains: []string{"Example.com", "@corp.example"}, Emails: []string{"Friend@Partner.org"}}
+
+	tests := []struct {
+		email   string
+		allowed bool
+	}{
+		{"someone@example.com", true},
+		{"Someone@EXAMPLE.com", true},
+		{"someone@corp.example", true},
+		{"friend@partner.org", true},
+		{"someone@sub.example.com", false},
+		{"someone@example.com.evil.org", false},
+		{"stranger@partner.org", false},
+		{"no-at-sign", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equalf(t, tt.allowed, allowlist.Allows(tt.email), "Expected %v to be allowed: %v", tt.email, tt.allowed)
+	}
+
+	assert.Truef(t, Allowlist{}.Allows("anyone@anywhere.org"), "Expected empty allowlist to allow everyone")
+}
+
+func TestService_SignIn_Allowlist(t *testing.T) {
+	invitations := newInvitationsRepositoryFake()
+	allowlist := Allowlist{Domains: []string{"example.com"}}
+	sut := NewService(newUsersRepositoryFake(), newIdentitiesRepositoryFake(), invitations, &auditServiceFake{}, []string{"boss@partner.org"}, allowlist)
+
+	_, err := sut.SignIn(context.Background(), googleIdentity("member", "member@example.com"))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	_, err = sut.SignIn(context.Background(), googleIdentity("stranger", "stranger@partner.org"))
+	assert.ErrorIsf(t, err, internal.ErrNotInvited, "Expected %v, got %v", internal.ErrNotInvited, err)
+
+	_, err = sut.SignIn(context.Background(), googleIdentity("boss", "boss@partner.org"))
+	assert.NoErrorf(t, err, "Expected admin emails to be allowed, got %v", err)
+
+	// existing users keep signing in
+	_, err = sut.SignIn(context.Background(), googleIdentity(testGoogleID, testEmail))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+}
+
+func TestService_Invite(t *testing.T) {
+	invitations := newInvitationsRepositoryFake()
+	auditor := &auditServiceFake{}
+	sut := NewService(newUsersRepositoryFake(), newIdentitiesRepositoryFake(), invitations, auditor, nil, Allowlist{Domains: []string{"example.com"}})
+	ctx := audit.WithActor(context.Background(), testInviter)
+
+	invitation, err := sut.Invite(ctx, " Guest@Partner.org ")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, "guest@partner.org", invitation.Email, "Expected normalized email, got %v", invitation.Email)
+	assert.Equalf(t, testInviter, invitation.InvitedBy, "Expected inviter %v, got %v", testInviter, invitation.InvitedBy)
+	assert.Equalf(t, internal.AuditInviteCreate, auditor.events[0].Action, "Expected invite event, got %v", auditor.events[0].Action)
+
+	_, err = sut.Invite(ctx, testEmail)
+	assert.ErrorIsf(t, err, internal.ErrEmailInUse, "Expected %v, got %v", internal.ErrEmailInUse, err)
+
+	_, err = sut.Invite(ctx, "Guest <guest@partner.org>")
+	assert.ErrorIsf(t, err, internal.ErrEmailInvalid, "Expected %v, got %v", internal.ErrEmailInvalid, err)
+
+	user, err := sut.SignIn(context.Background(), googleIdentity("guest", "guest@partner.org"))
+	assert.NoErrorf(t, err, "Expected invited email to sign up, got %v", err)
+	assert.NotEmptyf(t, user.ID, "Expected user ID to be set")
+	assert.Emptyf(t, invitations.invitations, "Expected invitation to be used up, got %v", invitations.invitations)
+
+	_, err = sut.SignIn(context.Background(), googleIdentity("guest-again", "other@partner.org"))
+	assert.ErrorIsf(t, err, internal.ErrNotInvited, "Expected %v, got %v", internal.ErrNotInvited, err)
+}
+
+func TestService_RevokeInvitation(t *testing.T) {
+	invitations := newInvitationsRepositoryFake()
+	sut := NewService(newUsersRepositoryFake(), newIdentitiesRepositoryFake(), invitations, &auditServiceFake{}, nil, Allowlist{Domains: []string{"example.com"}})
+
+	invitation, err := sut.Invite(context.Background(), "guest@partner.org")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.RevokeInvitation(context.Background(), invitation.ID)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.RevokeInvitation(context.Background(), invitation.ID)
+	assert.ErrorIsf(t, err, pgx.ErrNoRows, "Expected %v, got %v", pgx.ErrNoRows, err)
+
+	_, err = sut.SignIn(context.Background(), googleIdentity("guest", "guest@partner.org"))
+	assert.ErrorIsf(t, err, internal.ErrNotInvited, "Expected %v, got %v", internal.ErrNotInvited, err)
+}
+
+type invitationsRepositoryFake struct {
+	invitations map[string]internal.Invitation
+}
+
+func newInvitationsRepositoryFake() *invitationsRepositoryFake {
+	return &invitationsRepositoryFake{invitations: make(map[string]internal.Invitation)}
+}
+
+func (i *invitationsRepositoryFake) List(context.Context) ([]internal.Invitation, error) {
+	var result []internal.Invitation
+	for _, invitation := range i.invitations {
+		result = append(result, invitation)
+	}
+	return result, nil
+}
+
+func (i *invitationsRepositoryFake) Save(_ context.Context, invitation internal.Invitation) error {
+	i.invitations[invitation.Email] = invitation
+	return nil
+}
+
+func (i *invitationsRepositoryFake) Consume(_ context.Context, email string) (internal.Invitation, error) {
+	invitation, ok := i.invitations[email]
+	if !ok || invitation.ExpiresAt.Before(time.Now()) {
+		return internal.Invitation{}, pgx.ErrNoRows
+	}
+	delete(i.invitations, email)
+	return invitation, nil
+}
+
+func (i *invitationsRepositoryFake) Delete(_ context.Context, id string) error {
+	for email, invitation := range i.invitations {
+		if invitation.ID == id {
+			delete(i.invitations, email)
+			return nil
+		}
+	}
+	return pgx.ErrNoRows
+}
@@ -6,41 +6,241 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
+	"strings"
+	"time"
+)
+
+const (
+	listLimit          = 100
+	invitationLifetime = 14 * 24 * time.Hour
 )
 
 type Service struct {
-	repository internal.UsersRepository
+	repository  internal.UsersRepository
+	identities  internal.IdentityRepository
+	invitations internal.InvitationRepository
+	audit       internal.AuditService
+	admins      map[string]bool
+	allowlist   Allowlist
 }
 
-func NewService(repository internal.UsersRepository) *Service {
-	return &Service{repository: repository}
+// NewService creates the users service. Users signing in with one of the admin emails are made administrators.
+// Only emails on the allowlist, admin emails and invited emails can sign up.
+func NewService(repository internal.UsersRepository, identities internal.IdentityRepository, invitations internal.InvitationRepository, audit internal.AuditService, adminEmails []string, allowlist Allowlist) *Service {
+	admins := make(map[string]bool, len(adminEmails))
+	for _, email := range adminEmails {
+		admins[normalizeEmail(email)] = true
+	}
+	return &Service{
+		repository:  repository,
+		identities:  identities,
+		invitations: invitations,
+		audit:       audit,
+		admins:      admins,
+		allowlist:   allowlist,
+	}
 }
 
-func (s *Service) CreateWithGoogleID(ctx context.Context, googleID string, email string) (internal.User, error) {
-	user := internal.User{
-		ID:       uuid.New().String(),
-		Email:    email,
-		GoogleID: googleID,
+func (s *Service) List(ctx context.Context, query string) ([]internal.User, error) {
+	return s.repository.List(ctx, strings.TrimSpace(query), listLimit)
+}
+
+func (s *Service) Get(ctx context.Context, id string) (internal.User, error) {
+	return s.repository.Get(ctx, id)
+}
+
+func (s *Service) GetByEmail(ctx context.Context, email string) (internal.User, error) {
+	return s.repository.GetByEmail(ctx, normalizeEmail(email))
+}
+
+// SignIn returns the user of the identity. Unknown identities sign up a new user, unless their
+// email already belongs to someone, who has to link the identity from their profile instead.
+func (s *Service) SignIn(ctx context.Context, identity internal.Identity) (internal.User, error) {
+	linked, err := s.identities.Get(ctx, identity.Provider, identity.Subject)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return internal.User{}, err
 	}
 
-	err := s.repository.Save(ctx, user)
+	var user internal.User
+	if err == nil {
+		user, err = s.repository.Get(ctx, linked.UserID)
+	} else {
+		user, err = s.signUp(ctx, identity)
+	}
 	if err != nil {
 		return internal.User{}, err
 	}
 
+	if user.Disabled {
+		return internal.User{}, internal.ErrUserDisabled
+	}
+
+	// only a verified email proves the user owns an admin's address
+	if identity.EmailVerified && s.admins[normalizeEmail(user.Email)] && !user.IsAdmin() {
+		if err := s.promote(ctx, user); err != nil {
+			return internal.User{}, err
+		}
+		user.Role = internal.RoleAdmin
+	}
+
 	return user, nil
 }
 
-func (s *Service) GetOrCreateByGoogle(ctx context.Context, googleID string, email string) (internal.User, error) {
-	user, err := s.repository.GetByGoogleID(ctx, googleID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+func (s *Service) signUp(ctx context.Context, identity internal.Identity) (internal.User, error) {
+	if identity.Email == "" {
+		return internal.User{}, internal.ErrEmailMissing
+	}
+	if !identity.EmailVerified {
+		return internal.User{}, internal.ErrEmailUnverified
+	}
+
+	identity.Email = normalizeEmail(identity.Email)
+	_, err := s.repository.GetByEmail(ctx, identity.Email)
+	if err == nil {
+		return internal.User{}, internal.ErrEmailInUse
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return internal.User{}, err
+	}
+
+	invitedBy, err := s.admit(ctx, identity.Email)
+	if err != nil {
+		return internal.User{}, err
+	}
+
+	user := internal.User{
+		ID:    uuid.New().String(),
+		Email: identity.Email,
+		Role:  internal.RoleUser,
+	}
+
+	if err := s.repository.Save(ctx, user); err != nil {
+		return internal.User{}, err
+	}
+
+	identity.UserID = user.ID
+	identity.CreatedAt = time.Now()
+	if err := s.identities.Save(ctx, identity); err != nil {
 		return internal.User{}, err
 	}
 
-	// found it!
+	// users sign up themselves
+	ctx = audit.WithActor(ctx, user.ID)
+	after := map[string]string{"email": user.Email, "provider": identity.Provider}
+	if invitedBy != "" {
+		after["invited_by"] = invitedBy
+	}
+	if err := s.audit.Record(ctx, internal.AuditUserCreate, internal.AuditTargetUser, user.ID, nil, after); err != nil {
+		return internal.User{}, err
+	}
+
+	return user, nil
+}
+
+// admit checks whether the normalized email may sign up. Emails that are neither allowed
+// nor an admin's use up their invitation, whose sender is returned.
+func (s *Service) admit(ctx context.Context, email string) (string, error) {
+	if s.admins[email] || s.allowlist.Allows(email) {
+		return "", nil
+	}
+
+	invitation, err := s.invitations.Consume(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", internal.ErrNotInvited
+	}
+	if err != nil {
+		return "", err
+	}
+	return invitation.InvitedBy, nil
+}
+
+func (s *Service) Identities(ctx context.Context, userID string) ([]internal.Identity, error) {
+	return s.identities.ListByUser(ctx, userID)
+}
+
+// Link connects another identity to the user. Identities of other users are refused.
+func (s *Service) Link(ctx context.Context, userID string, identity internal.Identity) error {
+	linked, err := s.identities.Get(ctx, identity.Provider, identity.Subject)
 	if err == nil {
-		return user, nil
+		if linked.UserID == userID {
+			return nil
+		}
+		return internal.ErrIdentityInUse
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	identity.UserID = userID
+	identity.CreatedAt = time.Now()
+	if err := s.identities.Save(ctx, identity); err != nil {
+		return err
+	}
+
+	ctx = audit.WithActor(ctx, userID)
+	return s.audit.Record(ctx, internal.AuditUserLink, internal.AuditTargetUser, userID, nil, identitySnapshot(identity))
+}
+
+// Unlink removes an identity from the user. The last one cannot be removed, or the user could
+// not sign in anymore.
+func (s *Service) Unlink(ctx context.Context, userID string, provider string, subject string) error {
+	identities, err := s.identities.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(identities) <= 1 {
+		return internal.ErrLastIdentity
+	}
+
+	for _, identity := range identities {
+		if identity.Provider != provider || identity.Subject != subject {
+			continue
+		}
+
+		if err := s.identities.Delete(ctx, provider, subject, userID); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, internal.AuditUserUnlink, internal.AuditTargetUser, userID, identitySnapshot(identity), nil)
+	}
+	return pgx.ErrNoRows
+}
+
+func identitySnapshot(identity internal.Identity) map[string]string {
+	return map[string]string{"provider": identity.Provider, "email": identity.Email}
+}
+
+func (s *Service) promote(ctx context.Context, user internal.User) error {
+	if err := s.repository.UpdateRole(ctx, user.ID, internal.RoleAdmin); err != nil {
+		return err
 	}
 
-	return s.CreateWithGoogleID(ctx, googleID, email)
+	before := map[string]internal.Role{"role": user.Role}
+	after := map[string]internal.Role{"role": internal.RoleAdmin}
+	return s.audit.Record(ctx, internal.AuditUserRole, internal.AuditTargetUser, user.ID, before, after)
+}
+
+// SetDisabled locks a user out or lets them back in. Administrators cannot disable themselves.
+func (s *Service) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	if disabled && id == audit.Actor(ctx) {
+		return errors.New("cannot disable yourself")
+	}
+
+	if err := s.repository.UpdateDisabled(ctx, id, disabled); err != nil {
+		return err
+	}
+
+	action := internal.AuditUserEnable
+	if disabled {
+		action = internal.AuditUserDisable
+	}
+	return s.audit.Record(ctx, action, internal.AuditTargetUser, id, map[string]bool{"disabled": !disabled}, map[string]bool{"disabled": disabled})
+}
+
+// Delete removes a user with everything they own. Their audit events are anonymized.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if err := s.repository.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, internal.AuditUserDelete, internal.AuditTargetUser, id, nil, nil)
 }
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"github.com/jackc/pgx/v4"
 	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/audit"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -13,69 +15,363 @@ const (
 	testUser     = "00000000-0000-0000-0000-000000000000"
 	testGoogleID = "testGoogleID"
 	testEmail    = "example@example.com"
+
+	testDisabledGoogleID = "disabledGoogleID"
+	testAdminEmail       = "admin@example.com"
 )
 
-func TestService_CreateWithGoogleID(t *testing.T) {
-	repo, sut := setupService()
+func TestService_SignIn(t *testing.T) {
+	repo, identities, sut := setupService()
 
-	user, err := sut.CreateWithGoogleID(context.Background(), testGoogleID, testEmail)
+	user, err := sut.SignIn(context.Background(), googleIdentity(testGoogleID, testEmail))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testUser, user.ID, "Expected user ID to be %v, got %v", testUser, user.ID)
+
+	user, err = sut.SignIn(context.Background(), googleIdentity("nonexistent", "new@example.com"))
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
 	assert.NotEmptyf(t, user.ID, "Expected user ID to be set, got %v", user.ID)
-	assert.Equalf(t, testGoogleID, user.GoogleID, "Expected GoogleID to be %v, got %v", testGoogleID, user.GoogleID)
+	assert.Equalf(t, "new@example.com", user.Email, "Expected user email to be %v, got %v", "new@example.com", user.Email)
+	assert.Equalf(t, user.ID, identities.identities["google|nonexistent"].UserID, "Expected identity to be linked to the new user")
 
 	repo.FailMode = true
-	_, err = sut.CreateWithGoogleID(context.Background(), testGoogleID, testEmail)
+	_, err = sut.SignIn(context.Background(), googleIdentity(testGoogleID, testEmail))
 	assert.Errorf(t, err, "Expected error, got nil")
+	assert.NotErrorIsf(t, err, pgx.ErrNoRows, "Expected error to not be %v, got %v", pgx.ErrNoRows, err)
+}
+
+func TestService_SignIn_Conflicts(t *testing.T) {
+	_, _, sut := setupService()
+
+	_, err := sut.SignIn(context.Background(), internal.Identity{Provider: "github", Subject: "42", Email: testEmail, EmailVerified: true})
+	assert.ErrorIsf(t, err, internal.ErrEmailInUse, "Expected %v, got %v", internal.ErrEmailInUse, err)
+
+	// an unverified email must not reveal or claim the account that uses it
+	_, err = sut.SignIn(context.Background(), internal.Identity{Provider: "github", Subject: "42", Email: testEmail})
+	assert.ErrorIsf(t, err, internal.ErrEmailUnverified, "Expected %v, got %v", internal.ErrEmailUnverified, err)
+
+	_, err = sut.SignIn(context.Background(), internal.Identity{Provider: "github", Subject: "42"})
+	assert.ErrorIsf(t, err, internal.ErrEmailMissing, "Expected %v, got %v", internal.ErrEmailMissing, err)
 }
 
-func TestService_GetOrCreateByGoogle(t *testing.T) {
-	repo, sut := setupService()
+func TestService_SignIn_EmailCase(t *testing.T) {
+	repo, _, sut := setupService()
+
+	_, err := sut.SignIn(context.Background(), googleIdentity("another", " Example@Example.com"))
+	assert.ErrorIsf(t, err, internal.ErrEmailInUse, "Expected %v, got %v", internal.ErrEmailInUse, err)
 
-	user, err := sut.GetOrCreateByGoogle(context.Background(), testGoogleID, testEmail)
+	user, err := sut.SignIn(context.Background(), googleIdentity("nonexistent", "New@Example.com"))
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
-	assert.Equalf(t, testUser, user.ID, "Expected user ID to be %v, got %v", testUser, user.ID)
+	assert.Equalf(t, "new@example.com", repo.users[user.ID].Email, "Expected normalized email to be stored, got %v", repo.users[user.ID].Email)
 
-	user, err = sut.GetOrCreateByGoogle(context.Background(), "nonexistent", testEmail)
+	found, err := sut.GetByEmail(context.Background(), "NEW@example.com")
 	assert.NoErrorf(t, err, "Expected no error, got %v", err)
-	assert.NotEmptyf(t, user.ID, "Expected user ID to be set, got %v", user.ID)
-	assert.Equalf(t, testEmail, user.Email, "Expected user email to be %v, got %v", testEmail, user.Email)
-	assert.Equalf(t, "nonexistent", user.GoogleID, "Expected GoogleID to be %v, got %v", "nonexistent", user.GoogleID)
+	assert.Equalf(t, user.ID, found.ID, "Expected user %v, got %v", user.ID, found.ID)
 
-	repo.FailMode = true
-	_, err = sut.GetOrCreateByGoogle(context.Background(), testGoogleID, testEmail)
+	_, err = sut.SignIn(context.Background(), internal.Identity{Provider: "github", Subject: "42", Email: "new@EXAMPLE.com", EmailVerified: true})
+	assert.ErrorIsf(t, err, internal.ErrEmailInUse, "Expected %v, got %v", internal.ErrEmailInUse, err)
+}
+
+func TestService_SignIn_Audit(t *testing.T) {
+	auditor := &auditServiceFake{}
+	sut := NewService(newUsersRepositoryFake(), newIdentitiesRepositoryFake(), newInvitationsRepositoryFake(), auditor, nil, Allowlist{})
+
+	user, err := sut.SignIn(context.Background(), googleIdentity("nonexistent", "new@example.com"))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, auditor.events, 1, "Expected one audit event, got %d", len(auditor.events))
+
+	event := auditor.events[0]
+	assert.Equalf(t, internal.AuditUserCreate, event.Action, "Expected user creation event, got %v", event.Action)
+	assert.Equalf(t, user.ID, event.ActorID, "Expected new user to be the actor, got %v", event.ActorID)
+
+	auditor.FailMode = true
+	_, err = sut.SignIn(context.Background(), googleIdentity("another", "another@example.com"))
 	assert.Errorf(t, err, "Expected error, got nil")
-	assert.NotErrorIsf(t, err, pgx.ErrNoRows, "Expected error to not be %v, got %v", pgx.ErrNoRows, err)
 }
 
-func setupService() (*usersRepositoryFake, *Service) {
-	repo := &usersRepositoryFake{}
-	svc := NewService(repo)
-	return repo, svc
+func TestService_SignIn_Disabled(t *testing.T) {
+	repo, identities, sut := setupService()
+	repo.users["disabled"] = internal.User{ID: "disabled", Email: "disabled@example.com", Disabled: true}
+	identities.identities["google|"+testDisabledGoogleID] = internal.Identity{Provider: "google", Subject: testDisabledGoogleID, UserID: "disabled"}
+
+	_, err := sut.SignIn(context.Background(), googleIdentity(testDisabledGoogleID, "disabled@example.com"))
+	assert.ErrorIsf(t, err, internal.ErrUserDisabled, "Expected %v, got %v", internal.ErrUserDisabled, err)
+}
+
+func TestService_SignIn_Admin(t *testing.T) {
+	repo := newUsersRepositoryFake()
+	sut := NewService(repo, newIdentitiesRepositoryFake(), newInvitationsRepositoryFake(), &auditServiceFake{}, []string{" Admin@Example.com "}, Allowlist{})
+
+	user, err := sut.SignIn(context.Background(), googleIdentity("adminGoogleID", testAdminEmail))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, user.IsAdmin(), "Expected user to be promoted, got role %v", user.Role)
+	assert.Equalf(t, internal.RoleAdmin, repo.users[user.ID].Role, "Expected stored role to be admin, got %v", repo.users[user.ID].Role)
+
+	user, err = sut.SignIn(context.Background(), googleIdentity(testGoogleID, testEmail))
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Falsef(t, user.IsAdmin(), "Expected regular user, got role %v", user.Role)
+}
+
+func TestService_SignIn_Unverified(t *testing.T) {
+	repo := newUsersRepositoryFake()
+	identities := newIdentitiesRepositoryFake()
+	sut := NewService(repo, identities, newInvitationsRepositoryFake(), &auditServiceFake{}, []string{testAdminEmail}, Allowlist{})
+
+	unverified := internal.Identity{Provider: "github", Subject: "42", Email: testAdminEmail}
+	_, err := sut.SignIn(context.Background(), unverified)
+	assert.ErrorIsf(t, err, internal.ErrEmailUnverified, "Expected %v, got %v", internal.ErrEmailUnverified, err)
+	assert.Lenf(t, repo.users, 1, "Expected no user to be created, got %d users", len(repo.users))
+
+	// an admin's email on an unverified identity of an existing user does not promote
+	repo.users["admin"] = internal.User{ID: "admin", Email: testAdminEmail, Role: internal.RoleUser}
+	identities.identities["github|42"] = internal.Identity{Provider: "github", Subject: "42", UserID: "admin"}
+
+	user, err := sut.SignIn(context.Background(), unverified)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Falsef(t, user.IsAdmin(), "Expected no promotion, got role %v", user.Role)
+
+	unverified.EmailVerified = true
+	user, err = sut.SignIn(context.Background(), unverified)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, user.IsAdmin(), "Expected promotion, got role %v", user.Role)
+}
+
+func TestService_Link(t *testing.T) {
+	_, identities, sut := setupService()
+	identities.identities["github|taken"] = internal.Identity{Provider: "github", Subject: "taken", UserID: "someone else"}
+
+	github := internal.Identity{Provider: "github", Subject: "42", Email: "octocat@example.com"}
+	err := sut.Link(context.Background(), testUser, github)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.Link(context.Background(), testUser, github)
+	assert.NoErrorf(t, err, "Expected linking twice to be fine, got %v", err)
+
+	err = sut.Link(context.Background(), testUser, internal.Identity{Provider: "github", Subject: "taken"})
+	assert.ErrorIsf(t, err, internal.ErrIdentityInUse, "Expected %v, got %v", internal.ErrIdentityInUse, err)
+
+	list, err := sut.Identities(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, list, 2, "Expected two identities, got %d", len(list))
+}
+
+func TestService_Unlink(t *testing.T) {
+	_, identities, sut := setupService()
+
+	err := sut.Unlink(context.Background(), testUser, "google", testGoogleID)
+	assert.ErrorIsf(t, err, internal.ErrLastIdentity, "Expected %v, got %v", internal.ErrLastIdentity, err)
+
+	err = sut.Link(context.Background(), testUser, internal.Identity{Provider: "github", Subject: "42"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.Unlink(context.Background(), testUser, "github", "unknown")
+	assert.ErrorIsf(t, err, pgx.ErrNoRows, "Expected %v, got %v", pgx.ErrNoRows, err)
+
+	err = sut.Unlink(context.Background(), testUser, "google", testGoogleID)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, identities.identities, 1, "Expected one identity left, got %d", len(identities.identities))
+}
+
+func TestService_SetDisabled(t *testing.T) {
+	repo, _, sut := setupService()
+	ctx := audit.WithActor(context.Background(), "admin")
+
+	err := sut.SetDisabled(ctx, testUser, true)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Truef(t, repo.users[testUser].Disabled, "Expected user to be disabled")
+
+	err = sut.SetDisabled(ctx, testUser, false)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Falsef(t, repo.users[testUser].Disabled, "Expected user to be enabled")
+
+	err = sut.SetDisabled(audit.WithActor(context.Background(), testUser), testUser, true)
+	assert.Errorf(t, err, "Expected error when disabling yourself, got nil")
+
+	err = sut.SetDisabled(ctx, "nonexistent", true)
+	assert.Errorf(t, err, "Expected error for unknown user, got nil")
+}
+
+func TestService_Delete(t *testing.T) {
+	repo, _, sut := setupService()
+	ctx := audit.WithActor(context.Background(), testUser)
+
+	err := sut.Delete(ctx, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	_, ok := repo.users[testUser]
+	assert.Falsef(t, ok, "Expected user to be deleted")
+
+	events := sut.audit.(*auditServiceFake).events
+	assert.Equalf(t, internal.AuditUserDelete, events[len(events)-1].Action, "Expected deletion to be audited, got %v", events)
+
+	err = sut.Delete(ctx, testUser)
+	assert.Errorf(t, err, "Expected error for unknown user, got nil")
+}
+
+func TestService_List(t *testing.T) {
+	_, _, sut := setupService()
+
+	users, err := sut.List(context.Background(), " example ")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, users, 1, "Expected one user, got %d", len(users))
+
+	user, err := sut.GetByEmail(context.Background(), testEmail)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, testUser, user.ID, "Expected user ID to be %v, got %v", testUser, user.ID)
+}
+
+func setupService() (*usersRepositoryFake, *identitiesRepositoryFake, *Service) {
+	repo := newUsersRepositoryFake()
+	identities := newIdentitiesRepositoryFake()
+	svc := NewService(repo, identities, newInvitationsRepositoryFake(), &auditServiceFake{}, nil, Allowlist{})
+	return repo, identities, svc
+}
+
+func googleIdentity(subject string, email string) internal.Identity {
+	return internal.Identity{Provider: "google", Subject: subject, Email: email, EmailVerified: true}
 }
 
 type usersRepositoryFake struct {
+	users    map[string]internal.User
 	FailMode bool
 }
 
-func (u usersRepositoryFake) Save(context.Context, internal.User) error {
+func newUsersRepositoryFake() *usersRepositoryFake {
+	user := internal.User{ID: testUser, Email: testEmail, Role: internal.RoleUser}
+	return &usersRepositoryFake{users: map[string]internal.User{testUser: user}}
+}
+
+func (u *usersRepositoryFake) List(_ context.Context, query string, _ int) ([]internal.User, error) {
+	if u.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	var result []internal.User
+	for _, user := range u.users {
+		if strings.Contains(user.Email, query) || user.ID == query {
+			result = append(result, user)
+		}
+	}
+	return result, nil
+}
+
+func (u *usersRepositoryFake) Get(_ context.Context, id string) (internal.User, error) {
+	if u.FailMode {
+		return internal.User{}, errors.New("fake error")
+	}
+
+	user, ok := u.users[id]
+	if !ok {
+		return internal.User{}, pgx.ErrNoRows
+	}
+	return user, nil
+}
+
+func (u *usersRepositoryFake) GetByEmail(_ context.Context, email string) (internal.User, error) {
+	return u.find(func(user internal.User) bool { return user.Email == email })
+}
+
+func (u *usersRepositoryFake) Save(_ context.Context, user internal.User) error {
 	if u.FailMode {
 		return errors.New("fake error")
 	}
+	u.users[user.ID] = user
+	return nil
+}
+
+func (u *usersRepositoryFake) UpdateRole(_ context.Context, id string, role internal.Role) error {
+	user, ok := u.users[id]
+	if u.FailMode || !ok {
+		return errors.New("fake error")
+	}
+	user.Role = role
+	u.users[id] = user
+	return nil
+}
+
+func (u *usersRepositoryFake) UpdateDisabled(_ context.Context, id string, disabled bool) error {
+	user, ok := u.users[id]
+	if u.FailMode || !ok {
+		return errors.New("fake error")
+	}
+	user.Disabled = disabled
+	u.users[id] = user
 	return nil
 }
 
-func (u usersRepositoryFake) GetByGoogleID(_ context.Context, googleID string) (internal.User, error) {
+func (u *usersRepositoryFake) Delete(_ context.Context, id string) error {
+	if _, ok := u.users[id]; u.FailMode || !ok {
+		return errors.New("fake error")
+	}
+	delete(u.users, id)
+	return nil
+}
+
+func (u *usersRepositoryFake) find(match func(internal.User) bool) (internal.User, error) {
 	if u.FailMode {
 		return internal.User{}, errors.New("fake error")
 	}
 
-	if googleID != testGoogleID {
-		return internal.User{}, pgx.ErrNoRows
+	for _, user := range u.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return internal.User{}, pgx.ErrNoRows
+}
+
+type identitiesRepositoryFake struct {
+	identities map[string]internal.Identity
+}
+
+func newIdentitiesRepositoryFake() *identitiesRepositoryFake {
+	identity := internal.Identity{Provider: "google", Subject: testGoogleID, UserID: testUser, Email: testEmail}
+	return &identitiesRepositoryFake{identities: map[string]internal.Identity{"google|" + testGoogleID: identity}}
+}
+
+func (i *identitiesRepositoryFake) Get(_ context.Context, provider string, subject string) (internal.Identity, error) {
+	identity, ok := i.identities[provider+"|"+subject]
+	if !ok {
+		return internal.Identity{}, pgx.ErrNoRows
+	}
+	return identity, nil
+}
+
+func (i *identitiesRepositoryFake) ListByUser(_ context.Context, userID string) ([]internal.Identity, error) {
+	var result []internal.Identity
+	for _, identity := range i.identities {
+		if identity.UserID == userID {
+			result = append(result, identity)
+		}
 	}
+	return result, nil
+}
+
+func (i *identitiesRepositoryFake) Save(_ context.Context, identity internal.Identity) error {
+	i.identities[identity.Provider+"|"+identity.Subject] = identity
+	return nil
+}
+
+func (i *identitiesRepositoryFake) Delete(_ context.Context, provider string, subject string, userID string) error {
+	identity, ok := i.identities[provider+"|"+subject]
+	if !ok || identity.UserID != userID {
+		return pgx.ErrNoRows
+	}
+	delete(i.identities, provider+"|"+subject)
+	return nil
+}
+
+type auditServiceFake struct {
+	events   []internal.AuditEvent
+	FailMode bool
+}
+
+func (a *auditServiceFake) Record(ctx context.Context, action internal.AuditAction, targetType string, targetID string, _ any, _ any) error {
+	if a.FailMode {
+		return errors.New("fake error")
+	}
+	a.events = append(a.events, internal.AuditEvent{ActorID: audit.Actor(ctx), Action: action, TargetType: targetType, TargetID: targetID})
+	return nil
+}
 
-	return internal.User{
-		ID:       testUser,
-		Email:    testEmail,
-		GoogleID: testGoogleID,
-	}, nil
+func (a *auditServiceFake) List(context.Context, internal.AuditFilter) ([]internal.AuditEvent, error) {
+	return a.events, nil
 }
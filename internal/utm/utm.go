@@ -0,0 +1,49 @@
+package utm
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/pscheid92/dwarferl/internal"
+	"strings"
+	"time"
+)
+
+type Service struct {
+	repository internal.UTMPresetRepository
+}
+
+func NewService(repository internal.UTMPresetRepository) *Service {
+	return &Service{repository: repository}
+}
+
+func (s *Service) List(ctx context.Context, userID string) ([]internal.UTMPreset, error) {
+	return s.repository.List(ctx, userID)
+}
+
+func (s *Service) Get(ctx context.Context, id string, userID string) (internal.UTMPreset, error) {
+	return s.repository.Get(ctx, id, userID)
+}
+
+func (s *Service) Create(ctx context.Context, preset internal.UTMPreset) (internal.UTMPreset, error) {
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" {
+		return internal.UTMPreset{}, errors.New("name is required")
+	}
+
+	if preset.Source == "" {
+		return internal.UTMPreset{}, errors.New("source is required")
+	}
+
+	preset.ID = uuid.New().String()
+	preset.CreatedAt = time.Now()
+
+	if err := s.repository.Save(ctx, preset); err != nil {
+		return internal.UTMPreset{}, err
+	}
+	return preset, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id string, userID string) error {
+	return s.repository.Delete(ctx, id, userID)
+}
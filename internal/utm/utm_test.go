@@ -0,0 +1,114 @@
+package utm
+
+import (
+	"context"
+	"errors"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testUser = "00000000-0000-0000-0000-000000000000"
+
+func TestService_Create(t *testing.T) {
+	repo, sut := setupService()
+
+	_, err := sut.Create(context.Background(), internal.UTMPreset{UserID: testUser, Name: "  ", Source: "newsletter"})
+	assert.Errorf(t, err, "Expected error for missing name, got nil")
+
+	_, err = sut.Create(context.Background(), internal.UTMPreset{UserID: testUser, Name: "Newsletter"})
+	assert.Errorf(t, err, "Expected error for missing source, got nil")
+
+	preset, err := sut.Create(context.Background(), internal.UTMPreset{UserID: testUser, Name: "Newsletter", Source: "newsletter"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.NotEmptyf(t, preset.ID, "Expected preset ID to be set")
+	assert.Falsef(t, preset.CreatedAt.IsZero(), "Expected creation time to be set")
+
+	stored, err := sut.Get(context.Background(), preset.ID, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, preset, stored, "Expected stored preset to equal created one")
+
+	repo.FailMode = true
+	_, err = sut.Create(context.Background(), internal.UTMPreset{UserID: testUser, Name: "Newsletter", Source: "newsletter"})
+	assert.Errorf(t, err, "Expected error, got nil")
+}
+
+func TestService_ListAndDelete(t *testing.T) {
+	_, sut := setupService()
+
+	preset, err := sut.Create(context.Background(), internal.UTMPreset{UserID: testUser, Name: "Newsletter", Source: "newsletter"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	list, err := sut.List(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, list, 1, "Expected one preset, got %d", len(list))
+
+	err = sut.Delete(context.Background(), preset.ID, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	list, err = sut.List(context.Background(), testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Emptyf(t, list, "Expected no presets, got %d", len(list))
+}
+
+func TestUTMPreset_Apply(t *testing.T) {
+	preset := internal.UTMPreset{Source: "newsletter", Medium: "email", Campaign: "launch"}
+
+	result, err := preset.Apply("https://example.com/page?utm_source=old&lang=en")
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	expected := "https://example.com/page?lang=en&utm_campaign=launch&utm_medium=email&utm_source=newsletter"
+	assert.Equalf(t, expected, result, "Expected %s, got %s", expected, result)
+}
+
+func setupService() (*utmPresetRepositoryFake, *Service) {
+	repo := &utmPresetRepositoryFake{presets: make(map[string]internal.UTMPreset)}
+	return repo, NewService(repo)
+}
+
+type utmPresetRepositoryFake struct {
+	presets  map[string]internal.UTMPreset
+	FailMode bool
+}
+
+func (r *utmPresetRepositoryFake) List(_ context.Context, userID string) ([]internal.UTMPreset, error) {
+	if r.FailMode {
+		return nil, errors.New("fake error")
+	}
+
+	var result []internal.UTMPreset
+	for _, p := range r.presets {
+		if p.UserID == userID {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (r *utmPresetRepositoryFake) Get(_ context.Context, id string, userID string) (internal.UTMPreset, error) {
+	if r.FailMode {
+		return internal.UTMPreset{}, errors.New("fake error")
+	}
+
+	p, ok := r.presets[id]
+	if !ok || p.UserID != userID {
+		return internal.UTMPreset{}, errors.New("not found")
+	}
+	return p, nil
+}
+
+func (r *utmPresetRepositoryFake) Save(_ context.Context, preset internal.UTMPreset) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+	r.presets[preset.ID] = preset
+	return nil
+}
+
+func (r *utmPresetRepositoryFake) Delete(_ context.Context, id string, _ string) error {
+	if r.FailMode {
+		return errors.New("fake error")
+	}
+	delete(r.presets, id)
+	return nil
+}
@@ -0,0 +1,393 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	maxWebhooks       = 10
+	maxAttempts       = 8
+	firstRetryDelay   = 30 * time.Second
+	requestTimeout    = 10 * time.Second
+	claimLease        = time.Minute
+	dispatchBatchSize = 20
+	deliveryLogSize   = 50
+	deliveryRetention = 7 * 24 * time.Hour
+	maxErrorLength    = 200
+
+	// a batch stops sending early enough for its last request to finish within the lease,
+	// before another dispatcher may claim the deliveries again
+	dispatchWindow = claimLease - 2*requestTimeout
+)
+
+// Headers sent with every delivery. The signature is the hex encoded HMAC-SHA256 of the body,
+// keyed with the webhook's secret and prefixed with "sha256=".
+const (
+	EventHeader     = "X-Dwarferl-Event"
+	DeliveryHeader  = "X-Dwarferl-Delivery"
+	SignatureHeader = "X-Dwarferl-Signature"
+)
+
+// errForbiddenDestination is returned for deliveries to addresses inside our own network.
+var errForbiddenDestination = errors.New("destination not allowed")
+
+type Service struct {
+	repository internal.WebhookRepository
+	audit      internal.AuditService
+	client     *http.Client
+	allowed    func(ip net.IP) bool
+	now        func() time.Time
+}
+
+func NewService(repository internal.WebhookRepository, audit internal.AuditService) *Service {
+	s := &Service{
+		repository: repository,
+		audit:      audit,
+		allowed:    isPublic,
+		now:        time.Now,
+	}
+	s.client = s.newClient()
+	return s
+}
+
+// newClient returns a client that only connects to allowed addresses. The check runs on the
+// resolved address of every connection, so a hostname can't be pointed at our network later.
+// Redirects are not followed, the response of the webhook URL itself is the result.
+func (s *Service) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !s.allowed(ip) {
+				return errForbiddenDestination
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:       requestTimeout,
+		Transport:     transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// isPublic reports whether the address is reachable from the internet, rejecting loopback,
+// private, link-local and shared addresses.
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	return !sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// payload is the JSON body of a delivery. Its ID matches the delivery header, so receivers
+// can drop the duplicates that retries may cause.
+type payload struct {
+	ID        string                `json:"id"`
+	Event     internal.WebhookEvent `json:"event"`
+	CreatedAt time.Time             `json:"created_at"`
+	Data      any                   `json:"data"`
+}
+
+// Publish adds a delivery to the outbox for every webhook of the user subscribed to the event.
+func (s *Service) Publish(ctx context.Context, userID string, event internal.WebhookEvent, data any) error {
+	webhooks, err := s.repository.ListSubscribed(ctx, userID, event)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	deliveries := make([]internal.WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i], err = s.newDelivery(webhook.ID, event, data)
+		if err != nil {
+			return err
+		}
+	}
+	return s.repository.Enqueue(ctx, deliveries)
+}
+
+func (s *Service) newDelivery(webhookID string, event internal.WebhookEvent, data any) (internal.WebhookDelivery, error) {
+	now := s.now()
+	id := uuid.New().String()
+	body, err := json.Marshal(payload{ID: id, Event: event, CreatedAt: now.UTC(), Data: data})
+	if err != nil {
+		return internal.WebhookDelivery{}, err
+	}
+
+	delivery := internal.WebhookDelivery{
+		ID:            id,
+		WebhookID:     webhookID,
+		Event:         event,
+		Payload:       body,
+		Status:        internal.DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	return delivery, nil
+}
+
+func (s *Service) List(ctx context.Context, userID string) ([]internal.Webhook, error) {
+	return s.repository.List(ctx, userID)
+}
+
+func (s *Service) Get(ctx context.Context, id string, userID string) (internal.Webhook, error) {
+	return s.repository.Get(ctx, id, userID)
+}
+
+// Create adds a webhook with a new secret. It needs an http or https URL and at least one event.
+// URLs naming a private address are rejected right away, hostnames are checked on delivery.
+func (s *Service) Create(ctx context.Context, userID string, rawURL string, events []internal.WebhookEvent) (internal.Webhook, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return internal.Webhook{}, internal.ErrInvalidWebhook
+	}
+	if ip := net.ParseIP(target.Hostname()); ip != nil && !s.allowed(ip) {
+		return internal.Webhook{}, internal.ErrInvalidWebhook
+	}
+
+	if len(events) == 0 {
+		return internal.Webhook{}, internal.ErrInvalidWebhook
+	}
+	for _, event := range events {
+		if !isKnownEvent(event) {
+			return internal.Webhook{}, internal.ErrInvalidWebhook
+		}
+	}
+
+	existing, err := s.repository.List(ctx, userID)
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+	if len(existing) >= maxWebhooks {
+		return internal.Webhook{}, internal.ErrTooManyWebhooks
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return internal.Webhook{}, err
+	}
+
+	webhook := internal.Webhook{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		URL:       rawURL,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: s.now(),
+	}
+	if err := s.repository.Save(ctx, webhook); err != nil {
+		return internal.Webhook{}, err
+	}
+
+	if err := s.audit.Record(ctx, internal.AuditHookCreate, internal.AuditTargetHook, webhook.ID, nil, snapshot(webhook)); err != nil {
+		return internal.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Delete removes the webhook together with its pending deliveries and delivery log.
+func (s *Service) Delete(ctx context.Context, id string, userID string) error {
+	webhook, err := s.repository.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.Delete(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, internal.AuditHookDelete, internal.AuditTargetHook, id, snapshot(webhook), nil)
+}
+
+// snapshot is what the audit log keeps of a webhook. The secret stays out of it.
+func snapshot(webhook internal.Webhook) map[string]any {
+	return map[string]any{"url": webhook.URL, "events": webhook.Events}
+}
+
+// Deliveries returns the most recent deliveries of the webhook, newest first.
+func (s *Service) Deliveries(ctx context.Context, id string, userID string) ([]internal.WebhookDelivery, error) {
+	if _, err := s.repository.Get(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return s.repository.ListDeliveries(ctx, id, deliveryLogSize)
+}
+
+// Test sends a ping right away and returns the outcome. A failed ping is retried like any other delivery.
+func (s *Service) Test(ctx context.Context, id string, userID string) (internal.WebhookDelivery, error) {
+	webhook, err := s.repository.Get(ctx, id, userID)
+	if err != nil {
+		return internal.WebhookDelivery{}, err
+	}
+
+	delivery, err := s.newDelivery(webhook.ID, internal.EventPing, map[string]string{"webhook_id": webhook.ID})
+	if err != nil {
+		return internal.WebhookDelivery{}, err
+	}
+
+	// leased right away, so the dispatcher leaves it to us
+	delivery.NextAttemptAt = delivery.CreatedAt.Add(claimLease)
+	if err := s.repository.Enqueue(ctx, []internal.WebhookDelivery{delivery}); err != nil {
+		return internal.WebhookDelivery{}, err
+	}
+	return s.attempt(ctx, webhook, delivery)
+}
+
+// DeliverDue sends the deliveries whose time has come and returns how many were attempted.
+// Deliveries left over when the dispatch window closes keep their lease and are claimed again
+// once it runs out.
+func (s *Service) DeliverDue(ctx context.Context) (int, error) {
+	now := s.now()
+	deliveries, err := s.repository.Claim(ctx, now, now.Add(claimLease), dispatchBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	closes := now.Add(dispatchWindow)
+	attempted := 0
+	webhooks := make(map[string]internal.Webhook)
+	for _, delivery := range deliveries {
+		if !s.now().Before(closes) {
+			break
+		}
+
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = s.repository.Find(ctx, delivery.WebhookID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				// deleted meanwhile, which takes its deliveries along
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			webhooks[webhook.ID] = webhook
+		}
+
+		if _, err := s.attempt(ctx, webhook, delivery); err != nil {
+			return 0, err
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// PurgeDeliveries removes finished deliveries that are older than the retention.
+func (s *Service) PurgeDeliveries(ctx context.Context) (int, error) {
+	return s.repository.DeleteDeliveriesBefore(ctx, s.now().Add(-deliveryRetention))
+}
+
+// attempt sends the delivery once and schedules the next attempt if it failed.
+func (s *Service) attempt(ctx context.Context, webhook internal.Webhook, delivery internal.WebhookDelivery) (internal.WebhookDelivery, error) {
+	status, err := s.send(ctx, webhook, delivery)
+	now := s.now()
+
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = internal.DeliveryDelivered
+		delivery.DeliveredAt = now
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = internal.DeliveryFailed
+		delivery.Error = truncate(err.Error())
+	default:
+		delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts))
+		delivery.Error = truncate(err.Error())
+	}
+
+	return delivery, s.repository.UpdateDelivery(ctx, delivery)
+}
+
+func (s *Service) send(ctx context.Context, webhook internal.Webhook, delivery internal.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dwarferl-webhooks")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// draining lets the connection be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of a payload.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the delay with every failed attempt, starting at half a minute.
+func backoff(attempts int) time.Duration {
+	return firstRetryDelay << (attempts - 1)
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func isKnownEvent(event internal.WebhookEvent) bool {
+	for _, known := range internal.WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(message string) string {
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength]
+	}
+	return message
+}
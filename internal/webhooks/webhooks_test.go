@@ -0,0 +1,478 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v4"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testUser  = "00000000-0000-0000-0000-000000000000"
+	otherUser = "11111111-1111-1111-1111-111111111111"
+)
+
+var testNow = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestService_Create(t *testing.T) {
+	sut, repo, _ := setupService()
+	sut.allowed = isPublic
+	ctx := context.Background()
+
+	webhook, err := sut.Create(ctx, testUser, " https://hooks.example.com/dwarferl ", []internal.WebhookEvent{internal.EventLinkCreated})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, "https://hooks.example.com/dwarferl", webhook.URL, "Expected trimmed URL, got %v", webhook.URL)
+	assert.Lenf(t, webhook.Secret, 64, "Expected a 32 byte secret, got %v", webhook.Secret)
+	assert.Containsf(t, repo.webhooks, webhook.ID, "Expected webhook to be saved")
+
+	invalid := []struct {
+		url    string
+		events []internal.WebhookEvent
+	}{
+		{"ftp://hooks.example.com", []internal.WebhookEvent{internal.EventLinkCreated}},
+		{"/relative", []internal.WebhookEvent{internal.EventLinkCreated}},
+		{"https://hooks.example.com", nil},
+		{"https://hooks.example.com", []internal.WebhookEvent{internal.EventPing}},
+		{"http://169.254.169.254/latest/meta-data", []internal.WebhookEvent{internal.EventLinkCreated}},
+		{"http://10.0.0.1:8080", []internal.WebhookEvent{internal.EventLinkCreated}},
+		{"http://[::1]/hook", []internal.WebhookEvent{internal.EventLinkCreated}},
+	}
+	for _, tc := range invalid {
+		_, err := sut.Create(ctx, testUser, tc.url, tc.events)
+		assert.ErrorIsf(t, err, internal.ErrInvalidWebhook, "Expected %v for %v %v, got %v", internal.ErrInvalidWebhook, tc.url, tc.events, err)
+	}
+
+	for i := len(repo.webhooks); i < maxWebhooks; i++ {
+		_, err := sut.Create(ctx, testUser, "https://hooks.example.com", internal.WebhookEvents)
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	}
+	_, err = sut.Create(ctx, testUser, "https://hooks.example.com", internal.WebhookEvents)
+	assert.ErrorIsf(t, err, internal.ErrTooManyWebhooks, "Expected %v, got %v", internal.ErrTooManyWebhooks, err)
+}
+
+func TestService_Delete(t *testing.T) {
+	sut, repo, auditor := setupService()
+	ctx := context.Background()
+
+	webhook, err := sut.Create(ctx, testUser, "https://hooks.example.com", internal.WebhookEvents)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	err = sut.Delete(ctx, webhook.ID, otherUser)
+	assert.Errorf(t, err, "Expected error for someone else's webhook, got nil")
+
+	err = sut.Delete(ctx, webhook.ID, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.NotContainsf(t, repo.webhooks, webhook.ID, "Expected webhook to be deleted")
+
+	expected := []internal.AuditAction{internal.AuditHookCreate, internal.AuditHookDelete}
+	assert.Equalf(t, expected, auditor.actions, "Expected actions %v, got %v", expected, auditor.actions)
+	assert.NotContainsf(t, string(auditor.snapshots), webhook.Secret, "Expected secret to stay out of the audit log, got %s", auditor.snapshots)
+}
+
+func TestService_Publish(t *testing.T) {
+	sut, repo, _ := setupService()
+	ctx := context.Background()
+
+	clicks, _ := sut.Create(ctx, testUser, "https://clicks.example.com", []internal.WebhookEvent{internal.EventLinkClicked})
+	_, _ = sut.Create(ctx, testUser, "https://links.example.com", []internal.WebhookEvent{internal.EventLinkCreated})
+	_, _ = sut.Create(ctx, otherUser, "https://other.example.com", internal.WebhookEvents)
+
+	err := sut.Publish(ctx, testUser, internal.EventLinkClicked, map[string]string{"short": "abc"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	assert.Lenf(t, repo.deliveries, 1, "Expected one delivery, got %v", repo.deliveries)
+	delivery := repo.pending()[0]
+	assert.Equalf(t, clicks.ID, delivery.WebhookID, "Expected delivery to the subscribed webhook, got %v", delivery.WebhookID)
+	assert.Equalf(t, testNow, delivery.NextAttemptAt, "Expected delivery to be due right away, got %v", delivery.NextAttemptAt)
+
+	var body payload
+	err = json.Unmarshal(delivery.Payload, &body)
+	assert.NoErrorf(t, err, "Expected JSON payload, got %v", err)
+	assert.Equalf(t, delivery.ID, body.ID, "Expected payload ID to match the delivery, got %v", body.ID)
+	assert.Equalf(t, internal.EventLinkClicked, body.Event, "Expected event in the payload, got %v", body.Event)
+
+	err = sut.Publish(ctx, testUser, internal.EventLinkDeleted, nil)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, repo.deliveries, 1, "Expected no delivery without subscribers, got %v", repo.deliveries)
+}
+
+func TestService_DeliverDue(t *testing.T) {
+	sut, repo, _ := setupService()
+	ctx := context.Background()
+	receiver := newReceiver()
+	defer receiver.Close()
+
+	webhook, _ := sut.Create(ctx, testUser, receiver.URL, []internal.WebhookEvent{internal.EventLinkCreated})
+	err := sut.Publish(ctx, testUser, internal.EventLinkCreated, map[string]string{"short": "abc"})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	attempted, err := sut.DeliverDue(ctx)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, attempted, "Expected one attempt, got %v", attempted)
+
+	requests := receiver.Requests()
+	assert.Lenf(t, requests, 1, "Expected one request, got %v", requests)
+	request := requests[0]
+	assert.Equalf(t, "application/json", request.header.Get("Content-Type"), "Expected JSON, got %v", request.header.Get("Content-Type"))
+	assert.Equalf(t, string(internal.EventLinkCreated), request.header.Get(EventHeader), "Expected event header, got %v", request.header.Get(EventHeader))
+	assert.Equalf(t, Sign(webhook.Secret, request.body), request.header.Get(SignatureHeader), "Expected valid signature, got %v", request.header.Get(SignatureHeader))
+	assert.Containsf(t, string(request.body), `"short":"abc"`, "Expected data in the body, got %s", request.body)
+
+	delivery := repo.deliveries[request.header.Get(DeliveryHeader)]
+	assert.Equalf(t, internal.DeliveryDelivered, delivery.Status, "Expected delivered status, got %v", delivery.Status)
+	assert.Equalf(t, http.StatusNoContent, delivery.ResponseStatus, "Expected response status, got %v", delivery.ResponseStatus)
+
+	attempted, err = sut.DeliverDue(ctx)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 0, attempted, "Expected nothing left to deliver, got %v", attempted)
+}
+
+func TestService_DeliverDue_Window(t *testing.T) {
+	sut, repo, _ := setupService()
+	ctx := context.Background()
+
+	// every request takes a quarter of the lease
+	var mu sync.Mutex
+	now := testNow
+	sut.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(claimLease / 4)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	_, _ = sut.Create(ctx, testUser, receiver.URL, []internal.WebhookEvent{internal.EventLinkCreated})
+	for i := 0; i < 4; i++ {
+		err := sut.Publish(ctx, testUser, internal.EventLinkCreated, nil)
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	}
+
+	attempted, err := sut.DeliverDue(ctx)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 3, attempted, "Expected sending to stop when the window closes, got %v attempts", attempted)
+
+	pending := repo.pending()
+	assert.Lenf(t, pending, 1, "Expected one delivery left, got %v", pending)
+	assert.Equalf(t, 0, pending[0].Attempts, "Expected the left over delivery to be untouched, got %v attempts", pending[0].Attempts)
+	assert.Equalf(t, testNow.Add(claimLease), pending[0].NextAttemptAt, "Expected it to keep its lease, got %v", pending[0].NextAttemptAt)
+}
+
+func TestService_DeliverDue_Retries(t *testing.T) {
+	sut, repo, _ := setupService()
+	ctx := context.Background()
+	receiver := newReceiver()
+	receiver.status = http.StatusInternalServerError
+	defer receiver.Close()
+
+	_, _ = sut.Create(ctx, testUser, receiver.URL, []internal.WebhookEvent{internal.EventLinkDeleted})
+	_ = sut.Publish(ctx, testUser, internal.EventLinkDeleted, nil)
+
+	_, err := sut.DeliverDue(ctx)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	delivery := repo.pending()[0]
+	assert.Equalf(t, 1, delivery.Attempts, "Expected one attempt, got %v", delivery.Attempts)
+	assert.Equalf(t, testNow.Add(firstRetryDelay), delivery.NextAttemptAt, "Expected retry after the first delay, got %v", delivery.NextAttemptAt)
+	assert.Containsf(t, delivery.Error, "500", "Expected status in the error, got %v", delivery.Error)
+
+	attempted, _ := sut.DeliverDue(ctx)
+	assert.Equalf(t, 0, attempted, "Expected no attempt before the retry is due, got %v", attempted)
+
+	// every further attempt waits twice as long
+	for attempt := 2; attempt <= maxAttempts; attempt++ {
+		due := repo.deliveries[delivery.ID].NextAttemptAt
+		sut.now = func() time.Time { return due }
+		_, err := sut.DeliverDue(ctx)
+		assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	}
+
+	failed := repo.deliveries[delivery.ID]
+	assert.Equalf(t, internal.DeliveryFailed, failed.Status, "Expected delivery to fail eventually, got %v", failed.Status)
+	assert.Equalf(t, maxAttempts, failed.Attempts, "Expected %v attempts, got %v", maxAttempts, failed.Attempts)
+	assert.Lenf(t, receiver.Requests(), maxAttempts, "Expected %v requests, got %v", maxAttempts, len(receiver.Requests()))
+	assert.Equalf(t, 16*time.Minute, backoff(6), "Expected exponential backoff, got %v", backoff(6))
+}
+
+func TestService_Test(t *testing.T) {
+	sut, repo, _ := setupService()
+	ctx := context.Background()
+	receiver := newReceiver()
+	defer receiver.Close()
+
+	webhook, _ := sut.Create(ctx, testUser, receiver.URL, []internal.WebhookEvent{internal.EventLinkClicked})
+
+	delivery, err := sut.Test(ctx, webhook.ID, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, internal.EventPing, delivery.Event, "Expected ping, got %v", delivery.Event)
+	assert.Equalf(t, internal.DeliveryDelivered, delivery.Status, "Expected delivered ping, got %v", delivery.Status)
+	assert.Lenf(t, receiver.Requests(), 1, "Expected one request, got %v", receiver.Requests())
+
+	deliveries, err := sut.Deliveries(ctx, webhook.ID, testUser)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Lenf(t, deliveries, 1, "Expected ping in the delivery log, got %v", deliveries)
+
+	_, err = sut.Test(ctx, webhook.ID, otherUser)
+	assert.Errorf(t, err, "Expected error for someone else's webhook, got nil")
+
+	_, err = sut.Deliveries(ctx, webhook.ID, otherUser)
+	assert.Errorf(t, err, "Expected error for someone else's webhook, got nil")
+
+	receiver.status = http.StatusGone
+	delivery, err = sut.Test(ctx, webhook.ID, testUser)
+	assert.NoErrorf(t, err, "Expected failed ping to be reported, got %v", err)
+	assert.Equalf(t, internal.DeliveryPending, delivery.Status, "Expected failed ping to be retried, got %v", delivery.Status)
+	assert.Equalf(t, http.StatusGone, repo.deliveries[delivery.ID].ResponseStatus, "Expected response status to be stored, got %v", repo.deliveries[delivery.ID].ResponseStatus)
+}
+
+func TestService_DeliverDue_PrivateDestination(t *testing.T) {
+	sut, repo, _ := setupService()
+	sut.allowed = isPublic
+	ctx := context.Background()
+	receiver := newReceiver()
+	defer receiver.Close()
+
+	_, err := sut.Create(ctx, testUser, receiver.URL, internal.WebhookEvents)
+	assert.ErrorIsf(t, err, internal.ErrInvalidWebhook, "Expected %v for a loopback URL, got %v", internal.ErrInvalidWebhook, err)
+
+	// a hostname passes creation but must not reach the loopback receiver
+	_, port, _ := net.SplitHostPort(receiver.Listener.Addr().String())
+	_, err = sut.Create(ctx, testUser, "http://localhost:"+port, []internal.WebhookEvent{internal.EventLinkCreated})
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	_ = sut.Publish(ctx, testUser, internal.EventLinkCreated, nil)
+
+	_, err = sut.DeliverDue(ctx)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	delivery := repo.pending()[0]
+	assert.Containsf(t, delivery.Error, errForbiddenDestination.Error(), "Expected forbidden destination, got %v", delivery.Error)
+	assert.Emptyf(t, receiver.Requests(), "Expected no request, got %v", receiver.Requests())
+}
+
+func TestService_DeliverDue_Redirect(t *testing.T) {
+	sut, repo, _ := setupService()
+	ctx := context.Background()
+	target := newReceiver()
+	defer target.Close()
+	receiver := newReceiver()
+	receiver.status = http.StatusFound
+	receiver.location = target.URL
+	defer receiver.Close()
+
+	_, _ = sut.Create(ctx, testUser, receiver.URL, []internal.WebhookEvent{internal.EventLinkCreated})
+	_ = sut.Publish(ctx, testUser, internal.EventLinkCreated, nil)
+
+	_, err := sut.DeliverDue(ctx)
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+
+	delivery := repo.pending()[0]
+	assert.Equalf(t, http.StatusFound, delivery.ResponseStatus, "Expected redirect as the result, got %v", delivery.ResponseStatus)
+	assert.Emptyf(t, target.Requests(), "Expected redirect not to be followed, got %v", target.Requests())
+}
+
+func TestService_PurgeDeliveries(t *testing.T) {
+	sut, repo, _ := setupService()
+
+	repo.deliveries["old"] = internal.WebhookDelivery{ID: "old", Status: internal.DeliveryDelivered, CreatedAt: testNow.Add(-2 * deliveryRetention)}
+	repo.deliveries["stuck"] = internal.WebhookDelivery{ID: "stuck", Status: internal.DeliveryPending, CreatedAt: testNow.Add(-2 * deliveryRetention)}
+	repo.deliveries["new"] = internal.WebhookDelivery{ID: "new", Status: internal.DeliveryFailed, CreatedAt: testNow}
+
+	purged, err := sut.PurgeDeliveries(context.Background())
+	assert.NoErrorf(t, err, "Expected no error, got %v", err)
+	assert.Equalf(t, 1, purged, "Expected one purged delivery, got %v", purged)
+	assert.NotContainsf(t, repo.deliveries, "old", "Expected old delivery to be purged")
+}
+
+func setupService() (*Service, *webhookRepositoryFake, *auditServiceFake) {
+	repo := &webhookRepositoryFake{webhooks: map[string]internal.Webhook{}, deliveries: map[string]internal.WebhookDelivery{}}
+	auditor := &auditServiceFake{}
+	svc := NewService(repo, auditor)
+	svc.now = func() time.Time { return testNow }
+	// the receivers listen on loopback
+	svc.allowed = func(net.IP) bool { return true }
+	return svc, repo, auditor
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local webhook endpoint that records what it receives.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []receivedRequest
+	status   int
+	location string
+}
+
+func newReceiver() *receiver {
+	r := &receiver{status: http.StatusNoContent}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, receivedRequest{header: req.Header, body: body})
+		if r.location != "" {
+			w.Header().Set("Location", r.location)
+		}
+		w.WriteHeader(r.status)
+	}))
+	return r
+}
+
+func (r *receiver) Requests() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+type webhookRepositoryFake struct {
+	webhooks   map[string]internal.Webhook
+	deliveries map[string]internal.WebhookDelivery
+}
+
+func (w *webhookRepositoryFake) List(_ context.Context, userID string) ([]internal.Webhook, error) {
+	var result []internal.Webhook
+	for _, webhook := range w.webhooks {
+		if webhook.UserID == userID {
+			result = append(result, webhook)
+		}
+	}
+	return result, nil
+}
+
+func (w *webhookRepositoryFake) ListSubscribed(ctx context.Context, userID string, event internal.WebhookEvent) ([]internal.Webhook, error) {
+	all, _ := w.List(ctx, userID)
+
+	var result []internal.Webhook
+	for _, webhook := range all {
+		if webhook.Subscribes(event) {
+			result = append(result, webhook)
+		}
+	}
+	return result, nil
+}
+
+func (w *webhookRepositoryFake) Get(_ context.Context, id string, userID string) (internal.Webhook, error) {
+	webhook, ok := w.webhooks[id]
+	if !ok || webhook.UserID != userID {
+		return internal.Webhook{}, pgx.ErrNoRows
+	}
+	return webhook, nil
+}
+
+func (w *webhookRepositoryFake) Find(_ context.Context, id string) (internal.Webhook, error) {
+	webhook, ok := w.webhooks[id]
+	if !ok {
+		return internal.Webhook{}, pgx.ErrNoRows
+	}
+	return webhook, nil
+}
+
+func (w *webhookRepositoryFake) Save(_ context.Context, webhook internal.Webhook) error {
+	w.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (w *webhookRepositoryFake) Delete(ctx context.Context, id string, userID string) error {
+	if _, err := w.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	delete(w.webhooks, id)
+	return nil
+}
+
+func (w *webhookRepositoryFake) Enqueue(_ context.Context, deliveries []internal.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		w.deliveries[delivery.ID] = delivery
+	}
+	return nil
+}
+
+func (w *webhookRepositoryFake) Claim(_ context.Context, now time.Time, leaseUntil time.Time, limit int) ([]internal.WebhookDelivery, error) {
+	var claimed []internal.WebhookDelivery
+	for _, delivery := range w.pending() {
+		if len(claimed) == limit || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		delivery.NextAttemptAt = leaseUntil
+		w.deliveries[delivery.ID] = delivery
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (w *webhookRepositoryFake) UpdateDelivery(_ context.Context, delivery internal.WebhookDelivery) error {
+	if _, ok := w.deliveries[delivery.ID]; !ok {
+		return errors.New("not found")
+	}
+	w.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (w *webhookRepositoryFake) ListDeliveries(_ context.Context, webhookID string, limit int) ([]internal.WebhookDelivery, error) {
+	var result []internal.WebhookDelivery
+	for _, delivery := range w.deliveries {
+		if delivery.WebhookID == webhookID && len(result) < limit {
+			result = append(result, delivery)
+		}
+	}
+	return result, nil
+}
+
+func (w *webhookRepositoryFake) DeleteDeliveriesBefore(_ context.Context, before time.Time) (int, error) {
+	deleted := 0
+	for id, delivery := range w.deliveries {
+		if delivery.Status != internal.DeliveryPending && delivery.CreatedAt.Before(before) {
+			delete(w.deliveries, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// pending returns the outbox in the order of the next attempts.
+func (w *webhookRepositoryFake) pending() []internal.WebhookDelivery {
+	var result []internal.WebhookDelivery
+	for _, delivery := range w.deliveries {
+		if delivery.Status == internal.DeliveryPending {
+			result = append(result, delivery)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].NextAttemptAt.Before(result[j].NextAttemptAt) })
+	return result
+}
+
+type auditServiceFake struct {
+	actions   []internal.AuditAction
+	snapshots []byte
+}
+
+func (a *auditServiceFake) Record(_ context.Context, action internal.AuditAction, _ string, _ string, before any, after any) error {
+	a.actions = append(a.actions, action)
+	encoded, _ := json.Marshal([]any{before, after})
+	a.snapshots = append(a.snapshots, encoded...)
+	return nil
+}
+
+func (a *auditServiceFake) List(context.Context, internal.AuditFilter) ([]internal.AuditEvent, error) {
+	return nil, nil
+}
@@ -2,20 +2,40 @@ package main
 
 import (
 	"context"
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/markbates/goth/gothic"
+	"github.com/pscheid92/dwarferl/internal"
+	"github.com/pscheid92/dwarferl/internal/accounts"
+	"github.com/pscheid92/dwarferl/internal/audit"
 	"github.com/pscheid92/dwarferl/internal/config"
 	"github.com/pscheid92/dwarferl/internal/hasher"
+	"github.com/pscheid92/dwarferl/internal/mailer"
+	"github.com/pscheid92/dwarferl/internal/privacy"
 	"github.com/pscheid92/dwarferl/internal/repository"
 	"github.com/pscheid92/dwarferl/internal/server"
+	"github.com/pscheid92/dwarferl/internal/sessionstore"
 	"github.com/pscheid92/dwarferl/internal/shortener"
+	"github.com/pscheid92/dwarferl/internal/twofactor"
 	"github.com/pscheid92/dwarferl/internal/users"
+	"github.com/pscheid92/dwarferl/internal/utm"
+	"github.com/pscheid92/dwarferl/internal/webhooks"
 	"log"
+	"net/http"
+	"os"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	conf, err := config.GatherConfig()
 	if err != nil {
 		log.Fatal(err)
@@ -27,17 +47,63 @@ func main() {
 	}
 	defer pool.Close()
 
-	sessionStore := cookie.NewStore([]byte(conf.SessionSecret))
-	gothic.Store = cookie.NewStore([]byte(conf.SessionSecret))
+	sessionsRepository := repository.NewDBSessionsRepository(pool)
+	sessionService := sessionstore.NewService(sessionsRepository)
+	sessionStore := sessionstore.NewStore(sessionsRepository, conf.SessionKeyPairs()...)
+
+	// gothic only keeps the short-lived OAuth state, which needs no server-side revocation;
+	// it must survive the cross-site redirect back from the provider, hence lax
+	gothicStore := cookie.NewStore(conf.SessionKeyPairs()...)
+	gothicStore.Options(sessions.Options{
+		Path:     "/",
+		Domain:   conf.CookieDomain,
+		MaxAge:   int(time.Hour.Seconds()),
+		Secure:   conf.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	gothic.Store = gothicStore
+
+	auditRepository := repository.NewDBAuditEventsRepository(pool)
+	auditService := audit.NewService(auditRepository)
+
+	webhooksRepository := repository.NewDBWebhooksRepository(pool)
+	webhookService := webhooks.NewService(webhooksRepository, auditService)
 
-	hasher := hasher.NewUrlHasher()
 	redirectsRepository := repository.NewDBRedirectsRepository(pool)
-	urlShortener := shortener.NewUrlShortenerService(hasher, redirectsRepository)
+	urlShortener := shortener.NewUrlShortenerService(newHasher(conf, pool), redirectsRepository, auditService, webhookService, conf.ShortDomains)
 
 	usersRepository := repository.NewDBUsersRepository(pool)
-	usersService := users.NewService(usersRepository)
+	identitiesRepository := repository.NewDBIdentitiesRepository(pool)
+	invitationsRepository := repository.NewDBInvitationsRepository(pool)
+	allowlist := users.Allowlist{Domains: conf.AllowedDomains, Emails: conf.AllowedEmails}
+	usersService := users.NewService(usersRepository, identitiesRepository, invitationsRepository, auditService, conf.AdminEmails, allowlist)
+
+	twoFactorRepository := repository.NewDBTwoFactorRepository(pool)
+	twoFactorService := twofactor.NewService(twoFactorRepository, auditService, conf.TwoFactorIssuer)
+
+	presetsRepository := repository.NewDBUTMPresetsRepository(pool)
+	presetsService := utm.NewService(presetsRepository)
+
+	privacyService := privacy.NewService(usersService, urlShortener, presetsService)
+
+	if conf.TrashRetention > 0 {
+		go purgeExpiredTrash(urlShortener, conf.TrashRetention)
+	}
+
+	go deleteExpiredSessions(sessionService)
+	go dispatchWebhooks(webhookService)
+	go purgeWebhookDeliveries(webhookService)
 
-	svr := server.New(conf, sessionStore, urlShortener, usersService)
+	var accountService *accounts.Service
+	if conf.LocalAccounts {
+		localAccountsRepository := repository.NewDBLocalAccountsRepository(pool)
+		accountTokensRepository := repository.NewDBAccountTokensRepository(pool)
+		accountService = accounts.NewService(usersService, localAccountsRepository, accountTokensRepository, sessionService, auditService, newMailer(conf), conf.LinkBase(), conf.EmailVerification)
+		go deleteExpiredTokens(accountService)
+	}
+
+	svr := server.New(conf, sessionStore, urlShortener, usersService, presetsService, auditService, sessionService, accountService, twoFactorService, usersService, privacyService, webhookService)
 	svr.Use(gin.Logger(), gin.Recovery())
 	svr.InitRoutes()
 
@@ -53,3 +119,107 @@ func openPGConnectionPool() (*pgxpool.Pool, error) {
 	}
 	return pgxpool.ConnectConfig(context.Background(), c)
 }
+
+// purgeExpiredTrash periodically removes links that stayed in the trash for longer than the retention.
+func purgeExpiredTrash(urlShortener shortener.UrlShortenerService, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		purged, err := urlShortener.PurgeExpiredTrash(context.Background(), retention)
+		if err != nil {
+			log.Printf("error purging trash: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("purged %d links from the trash", purged)
+		}
+	}
+}
+
+// deleteExpiredSessions periodically removes sessions that can no longer be used.
+func deleteExpiredSessions(sessionService *sessionstore.Service) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		deleted, err := sessionService.DeleteExpired(context.Background())
+		if err != nil {
+			log.Printf("error deleting expired sessions: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("deleted %d expired sessions", deleted)
+		}
+	}
+}
+
+// dispatchWebhooks sends the deliveries in the webhook outbox as they become due.
+func dispatchWebhooks(webhookService *webhooks.Service) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		if _, err := webhookService.DeliverDue(context.Background()); err != nil {
+			log.Printf("error delivering webhooks: %v", err)
+		}
+	}
+}
+
+// purgeWebhookDeliveries periodically removes old entries of the webhook delivery logs.
+func purgeWebhookDeliveries(webhookService *webhooks.Service) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		purged, err := webhookService.PurgeDeliveries(context.Background())
+		if err != nil {
+			log.Printf("error purging webhook deliveries: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("purged %d webhook deliveries", purged)
+		}
+	}
+}
+
+func newHasher(conf config.Configuration, pool *pgxpool.Pool) internal.Hasher {
+	alphabet := hasher.Base62Alphabet
+	if conf.CodeAlphabet == "unambiguous" {
+		alphabet = hasher.UnambiguousAlphabet
+	}
+
+	switch conf.CodeGenerator {
+	case "random":
+		return hasher.NewRandomHasher(alphabet, conf.CodeLength)
+	case "sequence":
+		return hasher.NewSequenceHasher(repository.NewDBShortCodeSequence(pool), alphabet, conf.CodeSalt, conf.CodeLength)
+	case "words":
+		return hasher.NewWordHasher(conf.CodeLength)
+	}
+	return hasher.NewUrlHasher()
+}
+
+func newMailer(conf config.Configuration) internal.Mailer {
+	if conf.MailTransport == "smtp" {
+		return mailer.NewSMTPMailer(conf.SMTPHost, conf.SMTPPort, conf.SMTPUsername, conf.SMTPPassword, conf.MailFrom)
+	}
+	return mailer.NewLogMailer()
+}
+
+// deleteExpiredTokens periodically removes verification and reset links that can no longer be used.
+func deleteExpiredTokens(accountService *accounts.Service) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		deleted, err := accountService.DeleteExpiredTokens(context.Background())
+		if err != nil {
+			log.Printf("error deleting expired account tokens: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("deleted %d expired account tokens", deleted)
+		}
+	}
+}